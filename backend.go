@@ -0,0 +1,18 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import "io"
+
+// backendWriter is implemented by the writers of alternative
+// backends.
+type backendWriter interface {
+	io.WriteCloser
+	Flush() error
+	EndBlock() error
+	// release frees the resources of a writer that will not be
+	// closed.
+	release()
+}
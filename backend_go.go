@@ -0,0 +1,27 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !liblzma || !cgo || xz_noencoder
+// +build !liblzma !cgo xz_noencoder
+
+package xz
+
+import "io"
+
+// Backend identifies the implementation used by Reader and Writer. It
+// is "liblzma" if the package has been built with the liblzma build
+// tag and cgo is enabled. Decoder-only builds using the xz_noencoder
+// tag always use the Go implementation.
+const Backend = "go"
+
+// newBackendReader returns nil; the Reader uses the Go implementation.
+func (c *ReaderConfig) newBackendReader(xz io.Reader) (io.Reader, error) {
+	return nil, nil
+}
+
+// newBackendWriter returns nil; the Writer uses the Go implementation.
+func (c *WriterConfig) newBackendWriter(xz io.Writer) (backendWriter,
+	error) {
+	return nil, nil
+}
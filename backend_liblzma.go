@@ -0,0 +1,391 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build liblzma && cgo && !xz_noencoder
+// +build liblzma,cgo,!xz_noencoder
+
+package xz
+
+/*
+#cgo LDFLAGS: -llzma
+#include <stdlib.h>
+#include <lzma.h>
+
+static lzma_stream *new_stream(void)
+{
+	// LZMA_STREAM_INIT sets all fields to zero
+	return calloc(1, sizeof(lzma_stream));
+}
+
+static lzma_ret init_encoder(lzma_stream *s, uint32_t dict_size,
+	uint32_t lc, uint32_t lp, uint32_t pb, lzma_match_finder mf,
+	uint32_t depth, lzma_check check, uint32_t threads, uint64_t block_size)
+{
+	lzma_options_lzma opt;
+	if (lzma_lzma_preset(&opt, LZMA_PRESET_DEFAULT)) {
+		return LZMA_OPTIONS_ERROR;
+	}
+	opt.dict_size = dict_size;
+	opt.lc = lc;
+	opt.lp = lp;
+	opt.pb = pb;
+	opt.mf = mf;
+	opt.depth = depth;
+	lzma_filter filters[2] = {
+		{ .id = LZMA_FILTER_LZMA2, .options = &opt },
+		{ .id = LZMA_VLI_UNKNOWN, .options = NULL },
+	};
+	if (threads <= 1) {
+		return lzma_stream_encoder(s, filters, check);
+	}
+	lzma_mt mt = {
+		.threads = threads,
+		.block_size = block_size,
+		.filters = filters,
+		.check = check,
+	};
+	return lzma_stream_encoder_mt(s, &mt);
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"io"
+	"runtime"
+	"unsafe"
+
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// Backend identifies the implementation used by Reader and Writer. It
+// is "liblzma" if the package has been built with the liblzma build
+// tag and cgo is enabled.
+const Backend = "liblzma"
+
+// lzmaBufLen is the size of the input and output buffers of a liblzma
+// stream.
+const lzmaBufLen = 1 << 16
+
+// lzmaStream wraps the liblzma stream. The stream structure and the
+// buffers are allocated in C memory, because liblzma keeps pointers to
+// them between calls.
+type lzmaStream struct {
+	s   *C.lzma_stream
+	in  *[lzmaBufLen]byte
+	out *[lzmaBufLen]byte
+}
+
+// newLzmaStream allocates the stream and its buffers. A finalizer
+// releases them if the stream hasn't been ended.
+func newLzmaStream() *lzmaStream {
+	z := &lzmaStream{
+		s:   C.new_stream(),
+		in:  (*[lzmaBufLen]byte)(C.malloc(lzmaBufLen)),
+		out: (*[lzmaBufLen]byte)(C.malloc(lzmaBufLen)),
+	}
+	runtime.SetFinalizer(z, (*lzmaStream).end)
+	return z
+}
+
+// end releases the resources of the stream.
+func (z *lzmaStream) end() {
+	if z.s == nil {
+		return
+	}
+	C.lzma_end(z.s)
+	C.free(unsafe.Pointer(z.s))
+	C.free(unsafe.Pointer(z.in))
+	C.free(unsafe.Pointer(z.out))
+	z.s, z.in, z.out = nil, nil, nil
+}
+
+// setInput copies p into the input buffer. It returns the number of
+// bytes copied.
+func (z *lzmaStream) setInput(p []byte) int {
+	n := copy(z.in[:], p)
+	z.s.next_in = (*C.uint8_t)(unsafe.Pointer(z.in))
+	z.s.avail_in = C.size_t(n)
+	return n
+}
+
+// code calls lzma_code with an empty output buffer of size n and
+// returns the output produced.
+func (z *lzmaStream) code(action C.lzma_action, n int) ([]byte,
+	C.lzma_ret) {
+	if n > lzmaBufLen {
+		n = lzmaBufLen
+	}
+	z.s.next_out = (*C.uint8_t)(unsafe.Pointer(z.out))
+	z.s.avail_out = C.size_t(n)
+	ret := C.lzma_code(z.s, action)
+	return z.out[:n-int(z.s.avail_out)], ret
+}
+
+// lzmaError converts liblzma return values into errors.
+func lzmaError(ret C.lzma_ret) error {
+	switch ret {
+	case C.LZMA_MEM_ERROR:
+		return errors.New("xz: liblzma: cannot allocate memory")
+	case C.LZMA_MEMLIMIT_ERROR:
+		return errors.New("xz: liblzma: memory usage limit reached")
+	case C.LZMA_FORMAT_ERROR:
+		return errHeaderMagic
+	case C.LZMA_OPTIONS_ERROR:
+		return errors.New("xz: liblzma: unsupported options")
+	case C.LZMA_DATA_ERROR:
+		return errors.New("xz: liblzma: compressed data is corrupt")
+	case C.LZMA_BUF_ERROR:
+		return io.ErrUnexpectedEOF
+	case C.LZMA_UNSUPPORTED_CHECK:
+		return errUnsupportedCheck
+	}
+	return errors.New("xz: liblzma: internal error")
+}
+
+// liblzmaReader decompresses xz streams using liblzma.
+type liblzmaReader struct {
+	ReaderConfig
+	z   *lzmaStream
+	xz  io.Reader
+	eof bool
+	err error
+	// total is the compressed input consumed when the stream ended
+	total int64
+}
+
+// newBackendReader creates a reader using liblzma. The dictionary
+// capacity limit is converted into a memory usage limit. Strict mode
+// and recovery mode are supported only by the Go implementation.
+func (c *ReaderConfig) newBackendReader(xz io.Reader) (io.Reader, error) {
+	if c.Strict || c.Recover || c.debug != nil {
+		return nil, nil
+	}
+	var flags C.uint32_t
+	if !c.SingleStream {
+		flags |= C.LZMA_CONCATENATED
+	}
+	var memlimit C.uint64_t = C.UINT64_MAX
+	if c.DictCapLimit > 0 {
+		// the LZMA2 decoder requires less than 1 MiB in
+		// addition to the dictionary
+		memlimit = C.uint64_t(c.DictCapLimit) + 1<<20
+	}
+	z := newLzmaStream()
+	if ret := C.lzma_stream_decoder(z.s, memlimit, flags); ret != C.LZMA_OK {
+		z.end()
+		return nil, lzmaError(ret)
+	}
+	return &liblzmaReader{ReaderConfig: *c, z: z, xz: xz}, nil
+}
+
+// Read reads decompressed data.
+func (r *liblzmaReader) Read(p []byte) (n int, err error) {
+	for n == 0 && len(p) > 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.z.s.avail_in == 0 && !r.eof {
+			k, err := r.xz.Read(r.z.in[:])
+			r.z.setInput(r.z.in[:k])
+			if err == io.EOF {
+				r.eof = true
+			} else if err != nil {
+				r.fail(err)
+				continue
+			}
+		}
+		var action C.lzma_action = C.LZMA_RUN
+		if r.eof {
+			action = C.LZMA_FINISH
+		}
+		out, ret := r.z.code(action, len(p))
+		n = copy(p, out)
+		switch ret {
+		case C.LZMA_OK:
+		case C.LZMA_STREAM_END:
+			r.fail(r.checkTrailingData())
+		case C.LZMA_MEMLIMIT_ERROR:
+			// liblzma reports only the memory usage, which
+			// is an upper bound for the dictionary capacity
+			r.fail(&lzma.DictCapLimitError{
+				DictCap: int64(C.lzma_memusage(r.z.s)),
+				Limit:   int64(r.DictCapLimit),
+			})
+		default:
+			r.fail(lzmaError(ret))
+		}
+	}
+	if n > 0 {
+		return n, nil
+	}
+	return 0, r.err
+}
+
+// inputCount returns the number of compressed bytes consumed by
+// liblzma.
+func (r *liblzmaReader) inputCount() int64 {
+	if r.z.s != nil {
+		return int64(r.z.s.total_in)
+	}
+	return r.total
+}
+
+// fail sets the error of the reader and releases the liblzma stream.
+// The error nil is replaced by io.EOF.
+func (r *liblzmaReader) fail(err error) {
+	if err == nil {
+		err = io.EOF
+	}
+	r.err = err
+	r.total = r.inputCount()
+	r.z.end()
+}
+
+// checkTrailingData returns errUnexpectedData if data follows a single
+// stream and trailing data must not be ignored.
+func (r *liblzmaReader) checkTrailingData() error {
+	if !r.SingleStream || r.IgnoreTrailingData {
+		return nil
+	}
+	if r.z.s.avail_in > 0 {
+		return errUnexpectedData
+	}
+	var p [1]byte
+	if _, err := io.ReadFull(r.xz, p[:]); err != io.EOF {
+		return errUnexpectedData
+	}
+	return nil
+}
+
+// liblzmaWriter compresses data into an xz stream using liblzma.
+type liblzmaWriter struct {
+	WriterConfig
+	z  *lzmaStream
+	xz io.Writer
+	mt bool
+	// manual is set if the writer ends the blocks itself
+	manual bool
+	blocks int
+	// n counts the uncompressed bytes of the current block
+	n int64
+}
+
+// lzmaChecks maps the check types to the liblzma values.
+var lzmaChecks = map[byte]C.lzma_check{
+	CRC32:  C.LZMA_CHECK_CRC32,
+	CRC64:  C.LZMA_CHECK_CRC64,
+	SHA256: C.LZMA_CHECK_SHA256,
+}
+
+// newBackendWriter creates a writer using liblzma. If Workers is larger
+// than one, the multi-threaded encoder of liblzma is used. It splits
+// blocks by itself unless a block list is given. Writers with a part
+// size are not supported by liblzma; the Go implementation is used for
+// them.
+func (c *WriterConfig) newBackendWriter(xz io.Writer) (backendWriter,
+	error) {
+	if c.PartSize > 0 || c.DecisionTrace != nil {
+		return nil, nil
+	}
+	w := &liblzmaWriter{
+		WriterConfig: *c,
+		z:            newLzmaStream(),
+		xz:           xz,
+		mt:           c.Workers > 1,
+	}
+	w.manual = !w.mt || len(c.BlockList) > 0
+	var mf C.lzma_match_finder = C.LZMA_MF_HC4
+	if c.Matcher == lzma.BinaryTree {
+		mf = C.LZMA_MF_BT4
+	}
+	ret := C.init_encoder(w.z.s, C.uint32_t(c.DictCap),
+		C.uint32_t(c.Properties.LC), C.uint32_t(c.Properties.LP),
+		C.uint32_t(c.Properties.PB), mf, C.uint32_t(c.Depth),
+		lzmaChecks[c.CheckSum],
+		C.uint32_t(c.Workers), C.uint64_t(c.BlockSize))
+	if ret != C.LZMA_OK {
+		w.z.end()
+		return nil, lzmaError(ret)
+	}
+	return w, nil
+}
+
+// code processes the input until it is consumed or, for actions other
+// than LZMA_RUN, until the action is completed.
+func (w *liblzmaWriter) code(action C.lzma_action) error {
+	for {
+		out, ret := w.z.code(action, lzmaBufLen)
+		if len(out) > 0 {
+			if _, err := w.xz.Write(out); err != nil {
+				return err
+			}
+		}
+		switch ret {
+		case C.LZMA_OK:
+		case C.LZMA_STREAM_END:
+			return nil
+		default:
+			return lzmaError(ret)
+		}
+		if action == C.LZMA_RUN && w.z.s.avail_in == 0 {
+			return nil
+		}
+	}
+}
+
+// Write compresses the data in p.
+func (w *liblzmaWriter) Write(p []byte) (n int, err error) {
+	for n < len(p) {
+		q := p[n:]
+		if w.manual {
+			if t := w.blockSize(w.blocks) - w.n; int64(len(q)) > t {
+				q = q[:t]
+			}
+		}
+		k := w.z.setInput(q)
+		if err = w.code(C.LZMA_RUN); err != nil {
+			return n, err
+		}
+		n += k
+		w.n += int64(k)
+		if w.manual && w.n == w.blockSize(w.blocks) {
+			if err = w.EndBlock(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Flush writes all pending data to the underlying writer. The
+// multi-threaded encoder doesn't support a sync flush, so the block is
+// ended like in the parallel mode of the Go implementation.
+func (w *liblzmaWriter) Flush() error {
+	if w.mt {
+		return w.EndBlock()
+	}
+	return w.code(C.LZMA_SYNC_FLUSH)
+}
+
+// EndBlock ends the current block unless it is empty.
+func (w *liblzmaWriter) EndBlock() error {
+	if w.n == 0 {
+		return nil
+	}
+	w.blocks++
+	w.n = 0
+	return w.code(C.LZMA_FULL_FLUSH)
+}
+
+// release frees the liblzma resources without finishing the stream.
+func (w *liblzmaWriter) release() {
+	w.z.end()
+}
+
+// Close finishes the stream and releases the liblzma resources.
+func (w *liblzmaWriter) Close() error {
+	defer w.z.end()
+	return w.code(C.LZMA_FINISH)
+}
@@ -49,26 +49,47 @@ func putUvarint(p []byte, x uint64) int {
 	return i + 1
 }
 
-// errOverflow indicates an overflow of the 64-bit unsigned integer.
-var errOverflowU64 = errors.New("xz: uvarint overflows 64-bit unsigned integer")
+// maxVLILen is the maximum length of a variable-length integer in the
+// xz format. The 9 bytes store at most 63 bits.
+const maxVLILen = 9
 
-// readUvarint reads a uvarint from the given byte reader.
+// Errors reported for invalid variable-length integers.
+var (
+	// ErrVLITooLong indicates a variable-length integer longer than
+	// 9 bytes, whose value would exceed the maximum 2^63-1.
+	ErrVLITooLong = errors.New(
+		"xz: variable-length integer longer than 9 bytes")
+	// ErrVLINonMinimal indicates a variable-length integer that
+	// isn't encoded with the minimal number of bytes.
+	ErrVLINonMinimal = errors.New(
+		"xz: variable-length integer not minimally encoded")
+)
+
+// readUvarint reads a variable-length integer from the given byte
+// reader. Integers with more than 9 bytes or with a final zero byte
+// are rejected as required by the xz specification.
 func readUvarint(r io.ByteReader) (x uint64, n int, err error) {
 	var s uint
 	i := 0
 	for {
 		b, err := r.ReadByte()
 		if err != nil {
+			if err == io.EOF && i > 0 {
+				err = io.ErrUnexpectedEOF
+			}
 			return x, i, err
 		}
 		i++
+		if i > maxVLILen {
+			return x, i, ErrVLITooLong
+		}
+		x |= uint64(b&0x7f) << s
 		if b < 0x80 {
-			if i > 10 || i == 10 && b > 1 {
-				return x, i, errOverflowU64
+			if b == 0 && i > 1 {
+				return x, i, ErrVLINonMinimal
 			}
-			return x | uint64(b)<<s, i, nil
+			return x, i, nil
 		}
-		x |= uint64(b&0x7f) << s
 		s += 7
 	}
 }
@@ -6,11 +6,12 @@ package xz
 
 import (
 	"bytes"
+	"io"
 	"testing"
 )
 
 func TestUvarint(t *testing.T) {
-	tests := []uint64{0, 0x80, 0x100, 0xffffffff, 0x100000000, 1<<64 - 1}
+	tests := []uint64{0, 0x80, 0x100, 0xffffffff, 0x100000000, 1<<63 - 1}
 	p := make([]byte, 10)
 	for _, u := range tests {
 		p = p[:10]
@@ -31,3 +32,26 @@ func TestUvarint(t *testing.T) {
 		}
 	}
 }
+
+func TestUvarintInvalid(t *testing.T) {
+	tests := []struct {
+		data []byte
+		err  error
+	}{
+		{[]byte{0x80, 0x00}, ErrVLINonMinimal},
+		{[]byte{0xff, 0x80, 0x00}, ErrVLINonMinimal},
+		{[]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+			0x01}, ErrVLITooLong},
+		{[]byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80,
+			0x80}, ErrVLITooLong},
+		{[]byte{0x80}, io.ErrUnexpectedEOF},
+		{[]byte{}, io.EOF},
+	}
+	for _, tc := range tests {
+		_, _, err := readUvarint(bytes.NewReader(tc.data))
+		if err != tc.err {
+			t.Errorf("readUvarint(% x) returned error %v; want %v",
+				tc.data, err, tc.err)
+		}
+	}
+}
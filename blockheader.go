@@ -0,0 +1,115 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// FilterInfo describes a filter of a block header.
+type FilterInfo struct {
+	// ID is the filter ID defined by the xz format.
+	ID uint64
+	// Name is the name of the filter, for instance LZMA2 or x86.
+	Name string
+	// Props contains the encoded properties of the filter.
+	Props []byte
+}
+
+// String describes the filter and its decoded properties.
+func (f FilterInfo) String() string {
+	switch {
+	case f.ID == lzmaFilterID && len(f.Props) == 1:
+		dc, err := lzma.DecodeDictCap(f.Props[0])
+		if err != nil {
+			break
+		}
+		return fmt.Sprintf("%s dict cap %d", f.Name, dc)
+	case f.ID == deltaFilterID && len(f.Props) == 1:
+		return fmt.Sprintf("%s distance %d", f.Name, int(f.Props[0])+1)
+	case len(f.Props) == 4:
+		return fmt.Sprintf("%s start offset %#x", f.Name,
+			uint32LE(f.Props))
+	case len(f.Props) == 0:
+		return f.Name
+	}
+	return fmt.Sprintf("%s props % x", f.Name, f.Props)
+}
+
+// BlockHeaderInfo describes the header of a block.
+type BlockHeaderInfo struct {
+	// Size is the size of the block header including the padding
+	// and the CRC-32.
+	Size int
+	// CompressedSize is the size of the compressed data of the
+	// block or -1 if the header doesn't store it.
+	CompressedSize int64
+	// UncompressedSize is the size of the uncompressed data of the
+	// block or -1 if the header doesn't store it.
+	UncompressedSize int64
+	// Filters lists the filter chain in the order of the header.
+	Filters []FilterInfo
+}
+
+// ReadBlockHeader reads the block header at the given offset of the xz
+// file. The offsets of the blocks are provided by ReadStreamInfo. The
+// filters are reported even if the package doesn't support them, so
+// that the function can be used to investigate files created by other
+// tools.
+func ReadBlockHeader(xz io.ReaderAt, offset int64) (*BlockHeaderInfo,
+	error) {
+
+	r := io.NewSectionReader(xz, offset, maxBlockHeaderLen)
+	h, n, err := readBlockHeader(r)
+	if err != nil {
+		if err == errIndexIndicator {
+			return nil, errorf(ErrBlockHeader, "xz: index "+
+				"indicator found at offset %d", offset)
+		}
+		return nil, err
+	}
+	bh := &BlockHeaderInfo{
+		Size:             n,
+		CompressedSize:   h.compressedSize,
+		UncompressedSize: h.uncompressedSize,
+		Filters:          make([]FilterInfo, 0, len(h.filters)),
+	}
+	for _, f := range h.filters {
+		fi, err := filterInfo(f)
+		if err != nil {
+			return nil, err
+		}
+		bh.Filters = append(bh.Filters, fi)
+	}
+	return bh, nil
+}
+
+// filterInfo returns the information for the filter. The properties
+// are taken from the encoded filter, which consists of the filter ID,
+// the size of the properties and the properties.
+func filterInfo(f filter) (fi FilterInfo, err error) {
+	data, err := f.MarshalBinary()
+	if err != nil {
+		return fi, err
+	}
+	r := bytes.NewReader(data)
+	if fi.ID, _, err = readUvarint(r); err != nil {
+		return fi, err
+	}
+	if _, _, err = readUvarint(r); err != nil {
+		return fi, err
+	}
+	fi.Props = data[len(data)-r.Len():]
+	if fi.ID == lzmaFilterID {
+		fi.Name = "LZMA2"
+	} else {
+		fi.Name = specFilterNames[fi.ID]
+	}
+	return fi, nil
+}
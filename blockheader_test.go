@@ -0,0 +1,93 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestReadBlockHeader(t *testing.T) {
+	tests := []struct {
+		file    string
+		filters []string
+		sizes   bool
+	}{
+		{"good-1-check-crc64.xz", []string{"LZMA2"}, false},
+		{"good-1-delta-lzma2.xz", []string{"delta", "LZMA2"}, false},
+		{"good-1-arm64-lzma2.xz", []string{"ARM64", "LZMA2"}, false},
+		{"good-1-block_header-sizes.xz", []string{"LZMA2"}, true},
+	}
+	for _, tc := range tests {
+		data, err := ioutil.ReadFile("testdata/" + tc.file)
+		if err != nil {
+			t.Fatalf("ReadFile error %s", err)
+		}
+		xz := bytes.NewReader(data)
+		streams, err := ReadStreamInfo(xz, int64(len(data)))
+		if err != nil {
+			t.Fatalf("%s: ReadStreamInfo error %s", tc.file, err)
+		}
+		b := streams[0].Blocks[0]
+		h, err := ReadBlockHeader(xz, b.Offset)
+		if err != nil {
+			t.Fatalf("%s: ReadBlockHeader error %s", tc.file, err)
+		}
+		if h.Size < 8 || h.Size%4 != 0 {
+			t.Fatalf("%s: header size %d", tc.file, h.Size)
+		}
+		if len(h.Filters) != len(tc.filters) {
+			t.Fatalf("%s: got %d filters; want %d", tc.file,
+				len(h.Filters), len(tc.filters))
+		}
+		for i, f := range h.Filters {
+			if f.Name != tc.filters[i] {
+				t.Fatalf("%s: filter %d is %s; want %s", tc.file,
+					i, f.Name, tc.filters[i])
+			}
+			if f.String() == "" {
+				t.Fatalf("%s: filter %d has no description",
+					tc.file, i)
+			}
+		}
+		if lf := h.Filters[len(h.Filters)-1]; lf.ID != 0x21 ||
+			len(lf.Props) != 1 {
+			t.Fatalf("%s: unexpected last filter %#v", tc.file, lf)
+		}
+		if tc.sizes && (h.CompressedSize < 0 ||
+			h.UncompressedSize < 0) {
+			t.Fatalf("%s: sizes %d and %d not stored", tc.file,
+				h.CompressedSize, h.UncompressedSize)
+		}
+		if h.UncompressedSize < 0 {
+			continue
+		}
+		if h.UncompressedSize != b.UncompressedSize {
+			t.Fatalf("%s: uncompressed size %d; want %d", tc.file,
+				h.UncompressedSize, b.UncompressedSize)
+		}
+		if n := int64(h.Size) + h.CompressedSize; h.CompressedSize >= 0 &&
+			n > b.UnpaddedSize {
+			t.Fatalf("%s: header and data size %d exceed "+
+				"unpadded size %d", tc.file, n, b.UnpaddedSize)
+		}
+	}
+
+	// the offset of the index must be rejected
+	data, err := ioutil.ReadFile("testdata/good-1-check-crc64.xz")
+	if err != nil {
+		t.Fatalf("ReadFile error %s", err)
+	}
+	xz := bytes.NewReader(data)
+	streams, err := ReadStreamInfo(xz, int64(len(data)))
+	if err != nil {
+		t.Fatalf("ReadStreamInfo error %s", err)
+	}
+	b := streams[0].Blocks[0]
+	if _, err = ReadBlockHeader(xz, b.Offset+b.TotalSize()); err == nil {
+		t.Fatalf("ReadBlockHeader at the index succeeded")
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ErrBudget is matched by the errors of type *BudgetError.
+var ErrBudget = errors.New("xz: decoding budget exceeded")
+
+// BudgetError reports that the reader exceeded the Timeout or the
+// MaxInputPerOutput budget of its configuration.
+type BudgetError struct {
+	// Timeout is set if the time limit has been exceeded; otherwise
+	// the input budget has been exhausted.
+	Timeout bool
+	// Input is the number of compressed bytes read.
+	Input int64
+	// Output is the number of uncompressed bytes returned.
+	Output int64
+}
+
+// Error returns the reason and the state of the reader.
+func (e *BudgetError) Error() string {
+	if e.Timeout {
+		return fmt.Sprintf("xz: decoding time limit exceeded after "+
+			"reading %d compressed bytes and returning %d "+
+			"uncompressed bytes", e.Input, e.Output)
+	}
+	return fmt.Sprintf("xz: input budget exhausted by reading %d "+
+		"compressed bytes and returning %d uncompressed bytes",
+		e.Input, e.Output)
+}
+
+// Is returns true for ErrBudget.
+func (e *BudgetError) Is(target error) bool {
+	return target == ErrBudget
+}
+
+// budgetAllowance is the number of compressed bytes the reader may
+// read in addition to the MaxInputPerOutput budget. It covers headers,
+// indexes and padding.
+const budgetAllowance = 1 << 20
+
+// budgetCheckInterval is the number of compressed bytes between checks
+// of the deadline. The lzma decoder reads single bytes and time.Now is
+// too expensive to be called for each of them.
+const budgetCheckInterval = 1 << 16
+
+// budgetReader enforces the budget of the reader configuration for the
+// compressed input.
+type budgetReader struct {
+	r io.Reader
+	// n counts the compressed bytes read
+	n int64
+	// limit is the maximum for n during the current Read call of the
+	// xz reader
+	limit int64
+	// out is the number of uncompressed bytes returned
+	out      int64
+	deadline time.Time
+	// check is the value of n at which the deadline is checked next
+	check int64
+	// err records the timeout, which is reported by all following
+	// reads, because callers like io.ReadFull may ignore an error
+	// returned together with data
+	err error
+}
+
+// newBudgetReader returns a budgetReader for the configuration or nil
+// if the configuration doesn't define a budget.
+func (c *ReaderConfig) newBudgetReader(xz io.Reader) *budgetReader {
+	if c.Timeout == 0 && c.MaxInputPerOutput == 0 {
+		return nil
+	}
+	b := &budgetReader{r: xz, limit: maxInt64}
+	if c.Timeout > 0 {
+		b.deadline = time.Now().Add(c.Timeout)
+	}
+	return b
+}
+
+// start prepares the budget for a Read call of the xz reader that may
+// return up to size bytes. It returns an error if the deadline has
+// passed.
+func (b *budgetReader) start(ratio int, out int64, size int) error {
+	b.out = out
+	if ratio > 0 {
+		// The limit is computed in floating point arithmetic to
+		// avoid integer overflows.
+		l := float64(ratio)*(float64(out)+float64(size)) +
+			budgetAllowance
+		if l < maxInt64 {
+			b.limit = int64(l)
+		}
+	}
+	return b.checkDeadline()
+}
+
+// checkDeadline returns a *BudgetError if the deadline has passed.
+func (b *budgetReader) checkDeadline() error {
+	if b.err == nil && !b.deadline.IsZero() &&
+		time.Now().After(b.deadline) {
+		b.err = &BudgetError{Timeout: true, Input: b.n, Output: b.out}
+	}
+	return b.err
+}
+
+// Read reads compressed data within the budget.
+func (b *budgetReader) Read(p []byte) (n int, err error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	if b.n >= b.limit {
+		return 0, &BudgetError{Input: b.n, Output: b.out}
+	}
+	if int64(len(p)) > b.limit-b.n {
+		p = p[:b.limit-b.n]
+	}
+	n, err = b.r.Read(p)
+	b.n += int64(n)
+	if b.n >= b.check {
+		b.check = b.n + budgetCheckInterval
+		if e := b.checkDeadline(); e != nil {
+			return n, e
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,64 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package xz
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+)
+
+func TestReaderInputBudget(t *testing.T) {
+	c := ReaderConfig{MaxInputPerOutput: 10}
+	r, err := c.NewReader(infinitePadding(t))
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	_, err = io.Copy(ioutil.Discard, r)
+	var e *BudgetError
+	if !errors.As(err, &e) || !errors.Is(err, ErrBudget) {
+		t.Fatalf("io.Copy error %v; want %v", err, ErrBudget)
+	}
+	if e.Timeout {
+		t.Fatalf("BudgetError reports timeout")
+	}
+	if e.Input > 10*(e.Output+32*1024)+budgetAllowance {
+		t.Fatalf("read %d compressed bytes for %d uncompressed "+
+			"bytes", e.Input, e.Output)
+	}
+
+	// incompressible data is within the budget of 2
+	data := make([]byte, 3<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	if _, err = w.Write(data); err != nil {
+		t.Fatalf("Write error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("w.Close error %s", err)
+	}
+	c = ReaderConfig{MaxInputPerOutput: 2}
+	r, err = c.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	out, err := readChunks(r, 100)
+	if err != io.EOF {
+		t.Fatalf("Read error %v; want %v", err, io.EOF)
+	}
+	if !bytes.Equal(out, data) {
+		t.Fatalf("decompressed data differs from original")
+	}
+}
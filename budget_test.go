@@ -0,0 +1,78 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+// zeroReader provides an infinite sequence of zero bytes, which is
+// valid stream padding.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (n int, err error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// infinitePadding returns a reader for fox.xz followed by unlimited
+// stream padding.
+func infinitePadding(t *testing.T) io.Reader {
+	return io.MultiReader(bytes.NewReader(foxXZ(t)), zeroReader{})
+}
+
+func TestReaderTimeout(t *testing.T) {
+	c := ReaderConfig{Timeout: 50 * time.Millisecond}
+	r, err := c.NewReader(infinitePadding(t))
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	start := time.Now()
+	_, err = io.Copy(ioutil.Discard, r)
+	var e *BudgetError
+	if !errors.As(err, &e) || !e.Timeout {
+		t.Fatalf("io.Copy error %v; want timeout", err)
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Fatalf("timeout reported after %s", d)
+	}
+
+	r, err = ReaderConfig{Timeout: 20 * time.Millisecond}.NewReader(
+		bytes.NewReader(foxXZ(t)))
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	time.Sleep(40 * time.Millisecond)
+	if _, err = r.Read(make([]byte, 10)); !errors.Is(err, ErrBudget) {
+		t.Fatalf("Read error %v; want %v", err, ErrBudget)
+	}
+}
+
+// foxXZ returns the content of fox.xz.
+func foxXZ(t *testing.T) []byte {
+	data, err := ioutil.ReadFile("fox.xz")
+	if err != nil {
+		t.Fatalf("ReadFile error %s", err)
+	}
+	return data
+}
+
+func TestReaderConfigBudgetVerify(t *testing.T) {
+	for _, c := range []ReaderConfig{
+		{Timeout: -time.Second},
+		{MaxInputPerOutput: -1},
+	} {
+		if err := c.Verify(); err == nil {
+			t.Errorf("Verify accepted %+v", c)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ulikunitz/xz"
+)
+
+// counter counts the bytes written to it.
+type counter struct {
+	w io.Writer
+	n int64
+}
+
+// Write writes p to the underlying writer and counts the bytes.
+func (c *counter) Write(p []byte) (n int, err error) {
+	n, err = c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// createArchive opens the archive file for writing. It returns the
+// function that must be called to close the file.
+func createArchive(name string) (w io.Writer, close func() error,
+	err error) {
+
+	if name == "-" {
+		return os.Stdout, func() error { return nil }, nil
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, f.Close, nil
+}
+
+// create writes a new archive containing the files and directory trees
+// given in paths.
+func create(paths []string, opts *options) (err error) {
+	if opts.dir != "" {
+		if err = os.Chdir(opts.dir); err != nil {
+			return err
+		}
+	}
+	f, closeFile, err := createArchive(opts.file)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := closeFile(); err == nil {
+			err = cerr
+		}
+	}()
+	bw := bufio.NewWriter(f)
+	cw := &counter{w: bw}
+	cfg := xz.WriterConfig{Workers: opts.workers()}
+	xw, err := cfg.NewWriter(cw)
+	if err != nil {
+		return err
+	}
+	uw := &counter{w: xw}
+	tw := tar.NewWriter(uw)
+
+	start := time.Now()
+	files := 0
+	log := opts.logWriter()
+	for _, p := range paths {
+		err = filepath.Walk(p, func(path string, fi os.FileInfo,
+			err error) error {
+			if err != nil {
+				return err
+			}
+			if opts.verbose > 0 {
+				fmt.Fprintln(log, path)
+			}
+			files++
+			return addFile(tw, path, fi)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err = tw.Close(); err != nil {
+		return err
+	}
+	if err = xw.Close(); err != nil {
+		return err
+	}
+	if err = bw.Flush(); err != nil {
+		return err
+	}
+	if opts.verbose > 0 {
+		printSummary(files, cw.n, uw.n, time.Since(start))
+	}
+	return nil
+}
+
+// addFile adds a single file to the archive. The contents of
+// directories are added by the caller.
+func addFile(tw *tar.Writer, path string, fi os.FileInfo) error {
+	var link string
+	if fi.Mode()&os.ModeSymlink != 0 {
+		var err error
+		if link, err = os.Readlink(path); err != nil {
+			return err
+		}
+	}
+	hdr, err := tar.FileInfoHeader(fi, link)
+	if err != nil {
+		return err
+	}
+	hdr.Name = filepath.ToSlash(path)
+	if fi.IsDir() {
+		hdr.Name += "/"
+	}
+	if err = tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err = io.Copy(tw, f); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build xz_noencoder
+// +build xz_noencoder
+
+package main
+
+import "errors"
+
+// create returns an error, because creating archives requires the
+// encoder excluded by the xz_noencoder tag.
+func create(paths []string, opts *options) error {
+	return errors.New(
+		"creating archives not supported; built with the " +
+			"xz_noencoder tag")
+}
@@ -0,0 +1,235 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ulikunitz/xz"
+)
+
+// openArchive opens the archive for reading.
+func openArchive(name string) (r io.Reader, close func() error,
+	err error) {
+
+	if name == "-" {
+		return os.Stdin, func() error { return nil }, nil
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, f.Close, nil
+}
+
+// countingReader counts the bytes read from the underlying reader.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+// Read reads from the underlying reader and counts the bytes.
+func (c *countingReader) Read(p []byte) (n int, err error) {
+	n, err = c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// readArchive calls fn for every entry of the archive.
+func readArchive(opts *options, fn func(hdr *tar.Header,
+	r io.Reader) error) (err error) {
+
+	f, closeFile, err := openArchive(opts.file)
+	if err != nil {
+		return err
+	}
+	defer closeFile()
+	cr := &countingReader{r: bufio.NewReader(f)}
+	xr, err := xz.NewReader(cr)
+	if err != nil {
+		return err
+	}
+	ur := &countingReader{r: xr}
+	tr := tar.NewReader(ur)
+	start := time.Now()
+	files := 0
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		files++
+		if err = fn(hdr, tr); err != nil {
+			return err
+		}
+	}
+	// read the rest of the xz stream to check it completely
+	if _, err = io.Copy(io.Discard, ur); err != nil {
+		return err
+	}
+	if opts.verbose > 0 {
+		printSummary(files, cr.n, ur.n, time.Since(start))
+	}
+	return nil
+}
+
+// list prints the names of the archive entries.
+func list(opts *options) error {
+	return readArchive(opts, func(hdr *tar.Header, r io.Reader) error {
+		if opts.verbose > 0 {
+			var link string
+			switch hdr.Typeflag {
+			case tar.TypeSymlink:
+				link = " -> " + hdr.Linkname
+			case tar.TypeLink:
+				link = " link to " + hdr.Linkname
+			}
+			fmt.Printf("%s %10d %s %s%s\n", hdr.FileInfo().Mode(),
+				hdr.Size, hdr.ModTime.Format("2006-01-02 15:04"),
+				hdr.Name, link)
+			return nil
+		}
+		fmt.Println(hdr.Name)
+		return nil
+	})
+}
+
+// safeName checks that the name of an archive entry stays inside the
+// target directory and converts it into a file path.
+func safeName(name string) (string, error) {
+	p := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(p) || filepath.VolumeName(p) != "" ||
+		p == ".." || strings.HasPrefix(p, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s: unsafe file name", name)
+	}
+	return p, nil
+}
+
+// errSymlinkPath indicates that a file would be written through a
+// symbolic link.
+var errSymlinkPath = errors.New("path contains a symbolic link")
+
+// checkParents verifies that no parent directory of the path is a
+// symbolic link.
+func checkParents(p string) error {
+	dir := filepath.Dir(p)
+	if dir == "." {
+		return nil
+	}
+	parts := strings.Split(dir, string(filepath.Separator))
+	q := ""
+	for _, part := range parts {
+		q = filepath.Join(q, part)
+		fi, err := os.Lstat(q)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%s: %s", p, errSymlinkPath)
+		}
+	}
+	return nil
+}
+
+// extract extracts the archive.
+func extract(opts *options) error {
+	if opts.dir != "" {
+		if err := os.Chdir(opts.dir); err != nil {
+			return err
+		}
+	}
+	type dirTime struct {
+		path  string
+		mtime time.Time
+	}
+	var dirs []dirTime
+	err := readArchive(opts, func(hdr *tar.Header, r io.Reader) error {
+		p, err := safeName(hdr.Name)
+		if err != nil {
+			return err
+		}
+		if opts.verbose > 0 {
+			fmt.Println(hdr.Name)
+		}
+		if err = checkParents(p); err != nil {
+			return err
+		}
+		if dir := filepath.Dir(p); dir != "." {
+			if err = os.MkdirAll(dir, 0777); err != nil {
+				return err
+			}
+		}
+		mode := hdr.FileInfo().Mode()
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err = os.Mkdir(p, 0700); err != nil &&
+				!os.IsExist(err) {
+				return err
+			}
+			if err = os.Chmod(p, mode.Perm()); err != nil {
+				return err
+			}
+			dirs = append(dirs, dirTime{p, hdr.ModTime})
+			return nil
+		case tar.TypeReg, tar.TypeRegA:
+			return extractFile(p, hdr, r)
+		case tar.TypeSymlink:
+			os.Remove(p)
+			return os.Symlink(hdr.Linkname, p)
+		case tar.TypeLink:
+			target, err := safeName(hdr.Linkname)
+			if err != nil {
+				return err
+			}
+			os.Remove(p)
+			return os.Link(target, p)
+		}
+		return fmt.Errorf("%s: unsupported file type %q", hdr.Name,
+			hdr.Typeflag)
+	})
+	if err != nil {
+		return err
+	}
+	// set directory times after their contents have been written
+	for i := len(dirs) - 1; i >= 0; i-- {
+		d := dirs[i]
+		if err = os.Chtimes(d.path, d.mtime, d.mtime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractFile writes a regular file.
+func extractFile(p string, hdr *tar.Header, r io.Reader) (err error) {
+	os.Remove(p)
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL,
+		hdr.FileInfo().Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(p, hdr.ModTime, hdr.ModTime)
+}
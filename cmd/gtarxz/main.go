@@ -0,0 +1,148 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Command gtarxz creates, extracts and lists tar archives compressed
+// with xz. The xz blocks are compressed in parallel.
+//
+// Use gtarxz -h to get information about supported flags.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/ulikunitz/xz/internal/gflag"
+	"github.com/ulikunitz/xz/internal/term"
+	"github.com/ulikunitz/xz/internal/xlog"
+)
+
+const usageStr = `Usage: gtarxz -c|-x|-t [OPTION]... [FILE]...
+Create, extract or list tar archives compressed in the .xz format.
+
+  -c, --create      create a new archive containing FILEs
+  -x, --extract     extract the archive
+  -t, --list        list the contents of the archive
+  -f, --file=ARCHIVE
+                    use the archive file ARCHIVE; - uses standard input
+                    or output, which is the default
+  -C, --directory=DIR
+                    change to DIR before creating or extracting
+  -T, --threads=NUM compress xz blocks using NUM go routines; 0 uses
+                    the number of CPUs, which is the default
+  -v, --verbose     list the files processed and print a summary
+  -h, --help        give this help
+
+Extraction refuses absolute file names, names containing .. and
+writing through symbolic links.
+
+Report bugs using <https://github.com/ulikunitz/xz/issues>.
+`
+
+type options struct {
+	help    bool
+	create  bool
+	extract bool
+	list    bool
+	file    string
+	dir     string
+	threads int
+	verbose int
+}
+
+func (o *options) Init() {
+	gflag.BoolVarP(&o.help, "help", "h", false, "")
+	gflag.BoolVarP(&o.create, "create", "c", false, "")
+	gflag.BoolVarP(&o.extract, "extract", "x", false, "")
+	gflag.BoolVarP(&o.list, "list", "t", false, "")
+	gflag.StringVarP(&o.file, "file", "f", "-", "")
+	gflag.StringVarP(&o.dir, "directory", "C", "", "")
+	gflag.IntVarP(&o.threads, "threads", "T", 0, "")
+	gflag.CounterVarP(&o.verbose, "verbose", "v", 0, "")
+}
+
+// workers returns the number of go routines compressing xz blocks.
+func (o *options) workers() int {
+	if o.threads == 0 {
+		return runtime.NumCPU()
+	}
+	return o.threads
+}
+
+// logWriter returns the writer for the verbose output. If the archive
+// is written to standard output, the list goes to standard error.
+func (o *options) logWriter() io.Writer {
+	if o.create && o.file == "-" {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+func main() {
+	cmdName := filepath.Base(os.Args[0])
+	xlog.SetPrefix(fmt.Sprintf("%s: ", cmdName))
+	// the debug output of the xz package is not shown
+	xlog.SetFlags(xlog.Lnodebug)
+
+	gflag.CommandLine = gflag.NewFlagSet(cmdName, gflag.ExitOnError)
+	gflag.Usage = func() { fmt.Fprint(os.Stderr, usageStr); os.Exit(1) }
+	opts := options{}
+	opts.Init()
+	gflag.Parse()
+
+	if opts.help {
+		fmt.Fprint(os.Stdout, usageStr)
+		os.Exit(0)
+	}
+	n := 0
+	for _, b := range []bool{opts.create, opts.extract, opts.list} {
+		if b {
+			n++
+		}
+	}
+	if n != 1 {
+		xlog.Fatal("exactly one of -c, -x or -t must be given")
+	}
+	if opts.threads < 0 {
+		xlog.Fatal("number of threads must not be negative")
+	}
+
+	var err error
+	switch {
+	case opts.create:
+		if gflag.NArg() == 0 {
+			xlog.Fatal("refusing to create an empty archive")
+		}
+		if opts.file == "-" && term.IsTerminal(os.Stdout.Fd()) {
+			xlog.Fatal("compressed data will not be written to " +
+				"a terminal")
+		}
+		err = create(gflag.Args(), &opts)
+	case opts.extract:
+		err = extract(&opts)
+	case opts.list:
+		err = list(&opts)
+	}
+	if err != nil {
+		xlog.Fatal(err)
+	}
+}
+
+// printSummary prints the number of files and the compression ratio to
+// standard error.
+func printSummary(files int, compressed, uncompressed int64,
+	d time.Duration) {
+
+	ratio := "---"
+	if uncompressed > 0 {
+		ratio = fmt.Sprintf("%.3f",
+			float64(compressed)/float64(uncompressed))
+	}
+	fmt.Fprintf(os.Stderr, "%d files, %d bytes tar, %d bytes xz, "+
+		"ratio %s, %.1f s\n", files, uncompressed, compressed, ratio,
+		d.Seconds())
+}
@@ -0,0 +1,168 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ulikunitz/xz"
+)
+
+// benchRange is the range of presets tested by --benchmark.
+type benchRange struct {
+	first, last int
+}
+
+// benchValue is the flag value for --benchmark. The argument is
+// optional; without it the preset selected by -0 ... -9 is used. The
+// range {-1, -1} indicates that the flag hasn't been given, the range
+// {-2, -2} that the flag has been given without argument.
+type benchValue struct {
+	p *benchRange
+}
+
+// Get returns the preset range.
+func (v benchValue) Get() interface{} { return *v.p }
+
+var errBenchRange = errors.New("--benchmark: invalid preset range")
+
+// parsePreset parses a single preset level.
+func parsePreset(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n > 9 {
+		return 0, errBenchRange
+	}
+	return n, nil
+}
+
+// Set parses the preset range in the form N or N-M.
+func (v benchValue) Set(s string) error {
+	var r benchRange
+	var err error
+	i := strings.IndexByte(s, '-')
+	if i < 0 {
+		if r.first, err = parsePreset(s); err != nil {
+			return err
+		}
+		r.last = r.first
+	} else {
+		if r.first, err = parsePreset(s[:i]); err != nil {
+			return err
+		}
+		if r.last, err = parsePreset(s[i+1:]); err != nil {
+			return err
+		}
+		if r.first > r.last {
+			return errBenchRange
+		}
+	}
+	*v.p = r
+	return nil
+}
+
+// Update selects the preset given by the preset flags.
+func (v benchValue) Update() { *v.p = benchRange{-2, -2} }
+
+// String returns the preset range as string.
+func (v benchValue) String() string {
+	return fmt.Sprintf("%d-%d", v.p.first, v.p.last)
+}
+
+// readBenchFile reads the complete file into memory.
+func readBenchFile(path string) ([]byte, error) {
+	if path == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	return ioutil.ReadFile(path)
+}
+
+// rateString returns the speed for n bytes processed in duration d.
+func rateString(n int64, d time.Duration) string {
+	s := d.Seconds()
+	if s <= 0 {
+		return "--- MiB/s"
+	}
+	return fmt.Sprintf("%.1f MiB/s", float64(n)/s/(1<<20))
+}
+
+// benchPreset compresses and decompresses the data using the preset
+// and prints the results.
+func benchPreset(name string, data []byte, preset int, opts *options) error {
+	o := *opts
+	o.preset = preset
+	cfg := xzWriterConfig(&o)
+
+	var buf bytes.Buffer
+	start := time.Now()
+	w, err := newXZCompressor(&buf, cfg)
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(data); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	cd := time.Since(start)
+	compressed := int64(buf.Len())
+
+	start = time.Now()
+	r, err := xz.NewReader(&buf)
+	if err != nil {
+		return err
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	if _, err = io.Copy(out, r); err != nil {
+		return err
+	}
+	dd := time.Since(start)
+	if !bytes.Equal(out.Bytes(), data) {
+		return fmt.Errorf("%s: preset %d: decompressed data differs",
+			name, preset)
+	}
+
+	n := int64(len(data))
+	fmt.Printf("-%d %s: %d -> %d (%s), compression %s, "+
+		"decompression %s\n", preset, name, n, compressed,
+		ratioString(compressed, n), rateString(n, cd),
+		rateString(n, dd))
+	return nil
+}
+
+// benchmark compresses each file with all presets of the range given by
+// --benchmark without writing any output. The files are read into
+// memory so that the speed isn't influenced by file system access.
+func benchmark(paths []string, opts *options) {
+	r := opts.benchmark
+	if r.first < 0 {
+		r = benchRange{opts.preset, opts.preset}
+	}
+	for _, path := range paths {
+		data, err := readBenchFile(path)
+		if err != nil {
+			printErr(err)
+			continue
+		}
+		name := path
+		if path == "-" {
+			name = "(stdin)"
+		}
+		for p := r.first; p <= r.last; p++ {
+			if err = benchPreset(name, data, p, opts); err != nil {
+				printErr(err)
+				break
+			}
+		}
+	}
+}
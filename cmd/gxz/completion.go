@@ -0,0 +1,340 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ulikunitz/xz/internal/gflag"
+)
+
+// usageColumn is the column in which the option descriptions of the
+// usage text start.
+const usageColumn = 20
+
+// usageEntry describes a single option of the usage text.
+type usageEntry struct {
+	// flags as given in the usage text, e.g. "-c, --stdout"
+	flags string
+	desc  string
+}
+
+// usageText contains the parts of the usage text. It is the source of
+// the descriptions used for the man page and the completions.
+type usageText struct {
+	synopsis    string
+	description []string
+	options     []usageEntry
+	notes       []string
+	bugs        string
+}
+
+// parseUsage splits the usage text into its parts. The first paragraph
+// contains synopsis and description, the second paragraph the options.
+// Lines of the options paragraph starting with "  -" start a new
+// option; all other lines continue the description of the option.
+func parseUsage(s string) usageText {
+	var u usageText
+	paras := strings.Split(strings.TrimSpace(s), "\n\n")
+	head := strings.SplitN(paras[0], "\n", 2)
+	u.synopsis = strings.TrimPrefix(head[0], "Usage: ")
+	if len(head) > 1 {
+		u.description = append(u.description, joinFields(head[1]))
+	}
+	if len(paras) > 1 {
+		u.options = parseOptions(paras[1])
+	}
+	for _, p := range paras[2:] {
+		p = joinFields(p)
+		if strings.HasPrefix(p, "Report bugs") {
+			u.bugs = p
+			continue
+		}
+		u.notes = append(u.notes, p)
+	}
+	return u
+}
+
+// joinFields replaces all white space sequences by a single space.
+func joinFields(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// parseOptions parses the option lines of the usage text.
+func parseOptions(s string) []usageEntry {
+	var entries []usageEntry
+	var desc []string
+	flush := func() {
+		if len(entries) > 0 {
+			e := &entries[len(entries)-1]
+			e.desc = joinFields(strings.Join(desc, " "))
+		}
+		desc = desc[:0]
+	}
+	sc := bufio.NewScanner(strings.NewReader(s))
+	for sc.Scan() {
+		line := sc.Text()
+		if !strings.HasPrefix(line, "  -") {
+			desc = append(desc, line)
+			continue
+		}
+		flush()
+		flags := line
+		if len(line) > usageColumn && line[usageColumn-1] == ' ' {
+			flags = line[:usageColumn]
+			desc = append(desc, line[usageColumn:])
+		}
+		entries = append(entries,
+			usageEntry{flags: strings.TrimSpace(flags)})
+	}
+	flush()
+	return entries
+}
+
+// optionNames returns the option names of the flags column of a usage
+// entry. The preset range "-0 ... -9" returns all preset flags.
+func optionNames(flags string) []string {
+	var a, b int
+	if n, _ := fmt.Sscanf(flags, "-%d ... -%d", &a, &b); n == 2 {
+		names := make([]string, 0, b-a+1)
+		for i := a; i <= b; i++ {
+			names = append(names, fmt.Sprintf("-%d", i))
+		}
+		return names
+	}
+	var names []string
+	for _, f := range strings.Split(flags, ",") {
+		f = strings.TrimSpace(f)
+		if i := strings.IndexAny(f, "=[< "); i >= 0 {
+			f = f[:i]
+		}
+		names = append(names, f)
+	}
+	return names
+}
+
+// flagDescriptions maps the option names to the descriptions of the
+// usage text.
+func flagDescriptions(u *usageText) map[string]string {
+	m := make(map[string]string)
+	for _, e := range u.options {
+		for _, name := range optionNames(e.flags) {
+			m[name] = e.desc
+		}
+	}
+	return m
+}
+
+// completionFlag provides the information about a flag required for
+// the completion scripts.
+type completionFlag struct {
+	long   string
+	shorts []string
+	hasArg bool
+	values []string
+	desc   string
+}
+
+// completionValues lists the supported arguments of flags.
+var completionValues = map[string][]string{
+	"format":     {"auto", "xz", "lzma", "alone", "raw"},
+	"completion": {"bash", "zsh", "fish"},
+}
+
+// completionFlags returns the flags defined for the command line. The
+// short description is the description of the usage text up to the
+// first semicolon.
+func completionFlags() []completionFlag {
+	u := parseUsage(usageStr)
+	descs := flagDescriptions(&u)
+	var flags []completionFlag
+	gflag.VisitAll(func(f *gflag.Flag) {
+		cf := completionFlag{
+			long:   f.Name,
+			hasArg: f.HasArg == gflag.RequiredArg,
+			values: completionValues[f.Name],
+		}
+		for _, r := range f.Shorthands {
+			cf.shorts = append(cf.shorts, string(r))
+		}
+		if f.Name != "" {
+			cf.desc = descs["--"+f.Name]
+		} else {
+			cf.desc = descs["-"+cf.shorts[0]]
+		}
+		if i := strings.IndexByte(cf.desc, ';'); i >= 0 {
+			cf.desc = cf.desc[:i]
+		}
+		flags = append(flags, cf)
+	})
+	return flags
+}
+
+// writeBashCompletion writes the completion script for bash.
+func writeBashCompletion(w io.Writer, flags []completionFlag) {
+	var words []string
+	fmt.Fprint(w, "# bash completion for gxz\n\n")
+	fmt.Fprint(w, "_gxz()\n{\n")
+	fmt.Fprint(w, "\tlocal cur=${COMP_WORDS[COMP_CWORD]}\n")
+	fmt.Fprint(w, "\tlocal prev=${COMP_WORDS[COMP_CWORD-1]}\n")
+	fmt.Fprint(w, "\tcase $prev in\n")
+	for _, f := range flags {
+		if f.long != "" {
+			words = append(words, "--"+f.long)
+		}
+		var patterns []string
+		for _, s := range f.shorts {
+			words = append(words, "-"+s)
+			patterns = append(patterns, "-"+s)
+		}
+		if f.values == nil {
+			continue
+		}
+		patterns = append(patterns, "--"+f.long)
+		fmt.Fprintf(w, "\t%s)\n", strings.Join(patterns, "|"))
+		fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n",
+			strings.Join(f.values, " "))
+		fmt.Fprint(w, "\t\treturn;;\n")
+	}
+	fmt.Fprint(w, "\tesac\n")
+	fmt.Fprint(w, "\tcase $cur in\n\t-*)\n")
+	fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n",
+		strings.Join(words, " "))
+	fmt.Fprint(w, "\t\treturn;;\n\tesac\n")
+	fmt.Fprint(w, "\tCOMPREPLY=($(compgen -f -- \"$cur\"))\n}\n\n")
+	fmt.Fprint(w, "complete -o filenames -F _gxz gxz\n")
+}
+
+// zshEscape escapes the characters having a special meaning in the
+// option specifications of the zsh function _arguments.
+var zshEscape = strings.NewReplacer(`'`, `'\''`, `[`, `\[`, `]`, `\]`,
+	`:`, `\:`)
+
+// writeZshCompletion writes the completion script for zsh.
+func writeZshCompletion(w io.Writer, flags []completionFlag) {
+	fmt.Fprint(w, "#compdef gxz\n\n_arguments -s \\\n")
+	for _, f := range flags {
+		desc := zshEscape.Replace(f.desc)
+		action := ""
+		if f.hasArg {
+			action = ":arg:"
+			if f.values != nil {
+				action = fmt.Sprintf(":arg:(%s)",
+					strings.Join(f.values, " "))
+			}
+		}
+		for _, s := range f.shorts {
+			spec := "*-" + s
+			if f.hasArg {
+				spec = "-" + s + "+"
+			}
+			fmt.Fprintf(w, "\t'%s[%s]%s' \\\n", spec, desc, action)
+		}
+		if f.long == "" {
+			continue
+		}
+		spec := "*--" + f.long
+		if f.hasArg {
+			spec = "--" + f.long + "="
+		}
+		fmt.Fprintf(w, "\t'%s[%s]%s' \\\n", spec, desc, action)
+	}
+	fmt.Fprint(w, "\t'*:file:_files'\n")
+}
+
+// fishEscape escapes the strings put into single quotes for fish.
+var fishEscape = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+// writeFishCompletion writes the completion script for fish.
+func writeFishCompletion(w io.Writer, flags []completionFlag) {
+	fmt.Fprint(w, "# fish completion for gxz\n\n")
+	for _, f := range flags {
+		fmt.Fprint(w, "complete -c gxz")
+		for _, s := range f.shorts {
+			fmt.Fprintf(w, " -s %s", s)
+		}
+		if f.long != "" {
+			fmt.Fprintf(w, " -l %s", f.long)
+		}
+		if f.hasArg {
+			fmt.Fprint(w, " -r")
+		}
+		if f.values != nil {
+			fmt.Fprintf(w, " -x -a '%s'", strings.Join(f.values, " "))
+		}
+		if f.desc != "" {
+			fmt.Fprintf(w, " -d '%s'", fishEscape.Replace(f.desc))
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// writeCompletion writes the completion script for the given shell.
+func writeCompletion(w io.Writer, shell string) error {
+	flags := completionFlags()
+	switch shell {
+	case "bash":
+		writeBashCompletion(w, flags)
+	case "zsh":
+		writeZshCompletion(w, flags)
+	case "fish":
+		writeFishCompletion(w, flags)
+	default:
+		return fmt.Errorf("completion for shell %q not supported",
+			shell)
+	}
+	return nil
+}
+
+// manEscape escapes the text for the roff input of the man page.
+func manEscape(s string) string {
+	s = strings.Replace(s, `\`, `\e`, -1)
+	s = strings.Replace(s, "-", `\-`, -1)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+	return s
+}
+
+// writeMan writes the man page in roff format. All text is taken from
+// the usage text.
+func writeMan(w io.Writer) {
+	u := parseUsage(usageStr)
+	fmt.Fprintf(w, ".TH GXZ 1 \"\" \"gxz %s\" \"User Commands\"\n",
+		manEscape(version))
+	fmt.Fprint(w, ".SH NAME\n")
+	fmt.Fprint(w, "gxz \\- compress or decompress .xz and .lzma files\n")
+	fmt.Fprint(w, ".SH SYNOPSIS\n")
+	fmt.Fprintf(w, ".B gxz\n%s\n",
+		manEscape(strings.TrimPrefix(u.synopsis, "gxz ")))
+	fmt.Fprint(w, ".SH DESCRIPTION\n")
+	for i, p := range u.description {
+		if i > 0 {
+			fmt.Fprint(w, ".PP\n")
+		}
+		fmt.Fprintf(w, "%s\n", manEscape(p))
+	}
+	fmt.Fprint(w, ".SH OPTIONS\n")
+	for _, e := range u.options {
+		fmt.Fprintf(w, ".TP\n.B %s\n%s\n", manEscape(e.flags),
+			manEscape(e.desc))
+	}
+	if len(u.notes) > 0 {
+		fmt.Fprint(w, ".SH NOTES\n")
+		for i, p := range u.notes {
+			if i > 0 {
+				fmt.Fprint(w, ".PP\n")
+			}
+			fmt.Fprintf(w, "%s\n", manEscape(p))
+		}
+	}
+	if u.bugs != "" {
+		fmt.Fprintf(w, ".SH REPORTING BUGS\n%s\n", manEscape(u.bugs))
+	}
+	fmt.Fprint(w, ".SH SEE ALSO\n.BR xz (1)\n")
+}
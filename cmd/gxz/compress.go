@@ -0,0 +1,36 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package main
+
+import (
+	"io"
+
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// The functions of this file are the only users of the encoder, so
+// that gxz can be built with the xz_noencoder tag for decompression.
+
+// newXZCompressor creates a writer for the xz format.
+func newXZCompressor(w io.Writer, cfg xz.WriterConfig) (io.WriteCloser,
+	error) {
+	return cfg.NewWriter(w)
+}
+
+// newRawCompressor creates a writer for raw LZMA2 streams.
+func newRawCompressor(w io.Writer, cfg xz.WriterConfig) (io.WriteCloser,
+	error) {
+	return cfg.NewRawWriter(w)
+}
+
+// newLZMACompressor creates a writer for the lzma format.
+func newLZMACompressor(w io.Writer, cfg lzma.WriterConfig) (io.WriteCloser,
+	error) {
+	return cfg.NewWriter(w)
+}
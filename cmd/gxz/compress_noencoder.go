@@ -0,0 +1,40 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build xz_noencoder
+// +build xz_noencoder
+
+package main
+
+import (
+	"errors"
+	"io"
+
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// errNoEncoder is returned for compression if gxz has been built with
+// the xz_noencoder tag. Decompression, --list and --test are still
+// supported.
+var errNoEncoder = errors.New(
+	"compression not supported; built with the xz_noencoder tag")
+
+// newXZCompressor returns errNoEncoder.
+func newXZCompressor(w io.Writer, cfg xz.WriterConfig) (io.WriteCloser,
+	error) {
+	return nil, errNoEncoder
+}
+
+// newRawCompressor returns errNoEncoder.
+func newRawCompressor(w io.Writer, cfg xz.WriterConfig) (io.WriteCloser,
+	error) {
+	return nil, errNoEncoder
+}
+
+// newLZMACompressor returns errNoEncoder.
+func newLZMACompressor(w io.Writer, cfg lzma.WriterConfig) (io.WriteCloser,
+	error) {
+	return nil, errNoEncoder
+}
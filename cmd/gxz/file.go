@@ -9,35 +9,58 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/ulikunitz/xz"
-	"github.com/ulikunitz/xz/internal/xlog"
 	"github.com/ulikunitz/xz/lzma"
 )
 
-// signalHandler establishes the signal handler for SIGTERM(1) and
-// handles it in its own go routine. The returned quit channel must be
-// closed to terminate the signal handler go routine.
-func signalHandler(w *writer) chan<- struct{} {
-	quit := make(chan struct{})
+// tmpFiles registers the writers whose temporary files must be removed
+// if the program is interrupted.
+var tmpFiles = struct {
+	sync.Mutex
+	m map[*writer]struct{}
+}{m: make(map[*writer]struct{})}
+
+// registerTmpFile registers the temporary file of the writer for
+// removal by the signal handler.
+func registerTmpFile(w *writer) {
+	tmpFiles.Lock()
+	tmpFiles.m[w] = struct{}{}
+	tmpFiles.Unlock()
+}
+
+// unregisterTmpFile removes the writer from the temporary file
+// registry.
+func unregisterTmpFile(w *writer) {
+	tmpFiles.Lock()
+	delete(tmpFiles.m, w)
+	tmpFiles.Unlock()
+}
+
+// signalHandler establishes the signal handler for SIGINT and SIGPIPE
+// and handles it in its own go routine. The handler removes all
+// registered temporary files and exits the program.
+func signalHandler() {
 	sigch := make(chan os.Signal, 1)
 	signal.Notify(sigch, os.Interrupt, syscall.SIGPIPE)
 	go func() {
-		select {
-		case <-quit:
-			signal.Stop(sigch)
-			return
-		case <-sigch:
+		<-sigch
+		// The lock is never released to prevent the
+		// registration of new temporary files.
+		tmpFiles.Lock()
+		for w := range tmpFiles.m {
 			w.removeTmpFile()
-			os.Exit(7)
 		}
+		os.Exit(7)
 	}()
-	return quit
 }
 
 // format defines the newCompressor and newDecompressor functions for a
@@ -50,26 +73,20 @@ type format struct {
 	validHeader func(br *bufio.Reader) bool
 }
 
-// dictCapExps maps preset values to exponent for dictionary capacity
-// sizes.
-var lzmaDictCapExps = []uint{18, 20, 21, 22, 22, 23, 23, 24, 25, 26}
-
 // formats contains the formats supported by gxz.
 var formats = map[string]*format{
 	"lzma": &format{
 		newCompressor: func(w io.Writer, opts *options,
 		) (c io.WriteCloser, err error) {
-			lc := lzma.WriterConfig{
-				Properties: &lzma.Properties{LC: 3, LP: 0,
-					PB: 2},
-				DictCap: 1 << lzmaDictCapExps[opts.preset],
-			}
-			return lc.NewWriter(w)
+			return newLZMACompressor(w, lzmaWriterConfig(opts))
 		},
 		newDecompressor: func(r io.Reader, opts *options,
 		) (d io.Reader, err error) {
+			// like xz data after the stream is rejected
 			lc := lzma.ReaderConfig{
-				DictCap: 1 << lzmaDictCapExps[opts.preset],
+				DictCap:            decoderDictCap(opts),
+				DictCapLimit:       decoderDictCapLimit(opts),
+				RejectTrailingData: true,
 			}
 			return lc.NewReader(r)
 		},
@@ -84,16 +101,11 @@ var formats = map[string]*format{
 	"xz": &format{
 		newCompressor: func(w io.Writer, opts *options,
 		) (c io.WriteCloser, err error) {
-			cfg := xz.WriterConfig{
-				DictCap: 1 << lzmaDictCapExps[opts.preset],
-			}
-			return cfg.NewWriter(w)
+			return newXZCompressor(w, xzWriterConfig(opts))
 		},
 		newDecompressor: func(r io.Reader, opts *options,
 		) (d io.Reader, err error) {
-			cfg := xz.ReaderConfig{
-				DictCap: 1 << lzmaDictCapExps[opts.preset],
-			}
+			cfg := xzReaderConfig(opts)
 			return cfg.NewReader(r)
 		},
 		validHeader: func(br *bufio.Reader) bool {
@@ -104,12 +116,47 @@ var formats = map[string]*format{
 			return xz.ValidHeader(h)
 		},
 	},
+	"raw": &format{
+		newCompressor: func(w io.Writer, opts *options,
+		) (c io.WriteCloser, err error) {
+			return newRawCompressor(w, xzWriterConfig(opts))
+		},
+		newDecompressor: func(r io.Reader, opts *options,
+		) (d io.Reader, err error) {
+			cfg := xz.ReaderConfig{
+				DictCap:      decoderDictCap(opts),
+				DictCapLimit: xzDictCapLimit(opts),
+				Logger:       debugLogger{},
+			}
+			return cfg.NewRawReader(r)
+		},
+		// raw streams have no header
+		validHeader: func(br *bufio.Reader) bool { return true },
+	},
+}
+
+// xzReaderConfig returns the reader configuration for the xz format.
+func xzReaderConfig(opts *options) xz.ReaderConfig {
+	return xz.ReaderConfig{
+		DictCap:            decoderDictCap(opts),
+		DictCapLimit:       xzDictCapLimit(opts),
+		SingleStream:       opts.single,
+		IgnoreTrailingData: opts.single,
+		Logger:             debugLogger{},
+	}
 }
 
 var errBase = errors.New("name has no base part")
 
+var errUnknownSuffix = errors.New("filename has an unknown suffix, skipping")
+
 // targetName finds the correct target name taking the options into
-// account.
+// account. The xz format uses the suffixes .xz and .txz for
+// compressed tar files; the lzma format uses .lzma and .tlz. A suffix
+// given by --suffix replaces the format suffix for compression and is
+// recognized in addition to the format suffixes for decompression.
+// Files without a known suffix cannot be decompressed into a file. As
+// for xz the raw format has no suffix, so --suffix is required.
 func targetName(path string, opts *options) (target string, err error) {
 	if path == "-" {
 		panic("path name - not supported")
@@ -117,19 +164,40 @@ func targetName(path string, opts *options) (target string, err error) {
 	if len(path) == 0 {
 		return "", errors.New("empty file name not supported")
 	}
+	if opts.format == "raw" && opts.suffix == "" {
+		return "", errors.New("the raw format requires --suffix " +
+			"unless writing to standard output")
+	}
 	ext := "." + opts.format
 	tarExt := ".txz"
 	if opts.format == "lzma" {
 		tarExt = ".tlz"
 	}
+	if opts.suffix != "" {
+		if strings.HasSuffix(path, opts.suffix) {
+			if !opts.decompress {
+				return "", warning{fmt.Errorf(
+					"%s: file has already %s suffix",
+					path, opts.suffix)}
+			}
+			target = path[:len(path)-len(opts.suffix)]
+			if filepath.Base(target) == "" {
+				return "", &userPathError{path, errBase}
+			}
+			return target, nil
+		}
+		if !opts.decompress {
+			return path + opts.suffix, nil
+		}
+	}
 	if !opts.decompress {
 		if strings.HasSuffix(path, ext) {
-			return "", fmt.Errorf(
-				"%s: file has already %s suffix", path, ext)
+			return "", warning{fmt.Errorf(
+				"%s: file has already %s suffix", path, ext)}
 		}
 		if strings.HasSuffix(path, tarExt) {
-			return "", fmt.Errorf(
-				"%s: file has already %s suffix", path, tarExt)
+			return "", warning{fmt.Errorf(
+				"%s: file has already %s suffix", path, tarExt)}
 		}
 		return path + ext, nil
 	}
@@ -147,7 +215,7 @@ func targetName(path string, opts *options) (target string, err error) {
 		}
 		return target + ".tar", nil
 	}
-	return path, nil
+	return "", warning{&userPathError{path, errUnknownSuffix}}
 }
 
 // tmpName converts the path string into a temporary name by appending
@@ -167,10 +235,17 @@ func tmpName(path string, decompress bool) string {
 type writer struct {
 	f    *os.File
 	name string
-	bw   *bufio.Writer
+	tmp  string
+	// file information of the input file; nil for stdin
+	fi os.FileInfo
+	// sparse writer; nil if not used
+	sw *sparseWriter
+	bw *bufio.Writer
 	io.Writer
 	cmp     io.WriteCloser
 	success bool
+	// bytes written to the output file
+	out byteCounter
 }
 
 // writerFormat select the writer format.
@@ -198,12 +273,14 @@ func newCompressor(w io.Writer, opts *options) (cmp io.WriteCloser, err error) {
 	return cmp, nil
 }
 
-// newWriter creates a new file writer. Note that options must contain
-// the actual compression format supported and not just auto.
-func newWriter(path string, perm os.FileMode, opts *options,
+// newWriter creates a new file writer. The file information fi of the
+// input file is used to set the metadata of the output file. Note
+// that options must contain the actual compression format supported
+// and not just auto.
+func newWriter(path string, fi os.FileInfo, opts *options,
 ) (w *writer, err error) {
-	w = &writer{name: path}
-	if opts.stdout {
+	w = &writer{name: path, fi: fi}
+	if opts.stdout || path == "-" {
 		w.f = os.Stdout
 		w.name = "-"
 	} else {
@@ -220,18 +297,29 @@ func newWriter(path string, perm os.FileMode, opts *options,
 		}
 		tmp := tmpName(name, opts.decompress)
 		if w.f, err = os.OpenFile(tmp,
-			os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm); err != nil {
+			os.O_WRONLY|os.O_CREATE|os.O_EXCL, filePerm(fi),
+		); err != nil {
 			return nil, err
 		}
 		w.name = name
+		w.tmp = tmp
+		registerTmpFile(w)
+	}
+	if opts.decompress && !opts.noSparse && w.tmp != "" {
+		w.sw = &sparseWriter{f: w.f}
+		w.bw = bufio.NewWriterSize(
+			&countingWriter{w: w.sw, c: &w.out}, 16*sparseBlockSize)
+	} else {
+		w.bw = bufio.NewWriter(&countingWriter{w: w.f, c: &w.out})
 	}
-	w.bw = bufio.NewWriter(w.f)
 	if opts.decompress {
 		w.Writer = w.bw
 		return w, nil
 	}
 	w.cmp, err = newCompressor(w.bw, opts)
 	if err != nil {
+		// removes the temporary file
+		w.Close()
 		return nil, &userPathError{w.name, err}
 	}
 	w.Writer = w.cmp
@@ -254,6 +342,7 @@ func (w *writer) Close() error {
 		return errInval
 	}
 	defer func() { w.f = nil }()
+	defer unregisterTmpFile(w)
 
 	if !w.success {
 		if isStdout(w.f) {
@@ -278,9 +367,28 @@ func (w *writer) Close() error {
 	if isStdout(w.f) {
 		return nil
 	}
+	if w.sw != nil {
+		if err = w.sw.Close(); err != nil {
+			return err
+		}
+	}
+	if err = w.f.Sync(); err != nil {
+		return err
+	}
+	if w.fi != nil {
+		if err = copyMetadata(w.f, w.fi); err != nil {
+			return err
+		}
+	}
 	if err = w.f.Close(); err != nil {
 		return err
 	}
+	if w.fi != nil {
+		t := w.fi.ModTime()
+		if err = os.Chtimes(w.f.Name(), t, t); err != nil {
+			return err
+		}
+	}
 	if err = os.Rename(w.f.Name(), w.name); err != nil {
 		return err
 	}
@@ -290,7 +398,9 @@ func (w *writer) Close() error {
 // removeTmpFile removes the temporary file for the writer. It is used
 // by the signal handler goroutine.
 func (w *writer) removeTmpFile() {
-	os.Remove(w.f.Name())
+	if w.tmp != "" {
+		os.Remove(w.tmp)
+	}
 }
 
 // SetSuccess sets the success variable to true.
@@ -302,6 +412,8 @@ type reader struct {
 	io.Reader
 	success bool
 	keep    bool
+	// bytes read from the input file
+	in byteCounter
 }
 
 // errNoRegular indicates that a file is not regular.
@@ -322,8 +434,8 @@ func openFile(path string, opts *options) (f *os.File, err error) {
 	fm := fi.Mode()
 	if !fm.IsRegular() {
 		if !opts.force || fm&os.ModeSymlink == 0 {
-			return nil, &userPathError{Path: path,
-				Err: errNoRegular}
+			return nil, warning{&userPathError{Path: path,
+				Err: errNoRegular}}
 		}
 	}
 	if f, err = os.Open(path); err != nil {
@@ -334,21 +446,29 @@ func openFile(path string, opts *options) (f *os.File, err error) {
 	}
 	fm = fi.Mode()
 	if !fm.IsRegular() {
-		return nil, &userPathError{Path: path, Err: errNoRegular}
+		f.Close()
+		return nil, warning{&userPathError{Path: path,
+			Err: errNoRegular}}
 	}
 	if fm&specialBits != 0 && !opts.force {
-		return nil, &userPathError{Path: path,
-			Err: errors.New("setuid, setgid and/or sticky bit set")}
+		f.Close()
+		return nil, warning{&userPathError{Path: path,
+			Err: errors.New("setuid, setgid and/or sticky bit set")}}
 	}
 	return f, nil
 }
 
 var errInvalidFormat = errors.New("file format not recognized")
 
-// readerFormat tries to determine the type of a file. Currently it
-// checks for the XZ header magic and if it is not present assumes that
-// the file has been encoded by LZMA. The format field in options is
-// updated.
+// detectionOrder defines the order in which the formats are tested by
+// readerFormat. The xz magic bytes are checked first, because the LZMA
+// header has no magic bytes and is only recognized by plausible
+// values.
+var detectionOrder = []string{"xz", "lzma"}
+
+// readerFormat tries to determine the type of a file. Only the header
+// of the file is inspected, so it works also for pipes. The format
+// field in options is updated.
 func readerFormat(br *bufio.Reader, opts *options) (f *format, err error) {
 	var ok bool
 	if f, ok = formats[opts.format]; ok {
@@ -361,7 +481,8 @@ func readerFormat(br *bufio.Reader, opts *options) (f *format, err error) {
 		return nil, fmt.Errorf("compression format %s not supported",
 			opts.format)
 	}
-	for format, f := range formats {
+	for _, format := range detectionOrder {
+		f := formats[format]
 		if f.validHeader(br) {
 			opts.format = format
 			return f, nil
@@ -378,6 +499,10 @@ func newDecompressor(br *bufio.Reader, opts *options) (dec io.Reader,
 	}
 	f, err := readerFormat(br, opts)
 	if err != nil {
+		if err == errInvalidFormat && opts.stdout && opts.force {
+			// copy unrecognized data unchanged like xz -dcf
+			return br, nil
+		}
 		return nil, err
 	}
 	if dec, err = f.newDecompressor(br, opts); err != nil {
@@ -392,16 +517,15 @@ func newReader(path string, opts *options) (r *reader, err error) {
 	if err != nil {
 		return nil, err
 	}
-	br := bufio.NewReader(f)
+	r = &reader{f: f, keep: opts.keep || opts.stdout}
+	br := bufio.NewReader(&countingReader{r: f, c: &r.in})
 	if !opts.decompress {
-		r = &reader{f: f, Reader: br, keep: opts.keep || opts.stdout}
+		r.Reader = br
 		return r, nil
 	}
-	dec, err := newDecompressor(br, opts)
-	if err != nil {
+	if r.Reader, err = newDecompressor(br, opts); err != nil {
 		return nil, &userPathError{path, err}
 	}
-	r = &reader{f: f, Reader: dec, keep: opts.keep || opts.stdout}
 	return r, nil
 }
 
@@ -434,15 +558,17 @@ func (r *reader) Close() error {
 
 func (r *reader) SetSuccess() { r.success = true }
 
-func (r *reader) Perm() os.FileMode {
-	const defaultPerm os.FileMode = 0666
-
+// Stat returns the file information for the input file. It returns
+// nil for standard input.
+func (r *reader) Stat() os.FileInfo {
+	if isStdin(r.f) {
+		return nil
+	}
 	fi, err := r.f.Stat()
 	if err != nil {
-		return defaultPerm
+		return nil
 	}
-
-	return fi.Mode() & defaultPerm
+	return fi
 }
 
 // userPathError represents a path error presentable to a user. In
@@ -458,6 +584,9 @@ func (e *userPathError) Error() string {
 	return e.Path + ": " + e.Err.Error()
 }
 
+// Unwrap returns the underlying error.
+func (e *userPathError) Unwrap() error { return e.Err }
+
 // userError converts path error to an error message that is
 // acceptable for gxz users. PathError provides information about the
 // command that has created an error. For instance Lstat informs that
@@ -472,43 +601,71 @@ func userError(err error) error {
 	return &userPathError{Path: pe.Path, Err: pe.Err}
 }
 
-func printErr(err error) {
-	if err != nil {
-		xlog.Warn(userError(err))
-	}
-}
-
 // processFile process the file with the given path applying the
 // provided options.
 func processFile(path string, opts *options) (err error) {
 	r, err := newReader(path, opts)
 	if err != nil {
-		printErr(err)
-		return
+		return err
 	}
 	defer r.Close()
-	w, err := newWriter(path, r.Perm(), opts)
+	w, err := newWriter(path, r.Stat(), opts)
 	if err != nil {
-		printErr(err)
-		return
+		return err
 	}
 	defer w.Close()
-	quitSignalHandler := signalHandler(w)
-	if _, err = io.Copy(w, r); err != nil {
-		close(quitSignalHandler)
-		printErr(err)
-		return err
+	p := startProgress(path, r.Stat(), &r.in, &w.out, opts)
+	defer p.stop()
+	if opts.flushTimeout > 0 && !opts.decompress {
+		_, err = copyFlush(w, r,
+			time.Duration(opts.flushTimeout)*time.Millisecond)
+	} else {
+		_, err = io.Copy(w, r)
+	}
+	if err != nil {
+		if _, ok := err.(*os.PathError); ok {
+			// write errors name the output file
+			return err
+		}
+		return &userPathError{path, err}
 	}
-	close(quitSignalHandler)
 	w.SetSuccess()
 	if err = w.Close(); err != nil {
-		printErr(err)
 		return err
 	}
 	r.SetSuccess()
 	if err = r.Close(); err != nil {
-		printErr(err)
 		return err
 	}
+	p.done()
+	return nil
+}
+
+// testFile decompresses the file with the given path and discards the
+// output. It reports whether the file could be decompressed without
+// errors. The structure of regular xz files, including the indexes and
+// block headers, is verified before the data is decompressed.
+func testFile(path string, opts *options) (err error) {
+	r, err := newReader(path, opts)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	fi := r.Stat()
+	if fi != nil && fi.Mode().IsRegular() && opts.format == "xz" &&
+		!opts.single {
+		cfg := xzReaderConfig(opts)
+		if _, err = cfg.VerifyStructure(r.f, fi.Size()); err != nil {
+			return &userPathError{path, err}
+		}
+	}
+	var out byteCounter
+	p := startProgress(path, r.Stat(), &r.in, &out, opts)
+	defer p.stop()
+	if _, err = io.Copy(&countingWriter{w: ioutil.Discard, c: &out},
+		r); err != nil {
+		return &userPathError{path, err}
+	}
+	p.done()
 	return nil
 }
@@ -0,0 +1,93 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+)
+
+// fileListValue is the flag value for --files and --files0. The
+// argument is optional; without it the list is read from standard
+// input.
+type fileListValue struct {
+	p *string
+}
+
+// Get returns the name of the list file.
+func (v fileListValue) Get() interface{} { return *v.p }
+
+// Set sets the name of the list file.
+func (v fileListValue) Set(s string) error {
+	*v.p = s
+	return nil
+}
+
+// Update selects standard input as list file.
+func (v fileListValue) Update() { *v.p = "-" }
+
+// String returns the name of the list file.
+func (v fileListValue) String() string { return *v.p }
+
+// readFileList reads the file names from the list file. The names are
+// terminated by the separator; empty names are ignored. The name -
+// selects standard input.
+func readFileList(name string, sep byte) (files []string, err error) {
+	var r io.Reader
+	if name == "-" {
+		r = os.Stdin
+	} else {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 4096), 1<<20)
+	s.Split(func(data []byte, atEOF bool) (advance int, token []byte,
+		err error) {
+		if i := bytes.IndexByte(data, sep); i >= 0 {
+			return i + 1, data[:i], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	})
+	for s.Scan() {
+		if len(s.Bytes()) == 0 {
+			continue
+		}
+		files = append(files, s.Text())
+	}
+	if err = s.Err(); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// fileListArgs appends the file names read from the lists given by
+// --files and --files0 to the arguments.
+func fileListArgs(args []string, opts *options) ([]string, error) {
+	if opts.files != "" {
+		files, err := readFileList(opts.files, '\n')
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, files...)
+	}
+	if opts.files0 != "" {
+		files, err := readFileList(opts.files0, 0)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, files...)
+	}
+	return args, nil
+}
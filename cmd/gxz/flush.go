@@ -0,0 +1,88 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io"
+	"time"
+)
+
+// flusher is implemented by compressors that support flushing.
+type flusher interface {
+	Flush() error
+}
+
+// Flush flushes the compressor and the buffered output. Compressors
+// without Flush method are not flushed.
+func (w *writer) Flush() error {
+	if f, ok := w.cmp.(flusher); ok {
+		if err := f.Flush(); err != nil {
+			return err
+		}
+	}
+	return w.bw.Flush()
+}
+
+// chunk is a piece of input read by the go routine of copyFlush.
+type chunk struct {
+	p   []byte
+	err error
+}
+
+// copyFlush copies the input to the writer like io.Copy. If no new
+// input arrives within the timeout, all data written so far is
+// flushed, so that it can be decompressed by the receiver.
+func copyFlush(w *writer, r io.Reader, timeout time.Duration) (n int64,
+	err error) {
+
+	chunks := make(chan chunk)
+	next := make(chan struct{})
+	defer close(next)
+	go func() {
+		buf := make([]byte, 32*1024)
+		for {
+			k, err := r.Read(buf)
+			chunks <- chunk{buf[:k], err}
+			if err != nil {
+				return
+			}
+			// wait until the buffer has been written
+			if _, ok := <-next; !ok {
+				return
+			}
+		}
+	}()
+
+	dirty := false
+	for {
+		var timer <-chan time.Time
+		if dirty {
+			timer = time.After(timeout)
+		}
+		select {
+		case c := <-chunks:
+			if len(c.p) > 0 {
+				k, err := w.Write(c.p)
+				n += int64(k)
+				if err != nil {
+					return n, err
+				}
+				dirty = true
+			}
+			if c.err == io.EOF {
+				return n, nil
+			}
+			if c.err != nil {
+				return n, c.err
+			}
+			next <- struct{}{}
+		case <-timer:
+			if err = w.Flush(); err != nil {
+				return n, err
+			}
+			dirty = false
+		}
+	}
+}
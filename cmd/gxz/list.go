@@ -0,0 +1,307 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ulikunitz/xz"
+)
+
+// checkNames maps the check methods to the names used by the xz tool.
+var checkNames = map[byte]string{
+	0x0:       "None",
+	xz.CRC32:  "CRC32",
+	xz.CRC64:  "CRC64",
+	xz.SHA256: "SHA-256",
+}
+
+// checkName returns the name for the check method.
+func checkName(c byte) string {
+	s, ok := checkNames[c]
+	if !ok {
+		return fmt.Sprintf("Unknown-%d", c)
+	}
+	return s
+}
+
+// sizeString converts a byte count in a string using binary units.
+func sizeString(n int64) string {
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+	units := []string{"KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+	f := float64(n) / 1024
+	i := 0
+	for f >= 1024 && i < len(units)-1 {
+		f /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f %s", f, units[i])
+}
+
+// ratioString returns the compression ratio as string.
+func ratioString(compressed, uncompressed int64) string {
+	if uncompressed <= 0 {
+		return "---"
+	}
+	return fmt.Sprintf("%.3f", float64(compressed)/float64(uncompressed))
+}
+
+// fileInfo collects the information for a single xz file.
+type fileInfo struct {
+	name    string
+	size    int64
+	streams []xz.StreamInfo
+}
+
+// blocks returns the number of blocks in all streams of the file.
+func (fi *fileInfo) blocks() int {
+	n := 0
+	for _, s := range fi.streams {
+		n += len(s.Blocks)
+	}
+	return n
+}
+
+// uncompressedSize returns the uncompressed size of the file.
+func (fi *fileInfo) uncompressedSize() int64 {
+	var n int64
+	for _, s := range fi.streams {
+		n += s.UncompressedSize
+	}
+	return n
+}
+
+// padding returns the size of the stream padding in the file.
+func (fi *fileInfo) padding() int64 {
+	var n int64
+	for _, s := range fi.streams {
+		n += s.Padding
+	}
+	return n
+}
+
+// checks returns the names of all checks used in the file.
+func (fi *fileInfo) checks() string {
+	var s string
+	seen := make(map[byte]bool)
+	for _, st := range fi.streams {
+		if seen[st.CheckSum] {
+			continue
+		}
+		seen[st.CheckSum] = true
+		if s != "" {
+			s += ","
+		}
+		s += checkName(st.CheckSum)
+	}
+	return s
+}
+
+var errListStdin = errors.New("--list does not support reading from " +
+	"standard input")
+
+// readFileInfo reads the stream information from the file with the
+// given path.
+func readFileInfo(path string, opts *options) (fi *fileInfo, err error) {
+	if path == "-" {
+		return nil, errListStdin
+	}
+	f, err := openFile(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	fi = &fileInfo{name: path, size: st.Size()}
+	if fi.streams, err = xz.ReadStreamInfo(f, fi.size); err != nil {
+		return nil, &userPathError{path, err}
+	}
+	return fi, nil
+}
+
+// listHeader is the header of the compact list format.
+const listHeader = "Strms  Blocks   Compressed Uncompressed  Ratio  Check" +
+	"   Filename\n"
+
+// printCompact prints a single line for the file info.
+func printCompact(w io.Writer, fi *fileInfo) {
+	fmt.Fprintf(w, "%5d %7d %12s %12s  %5s  %-7s %s\n",
+		len(fi.streams), fi.blocks(), sizeString(fi.size),
+		sizeString(fi.uncompressedSize()),
+		ratioString(fi.size, fi.uncompressedSize()),
+		fi.checks(), fi.name)
+}
+
+// printVerbose prints the file info including the tables of the
+// streams and blocks of the file.
+func printVerbose(w io.Writer, fi *fileInfo, i, n int) {
+	u := fi.uncompressedSize()
+	fmt.Fprintf(w, "%s (%d/%d)\n", fi.name, i, n)
+	fmt.Fprintf(w, "  Streams:            %d\n", len(fi.streams))
+	fmt.Fprintf(w, "  Blocks:             %d\n", fi.blocks())
+	fmt.Fprintf(w, "  Compressed size:    %s\n", sizeString(fi.size))
+	fmt.Fprintf(w, "  Uncompressed size:  %s\n", sizeString(u))
+	fmt.Fprintf(w, "  Ratio:              %s\n", ratioString(fi.size, u))
+	fmt.Fprintf(w, "  Check:              %s\n", fi.checks())
+	fmt.Fprintf(w, "  Stream Padding:     %s\n", sizeString(fi.padding()))
+
+	fmt.Fprintf(w, "  Streams:\n")
+	fmt.Fprintf(w, "    %6s %9s %15s %15s %15s %15s %6s %-7s %7s\n",
+		"Stream", "Blocks", "CompOffset", "UncompOffset",
+		"CompSize", "UncompSize", "Ratio", "Check", "Padding")
+	for k, s := range fi.streams {
+		fmt.Fprintf(w, "    %6d %9d %15d %15d %15d %15d %6s %-7s %7d\n",
+			k+1, len(s.Blocks), s.Offset, s.UncompressedOffset,
+			s.Size, s.UncompressedSize,
+			ratioString(s.Size, s.UncompressedSize),
+			checkName(s.CheckSum), s.Padding)
+	}
+
+	fmt.Fprintf(w, "  Blocks:\n")
+	fmt.Fprintf(w, "    %6s %9s %15s %15s %15s %15s %6s %s\n",
+		"Stream", "Block", "CompOffset", "UncompOffset",
+		"TotalSize", "UncompSize", "Ratio", "Check")
+	for k, s := range fi.streams {
+		for j, b := range s.Blocks {
+			fmt.Fprintf(w,
+				"    %6d %9d %15d %15d %15d %15d %6s %s\n",
+				k+1, j+1, b.Offset, b.UncompressedOffset,
+				b.TotalSize(), b.UncompressedSize,
+				ratioString(b.TotalSize(), b.UncompressedSize),
+				checkName(s.CheckSum))
+		}
+	}
+}
+
+// printRobot prints the file info in the tab-separated format of
+// xz --robot --list. The stream and block lines are only printed in
+// verbose mode.
+func printRobot(w io.Writer, fi *fileInfo, opts *options) {
+	u := fi.uncompressedSize()
+	fmt.Fprintf(w, "name\t%s\n", fi.name)
+	fmt.Fprintf(w, "file\t%d\t%d\t%d\t%d\t%s\t%s\t%d\n",
+		len(fi.streams), fi.blocks(), fi.size, u,
+		ratioString(fi.size, u), fi.checks(), fi.padding())
+	if opts.verbose <= 0 {
+		return
+	}
+	for k, s := range fi.streams {
+		fmt.Fprintf(w, "stream\t%d\t%d\t%d\t%d\t%d\t%d\t%s\t%s\t%d\n",
+			k+1, len(s.Blocks), s.Offset, s.UncompressedOffset,
+			s.Size, s.UncompressedSize,
+			ratioString(s.Size, s.UncompressedSize),
+			checkName(s.CheckSum), s.Padding)
+	}
+	n := 0
+	for k, s := range fi.streams {
+		for j, b := range s.Blocks {
+			n++
+			fmt.Fprintf(w,
+				"block\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%s\t%s\n",
+				k+1, j+1, n, b.Offset, b.UncompressedOffset,
+				b.TotalSize(), b.UncompressedSize,
+				ratioString(b.TotalSize(), b.UncompressedSize),
+				checkName(s.CheckSum))
+		}
+	}
+}
+
+// printRobotTotals prints the totals line of xz --robot --list.
+func printRobotTotals(w io.Writer, infos []*fileInfo) {
+	var streams, blocks int
+	var size, u, padding int64
+	checks := &fileInfo{}
+	for _, fi := range infos {
+		streams += len(fi.streams)
+		blocks += fi.blocks()
+		size += fi.size
+		u += fi.uncompressedSize()
+		padding += fi.padding()
+		checks.streams = append(checks.streams, fi.streams...)
+	}
+	fmt.Fprintf(w, "totals\t%d\t%d\t%d\t%d\t%s\t%s\t%d\t%d\n",
+		streams, blocks, size, u, ratioString(size, u),
+		checks.checks(), padding, len(infos))
+}
+
+// printTotals prints the totals for all listed files.
+func printTotals(w io.Writer, infos []*fileInfo, opts *options) {
+	var streams, blocks int
+	var size, u, padding int64
+	for _, fi := range infos {
+		streams += len(fi.streams)
+		blocks += fi.blocks()
+		size += fi.size
+		u += fi.uncompressedSize()
+		padding += fi.padding()
+	}
+	if opts.verbose <= 0 {
+		fmt.Fprintf(w, "-------------------------------------------"+
+			"------------------------\n")
+		fmt.Fprintf(w, "%5d %7d %12s %12s  %5s  %-7s %d files\n",
+			streams, blocks, sizeString(size), sizeString(u),
+			ratioString(size, u), "", len(infos))
+		return
+	}
+	fmt.Fprintf(w, "Totals:\n")
+	fmt.Fprintf(w, "  Number of files:    %d\n", len(infos))
+	fmt.Fprintf(w, "  Streams:            %d\n", streams)
+	fmt.Fprintf(w, "  Blocks:             %d\n", blocks)
+	fmt.Fprintf(w, "  Compressed size:    %s\n", sizeString(size))
+	fmt.Fprintf(w, "  Uncompressed size:  %s\n", sizeString(u))
+	fmt.Fprintf(w, "  Ratio:              %s\n", ratioString(size, u))
+	fmt.Fprintf(w, "  Stream Padding:     %s\n", sizeString(padding))
+}
+
+// listFiles prints information about the given xz files.
+func listFiles(paths []string, opts *options) {
+	if opts.format != "xz" {
+		printErr(errors.New("--list works only on .xz files"))
+		return
+	}
+	infos := make([]*fileInfo, 0, len(paths))
+	w := os.Stdout
+	for i, path := range paths {
+		fi, err := readFileInfo(path, opts)
+		if err != nil {
+			printErr(err)
+			continue
+		}
+		infos = append(infos, fi)
+		if opts.robot {
+			printRobot(w, fi, opts)
+			continue
+		}
+		if opts.verbose <= 0 {
+			if len(infos) == 1 {
+				fmt.Fprint(w, listHeader)
+			}
+			printCompact(w, fi)
+			continue
+		}
+		if len(infos) > 1 {
+			fmt.Fprintln(w)
+		}
+		printVerbose(w, fi, i+1, len(paths))
+	}
+	if opts.robot {
+		printRobotTotals(w, infos)
+		return
+	}
+	if len(infos) > 1 {
+		if opts.verbose > 0 {
+			fmt.Fprintln(w)
+		}
+		printTotals(w, infos, opts)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// lzma2Options contains the LZMA2 filter options given by --lzma2.
+// Zero values and a nil matcher mean that the preset value is used.
+type lzma2Options struct {
+	dictCap int
+	props   *lzma.Properties
+	matcher *lzma.MatchAlgorithm
+}
+
+// lzma2Matchers maps the match finder names of the xz tool to the
+// match algorithms of the package.
+var lzma2Matchers = map[string]lzma.MatchAlgorithm{
+	"hc4": lzma.HashTable4,
+	"bt4": lzma.BinaryTree,
+}
+
+// parseLZMA2Options parses the argument of the --lzma2 flag. It uses
+// the notation of the xz tool: a comma-separated list of name=value
+// pairs with the names preset, dict, lc, lp, pb and mf. The preset
+// option sets the preset level of the options; the suffix e selects
+// the extreme variant like -e.
+func parseLZMA2Options(o *options) error {
+	if o.lzma2Arg == "" {
+		return nil
+	}
+	props := defaultProperties
+	for _, opt := range strings.Split(o.lzma2Arg, ",") {
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return fmt.Errorf("--lzma2: %q has no value", opt)
+		}
+		name, value := kv[0], kv[1]
+		switch name {
+		case "preset":
+			level := strings.TrimSuffix(value, "e")
+			n, err := strconv.Atoi(level)
+			if err != nil || n < 0 || n > 9 {
+				return fmt.Errorf("--lzma2: unsupported preset %q",
+					value)
+			}
+			o.preset = n
+			o.extreme = level != value
+		case "dict":
+			n, err := parseSize(value)
+			if err != nil {
+				return fmt.Errorf("--lzma2: %s", err)
+			}
+			if n < lzma.MinDictCap || n > lzma.MaxDictCap {
+				return fmt.Errorf("--lzma2: dictionary size %s "+
+					"out of range", value)
+			}
+			o.lzma2.dictCap = int(n)
+		case "lc", "lp", "pb":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return fmt.Errorf("--lzma2: invalid value %q "+
+					"for %s", value, name)
+			}
+			switch name {
+			case "lc":
+				props.LC = n
+			case "lp":
+				props.LP = n
+			case "pb":
+				props.PB = n
+			}
+			o.lzma2.props = &props
+		case "mf":
+			m, ok := lzma2Matchers[value]
+			if !ok {
+				return fmt.Errorf("--lzma2: unsupported match "+
+					"finder %q", value)
+			}
+			o.lzma2.matcher = &m
+		default:
+			return fmt.Errorf("--lzma2: unsupported option %q", name)
+		}
+	}
+	if o.lzma2.props != nil {
+		c := lzma.Writer2Config{Properties: o.lzma2.props}
+		if err := c.Verify(); err != nil {
+			return fmt.Errorf("--lzma2: %s", err)
+		}
+	}
+	return nil
+}
@@ -5,12 +5,17 @@
 // Command gxz supports the compression and decompression of LZMA files.
 //
 // Use gxz -h to get information about supported flags.
+//
+// If gxz is called by a link named gunxz, gxzcat, glzma, gunlzma or
+// glzcat it behaves like unxz, xzcat, lzma, unlzma or lzcat
+// respectively. The names without the g prefix are supported as well.
 package main
 
 //go:generate xb cat -o licenses.go xzLicense:github.com/ulikunitz/xz/LICENSE goLicense:~/go/LICENSE
 //go:generate xb version-file -o version.go
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -26,8 +31,8 @@ import (
 
 const (
 	usageStr = `Usage: gxz [OPTION]... [FILE]...
-Compress or uncompress FILEs in the .lzma format (by default, compress FILES
-in place).
+Compress or uncompress FILEs in the .xz or .lzma format (by default,
+compress FILES in place).
 
   -c, --stdout      write to standard output and don't delete input files
   -d, --decompress  force decompression
@@ -38,18 +43,90 @@ in place).
 	            the file content is used to identify the format.
     xz              The xz file format.
     lzma, alone     Compress to the .lzma file format.
+    raw             Raw LZMA2 stream without headers; the LZMA2
+                    options must be given for decompression too and
+                    files require --suffix.
+  --completion=SHELL
+                    write the completion script for the shell bash,
+                    zsh or fish to standard output
+  -b, --benchmark[=N[-M]]
+                    compress and decompress the FILEs in memory with
+                    the presets N to M and report ratio and speed; no
+                    output files are written; without argument the
+                    preset given by -0 ... -9 is used
+  --block-size=SIZE
+                    start a new xz block after SIZE bytes of
+                    uncompressed data; SIZE may use the suffixes KiB,
+                    MiB and GiB
+  --block-list=SIZES
+                    start new xz blocks after the comma-separated
+                    uncompressed sizes; the last size is repeated and a
+                    last size of 0 puts the rest of the file into a
+                    single block
+  --files[=FILE]    read the names of the files to process from FILE;
+                    the names are terminated by newlines; without FILE
+                    the names are read from standard input
+  --files0[=FILE]   like --files but the names are terminated by the
+                    null character as created by find -print0
+  --flush-timeout=MS
+                    when compressing, flush the compressed data if no
+                    new input arrived within MS milliseconds; this
+                    requires the xz format
   -h, --help        give this help
+  --man             write the man page in roff format to standard output
+  -M, --memlimit=LIMIT
+                    set the memory usage limit for compression and
+                    decompression; 0 means no limit
+  --memlimit-compress=LIMIT
+                    set the memory usage limit for compression; the
+                    dictionary size is reduced to meet the limit
+  --memlimit-decompress=LIMIT
+                    set the memory usage limit for decompression; files
+                    requiring more memory are not decompressed
   -k, --keep        keep (don't delete) input files
+  -l, --list        list information about .xz files; use -v for
+                    details about streams and blocks
   -L, --license     display software license
-  -q, --quiet       suppress all warnings
-  -v, --verbose     verbose mode
+  --no-sparse       don't create sparse files when decompressing
+  -q, --quiet       suppress warnings; specify twice to suppress errors
+                    too
+  -Q, --no-warn     don't set the exit status 2 for warnings
+  -r, --recursive   operate recursively on directories; files are
+                    processed in parallel
+  --robot           use tab-separated output for --list and -v; the
+                    list columns are the same as for xz --robot; with
+                    -v a line "file NAME COMPRESSED UNCOMPRESSED RATIO
+                    SECONDS" is written to standard error for each file
+  --single-stream   decompress only the first .xz stream and ignore
+                    the data following it
+  --self-test       decompress the built-in test vectors, compress and
+                    decompress test data and report the results
+  -S, --suffix=.SUF use the suffix .SUF for compressed files; for
+                    decompression .SUF is recognized in addition to
+                    the suffixes of the format
+  -t, --test        test compressed file integrity
+  -T, --threads=NUM compress xz blocks using NUM go routines; 0 uses
+                    the number of CPUs
+  -v, --verbose     verbose mode; show progress and compression ratio
   -V, --version     display version string
   -z, --compress    force compression
   -0 ... -9         compression preset; default is 6
+  -e, --extreme     search deeper for matches; compresses slightly
+                    better but slower
+  --lzma2=OPTS      set the LZMA2 options as comma-separated list of
+                    preset=PRESET, dict=SIZE, lc=NUM, lp=NUM, pb=NUM
+                    and mf=hc4|bt4; the dictionary size is required
+                    to decompress raw streams
   --cpuprofile <file>
                     create a cpuprofile that can be used with go tool pprof
 
-With no file, or when FILE is -, read standard input.
+With no file, or when FILE is -, read standard input and write to
+standard output. The format of compressed input is detected by its
+header, so xz and lzma data can be decompressed in pipelines. Using -c
+and -f together copies input that is not recognized unchanged.
+
+Exit status is 0 if all is OK, 1 if an error occurred and 2 if only
+warnings have been reported.
 
 Report bugs using <https://github.com/ulikunitz/xz/issues>.
 `
@@ -96,12 +173,48 @@ type options struct {
 	force      bool
 	format     string
 	keep       bool
+	list       bool
 	license    bool
+	test       bool
 	version    bool
+	noSparse   bool
+	single     bool
 	quiet      int
+	noWarn     bool
+	recursive  bool
 	verbose    int
 	preset     int
+	extreme    bool
+	threads    int
+	suffix     string
+	files      string
+	files0     string
+	benchmark  benchRange
+	robot      bool
+	selfTest   bool
+	completion string
+	man        bool
 	cpuprofile string
+	lzma2Arg   string
+	lzma2      lzma2Options
+
+	blockSizeArg string
+	blockListArg string
+	blockSize    int64
+	blockList    []int64
+
+	memlimitArg           string
+	memlimitCompressArg   string
+	memlimitDecompressArg string
+	memlimitCompress      int64
+	memlimitDecompress    int64
+	// flush timeout in milliseconds
+	flushTimeout int
+	// number of files processed in parallel
+	workers int
+	// dictCap replaces the dictionary capacity of the preset if
+	// positive
+	dictCap int
 }
 
 func (o *options) Init() {
@@ -114,20 +227,70 @@ func (o *options) Init() {
 	gflag.BoolVarP(&o.force, "force", "f", false, "")
 	gflag.StringVarP(&o.format, "format", "F", "auto", "")
 	gflag.BoolVarP(&o.keep, "keep", "k", false, "")
+	gflag.BoolVarP(&o.list, "list", "l", false, "")
 	gflag.BoolVarP(&o.license, "license", "L", false, "")
+	gflag.BoolVarP(&o.test, "test", "t", false, "")
 	gflag.BoolVarP(&o.version, "version", "V", false, "")
+	gflag.BoolVarP(&o.noSparse, "no-sparse", "", false, "")
+	gflag.BoolVarP(&o.single, "single-stream", "", false, "")
 	gflag.CounterVarP(&o.quiet, "quiet", "q", 0, "")
+	gflag.BoolVarP(&o.noWarn, "no-warn", "Q", false, "")
+	gflag.BoolVarP(&o.recursive, "recursive", "r", false, "")
 	gflag.CounterVarP(&o.verbose, "verbose", "v", 0, "")
 	gflag.PresetVar(&o.preset, 0, 9, 6, "")
+	gflag.BoolVarP(&o.extreme, "extreme", "e", false, "")
+	gflag.BoolVarP(&o.robot, "robot", "", false, "")
+	gflag.BoolVarP(&o.selfTest, "self-test", "", false, "")
+	gflag.StringVarP(&o.completion, "completion", "", "", "")
+	gflag.BoolVarP(&o.man, "man", "", false, "")
+	gflag.StringVarP(&o.suffix, "suffix", "S", "", "")
+	gflag.Var(fileListValue{&o.files}, "files", gflag.OptionalArg)
+	gflag.Var(fileListValue{&o.files0}, "files0", gflag.OptionalArg)
+	gflag.IntVarP(&o.flushTimeout, "flush-timeout", "", 0, "")
+	o.benchmark = benchRange{-1, -1}
+	gflag.VarP(benchValue{&o.benchmark}, "benchmark", "b",
+		gflag.OptionalArg)
+	gflag.IntVarP(&o.threads, "threads", "T", 1, "")
 	gflag.StringVarP(&o.cpuprofile, "cpuprofile", "", "", "")
+	gflag.StringVarP(&o.lzma2Arg, "lzma2", "", "", "")
+	gflag.StringVarP(&o.blockSizeArg, "block-size", "", "", "")
+	gflag.StringVarP(&o.blockListArg, "block-list", "", "", "")
+	gflag.StringVarP(&o.memlimitArg, "memlimit", "M", "", "")
+	gflag.StringVarP(&o.memlimitCompressArg, "memlimit-compress", "",
+		"", "")
+	gflag.StringVarP(&o.memlimitDecompressArg, "memlimit-decompress", "",
+		"", "")
+}
+
+// setPersonality sets the options for the program name. The gxz
+// binary can be installed under the names of the xz tools using links;
+// for instance gunxz behaves like unxz and gxzcat like xzcat.
+func setPersonality(cmdName string, o *options) {
+	name := strings.TrimSuffix(strings.ToLower(cmdName), ".exe")
+	switch name {
+	case "lzma", "glzma":
+		o.format = "lzma"
+	case "lzcat", "glzcat":
+		o.format = "lzma"
+		fallthrough
+	case "xzcat", "gxzcat":
+		o.stdout = true
+		o.decompress = true
+	case "unlzma", "unglzma", "gunlzma":
+		o.format = "lzma"
+		fallthrough
+	case "unxz", "ungxz", "gunxz":
+		o.decompress = true
+	}
 }
 
 // normalizeFormat normalizes the format field of options. If the
 // function completes without error the format field will be "xz",
-// "lzma" or "auto". The latter only if the option decompress is true.
+// "lzma", "raw" or "auto". The latter only if the option decompress is
+// true.
 func normalizeFormat(o *options) error {
 	switch o.format {
-	case "xz", "lzma":
+	case "xz", "lzma", "raw":
 	case "auto":
 		if !o.decompress {
 			o.format = "xz"
@@ -140,6 +303,45 @@ func normalizeFormat(o *options) error {
 	return nil
 }
 
+// checkSuffix verifies the suffix given by --suffix. As for xz the
+// suffix must not contain a directory separator.
+func checkSuffix(o *options) error {
+	if strings.ContainsAny(o.suffix, "/"+string(filepath.Separator)) {
+		return fmt.Errorf("%s: invalid filename suffix", o.suffix)
+	}
+	return nil
+}
+
+// parseBlockOptions parses the arguments of the --block-size and
+// --block-list flags.
+func parseBlockOptions(o *options) (err error) {
+	if o.blockSizeArg != "" {
+		if o.blockSize, err = parseSize(o.blockSizeArg); err != nil {
+			return fmt.Errorf("--block-size: %s", err)
+		}
+		if o.blockSize == 0 {
+			return errors.New("--block-size: size must be positive")
+		}
+	}
+	if o.blockListArg != "" {
+		if o.blockList, err = parseSizeList(o.blockListArg); err != nil {
+			return fmt.Errorf("--block-list: %s", err)
+		}
+		for i, n := range o.blockList {
+			if n == 0 && i < len(o.blockList)-1 {
+				return errors.New("--block-list: only the last " +
+					"size may be 0")
+			}
+		}
+	}
+	if (o.format == "lzma" || o.format == "raw") &&
+		(o.blockSize > 0 || o.blockList != nil) {
+		warn(fmt.Sprintf("block options are ignored for the %s format",
+			o.format))
+	}
+	return nil
+}
+
 func main() {
 	// setup logger
 	cmdName := filepath.Base(os.Args[0])
@@ -152,21 +354,7 @@ func main() {
 	opts := options{}
 	opts.Init()
 
-	switch cmdName {
-	case "lzma", "glzma":
-		opts.format = "lzma"
-	case "lzcat", "glzcat":
-		opts.format = "lzma"
-		fallthrough
-	case "xzcat", "gxzcat":
-		opts.stdout = true
-		opts.decompress = true
-	case "unlzma", "unglzma":
-		opts.format = "lzma"
-		fallthrough
-	case "unxz", "ungxz":
-		opts.decompress = true
-	}
+	setPersonality(cmdName, &opts)
 	gflag.Parse()
 
 	if opts.help {
@@ -177,7 +365,21 @@ func main() {
 		licenses(os.Stdout)
 		os.Exit(0)
 	}
+	if opts.completion != "" {
+		if err := writeCompletion(os.Stdout, opts.completion); err != nil {
+			xlog.Fatal(err)
+		}
+		os.Exit(0)
+	}
+	if opts.man {
+		writeMan(os.Stdout)
+		os.Exit(0)
+	}
 	if opts.version {
+		if opts.robot {
+			fmt.Printf("GXZ_VERSION=%s\n", version)
+			os.Exit(0)
+		}
 		xlog.Printf("version %s\n", version)
 		os.Exit(0)
 	}
@@ -192,12 +394,17 @@ func main() {
 	switch {
 	case opts.quiet >= 2:
 		flags |= xlog.Lnoprint | xlog.Lnowarn | xlog.Lnodebug
-		flags |= xlog.Lnopanic | xlog.Lnofatal
+		flags |= xlog.Lnopanic | xlog.Lnofatal | xlog.Lnoerror
 	case opts.quiet == 1:
 		flags |= xlog.Lnoprint | xlog.Lnowarn | xlog.Lnodebug
 	}
 	xlog.SetFlags(flags)
 
+	if opts.selfTest {
+		selfTest()
+		os.Exit(exitStatus(&opts))
+	}
+
 	if opts.cpuprofile != "" {
 		f, err := os.Create(opts.cpuprofile)
 		if err != nil {
@@ -208,33 +415,103 @@ func main() {
 		}
 	}
 
+	if opts.test {
+		opts.decompress = true
+		opts.keep = true
+	}
+
 	if err := normalizeFormat(&opts); err != nil {
 		pprof.StopCPUProfile()
 		xlog.Fatal(err)
 	}
+	if err := parseLZMA2Options(&opts); err != nil {
+		pprof.StopCPUProfile()
+		xlog.Fatal(err)
+	}
+	if err := parseBlockOptions(&opts); err != nil {
+		pprof.StopCPUProfile()
+		xlog.Fatal(err)
+	}
+	if err := checkSuffix(&opts); err != nil {
+		pprof.StopCPUProfile()
+		xlog.Fatal(err)
+	}
+	if opts.flushTimeout < 0 {
+		pprof.StopCPUProfile()
+		xlog.Fatal("flush timeout must not be negative")
+	}
+	if opts.flushTimeout > 0 && opts.format == "lzma" {
+		warn("--flush-timeout is ignored for the lzma format")
+	}
+	if opts.threads < 0 {
+		pprof.StopCPUProfile()
+		xlog.Fatal("number of threads must not be negative")
+	}
+	if err := parseMemLimits(&opts); err != nil {
+		pprof.StopCPUProfile()
+		xlog.Fatal(err)
+	}
+	if !opts.decompress && !opts.list {
+		if err := adjustDictCap(&opts); err != nil {
+			pprof.StopCPUProfile()
+			xlog.Fatal(err)
+		}
+	}
 
-	var args []string
-	if gflag.NArg() == 0 {
+	if opts.files == "-" && opts.files0 == "-" {
+		pprof.StopCPUProfile()
+		xlog.Fatal("--files and --files0 cannot both read " +
+			"standard input")
+	}
+	args, err := fileListArgs(gflag.Args(), &opts)
+	if err != nil {
+		pprof.StopCPUProfile()
+		xlog.Fatal(err)
+	}
+	if len(args) == 0 {
+		if opts.files != "" || opts.files0 != "" {
+			// an empty list is no request to read stdin
+			pprof.StopCPUProfile()
+			os.Exit(0)
+		}
 		opts.stdout = true
 		args = []string{"-"}
-	} else {
-		args = gflag.Args()
 	}
 
-	if opts.stdout && !opts.decompress && !opts.force &&
+	if opts.benchmark.first != -1 {
+		benchmark(args, &opts)
+		pprof.StopCPUProfile()
+		os.Exit(exitStatus(&opts))
+	}
+
+	if opts.list {
+		listFiles(args, &opts)
+		pprof.StopCPUProfile()
+		os.Exit(exitStatus(&opts))
+	}
+
+	if opts.recursive {
+		var errs []error
+		args, errs = walkArgs(args, &opts)
+		for _, err := range errs {
+			printErr(err)
+		}
+	}
+
+	process := processFile
+	if opts.test {
+		process = testFile
+	} else if opts.stdout && !opts.decompress && !opts.force &&
 		term.IsTerminal(os.Stdout.Fd()) {
 		pprof.StopCPUProfile()
 		xlog.Fatal(`Compressed data will not be written to a terminal
 Use -f to force compression. For help type gxz -h.`)
 	}
 
-	exit := 0
-	for _, arg := range args {
-		if err := processFile(arg, &opts); err != nil {
-			exit = 1
-		}
-	}
+	signalHandler()
+	opts.workers = fileWorkers(&opts)
+	processFiles(args, &opts, opts.workers, process)
 
 	pprof.StopCPUProfile()
-	os.Exit(exit)
+	os.Exit(exitStatus(&opts))
 }
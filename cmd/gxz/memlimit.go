@@ -0,0 +1,147 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/ulikunitz/xz/internal/xlog"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// parseMemLimits parses the arguments of the memory limit flags. The
+// flag --memlimit sets both limits; the specific flags take
+// precedence. A limit of 0 means that there is no limit.
+func parseMemLimits(o *options) (err error) {
+	var limit int64
+	if o.memlimitArg != "" {
+		if limit, err = parseSize(o.memlimitArg); err != nil {
+			return fmt.Errorf("--memlimit: %s", err)
+		}
+		o.memlimitCompress = limit
+		o.memlimitDecompress = limit
+	}
+	if o.memlimitCompressArg != "" {
+		if o.memlimitCompress, err = parseSize(
+			o.memlimitCompressArg); err != nil {
+			return fmt.Errorf("--memlimit-compress: %s", err)
+		}
+	}
+	if o.memlimitDecompressArg != "" {
+		if o.memlimitDecompress, err = parseSize(
+			o.memlimitDecompressArg); err != nil {
+			return fmt.Errorf("--memlimit-decompress: %s", err)
+		}
+	}
+	return nil
+}
+
+// encoderMemUsage estimates the memory required by the encoder. The
+// encoder buffer holds the dictionary and the write buffer. The hash
+// table matcher stores four bytes per dictionary position and uses a
+// table of 8-byte entries with about half as many entries as the
+// dictionary capacity.
+func encoderMemUsage(dictCap, bufSize int) int64 {
+	return 9*int64(dictCap) + int64(bufSize)
+}
+
+var errMemLimitTooLow = errors.New("memory usage limit is too low " +
+	"for the given filter setup")
+
+// adjustDictCap reduces the dictionary capacity of the preset until the
+// estimated memory usage of the encoder doesn't exceed the compression
+// memory limit.
+func adjustDictCap(o *options) error {
+	limit := o.memlimitCompress
+	p := basePreset(o)
+	if limit <= 0 || encoderMemUsage(p.dictCap, p.bufSize) <= limit {
+		return nil
+	}
+	dictCap := p.dictCap
+	for encoderMemUsage(dictCap, p.bufSize) > limit {
+		if dictCap <= lzma.MinDictCap {
+			return errMemLimitTooLow
+		}
+		dictCap >>= 1
+	}
+	xlog.Printf("adjusted LZMA2 dictionary size from %s to %s to not "+
+		"exceed the memory usage limit of %s", mibString(int64(p.dictCap)),
+		mibString(int64(dictCap)), mibString(limit))
+	o.dictCap = dictCap
+	return nil
+}
+
+// decoderDictCapLimit translates the decompression memory limit into
+// a limit for the dictionary capacity. The return value 0 means that
+// there is no limit.
+func decoderDictCapLimit(o *options) int {
+	limit := o.memlimitDecompress
+	switch {
+	case limit <= 0:
+		return 0
+	case limit < lzma.MinDictCap:
+		return lzma.MinDictCap
+	case limit > math.MaxInt32:
+		// all dictionary capacities can be represented as int
+		return 0
+	}
+	return int(limit)
+}
+
+// xzDictCapLimit returns the dictionary capacity limit for the xz
+// reader. Without a memory limit the default limit of the reader is
+// removed, so gxz decompresses all files like xz does.
+func xzDictCapLimit(o *options) int {
+	if limit := decoderDictCapLimit(o); limit > 0 {
+		return limit
+	}
+	return -1
+}
+
+// decoderDictCap returns the initial dictionary capacity for the
+// decoder respecting the decompression memory limit.
+func decoderDictCap(o *options) int {
+	dictCap := basePreset(o).dictCap
+	if limit := decoderDictCapLimit(o); limit > 0 && limit < dictCap {
+		dictCap = limit
+	}
+	return dictCap
+}
+
+// mibString formats a byte count in mebibytes rounding up like xz.
+func mibString(n int64) string {
+	return fmt.Sprintf("%d MiB", (n+(1<<20)-1)>>20)
+}
+
+// memLimitError reports that the decompression of a file requires more
+// memory than the limit allows.
+type memLimitError struct {
+	path     string
+	required int64
+	limit    int64
+}
+
+// Error returns the error message.
+func (e *memLimitError) Error() string {
+	return fmt.Sprintf("%s: memory usage limit reached; %s of memory "+
+		"is required, the limit is %s", e.path,
+		mibString(e.required), mibString(e.limit))
+}
+
+// memLimitErr converts an error caused by the dictionary capacity
+// limit into a memLimitError. Other errors are returned unchanged.
+func memLimitErr(path string, o *options, err error) error {
+	var e *lzma.DictCapLimitError
+	if !errors.As(err, &e) {
+		return err
+	}
+	return &memLimitError{
+		path:     path,
+		required: e.DictCap,
+		limit:    o.memlimitDecompress,
+	}
+}
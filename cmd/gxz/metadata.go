@@ -0,0 +1,27 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "os"
+
+// filePerm returns the permissions for a new output file. The
+// permissions of the input file are used if available.
+func filePerm(fi os.FileInfo) os.FileMode {
+	const defaultPerm os.FileMode = 0666
+	if fi == nil {
+		return defaultPerm
+	}
+	return fi.Mode() & defaultPerm
+}
+
+// copyMetadata copies the ownership and the permissions of the input
+// file described by fi to the output file f. The ownership is copied
+// only where the platform supports it and failures to change it are
+// ignored like the xz tool does. Changing the owner may clear
+// permission bits, so the permissions are set afterwards.
+func copyMetadata(f *os.File, fi os.FileInfo) error {
+	copyOwner(f, fi)
+	return f.Chmod(fi.Mode() & os.ModePerm)
+}
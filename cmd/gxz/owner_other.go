@@ -0,0 +1,13 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !unix
+// +build !unix
+
+package main
+
+import "os"
+
+// copyOwner does nothing on platforms without Unix file ownership.
+func copyOwner(f *os.File, fi os.FileInfo) {}
@@ -0,0 +1,26 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build unix
+// +build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// copyOwner tries to set the user and group of the output file to the
+// values of the input file. Usually only the superuser is allowed to
+// change the user, so the group is set separately if that fails.
+func copyOwner(f *os.File, fi os.FileInfo) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+	if err := f.Chown(int(st.Uid), int(st.Gid)); err != nil {
+		f.Chown(-1, int(st.Gid))
+	}
+}
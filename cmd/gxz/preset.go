@@ -0,0 +1,137 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"runtime"
+
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/internal/xlog"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// preset describes the compression parameters selected by the flags
+// -0 ... -9 and -e. A depth of zero selects the default depth of the
+// encoder.
+type preset struct {
+	dictCap int
+	matcher lzma.MatchAlgorithm
+	bufSize int
+	depth   int
+}
+
+// presets maps the preset levels to the compression parameters. The
+// dictionary capacities follow the xz tool. The binary tree matcher
+// is not used, because it is much slower than the hash table without
+// providing better compression.
+var presets = [10]preset{
+	{dictCap: 1 << 18, matcher: lzma.HashTable4, bufSize: 4096},
+	{dictCap: 1 << 20, matcher: lzma.HashTable4, bufSize: 4096},
+	{dictCap: 1 << 21, matcher: lzma.HashTable4, bufSize: 4096},
+	{dictCap: 1 << 22, matcher: lzma.HashTable4, bufSize: 4096},
+	{dictCap: 1 << 22, matcher: lzma.HashTable4, bufSize: 4096},
+	{dictCap: 1 << 23, matcher: lzma.HashTable4, bufSize: 4096},
+	{dictCap: 1 << 23, matcher: lzma.HashTable4, bufSize: 4096},
+	{dictCap: 1 << 24, matcher: lzma.HashTable4, bufSize: 4096},
+	{dictCap: 1 << 25, matcher: lzma.HashTable4, bufSize: 4096},
+	{dictCap: 1 << 26, matcher: lzma.HashTable4, bufSize: 4096},
+}
+
+// defaultProperties are the LZMA properties used for all presets.
+var defaultProperties = lzma.Properties{LC: 3, LP: 0, PB: 2}
+
+// basePreset returns the preset selected by the options including the
+// values given by --lzma2.
+func basePreset(opts *options) preset {
+	p := presets[opts.preset]
+	if opts.lzma2.dictCap > 0 {
+		p.dictCap = opts.lzma2.dictCap
+	}
+	if opts.lzma2.matcher != nil {
+		p.matcher = *opts.lzma2.matcher
+	}
+	return p
+}
+
+// properties returns the LZMA properties selected by the options.
+func properties(opts *options) lzma.Properties {
+	if opts.lzma2.props != nil {
+		return *opts.lzma2.props
+	}
+	return defaultProperties
+}
+
+// presetFor returns the preset selected by the options. The extreme
+// flag selects a deeper match search as the extreme presets of xz do;
+// it compresses slightly better but slower. A dictionary capacity
+// reduced by the memory limit replaces the capacity of the preset.
+func presetFor(opts *options) preset {
+	p := basePreset(opts)
+	if opts.dictCap > 0 {
+		p.dictCap = opts.dictCap
+	}
+	if opts.extreme {
+		p.depth = xz.ExtremeDepth
+	}
+	props := properties(opts)
+	depth := p.depth
+	if depth == 0 {
+		depth = lzma.DefaultDepth
+	}
+	xlog.Debugf("preset %d extreme %t: LC %d LP %d PB %d dict cap %d "+
+		"matcher %s depth %d buffer size %d", opts.preset,
+		opts.extreme, props.LC, props.LP, props.PB, p.dictCap,
+		p.matcher, depth, p.bufSize)
+	return p
+}
+
+// xzWriterConfig returns the xz writer configuration for the options.
+func xzWriterConfig(opts *options) xz.WriterConfig {
+	p := presetFor(opts)
+	props := properties(opts)
+	return xz.WriterConfig{
+		Properties: &props,
+		DictCap:    p.dictCap,
+		BufSize:    p.bufSize,
+		BlockSize:  opts.blockSize,
+		BlockList:  opts.blockList,
+		Matcher:    p.matcher,
+		Depth:      p.depth,
+		Workers:    threads(opts),
+		Logger:     debugLogger{},
+	}
+}
+
+// debugLogger passes the debug messages of the xz package to the debug
+// output of xlog.
+type debugLogger struct{}
+
+// Printf writes a debug message.
+func (debugLogger) Printf(format string, v ...interface{}) {
+	xlog.Debugf(format, v...)
+}
+
+// threads returns the number of go routines used for the compression
+// of xz blocks. The value 0 requests one go routine per CPU.
+func threads(opts *options) int {
+	if opts.threads == 0 {
+		return runtime.NumCPU()
+	}
+	return opts.threads
+}
+
+// lzmaWriterConfig returns the configuration for the classic LZMA
+// writer.
+func lzmaWriterConfig(opts *options) lzma.WriterConfig {
+	p := presetFor(opts)
+	props := properties(opts)
+	return lzma.WriterConfig{
+		Properties: &props,
+		DictCap:    p.dictCap,
+		BufSize:    p.bufSize,
+		Matcher:    p.matcher,
+		Depth:      p.depth,
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/internal/xlog"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+func TestPresetExtreme(t *testing.T) {
+	var buf bytes.Buffer
+	flags := xlog.Flags()
+	xlog.SetOutput(&buf)
+	xlog.SetFlags(0)
+	defer func() {
+		xlog.SetOutput(os.Stderr)
+		xlog.SetFlags(flags)
+	}()
+
+	opts := options{preset: 6}
+	if p := presetFor(&opts); p.depth != 0 {
+		t.Fatalf("preset 6 has depth %d; want 0", p.depth)
+	}
+	want := fmt.Sprintf("depth %d buffer size 4096", lzma.DefaultDepth)
+	if !strings.Contains(buf.String(), "extreme false") ||
+		!strings.Contains(buf.String(), want) {
+		t.Fatalf("unexpected parameter output %q", buf.String())
+	}
+
+	buf.Reset()
+	opts.extreme = true
+	if c := xzWriterConfig(&opts); c.Depth != xz.ExtremeDepth {
+		t.Fatalf("xz writer config for -6e has depth %d; want %d",
+			c.Depth, xz.ExtremeDepth)
+	}
+	if c := lzmaWriterConfig(&opts); c.Depth != xz.ExtremeDepth {
+		t.Fatalf("lzma writer config for -6e has depth %d; want %d",
+			c.Depth, xz.ExtremeDepth)
+	}
+	if !strings.Contains(buf.String(), "preset 6 extreme true") ||
+		!strings.Contains(buf.String(), "depth 256 ") {
+		t.Fatalf("unexpected parameter output %q", buf.String())
+	}
+
+	opts = options{lzma2Arg: "preset=3e"}
+	if err := parseLZMA2Options(&opts); err != nil {
+		t.Fatalf("parseLZMA2Options error %s", err)
+	}
+	if !opts.extreme || opts.preset != 3 {
+		t.Fatalf("--lzma2=preset=3e sets preset %d extreme %t",
+			opts.preset, opts.extreme)
+	}
+}
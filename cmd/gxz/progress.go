@@ -0,0 +1,214 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ulikunitz/xz/internal/term"
+)
+
+// byteCounter counts bytes. It may be read while it is updated by
+// another go routine.
+type byteCounter struct {
+	n int64
+}
+
+// add adds n to the counter.
+func (c *byteCounter) add(n int) { atomic.AddInt64(&c.n, int64(n)) }
+
+// value returns the current value of the counter.
+func (c *byteCounter) value() int64 { return atomic.LoadInt64(&c.n) }
+
+// countingReader counts the bytes read from the underlying reader.
+type countingReader struct {
+	r io.Reader
+	c *byteCounter
+}
+
+// Read reads from the underlying reader and counts the bytes.
+func (cr *countingReader) Read(p []byte) (n int, err error) {
+	n, err = cr.r.Read(p)
+	cr.c.add(n)
+	return n, err
+}
+
+// countingWriter counts the bytes written to the underlying writer.
+type countingWriter struct {
+	w io.Writer
+	c *byteCounter
+}
+
+// Write writes to the underlying writer and counts the bytes.
+func (cw *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = cw.w.Write(p)
+	cw.c.add(n)
+	return n, err
+}
+
+// progressInterval is the time between two updates of the progress
+// line.
+const progressInterval = time.Second
+
+// progress reports the progress of the processing of a single file on
+// standard error. The live progress line is only shown if standard
+// error is a terminal and files are not processed in parallel.
+type progress struct {
+	name       string
+	size       int64
+	decompress bool
+	robot      bool
+	in, out    *byteCounter
+	start      time.Time
+
+	live    bool
+	quit    chan struct{}
+	wg      sync.WaitGroup
+	stopped bool
+}
+
+// startProgress starts the progress reporting for a file. The counters
+// count the bytes read from the input file and written to the output
+// file. The function returns nil if the options don't request verbose
+// output.
+func startProgress(path string, fi os.FileInfo, in, out *byteCounter,
+	opts *options) *progress {
+
+	if opts.verbose < 1 || opts.quiet > 0 {
+		return nil
+	}
+	p := &progress{
+		name:       path,
+		size:       -1,
+		decompress: opts.decompress,
+		robot:      opts.robot,
+		in:         in,
+		out:        out,
+		start:      time.Now(),
+		live: opts.workers <= 1 && !opts.robot &&
+			term.IsTerminal(os.Stderr.Fd()),
+	}
+	if path == "-" {
+		p.name = "(stdin)"
+	}
+	if fi != nil {
+		p.size = fi.Size()
+	}
+	if p.live {
+		fmt.Fprintf(os.Stderr, "%s\n", p.name)
+		p.quit = make(chan struct{})
+		p.wg.Add(1)
+		go p.run()
+	}
+	return p
+}
+
+// run updates the progress line until the progress is stopped.
+func (p *progress) run() {
+	defer p.wg.Done()
+	t := time.NewTicker(progressInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-p.quit:
+			return
+		case <-t.C:
+			fmt.Fprintf(os.Stderr, "\r%s", p.line(true))
+		}
+	}
+}
+
+// stop stops the live progress line and clears it.
+func (p *progress) stop() {
+	if p == nil || p.stopped {
+		return
+	}
+	p.stopped = true
+	if !p.live {
+		return
+	}
+	close(p.quit)
+	p.wg.Wait()
+	fmt.Fprintf(os.Stderr, "\r%s\r", strings.Repeat(" ", 79))
+}
+
+// done stops the progress and prints the summary for the file.
+func (p *progress) done() {
+	if p == nil {
+		return
+	}
+	p.stop()
+	if p.robot {
+		fmt.Fprintf(os.Stderr, "%s\n", p.robotLine())
+		return
+	}
+	if !p.live {
+		fmt.Fprintf(os.Stderr, "%s\n", p.name)
+	}
+	fmt.Fprintf(os.Stderr, "%s\n", p.line(false))
+}
+
+// line returns the progress line. The argument eta requests the live
+// line including the estimated remaining time; otherwise the summary
+// line is returned. The percentage and the remaining time can only be
+// computed if the input size is known.
+func (p *progress) line(eta bool) string {
+	in, out := p.in.value(), p.out.value()
+	compressed, uncompressed := out, in
+	if p.decompress {
+		compressed, uncompressed = in, out
+	}
+	pct := "100 %"
+	if eta {
+		pct = "--- %"
+		if p.size > 0 {
+			pct = fmt.Sprintf("%.1f %%",
+				100*float64(in)/float64(p.size))
+		}
+	}
+	elapsed := time.Since(p.start)
+	var rate int64
+	if s := elapsed.Seconds(); s > 0 {
+		rate = int64(float64(in) / s)
+	}
+	line := fmt.Sprintf("  %7s %10s / %10s = %s %12s %7s", pct,
+		sizeString(compressed), sizeString(uncompressed),
+		ratioString(compressed, uncompressed),
+		sizeString(rate)+"/s", durationString(elapsed))
+	if eta && p.size > 0 && rate > 0 && in <= p.size {
+		remaining := time.Duration((p.size - in) / rate * int64(time.Second))
+		line += " ETA " + durationString(remaining)
+	}
+	return line
+}
+
+// robotLine returns the tab-separated summary line for the robot mode.
+// The columns are the file name, the compressed size, the uncompressed
+// size, the ratio and the elapsed time in seconds.
+func (p *progress) robotLine() string {
+	compressed, uncompressed := p.out.value(), p.in.value()
+	if p.decompress {
+		compressed, uncompressed = uncompressed, compressed
+	}
+	return fmt.Sprintf("file\t%s\t%d\t%d\t%s\t%.3f", p.name,
+		compressed, uncompressed,
+		ratioString(compressed, uncompressed),
+		time.Since(p.start).Seconds())
+}
+
+// durationString formats the duration as h:mm:ss or m:ss.
+func durationString(d time.Duration) string {
+	s := int64(d / time.Second)
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
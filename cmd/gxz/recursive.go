@@ -0,0 +1,128 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// compressedSuffixes returns the file name suffixes of compressed files
+// for the format given in the options including the suffix provided by
+// --suffix.
+func compressedSuffixes(opts *options) []string {
+	var suffixes []string
+	switch opts.format {
+	case "xz":
+		suffixes = []string{".xz", ".txz"}
+	case "lzma":
+		suffixes = []string{".lzma", ".tlz"}
+	default:
+		suffixes = []string{".xz", ".txz", ".lzma", ".tlz"}
+	}
+	if opts.suffix != "" {
+		suffixes = append(suffixes, opts.suffix)
+	}
+	return suffixes
+}
+
+// selectFile checks whether a file found while walking a directory
+// tree should be processed. For decompression only files with the
+// suffixes of compressed files are selected; for compression only files
+// without those suffixes.
+func selectFile(path string, opts *options) bool {
+	for _, s := range compressedSuffixes(opts) {
+		if strings.HasSuffix(path, s) {
+			return opts.decompress
+		}
+	}
+	return !opts.decompress
+}
+
+// walkArgs replaces all directories in args by the regular files
+// contained in the directory trees. Errors are returned in the order
+// they have been encountered.
+func walkArgs(args []string, opts *options) (files []string, errs []error) {
+	for _, arg := range args {
+		if arg == "-" {
+			files = append(files, arg)
+			continue
+		}
+		fi, err := os.Lstat(arg)
+		if err != nil || !fi.IsDir() {
+			// processFile reports the error
+			files = append(files, arg)
+			continue
+		}
+		filepath.Walk(arg, func(path string, fi os.FileInfo,
+			err error) error {
+			if err != nil {
+				errs = append(errs, userError(err))
+				return nil
+			}
+			if fi.Mode().IsRegular() && selectFile(path, opts) {
+				files = append(files, path)
+			}
+			return nil
+		})
+	}
+	return files, errs
+}
+
+// processFiles processes all files using the given number of go
+// routines. Each file uses its own copy of the options, because the
+// format field might be changed. The errors are reported in the order
+// of the files.
+func processFiles(files []string, opts *options, workers int,
+	process func(path string, opts *options) error) {
+
+	if workers < 1 {
+		workers = 1
+	}
+	errs := make([]error, len(files))
+	done := make([]chan struct{}, len(files))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+
+	var wg sync.WaitGroup
+	next := make(chan int)
+	for k := 0; k < workers; k++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				o := *opts
+				err := process(files[i], &o)
+				errs[i] = memLimitErr(files[i], &o, err)
+				close(done[i])
+			}
+		}()
+	}
+	go func() {
+		for i := range files {
+			next <- i
+		}
+		close(next)
+	}()
+
+	for i := range files {
+		<-done[i]
+		printErr(errs[i])
+	}
+	wg.Wait()
+}
+
+// fileWorkers returns the number of files that are processed in
+// parallel. Output to standard output requires sequential processing.
+func fileWorkers(opts *options) int {
+	if !opts.recursive || opts.stdout {
+		return 1
+	}
+	return runtime.NumCPU()
+}
@@ -0,0 +1,208 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"path"
+	"strings"
+
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/internal/randtxt"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// vectorFS contains the test vectors for --self-test. The file
+// testdata/README.md describes how they have been created.
+//
+//go:embed testdata/*.xz testdata/*.lzma
+var vectorFS embed.FS
+
+// Checksums of the uncompressed data of the test vectors.
+const (
+	sumEmpty = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	sumHello = "8e5935e7e13368cd9688fe8f48a0955293676a021562582c7e848dafe13fb046"
+	sumMixed = "39a6b1eef8c5fd8a7645f7f3ddb60578a075a5b49e0ee1f792badb590cd39788"
+)
+
+// testVector describes a compressed file and the SHA-256 checksum of
+// its uncompressed content.
+type testVector struct {
+	name string
+	size int64
+	sum  string
+}
+
+var testVectors = []testVector{
+	{"good-0-empty.xz", 0, sumEmpty},
+	{"good-0pad-empty.xz", 0, sumEmpty},
+	{"good-0cat-empty.xz", 0, sumEmpty},
+	{"good-1-check-crc32.xz", 13, sumHello},
+	{"good-1-check-crc64.xz", 13, sumHello},
+	{"good-1-check-sha256.xz", 13, sumHello},
+	{"good-1-block_header-sizes.xz", 13, sumHello},
+	{"good-2-blocks.xz", 13, sumHello},
+	{"good-1-lzma2-lc0-lp4.xz", 13, sumHello},
+	{"good-1-lzma2-lc4-pb4.xz", 13, sumHello},
+	{"good-1-lzma2-mixed-chunks.xz", 140000, sumMixed},
+	{"good-hello.lzma", 13, sumHello},
+	{"good-mixed.lzma", 140000, sumMixed},
+}
+
+// newVectorReader returns the decompressing reader for the test vector
+// data. The format is given by the file extension.
+func newVectorReader(name string, r io.Reader) (io.Reader, error) {
+	if strings.HasSuffix(name, ".lzma") {
+		return lzma.NewReader(r)
+	}
+	return xz.NewReader(r)
+}
+
+// checkVector decompresses the test vector and compares size and
+// checksum of the uncompressed data.
+func checkVector(v testVector) error {
+	data, err := vectorFS.ReadFile(path.Join("testdata", v.name))
+	if err != nil {
+		return err
+	}
+	r, err := newVectorReader(v.name, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return err
+	}
+	if n != v.size {
+		return fmt.Errorf("got %d bytes; want %d", n, v.size)
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != v.sum {
+		return fmt.Errorf("checksum mismatch")
+	}
+	return nil
+}
+
+// roundTrip describes the compression and decompression of data.
+type roundTrip struct {
+	name     string
+	format   string
+	preset   int
+	threads  int
+	compress func(w io.Writer, opts *options) (io.WriteCloser, error)
+}
+
+// newXZWriter creates a writer for the xz format. Small blocks are used
+// for multiple threads to test the parallel compression.
+func newXZWriter(w io.Writer, opts *options) (io.WriteCloser, error) {
+	cfg := xzWriterConfig(opts)
+	if opts.threads > 1 {
+		cfg.BlockSize = 1 << 16
+	}
+	return newXZCompressor(w, cfg)
+}
+
+// newLZMAWriter creates a writer for the lzma format.
+func newLZMAWriter(w io.Writer, opts *options) (io.WriteCloser, error) {
+	return newLZMACompressor(w, lzmaWriterConfig(opts))
+}
+
+var roundTrips = []roundTrip{
+	{"xz -0", "xz", 0, 1, newXZWriter},
+	{"xz -6", "xz", 6, 1, newXZWriter},
+	{"xz -9", "xz", 9, 1, newXZWriter},
+	{"xz -6 -T4", "xz", 6, 4, newXZWriter},
+	{"lzma -0", "lzma", 0, 1, newLZMAWriter},
+	{"lzma -6", "lzma", 6, 1, newLZMAWriter},
+}
+
+// selfTestData returns the data used for the round trips.
+func selfTestData() (names []string, data [][]byte, err error) {
+	hello := []byte("Hello\nWorld!\n")
+
+	var txt bytes.Buffer
+	if _, err = io.CopyN(&txt, randtxt.NewReader(rand.NewSource(42)),
+		200000); err != nil {
+		return nil, nil, err
+	}
+
+	random := make([]byte, 100000)
+	rand.New(rand.NewSource(43)).Read(random)
+
+	names = []string{"empty", "hello", "text", "random"}
+	data = [][]byte{nil, hello, txt.Bytes(), random}
+	return names, data, nil
+}
+
+// checkRoundTrip compresses and decompresses the data.
+func checkRoundTrip(rt roundTrip, data []byte) error {
+	opts := options{preset: rt.preset, threads: rt.threads}
+	var buf bytes.Buffer
+	w, err := rt.compress(&buf, &opts)
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(data); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	r, err := newVectorReader("."+rt.format, &buf)
+	if err != nil {
+		return err
+	}
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(out, data) {
+		return fmt.Errorf("decompressed data differs")
+	}
+	return nil
+}
+
+// selfTest checks the embedded test vectors and compresses and
+// decompresses test data with multiple presets and both formats. It
+// prints PASS or FAIL for every test and reports failures as errors.
+func selfTest() {
+	var tests, failed int
+	report := func(name string, err error) {
+		tests++
+		if err != nil {
+			failed++
+			fmt.Printf("FAIL %s\n", name)
+			printErr(fmt.Errorf("self-test %s: %s", name, err))
+			return
+		}
+		fmt.Printf("PASS %s\n", name)
+	}
+
+	for _, v := range testVectors {
+		report("decode "+v.name, checkVector(v))
+	}
+
+	names, data, err := selfTestData()
+	if err != nil {
+		printErr(err)
+		return
+	}
+	for _, rt := range roundTrips {
+		for i, d := range data {
+			name := fmt.Sprintf("round trip %s %s", rt.name,
+				names[i])
+			report(name, checkRoundTrip(rt, d))
+		}
+	}
+
+	fmt.Printf("%d of %d tests passed\n", tests-failed, tests)
+}
@@ -0,0 +1,60 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// sizeUnits maps the suffixes accepted for sizes to their multipliers.
+// As in xz all units are binary units.
+var sizeUnits = []struct {
+	suffixes []string
+	shift    uint
+}{
+	{[]string{"kib", "ki", "kb", "k"}, 10},
+	{[]string{"mib", "mi", "mb", "m"}, 20},
+	{[]string{"gib", "gi", "gb", "g"}, 30},
+}
+
+// parseSize parses a byte count that may be followed by one of the
+// suffixes KiB, MiB or GiB.
+func parseSize(s string) (n int64, err error) {
+	t := strings.ToLower(strings.TrimSpace(s))
+	var shift uint
+loop:
+	for _, u := range sizeUnits {
+		for _, suffix := range u.suffixes {
+			if strings.HasSuffix(t, suffix) {
+				t = strings.TrimSuffix(t, suffix)
+				shift = u.shift
+				break loop
+			}
+		}
+	}
+	n, err = strconv.ParseInt(t, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%q is not a valid size", s)
+	}
+	if n > math.MaxInt64>>shift {
+		return 0, fmt.Errorf("size %q is too large", s)
+	}
+	return n << shift, nil
+}
+
+// parseSizeList parses a comma-separated list of sizes.
+func parseSizeList(s string) (sizes []int64, err error) {
+	for _, f := range strings.Split(s, ",") {
+		n, err := parseSize(f)
+		if err != nil {
+			return nil, err
+		}
+		sizes = append(sizes, n)
+	}
+	return sizes, nil
+}
@@ -0,0 +1,120 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io"
+	"os"
+)
+
+// sparseBlockSize is the size of the blocks that are checked for zeros.
+// It matches the block size of most file systems.
+const sparseBlockSize = 4096
+
+// sparseWriter writes data to a file. Blocks consisting only of zeros
+// are not written, but skipped by seeking. On file systems supporting
+// them holes will be created in the file. This saves disk space for
+// images of virtual machines. The file must be empty, so that the
+// blocks checked for zeros are aligned with the blocks of the file
+// system. The data of an incomplete block is kept until the block is
+// complete, so the alignment doesn't depend on the sizes of the writes.
+type sparseWriter struct {
+	f *os.File
+	// data of the current block that hasn't been written yet
+	block []byte
+	// number of zeros that have not been written yet
+	skip int64
+}
+
+// allZeros checks whether the slice contains only zero bytes.
+func allZeros(p []byte) bool {
+	for _, c := range p {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Write writes the data into the file skipping blocks of zeros.
+func (w *sparseWriter) Write(p []byte) (n int, err error) {
+	for n < len(p) {
+		q := p[n:]
+		if len(w.block) == 0 && len(q) >= sparseBlockSize {
+			// the block can be taken directly from p
+			if err = w.writeBlock(q[:sparseBlockSize]); err != nil {
+				return n, err
+			}
+			n += sparseBlockSize
+			continue
+		}
+		if w.block == nil {
+			w.block = make([]byte, 0, sparseBlockSize)
+		}
+		k := sparseBlockSize - len(w.block)
+		if len(q) > k {
+			q = q[:k]
+		}
+		w.block = append(w.block, q...)
+		n += len(q)
+		if len(w.block) < sparseBlockSize {
+			break
+		}
+		err = w.writeBlock(w.block)
+		w.block = w.block[:0]
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// writeBlock writes a block to the file or skips it if it is a complete
+// block of zeros.
+func (w *sparseWriter) writeBlock(q []byte) error {
+	if len(q) == sparseBlockSize && allZeros(q) {
+		w.skip += sparseBlockSize
+		return nil
+	}
+	if err := w.seek(); err != nil {
+		return err
+	}
+	_, err := w.f.Write(q)
+	return err
+}
+
+// seek skips over the pending zeros.
+func (w *sparseWriter) seek() error {
+	if w.skip == 0 {
+		return nil
+	}
+	if _, err := w.f.Seek(w.skip, io.SeekCurrent); err != nil {
+		return err
+	}
+	w.skip = 0
+	return nil
+}
+
+// Close writes the incomplete last block and sets the size of the file,
+// if it ends with zeros that have been skipped. The file itself is not
+// closed.
+func (w *sparseWriter) Close() error {
+	if len(w.block) > 0 {
+		err := w.writeBlock(w.block)
+		w.block = w.block[:0]
+		if err != nil {
+			return err
+		}
+	}
+	if w.skip == 0 {
+		return nil
+	}
+	off, err := w.f.Seek(w.skip, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	w.skip = 0
+	return w.f.Truncate(off)
+}
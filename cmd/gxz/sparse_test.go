@@ -0,0 +1,67 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSparseWriter(t *testing.T) {
+	// blocks 1, 2 and 5 are zero, block 3 only in its second half
+	data := bytes.Repeat([]byte{'a'}, 6*sparseBlockSize+100)
+	for _, i := range []int{1, 2, 5} {
+		copy(data[i*sparseBlockSize:], make([]byte, sparseBlockSize))
+	}
+	copy(data[3*sparseBlockSize+sparseBlockSize/2:],
+		make([]byte, sparseBlockSize/2))
+
+	// the file is filled with 0xff, so skipped blocks are recognized
+	name := filepath.Join(t.TempDir(), "sparse")
+	fill := bytes.Repeat([]byte{0xff}, len(data))
+	if err := ioutil.WriteFile(name, fill, 0644); err != nil {
+		t.Fatalf("WriteFile error %s", err)
+	}
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("OpenFile error %s", err)
+	}
+	defer f.Close()
+
+	w := &sparseWriter{f: f}
+	sizes := []int{1, 1000, sparseBlockSize + 1, 3, 2 * sparseBlockSize}
+	for i, p := 0, data; len(p) > 0; i++ {
+		k := sizes[i%len(sizes)]
+		if k > len(p) {
+			k = len(p)
+		}
+		n, err := w.Write(p[:k])
+		if err != nil {
+			t.Fatalf("Write error %s", err)
+		}
+		if n != k {
+			t.Fatalf("Write returned %d; want %d", n, k)
+		}
+		p = p[k:]
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("Close error %s", err)
+	}
+
+	got, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatalf("ReadFile error %s", err)
+	}
+	want := append([]byte(nil), data...)
+	for _, i := range []int{1, 2, 5} {
+		copy(want[i*sparseBlockSize:], fill[:sparseBlockSize])
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("file content differs from expected content")
+	}
+}
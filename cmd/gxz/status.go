@@ -0,0 +1,81 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/ulikunitz/xz/internal/xlog"
+)
+
+// The exit status follows the xz tool. The status 2 is returned if
+// only warnings have been reported.
+const (
+	exitSuccess = 0
+	exitError   = 1
+	exitWarning = 2
+)
+
+// warning marks errors that are reported as warnings. For instance
+// files that are skipped are warnings.
+type warning struct {
+	error
+}
+
+// Unwrap returns the error marked as warning.
+func (w warning) Unwrap() error { return w.error }
+
+// isWarning checks whether the error has been marked as warning.
+func isWarning(err error) bool {
+	var w warning
+	return errors.As(err, &w)
+}
+
+// status records whether errors or warnings have been reported.
+var status struct {
+	sync.Mutex
+	errors   bool
+	warnings bool
+}
+
+// printErr reports the error or warning and records it for the exit
+// status. Warnings are suppressed by -q, errors by -qq.
+func printErr(err error) {
+	if err == nil {
+		return
+	}
+	status.Lock()
+	defer status.Unlock()
+	if isWarning(err) {
+		status.warnings = true
+		xlog.Warn(userError(err))
+		return
+	}
+	status.errors = true
+	xlog.Error(userError(err))
+}
+
+// warn reports a warning that is not related to a file.
+func warn(v ...interface{}) {
+	status.Lock()
+	defer status.Unlock()
+	status.warnings = true
+	xlog.Warn(v...)
+}
+
+// exitStatus returns the exit status for the errors and warnings
+// reported. The flag --no-warn prevents the warning status.
+func exitStatus(opts *options) int {
+	status.Lock()
+	defer status.Unlock()
+	switch {
+	case status.errors:
+		return exitError
+	case status.warnings && !opts.noWarn:
+		return exitWarning
+	}
+	return exitSuccess
+}
@@ -0,0 +1,199 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Command xzinfo prints the container structure of xz files: the
+// stream headers, the block headers with their filters and properties,
+// the index records and the stream footers. The data of the blocks is
+// not decompressed. The command helps to investigate interoperability
+// problems with other xz implementations.
+//
+// Usage:
+//
+//	xzinfo file...
+//
+// The file - is read from standard input.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/ulikunitz/xz"
+)
+
+const usage = `usage: xzinfo file...
+
+xzinfo prints the stream headers, block headers, filters, index records
+and stream footers of xz files. The file - is read from standard input.
+
+Report bugs using <https://github.com/ulikunitz/xz/issues>.
+`
+
+// checkNames maps the check methods to their names.
+var checkNames = map[byte]string{
+	0x0:       "None",
+	xz.CRC32:  "CRC32",
+	xz.CRC64:  "CRC64",
+	xz.SHA256: "SHA-256",
+}
+
+// checkName returns the name for the check method.
+func checkName(c byte) string {
+	s, ok := checkNames[c]
+	if !ok {
+		return fmt.Sprintf("Unknown-%d", c)
+	}
+	return s
+}
+
+// sizeField returns the size stored in a block header or a dash if the
+// size isn't stored.
+func sizeField(n int64) string {
+	if n < 0 {
+		return "-"
+	}
+	return fmt.Sprint(n)
+}
+
+// file provides the content of an xz file.
+type file interface {
+	io.ReaderAt
+	io.Closer
+}
+
+// bytesFile adds a Close method to bytes.Reader.
+type bytesFile struct {
+	*bytes.Reader
+}
+
+// Close does nothing.
+func (bytesFile) Close() error { return nil }
+
+// openFile opens the file and returns its size. Standard input is read
+// into memory, because the index is read from the end of the file.
+func openFile(path string) (f file, size int64, err error) {
+	if path == "-" {
+		data, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, 0, err
+		}
+		return bytesFile{bytes.NewReader(data)}, int64(len(data)), nil
+	}
+	g, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	fi, err := g.Stat()
+	if err != nil {
+		g.Close()
+		return nil, 0, err
+	}
+	return g, fi.Size(), nil
+}
+
+// readAt reads n bytes at the given offset.
+func readAt(r io.ReaderAt, off int64, n int) ([]byte, error) {
+	p := make([]byte, n)
+	if _, err := r.ReadAt(p, off); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// printFile prints the structure of the xz file at path.
+func printFile(w io.Writer, path string) error {
+	f, size, err := openFile(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	streams, err := xz.ReadStreamInfo(f, size)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	fmt.Fprintf(w, "%s: size %d, streams %d\n", path, size,
+		len(streams))
+	for i, s := range streams {
+		if err = printStream(w, f, i, &s); err != nil {
+			return fmt.Errorf("%s: stream %d: %w", path, i+1, err)
+		}
+	}
+	return nil
+}
+
+// printStream prints the structure of a single stream.
+func printStream(w io.Writer, f io.ReaderAt, i int, s *xz.StreamInfo) error {
+	const footerLen = 12
+	fmt.Fprintf(w, "stream %d\n", i+1)
+	fmt.Fprintf(w, "  offset %d, size %d, uncompressed offset %d, "+
+		"uncompressed size %d\n", s.Offset, s.Size,
+		s.UncompressedOffset, s.UncompressedSize)
+	p, err := readAt(f, s.Offset, xz.HeaderLen)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "  header: stream flags % x, check %s\n", p[6:8],
+		checkName(s.CheckSum))
+	for j, b := range s.Blocks {
+		h, err := xz.ReadBlockHeader(f, b.Offset)
+		if err != nil {
+			return fmt.Errorf("block %d: %w", j+1, err)
+		}
+		fmt.Fprintf(w, "  block %d\n", j+1)
+		fmt.Fprintf(w, "    offset %d, uncompressed offset %d\n",
+			b.Offset, b.UncompressedOffset)
+		fmt.Fprintf(w, "    header: size %d, compressed size %s, "+
+			"uncompressed size %s\n", h.Size,
+			sizeField(h.CompressedSize),
+			sizeField(h.UncompressedSize))
+		for k, fi := range h.Filters {
+			fmt.Fprintf(w, "    filter %d: id %#x, props [% x], %s\n",
+				k+1, fi.ID, fi.Props, fi)
+		}
+		fmt.Fprintf(w, "    index record: unpadded size %d, "+
+			"uncompressed size %d, total size %d\n",
+			b.UnpaddedSize, b.UncompressedSize, b.TotalSize())
+	}
+	footer := s.Offset + s.Size - footerLen
+	fmt.Fprintf(w, "  index: offset %d, size %d, records %d\n",
+		footer-s.IndexSize, s.IndexSize, len(s.Blocks))
+	if p, err = readAt(f, footer, footerLen); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "  footer: offset %d, backward size %d, "+
+		"stream flags % x\n", footer, s.IndexSize, p[8:10])
+	if s.Padding > 0 {
+		fmt.Fprintf(w, "  padding: %d bytes\n", s.Padding)
+	}
+	return nil
+}
+
+func main() {
+	log.SetPrefix("xzinfo: ")
+	log.SetFlags(0)
+
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	status := 0
+	for i, path := range flag.Args() {
+		if i > 0 {
+			fmt.Println()
+		}
+		if err := printFile(os.Stdout, path); err != nil {
+			log.Print(err)
+			status = 1
+		}
+	}
+	os.Exit(status)
+}
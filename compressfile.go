@@ -0,0 +1,40 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package xz
+
+import (
+	"io"
+	"os"
+)
+
+// CompressFile compresses the file src into the xz file dst using the
+// default parameters changed by the options. The data is written to a
+// temporary file in the directory of dst, which is synced to disk and
+// renamed to dst, so that dst is never left partially written. The
+// permissions and the modification time of src are preserved; the
+// ownership is not changed. The source file is not removed. A dst
+// equal to src is replaced only after the compression succeeded.
+func CompressFile(dst, src string, opts ...Option) error {
+	c, err := writerConfig(opts)
+	if err != nil {
+		return err
+	}
+	if err = c.Verify(); err != nil {
+		return err
+	}
+	return replaceFile(dst, src, func(w io.Writer, f *os.File) error {
+		xw, err := c.NewWriter(w)
+		if err != nil {
+			return err
+		}
+		if _, err = io.Copy(xw, f); err != nil {
+			return err
+		}
+		return xw.Close()
+	})
+}
@@ -0,0 +1,91 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package xz
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/ulikunitz/xz/internal/randtxt"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// roundTrip compresses and decompresses txt with the given
+// configurations.
+func roundTrip(wc WriterConfig, rc ReaderConfig, txt []byte) error {
+	var buf bytes.Buffer
+	w, err := wc.NewWriter(&buf)
+	if err != nil {
+		return fmt.Errorf("NewWriter error %s", err)
+	}
+	if _, err = w.Write(txt); err != nil {
+		return fmt.Errorf("Write error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		return fmt.Errorf("Close error %s", err)
+	}
+	r, err := rc.NewReader(&buf)
+	if err != nil {
+		return fmt.Errorf("NewReader error %s", err)
+	}
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("ReadAll error %s", err)
+	}
+	if !bytes.Equal(out, txt) {
+		return fmt.Errorf("decompressed data differs from original")
+	}
+	return nil
+}
+
+// TestConcurrentReadersWriters runs many readers and writers in
+// parallel. It is most useful with the race detector enabled by the
+// -race flag. The configurations are shared by the goroutines.
+func TestConcurrentReadersWriters(t *testing.T) {
+	const txtlen = 1 << 17
+	var buf bytes.Buffer
+	io.CopyN(&buf, randtxt.NewReader(rand.NewSource(43)), txtlen)
+	txt := buf.Bytes()
+
+	props := &lzma.Properties{LC: 3, LP: 0, PB: 2}
+	writerConfigs := []WriterConfig{
+		{Properties: props, DictCap: 1 << 16},
+		{Properties: props, BlockSize: 1 << 15, CheckSum: SHA256},
+		{Properties: props, Workers: 3, BlockSize: 1 << 14},
+		{Properties: props, Matcher: lzma.BinaryTree, CheckSum: CRC32},
+	}
+	readerConfigs := []ReaderConfig{
+		{},
+		{Strict: true},
+		{Recover: true},
+		{SingleStream: true, MaxInputPerOutput: 4},
+	}
+	const n = 16
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			wc := writerConfigs[i%len(writerConfigs)]
+			rc := readerConfigs[(i/len(writerConfigs))%
+				len(readerConfigs)]
+			if err := roundTrip(wc, rc, txt); err != nil {
+				t.Errorf("goroutine %d: %s", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if *props != (lzma.Properties{LC: 3, LP: 0, PB: 2}) {
+		t.Fatalf("shared properties modified to %v", props)
+	}
+}
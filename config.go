@@ -0,0 +1,46 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// sizeString formats a byte count using the largest binary unit that
+// represents it with at most two decimals, e.g. "1.5 GiB". Other values
+// are given in bytes.
+func sizeString(n int64) string {
+	units := []struct {
+		size int64
+		name string
+	}{
+		{1 << 30, "GiB"},
+		{1 << 20, "MiB"},
+		{1 << 10, "KiB"},
+	}
+	for _, u := range units {
+		if n < u.size || (n%u.size)*100%u.size != 0 {
+			continue
+		}
+		v := float64(n) / float64(u.size)
+		return strconv.FormatFloat(v, 'f', -1, 64) + " " + u.name
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
+
+// joinErrors combines the errors found by the verification of a
+// configuration. A single error is returned unchanged, so that it can
+// still be compared directly.
+func joinErrors(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,31 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import "testing"
+
+func TestSizeString(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 bytes"},
+		{3, "3 bytes"},
+		{4096, "4 KiB"},
+		{1500, "1500 bytes"},
+		{3 << 20, "3 MiB"},
+		{3 << 29, "1.5 GiB"},
+		{5 << 28, "1.25 GiB"},
+		{1<<32 - 1, "4294967295 bytes"},
+		{-1024, "-1024 bytes"},
+		{1<<63 - 1, "9223372036854775807 bytes"},
+	}
+	for _, tc := range tests {
+		if s := sizeString(tc.n); s != tc.want {
+			t.Errorf("sizeString(%d) = %q; want %q", tc.n, s,
+				tc.want)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The conformance tests use the files in the testdata directory. See
+// testdata/README.md for their origin.
+
+// SHA-256 sums of the uncompressed content of the good files
+const (
+	sumEmpty = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	// sumHello is the sum of "Hello\nWorld!\n".
+	sumHello = "8e5935e7e13368cd9688fe8f48a0955293676a021562582c7e848dafe13fb046"
+	sumMixed = "39a6b1eef8c5fd8a7645f7f3ddb60578a075a5b49e0ee1f792badb590cd39788"
+	// sumChunks2 and sumChunks3 are the sums of the texts with two
+	// and three chunks of the good-1-lzma2-* files.
+	sumChunks2 = "f0574fcdbe901d468195efe6cac0cb60db7e1e7daf67354518fa60f513dcfdc4"
+	sumChunks3 = "f16cd3a903e408c86cd0f55cb996038265ff14a7b6d9742d622687cf9716a28e"
+)
+
+// goodFiles maps the good test files to the SHA-256 sums of their
+// uncompressed content.
+var goodFiles = map[string]string{
+	"good-0-empty.xz":              sumEmpty,
+	"good-0pad-empty.xz":           sumEmpty,
+	"good-0cat-empty.xz":           sumEmpty,
+	"good-1-check-none.xz":         sumHello,
+	"good-1-check-crc32.xz":        sumHello,
+	"good-1-check-crc64.xz":        sumHello,
+	"good-1-check-sha256.xz":       sumHello,
+	"good-1-block_header-sizes.xz": sumHello,
+	"good-2-blocks.xz":             sumHello,
+	"good-1-lzma2-lc0-lp4.xz":      sumHello,
+	"good-1-lzma2-lc4-pb4.xz":      sumHello,
+	"good-1-extreme.xz":            sumHello,
+	"good-1-lzma2-mixed-chunks.xz": sumMixed,
+	"good-1-lzma2-1.xz":            sumChunks2,
+	"good-1-lzma2-2.xz":            sumChunks2,
+	"good-1-lzma2-3.xz":            sumChunks2,
+	"good-1-lzma2-4.xz":            sumChunks3,
+	"good-1-lzma2-5.xz":            sumEmpty,
+}
+
+// errorClasses lists the error classes. An error of the Go
+// implementation caused by invalid data must match exactly one of them.
+var errorClasses = []error{
+	io.ErrUnexpectedEOF,
+	ErrStreamHeader,
+	ErrStreamFlags,
+	ErrStreamFooter,
+	ErrBlockHeader,
+	ErrBlockPadding,
+	ErrChecksum,
+	ErrIndex,
+	ErrData,
+	ErrUnsupported,
+}
+
+// classes returns the error classes matched by err.
+func classes(err error) []error {
+	var c []error
+	for _, class := range errorClasses {
+		if errors.Is(err, class) {
+			c = append(c, class)
+		}
+	}
+	return c
+}
+
+// badFiles maps the files that must be rejected to the expected error
+// class. The good files requiring unsupported features are included.
+var badFiles = map[string]error{
+	"bad-0-header_magic.xz":                   ErrStreamHeader,
+	"bad-0-footer_magic.xz":                   ErrStreamFooter,
+	"bad-0-empty-truncated.xz":                io.ErrUnexpectedEOF,
+	"bad-0-nonempty_index.xz":                 ErrIndex,
+	"bad-0-backward_size.xz":                  ErrStreamFooter,
+	"bad-0-header_flags.xz":                   ErrStreamFlags,
+	"bad-0-footer_flags.xz":                   ErrStreamFlags,
+	"bad-0-header_crc.xz":                     ErrStreamHeader,
+	"bad-0-footer_crc.xz":                     ErrStreamFooter,
+	"bad-0cat-alone.xz":                       ErrStreamHeader,
+	"bad-0cat-header_magic.xz":                ErrStreamHeader,
+	"bad-0catpad-empty.xz":                    ErrStreamHeader,
+	"bad-0pad-empty.xz":                       io.ErrUnexpectedEOF,
+	"bad-1-stream_flags-footer.xz":            ErrStreamFlags,
+	"bad-1-block_header-crc.xz":               ErrBlockHeader,
+	"bad-1-block_header-flags.xz":             ErrBlockHeader,
+	"bad-1-block_header-compressed_size.xz":   ErrBlockHeader,
+	"bad-1-block_header-uncompressed_size.xz": ErrBlockHeader,
+	"bad-1-block_header-padding.xz":           ErrBlockHeader,
+	"bad-1-block_header-filter.xz":            ErrBlockHeader,
+	"bad-1-block_header-dict_size.xz":         ErrBlockHeader,
+	"bad-1-block-padding.xz":                  ErrBlockPadding,
+	"bad-1-check-crc32.xz":                    ErrChecksum,
+	"bad-1-check-crc64.xz":                    ErrChecksum,
+	"bad-1-check-sha256.xz":                   ErrChecksum,
+	"bad-1-lzma2-control.xz":                  ErrData,
+	"bad-1-lzma2-no_dict_reset.xz":            ErrData,
+	"bad-1-lzma2-lzma_no_dict_reset.xz":       ErrData,
+	"bad-1-lzma2-props.xz":                    ErrData,
+	"bad-1-lzma2-data.xz":                     ErrData,
+	"bad-1-index-unpadded_size.xz":            ErrIndex,
+	"bad-1-index-uncompressed_size.xz":        ErrIndex,
+	"bad-1-index-crc.xz":                      ErrIndex,
+	"bad-1-vli-nonminimal.xz":                 ErrIndex,
+	"bad-2-index-1.xz":                        ErrIndex,
+	"bad-2-index-2.xz":                        ErrIndex,
+	"bad-2-index-3.xz":                        ErrIndex,
+	"bad-2-index-4.xz":                        ErrIndex,
+	"bad-2-index-5.xz":                        ErrIndex,
+	"bad-3-index-uncomp-overflow.xz":          ErrIndex,
+	"good-1-delta-lzma2.xz":                   ErrUnsupported,
+	"good-1-x86-lzma2.xz":                     ErrUnsupported,
+	"good-1-arm64-lzma2.xz":                   ErrUnsupported,
+}
+
+// decodeFile decodes the given test file.
+func decodeFile(name string) ([]byte, error) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		return nil, err
+	}
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
+
+func TestConformanceGood(t *testing.T) {
+	for name, want := range goodFiles {
+		out, err := decodeFile(name)
+		if err != nil {
+			t.Errorf("%s: decode error %s", name, err)
+			continue
+		}
+		h := sha256.Sum256(out)
+		if got := hex.EncodeToString(h[:]); got != want {
+			t.Errorf("%s: unexpected uncompressed data", name)
+		}
+	}
+}
+
+// TestConformanceBad checks that the bad files are rejected with an
+// error of the expected class. The errors of the liblzma backend are
+// not classified and it supports the features not supported by the Go
+// implementation.
+func TestConformanceBad(t *testing.T) {
+	for name, want := range badFiles {
+		_, err := decodeFile(name)
+		if Backend != "go" && want == ErrUnsupported {
+			if err != nil {
+				t.Errorf("%s: decode error %s", name, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: no error", name)
+			continue
+		}
+		if Backend != "go" {
+			continue
+		}
+		c := classes(err)
+		if len(c) != 1 || c[0] != want {
+			t.Errorf("%s: error %q has classes %v; want %q",
+				name, err, c, want)
+		}
+		if corrupt := want != ErrUnsupported; errors.Is(err,
+			ErrCorrupt) != corrupt || errors.Is(err, ErrIO) {
+			t.Errorf("%s: error %q doesn't match ErrCorrupt %t",
+				name, err, corrupt)
+		}
+	}
+}
+
+// TestConformanceFiles makes sure that all test files are covered by
+// the tests.
+func TestConformanceFiles(t *testing.T) {
+	names, err := filepath.Glob(filepath.Join("testdata", "*.xz"))
+	if err != nil {
+		t.Fatalf("Glob error %s", err)
+	}
+	for _, name := range names {
+		name = filepath.Base(name)
+		_, good := goodFiles[name]
+		_, bad := badFiles[name]
+		if !good && !bad {
+			t.Errorf("test file %s not tested", name)
+		}
+		if good && strings.HasPrefix(name, "bad-") {
+			t.Errorf("bad file %s is listed as good", name)
+		}
+	}
+}
+
+// mutation describes the change of a valid file. The CRC-32 of the
+// bytes from crcStart to crcEnd is stored at crcAt, so that the reader
+// must detect the modified field itself. Negative offsets are relative
+// to the end of the file.
+type mutation struct {
+	name     string
+	file     string
+	offset   int
+	value    byte
+	crcAt    int
+	crcStart int
+	crcEnd   int
+}
+
+// apply returns a mutated copy of data.
+func (m mutation) apply(data []byte) []byte {
+	data = append([]byte(nil), data...)
+	pos := func(off int) int {
+		if off < 0 {
+			return len(data) + off
+		}
+		return off
+	}
+	data[pos(m.offset)] = m.value
+	if m.crcEnd != 0 {
+		putUint32LE(data[pos(m.crcAt):], crc32.ChecksumIEEE(
+			data[pos(m.crcStart):pos(m.crcEnd)]))
+	}
+	return data
+}
+
+// The mutations are applied to fox.xz with a single block header at
+// offset 12, which has 3 bytes of padding, and to
+// good-1-block_header-sizes.xz, whose first block header contains the
+// compressed size at offset 14 and whose index at offset 76 has 2 bytes
+// of padding.
+var mutations = []mutation{
+	{"header reserved flags byte", "fox.xz", 6, 0x01, 8, 6, 8},
+	{"header reserved flag bits", "fox.xz", 7, 0x14, 8, 6, 8},
+	{"footer reserved flags byte", "fox.xz", -4, 0x01, -12, -8, -2},
+	{"footer reserved flag bits", "fox.xz", -3, 0x24, -12, -8, -2},
+	{"block header reserved bit 2", "fox.xz", 13, 0x04, 20, 12, 20},
+	{"block header reserved bit 3", "fox.xz", 13, 0x08, 20, 12, 20},
+	{"block header reserved bit 4", "fox.xz", 13, 0x10, 20, 12, 20},
+	{"block header reserved bit 5", "fox.xz", 13, 0x20, 20, 12, 20},
+	{"block header padding", "fox.xz", 19, 0x01, 20, 12, 20},
+	{"LZMA2 properties reserved bits", "fox.xz", 16, 0x56, 20, 12, 20},
+	{"LZMA2 properties size", "fox.xz", 15, 0x02, 20, 12, 20},
+	{"block padding", "fox.xz", 73, 0x01, 0, 0, 0},
+	{"zero compressed size", "testdata/good-1-block_header-sizes.xz",
+		14, 0x00, 20, 12, 20},
+	{"index padding", "testdata/good-1-block_header-sizes.xz",
+		82, 0x01, 84, 76, 84},
+}
+
+// TestConformanceMutations checks that the reserved fields and the
+// padding, which decoders must verify according to the specification,
+// are checked in strict and in permissive mode.
+func TestConformanceMutations(t *testing.T) {
+	for _, m := range mutations {
+		orig, err := ioutil.ReadFile(m.file)
+		if err != nil {
+			t.Fatalf("ReadFile error %s", err)
+		}
+		data := m.apply(orig)
+		for _, strict := range []bool{false, true} {
+			c := ReaderConfig{Strict: strict}
+			r, err := c.NewReader(bytes.NewReader(data))
+			if err == nil {
+				_, err = ioutil.ReadAll(r)
+			}
+			if err == nil {
+				t.Errorf("%s: strict %t: mutated file accepted",
+					m.name, strict)
+			}
+		}
+	}
+}
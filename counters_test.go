@@ -0,0 +1,160 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package xz
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestWriterCounters(t *testing.T) {
+	text := strings.Repeat("The quick brown fox jumps over the lazy dog.\n",
+		100)
+	for _, workers := range []int{1, 2} {
+		var buf bytes.Buffer
+		w, err := WriterConfig{BlockSize: 1000,
+			Workers: workers}.NewWriter(&buf)
+		if err != nil {
+			t.Fatalf("NewWriter error %s", err)
+		}
+		if _, err = io.WriteString(w, text); err != nil {
+			t.Fatalf("WriteString error %s", err)
+		}
+		if n := w.UncompressedCount(); n != int64(len(text)) {
+			t.Fatalf("workers %d: UncompressedCount %d; want %d",
+				workers, n, len(text))
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("w.Close error %s", err)
+		}
+		if n := w.CompressedCount(); n != int64(buf.Len()) {
+			t.Fatalf("workers %d: CompressedCount %d; want %d",
+				workers, n, buf.Len())
+		}
+		want := float64(buf.Len()) / float64(len(text))
+		if r := w.Ratio(); r != want {
+			t.Fatalf("workers %d: Ratio %g; want %g", workers, r,
+				want)
+		}
+		if b, n := w.Block(), (len(text)+999)/1000; Backend == "go" &&
+			b != n {
+			t.Fatalf("workers %d: Block %d; want %d", workers, b,
+				n)
+		}
+	}
+}
+
+func TestReaderCounters(t *testing.T) {
+	parts := []string{strings.Repeat("a", 100), strings.Repeat("b", 100)}
+	data := multiBlockStream(t, parts...)
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	p := make([]byte, 150)
+	if _, err = io.ReadFull(r, p); err != nil {
+		t.Fatalf("ReadFull error %s", err)
+	}
+	if n := r.UncompressedCount(); n != 150 {
+		t.Fatalf("UncompressedCount %d; want 150", n)
+	}
+	if Backend == "go" {
+		if b := r.Block(); b != 1 {
+			t.Fatalf("Block %d; want 1", b)
+		}
+		if s := r.Stream(); s != 0 {
+			t.Fatalf("Stream %d; want 0", s)
+		}
+	}
+	if _, err = io.Copy(ioutil.Discard, r); err != nil {
+		t.Fatalf("Copy error %s", err)
+	}
+	if n := r.UncompressedCount(); n != 200 {
+		t.Fatalf("UncompressedCount %d; want 200", n)
+	}
+	n := r.CompressedCount()
+	if Backend == "go" && n != int64(len(data)) {
+		t.Fatalf("CompressedCount %d; want %d", n, len(data))
+	}
+	if n >= 0 && r.Ratio() != float64(n)/200 {
+		t.Fatalf("Ratio %g; want %g", r.Ratio(), float64(n)/200)
+	}
+	if b := r.Block(); b != -1 {
+		t.Fatalf("Block %d after end of stream; want -1", b)
+	}
+}
+
+func TestReaderResume(t *testing.T) {
+	if Backend != "go" {
+		t.Skip("the backend doesn't provide the offsets")
+	}
+	text := strings.Repeat("The quick brown fox jumps over the lazy dog.\n",
+		100)
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, WithBlockSize(1000))
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	if _, err = io.WriteString(w, text); err != nil {
+		t.Fatalf("WriteString error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("w.Close error %s", err)
+	}
+	data := buf.Bytes()
+
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	const checkpoint = 2500
+	if _, err = io.CopyN(ioutil.Discard, r, checkpoint); err != nil {
+		t.Fatalf("CopyN error %s", err)
+	}
+	co, uo := r.CompressedOffset(), r.UncompressedOffset()
+	if uo != 2000 {
+		t.Fatalf("UncompressedOffset is %d; want %d", uo, 2000)
+	}
+
+	streams, err := ReadStreamInfo(bytes.NewReader(data),
+		int64(len(data)))
+	if err != nil {
+		t.Fatalf("ReadStreamInfo error %s", err)
+	}
+	s := &streams[0]
+	var b *BlockInfo
+	for i := range s.Blocks {
+		if s.Blocks[i].Offset == co {
+			b = &s.Blocks[i]
+		}
+	}
+	if b == nil {
+		t.Fatalf("no block at CompressedOffset %d", co)
+	}
+	if b.UncompressedOffset != uo {
+		t.Fatalf("block has uncompressed offset %d; want %d",
+			b.UncompressedOffset, uo)
+	}
+	br, err := ReaderConfig{}.NewBlockReader(bytes.NewReader(data), s, b)
+	if err != nil {
+		t.Fatalf("NewBlockReader error %s", err)
+	}
+	if _, err = io.CopyN(ioutil.Discard, br, checkpoint-uo); err != nil {
+		t.Fatalf("CopyN error %s", err)
+	}
+	p := make([]byte, b.UncompressedSize-(checkpoint-uo))
+	if _, err = io.ReadFull(br, p); err != nil {
+		t.Fatalf("ReadFull error %s", err)
+	}
+	if string(p) != text[checkpoint:3000] {
+		t.Fatalf("resumed data differs")
+	}
+}
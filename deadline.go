@@ -0,0 +1,50 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// deadlineSetter is implemented by net.Conn and os.File.
+type deadlineSetter interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// errNoDeadline indicates that the underlying reader doesn't support
+// deadlines.
+var errNoDeadline = errorf(ErrUnsupported,
+	"xz: underlying reader doesn't support deadlines")
+
+// SetReadDeadline sets the read deadline of the underlying reader, which
+// must provide a SetReadDeadline method like net.Conn. A zero value
+// removes the deadline. If the deadline expires while the reader waits
+// for compressed data, Read returns a *DecodeError whose Timeout method
+// returns true and which matches os.ErrDeadlineExceeded for net.Conn
+// and os.File. The decoder state is lost in the middle of the data, so
+// all following reads return the same error until Reset is called.
+func (r *Reader) SetReadDeadline(t time.Time) error {
+	ds, ok := r.src.(deadlineSetter)
+	if !ok {
+		return errNoDeadline
+	}
+	return ds.SetReadDeadline(t)
+}
+
+// isTimeout reports whether err has been caused by a deadline or a
+// timeout.
+func isTimeout(err error) bool {
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return true
+	}
+	var be *BudgetError
+	if errors.As(err, &be) {
+		return be.Timeout
+	}
+	var te interface{ Timeout() bool }
+	return errors.As(err, &te) && te.Timeout()
+}
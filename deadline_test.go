@@ -0,0 +1,76 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package xz
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReaderSetReadDeadline(t *testing.T) {
+	text := strings.Repeat("The quick brown fox jumps over the lazy dog.\n",
+		1000)
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, WithBlockSize(1000))
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	if _, err = w.Write([]byte(text)); err != nil {
+		t.Fatalf("Write error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("w.Close error %s", err)
+	}
+	data := buf.Bytes()
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	// the server stalls after sending half of the data
+	go server.Write(data[:len(data)/2])
+
+	r, err := NewReader(client)
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	if err = r.SetReadDeadline(time.Now().Add(50 * time.Millisecond)); err != nil {
+		t.Fatalf("SetReadDeadline error %s", err)
+	}
+	_, err = ioutil.ReadAll(r)
+	if err == nil {
+		t.Fatalf("ReadAll returned no error")
+	}
+	if !errors.Is(err, os.ErrDeadlineExceeded) || !errors.Is(err, ErrIO) {
+		t.Fatalf("ReadAll error %v doesn't match os.ErrDeadlineExceeded "+
+			"and ErrIO", err)
+	}
+	var de *DecodeError
+	if !errors.As(err, &de) || !de.Timeout() {
+		t.Fatalf("ReadAll error %v is not a timeout", err)
+	}
+	// the error is reported again
+	if _, err2 := r.Read(make([]byte, 10)); err2 != err {
+		t.Fatalf("Read returned %v; want %v", err2, err)
+	}
+
+	r, err = NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	err = r.SetReadDeadline(time.Now())
+	if !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("SetReadDeadline returned %v; want ErrUnsupported",
+			err)
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// DebugReader decompresses xz data like Reader and writes an annotation
+// of the structure of the data to a writer while it is decoded: the
+// stream headers, the block headers and boundaries, the LZMA2 chunk
+// types, the dictionary resets, the results of the checks, the indexes
+// and the stream footers. The annotations are written as soon as the
+// structures are read, so that the last lines show where the decoding
+// of a damaged file or of a file created by another encoder failed.
+//
+// The output is meant to be read by humans; its format may change.
+type DebugReader struct {
+	r *Reader
+	a *annotator
+}
+
+// NewDebugReader creates a DebugReader reading from xz and writing the
+// annotations to w. The options are the options of NewReader.
+func NewDebugReader(xz io.Reader, w io.Writer, opts ...Option) (
+	*DebugReader, error) {
+
+	c, err := readerConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	return c.NewDebugReader(xz, w)
+}
+
+// NewDebugReader creates a DebugReader using the configuration. The
+// Logger of the configuration isn't used; the Hooks are still called.
+// The liblzma backend isn't used.
+func (c ReaderConfig) NewDebugReader(xz io.Reader, w io.Writer) (
+	*DebugReader, error) {
+
+	a := &annotator{w: w}
+	c.Logger = nil
+	c.debug = a
+	r, err := c.NewReader(xz)
+	if err != nil {
+		return nil, err
+	}
+	if a.err != nil {
+		return nil, a.err
+	}
+	return &DebugReader{r: r, a: a}, nil
+}
+
+// Read reads uncompressed data. An error writing the annotations is
+// returned as well.
+func (r *DebugReader) Read(p []byte) (n int, err error) {
+	n, err = r.r.Read(p)
+	if r.a.err != nil && (err == nil || err == io.EOF) {
+		err = r.a.err
+	}
+	return n, err
+}
+
+// annotator receives the structures of the data from the reader and
+// writes them as indented lines. The stream structures and the block
+// headers start at the left margin, the block contents are indented.
+// All methods may be called on a nil annotator and do nothing then.
+type annotator struct {
+	w   io.Writer
+	err error
+}
+
+// streamHeader annotates the header of a stream.
+func (a *annotator) streamHeader(h *header) {
+	a.printf("xz header %s", h)
+}
+
+// blockHeader annotates a block header and the position of the block.
+func (a *annotator) blockHeader(h *blockHeader, stream, block int,
+	offset, uncompressedOffset int64) {
+
+	a.printf("block %v", *h)
+	a.printf("  stream %d block %d: offset %d, uncompressed offset %d",
+		stream, block, offset, uncompressedOffset)
+}
+
+// check annotates the check of a block.
+func (a *annotator) check(checkType byte, stored, computed []byte,
+	verified bool) {
+
+	switch {
+	case !verified:
+		a.printf("  check %s not verified", flagString(checkType))
+	case bytes.Equal(stored, computed):
+		a.printf("  check %s %x ok", flagString(checkType), stored)
+	default:
+		a.printf("  check %s %x failed; computed %x",
+			flagString(checkType), stored, computed)
+	}
+}
+
+// blockEnd annotates the sizes of a completed block.
+func (a *annotator) blockEnd(rec record) {
+	a.printf("  end: unpadded size %d, uncompressed size %d",
+		rec.unpaddedSize, rec.uncompressedSize)
+}
+
+// index annotates the index of a stream.
+func (a *annotator) index(records int, size int64) {
+	a.printf("xz index records %d size %d", records, size)
+}
+
+// streamFooter annotates the footer of a stream.
+func (a *annotator) streamFooter(f *footer) {
+	a.printf("xz footer %s", f)
+}
+
+// chunks returns the logger for the LZMA2 decoder, which annotates the
+// chunks of the blocks.
+func (a *annotator) chunks() lzma.Logger {
+	return chunkAnnotator{a}
+}
+
+// chunkAnnotator writes the messages of the LZMA2 decoder indented
+// below the block.
+type chunkAnnotator struct {
+	a *annotator
+}
+
+// Printf writes a message of the LZMA2 decoder.
+func (c chunkAnnotator) Printf(format string, v ...interface{}) {
+	c.a.printf("    "+format, v...)
+}
+
+// printf writes a line unless an error occurred before.
+func (a *annotator) printf(format string, v ...interface{}) {
+	if a == nil || a.err != nil {
+		return
+	}
+	_, a.err = fmt.Fprintf(a.w, format+"\n", v...)
+}
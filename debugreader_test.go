@@ -0,0 +1,91 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDebugReader(t *testing.T) {
+	tests := []struct {
+		file  string
+		lines []string
+		err   error
+	}{
+		{"good-1-check-crc64.xz", []string{
+			"xz header CRC-64",
+			"block ",
+			"  stream 0 block 0: offset 12, uncompressed offset 0",
+			"    chunk header ",
+			"    dictionary reset",
+			"  check CRC-64 ",
+			"  end: unpadded size ",
+			"xz index records 1 size ",
+			"xz footer CRC-64 ",
+		}, nil},
+		{"good-1-check-none.xz", []string{
+			"  check None not verified",
+		}, nil},
+		{"bad-1-check-crc64.xz", []string{
+			"failed; computed",
+		}, ErrChecksum},
+	}
+	for _, tc := range tests {
+		f, err := os.Open("testdata/" + tc.file)
+		if err != nil {
+			t.Fatalf("Open error %s", err)
+		}
+		var buf bytes.Buffer
+		r, err := NewDebugReader(f, &buf)
+		if err != nil {
+			t.Fatalf("%s: NewDebugReader error %s", tc.file, err)
+		}
+		_, err = ioutil.ReadAll(r)
+		f.Close()
+		if !errors.Is(err, tc.err) {
+			t.Fatalf("%s: ReadAll returned error %v; want %v",
+				tc.file, err, tc.err)
+		}
+		// the annotations must appear in the given order
+		out := buf.String()
+		for _, s := range tc.lines {
+			i := strings.Index(out, s)
+			if i < 0 {
+				t.Fatalf("%s: annotation %q missing in\n%s",
+					tc.file, s, buf.String())
+			}
+			out = out[i+len(s):]
+		}
+	}
+}
+
+func TestDebugReaderHooks(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/good-1-block_header-sizes.xz")
+	if err != nil {
+		t.Fatalf("ReadFile error %s", err)
+	}
+	var starts, ends int
+	h := &Hooks{
+		OnBlockStart: func(e BlockEvent) { starts++ },
+		OnBlockEnd:   func(e BlockEvent) { ends++ },
+	}
+	r, err := NewDebugReader(bytes.NewReader(data), ioutil.Discard,
+		WithHooks(h))
+	if err != nil {
+		t.Fatalf("NewDebugReader error %s", err)
+	}
+	if _, err = ioutil.ReadAll(r); err != nil {
+		t.Fatalf("ReadAll error %s", err)
+	}
+	if starts != 2 || ends != 2 {
+		t.Fatalf("hooks called %d and %d times; want %d", starts, ends,
+			2)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/ulikunitz/xz/lzip"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// Format identifies a compression format supported by the module.
+type Format int
+
+// Formats detected by DetectFormat.
+const (
+	Unknown Format = iota
+	XZ
+	LZMAAlone
+	LZIP
+)
+
+// String returns the name of the format.
+func (f Format) String() string {
+	switch f {
+	case XZ:
+		return "xz"
+	case LZMAAlone:
+		return "lzma"
+	case LZIP:
+		return "lzip"
+	}
+	return "unknown"
+}
+
+// detectLen is the number of bytes required to detect the formats.
+const detectLen = lzma.HeaderLen
+
+// peeker is implemented by bufio.Reader.
+type peeker interface {
+	Peek(n int) ([]byte, error)
+}
+
+// DetectFormat detects the compression format of the data provided by
+// r using the header of the data. Since the header is read, the
+// function returns a reader providing the complete data. If r has a
+// Peek method like bufio.Reader, r itself is returned. The LZMA_Alone
+// format has no magic bytes; it is recognized by plausible values of
+// the header fields. Data too short for a header is reported as
+// Unknown format without error.
+func DetectFormat(r io.Reader) (f Format, data io.Reader, err error) {
+	var head []byte
+	if p, ok := r.(peeker); ok {
+		head, err = p.Peek(detectLen)
+		data = r
+	} else {
+		head = make([]byte, detectLen)
+		var n int
+		n, err = io.ReadFull(r, head)
+		head = head[:n]
+		data = io.MultiReader(bytes.NewReader(head), r)
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	if err != nil {
+		return Unknown, data, err
+	}
+	switch {
+	case len(head) >= HeaderLen && ValidHeader(head[:HeaderLen]):
+		f = XZ
+	case len(head) >= 6 && lzip.ValidHeader(head[:6]):
+		f = LZIP
+	case len(head) >= lzma.HeaderLen && lzma.ValidHeader(head):
+		f = LZMAAlone
+	}
+	return f, data, nil
+}
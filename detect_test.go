@@ -0,0 +1,72 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		file string
+		want Format
+	}{
+		{"fox.xz", XZ},
+		{"lzma/fox.lzma", LZMAAlone},
+		{"lzip/fox.lz", LZIP},
+		{"README.md", Unknown},
+	}
+	for _, tc := range tests {
+		data, err := ioutil.ReadFile(tc.file)
+		if err != nil {
+			t.Fatalf("ReadFile error %s", err)
+		}
+		for _, buffered := range []bool{false, true} {
+			var r io.Reader = bytes.NewReader(data)
+			if buffered {
+				r = bufio.NewReader(r)
+			}
+			f, dr, err := DetectFormat(r)
+			if err != nil {
+				t.Fatalf("DetectFormat error %s", err)
+			}
+			if f != tc.want {
+				t.Errorf("%s: got format %s; want %s", tc.file,
+					f, tc.want)
+			}
+			out, err := ioutil.ReadAll(dr)
+			if err != nil {
+				t.Fatalf("ReadAll error %s", err)
+			}
+			if !bytes.Equal(out, data) {
+				t.Errorf("%s: returned reader doesn't provide "+
+					"the data", tc.file)
+			}
+		}
+	}
+}
+
+func TestDetectFormatShort(t *testing.T) {
+	for _, data := range []string{"", "\xfd7z"} {
+		f, dr, err := DetectFormat(bytes.NewReader([]byte(data)))
+		if err != nil {
+			t.Fatalf("DetectFormat error %s", err)
+		}
+		if f != Unknown {
+			t.Errorf("%q: got format %s; want %s", data, f, Unknown)
+		}
+		out, err := ioutil.ReadAll(dr)
+		if err != nil {
+			t.Fatalf("ReadAll error %s", err)
+		}
+		if string(out) != data {
+			t.Errorf("got %q; want %q", out, data)
+		}
+	}
+}
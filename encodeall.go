@@ -0,0 +1,120 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package xz
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+)
+
+// appendWriter appends the data written to a slice.
+type appendWriter struct {
+	p []byte
+}
+
+// Write appends p to the slice.
+func (w *appendWriter) Write(p []byte) (n int, err error) {
+	w.p = append(w.p, p...)
+	return len(p), nil
+}
+
+// encoderState is the pooled state of an Encoder.
+type encoderState struct {
+	w  *Writer
+	aw appendWriter
+}
+
+// Encoder compresses complete byte slices into xz streams. It may be
+// used by multiple goroutines concurrently; every call of EncodeAll
+// uses a writer taken from an internal pool. The pooled writers are
+// reused with Reset, which keeps the dictionaries and match finders, so
+// that repeated calls don't allocate them again.
+type Encoder struct {
+	c    WriterConfig
+	pool sync.Pool
+}
+
+// NewEncoder returns an encoder using the default parameters changed by
+// the options.
+func NewEncoder(opts ...Option) (*Encoder, error) {
+	c, err := writerConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	return c.NewEncoder()
+}
+
+// NewEncoder returns an encoder using the configuration. A DecisionTrace
+// is rejected, because EncodeAll cannot report errors writing the trace;
+// use a Writer to trace the encoder.
+func (c WriterConfig) NewEncoder() (*Encoder, error) {
+	if err := c.Verify(); err != nil {
+		return nil, err
+	}
+	if c.DecisionTrace != nil {
+		return nil, errors.New(
+			"xz: DecisionTrace not supported by NewEncoder")
+	}
+	return &Encoder{c: c}, nil
+}
+
+// EncodeAll appends the xz stream for src to dst and returns the
+// extended slice. The argument order follows the EncodeAll method of
+// the zstd encoders. The configuration has been verified by NewEncoder,
+// it has no writer that might fail and appending to a slice cannot
+// fail, so an error of the writer indicates a bug and causes a panic.
+func (e *Encoder) EncodeAll(src, dst []byte) []byte {
+	s, _ := e.pool.Get().(*encoderState)
+	if s == nil {
+		s = new(encoderState)
+		addStat(e.c.Stats, StatPoolMisses, 1)
+	} else {
+		addStat(e.c.Stats, StatPoolHits, 1)
+	}
+	s.aw.p = dst
+	var err error
+	if s.w == nil {
+		s.w, err = e.c.NewWriter(&s.aw)
+	} else {
+		// an error of Reset is returned by Write
+		s.w.Reset(&s.aw)
+	}
+	if err == nil {
+		_, err = s.w.Write(src)
+	}
+	if err == nil {
+		err = s.w.Close()
+	}
+	if err != nil {
+		panic(err)
+	}
+	dst = s.aw.p
+	s.aw.p = nil
+	e.pool.Put(s)
+	return dst
+}
+
+// Compress appends the xz stream for src to dst and returns the
+// extended slice. The capacity of dst is used if it suffices, so
+// passing buf[:0] reuses the buffer buf. The writer uses the
+// configuration cfg; the zero value selects the default parameters.
+func Compress(dst, src []byte, cfg WriterConfig) ([]byte, error) {
+	buf := bytes.NewBuffer(dst)
+	w, err := cfg.NewWriter(buf)
+	if err != nil {
+		return dst, err
+	}
+	if _, err = w.Write(src); err != nil {
+		return dst, err
+	}
+	if err = w.Close(); err != nil {
+		return dst, err
+	}
+	return buf.Bytes(), nil
+}
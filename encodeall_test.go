@@ -0,0 +1,131 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package xz
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestEncodeAllDecodeAll(t *testing.T) {
+	enc, err := NewEncoder(WithDictSize(1 << 16))
+	if err != nil {
+		t.Fatalf("NewEncoder error %s", err)
+	}
+	dec, err := NewDecoder()
+	if err != nil {
+		t.Fatalf("NewDecoder error %s", err)
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				text := []byte(strings.Repeat(
+					fmt.Sprintf("goroutine %d call %d\n",
+						i, j), 100))
+				c := enc.EncodeAll(text, []byte("xz"))
+				if !bytes.HasPrefix(c, []byte("xz")) {
+					errs <- fmt.Errorf("EncodeAll " +
+						"overwrote dst")
+					return
+				}
+				d, err := dec.DecodeAll(c[2:], []byte("d:"))
+				if err != nil {
+					errs <- fmt.Errorf("DecodeAll error %s",
+						err)
+					return
+				}
+				if string(d) != "d:"+string(text) {
+					errs <- fmt.Errorf("DecodeAll " +
+						"returned wrong data")
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	c := enc.EncodeAll([]byte("abc"), nil)
+	dst := []byte("prefix")
+	d, err := dec.DecodeAll(c[:len(c)-4], dst)
+	if err == nil {
+		t.Fatalf("DecodeAll accepted truncated data")
+	}
+	if string(d) != "prefix" {
+		t.Fatalf("DecodeAll returned %q after error; want %q", d,
+			"prefix")
+	}
+	if d, err = dec.DecodeAll(c, nil); err != nil || string(d) != "abc" {
+		t.Fatalf("DecodeAll returned %q, %v after error; want %q",
+			d, err, "abc")
+	}
+	if _, err = NewEncoder(WithDictCapLimit(1 << 20)); err == nil {
+		t.Fatalf("NewEncoder accepted reader option")
+	}
+	if _, err = (ReaderConfig{DictCap: 1}).NewDecoder(); err == nil {
+		t.Fatalf("NewDecoder accepted invalid configuration")
+	}
+}
+
+func TestEncoderDecisionTrace(t *testing.T) {
+	c := WriterConfig{DecisionTrace: errWriter{}}
+	if _, err := c.NewEncoder(); err == nil {
+		t.Fatal("NewEncoder accepted DecisionTrace")
+	}
+	// the Writer reports the error of the trace writer
+	if _, err := Compress(nil, benchmarkText(), c); err == nil {
+		t.Fatal("Compress succeeded for failing DecisionTrace")
+	}
+}
+
+// benchmarkText returns the text compressed by the benchmarks.
+func benchmarkText() []byte {
+	return []byte(strings.Repeat(
+		"The quick brown fox jumps over the lazy dog.\n", 100))
+}
+
+// BenchmarkEncodeAll shows that the encoder reuses the dictionary and the
+// match finder; compare the allocations with BenchmarkCompress.
+func BenchmarkEncodeAll(b *testing.B) {
+	enc, err := NewEncoder()
+	if err != nil {
+		b.Fatalf("NewEncoder error %s", err)
+	}
+	text := benchmarkText()
+	dst := enc.EncodeAll(text, nil)
+	b.SetBytes(int64(len(text)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dst = enc.EncodeAll(text, dst[:0])
+	}
+}
+
+func BenchmarkCompress(b *testing.B) {
+	text := benchmarkText()
+	var dst []byte
+	b.SetBytes(int64(len(text)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var err error
+		if dst, err = Compress(dst[:0], text, WriterConfig{}); err != nil {
+			b.Fatalf("Compress error %s", err)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The errors of the Go implementation caused by invalid xz data match
+// one of the following error classes using errors.Is. Together with
+// ErrChecksum for a wrong block check and io.ErrUnexpectedEOF for
+// truncated data they identify the part of the file that violates the
+// specification. The error messages give the details. Errors of the
+// configuration are not classified; errors of the underlying reader
+// match ErrIO. The liblzma backend doesn't classify its errors.
+var (
+	// ErrStreamHeader indicates an invalid stream header, including
+	// data following a stream that isn't a stream header.
+	ErrStreamHeader = errors.New("xz: invalid stream header")
+	// ErrStreamFlags indicates invalid stream flags or stream
+	// footer flags that differ from the stream header flags.
+	ErrStreamFlags = errors.New("xz: invalid stream flags")
+	// ErrStreamFooter indicates an invalid stream footer or a
+	// backward size that doesn't match the index.
+	ErrStreamFooter = errors.New("xz: invalid stream footer")
+	// ErrBlockHeader indicates an invalid block header or block
+	// sizes that don't match the sizes in the block header.
+	ErrBlockHeader = errors.New("xz: invalid block header")
+	// ErrBlockPadding indicates non-zero block padding.
+	ErrBlockPadding = errors.New("xz: invalid block padding")
+	// ErrIndex indicates an invalid index or an index that doesn't
+	// match the blocks.
+	ErrIndex = errors.New("xz: invalid index")
+	// ErrData indicates invalid LZMA2 data.
+	ErrData = errors.New("xz: invalid LZMA2 data")
+	// ErrUnsupported indicates a check type or a filter that is
+	// valid but not supported by the package.
+	ErrUnsupported = errors.New("xz: unsupported feature")
+)
+
+// ErrCorrupt is matched by all errors caused by invalid compressed
+// data: the error classes above with the exception of ErrUnsupported,
+// ErrChecksum and io.ErrUnexpectedEOF for truncated data. ErrIO is
+// matched by the errors of the underlying reader or writer, which are
+// wrapped by readers and writers, so that errors.Is and errors.As still
+// find the original error. Together they allow callers to distinguish
+// a failing source, which might be worth a retry, from corrupt data.
+var (
+	ErrCorrupt = errors.New("xz: corrupt data")
+	ErrIO      = errors.New("xz: error of underlying reader or writer")
+)
+
+// corruptErrors lists the errors matching ErrCorrupt.
+var corruptErrors = []error{
+	ErrStreamHeader, ErrStreamFlags, ErrStreamFooter, ErrBlockHeader,
+	ErrBlockPadding, ErrIndex, ErrData, ErrChecksum,
+	io.ErrUnexpectedEOF,
+}
+
+// isCorrupt reports whether err is caused by invalid compressed data.
+// Errors of the underlying reader are never reported as corrupt data,
+// even if they match io.ErrUnexpectedEOF.
+func isCorrupt(err error) bool {
+	if errors.Is(err, ErrIO) {
+		return false
+	}
+	for _, c := range corruptErrors {
+		if errors.Is(err, c) {
+			return true
+		}
+	}
+	return false
+}
+
+// classError adds an error class to an error. The message of the error
+// is not changed.
+type classError struct {
+	class error
+	err   error
+}
+
+// Error returns the message of the wrapped error.
+func (e *classError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e *classError) Unwrap() error {
+	return e.err
+}
+
+// Is reports whether target is the class of the error or ErrCorrupt
+// for the classes of invalid data.
+func (e *classError) Is(target error) bool {
+	if target == ErrCorrupt {
+		return e.class != ErrIO && e.class != ErrUnsupported
+	}
+	return target == e.class
+}
+
+// errorf formats an error of the given class.
+func errorf(class error, format string, a ...interface{}) error {
+	return &classError{class: class, err: fmt.Errorf(format, a...)}
+}
+
+// withClass adds the class to err. A nil error is returned unchanged.
+func withClass(class, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &classError{class: class, err: err}
+}
+
+// ioReader adds the class ErrIO to the errors of the underlying
+// reader. The io.EOF error is returned unchanged.
+type ioReader struct {
+	r io.Reader
+}
+
+// Read reads from the underlying reader.
+func (r *ioReader) Read(p []byte) (n int, err error) {
+	n, err = r.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = withClass(ErrIO, err)
+	}
+	return n, err
+}
+
+// ioWriter adds the class ErrIO to the errors of the underlying
+// writer.
+type ioWriter struct {
+	w io.Writer
+}
+
+// Write writes to the underlying writer.
+func (w *ioWriter) Write(p []byte) (n int, err error) {
+	n, err = w.w.Write(p)
+	return n, withClass(ErrIO, err)
+}
+
+// classifyVLI adds the class to the errors of readUvarint caused by the
+// encoding of the integer. Other errors are returned unchanged.
+func classifyVLI(class, err error) error {
+	if err == ErrVLITooLong || err == ErrVLINonMinimal {
+		return withClass(class, err)
+	}
+	return err
+}
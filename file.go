@@ -0,0 +1,95 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// DecompressFile decompresses the xz file src into the file dst using
+// the default parameters changed by the options. Like CompressFile it
+// replaces dst atomically.
+func DecompressFile(dst, src string, opts ...Option) error {
+	c, err := readerConfig(opts)
+	if err != nil {
+		return err
+	}
+	if err = c.Verify(); err != nil {
+		return err
+	}
+	return replaceFile(dst, src, func(w io.Writer, f *os.File) error {
+		r, err := c.NewReader(f)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, r)
+		return err
+	})
+}
+
+// replaceFile opens the file src and calls convert to write the
+// contents of dst into a temporary file in the directory of dst. The
+// temporary file gets the permissions and the modification time of
+// src, is synced and then renamed to dst. It is removed if an error
+// occurs, so that dst is either unchanged or completely written.
+func replaceFile(dst, src string,
+	convert func(w io.Writer, f *os.File) error) (err error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	dir, name := filepath.Split(dst)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := os.CreateTemp(dir, "."+name+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	if err = convert(tmp, f); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(fi.Mode() & os.ModePerm); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chtimes(tmp.Name(), fi.ModTime(), fi.ModTime()); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), dst); err != nil {
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
+
+// syncDir makes the rename in the directory durable. Errors are ignored
+// because not all platforms support syncing directories.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
@@ -0,0 +1,73 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package xz
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompressFile(t *testing.T) {
+	dir := t.TempDir()
+	text := strings.Repeat("The quick brown fox jumps over the lazy dog.\n",
+		100)
+	src := filepath.Join(dir, "fox.txt")
+	if err := ioutil.WriteFile(src, []byte(text), 0640); err != nil {
+		t.Fatalf("WriteFile error %s", err)
+	}
+	mtime := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(src, mtime, mtime); err != nil {
+		t.Fatalf("Chtimes error %s", err)
+	}
+	xzFile := filepath.Join(dir, "fox.txt.xz")
+	if err := CompressFile(xzFile, src, WithCheck(CRC32)); err != nil {
+		t.Fatalf("CompressFile error %s", err)
+	}
+	fi, err := os.Stat(xzFile)
+	if err != nil {
+		t.Fatalf("Stat error %s", err)
+	}
+	if fi.Mode().Perm() != 0640 || !fi.ModTime().Equal(mtime) {
+		t.Fatalf("got mode %v and mtime %v; want %v and %v",
+			fi.Mode().Perm(), fi.ModTime(), os.FileMode(0640), mtime)
+	}
+	out := filepath.Join(dir, "out.txt")
+	if err = DecompressFile(out, xzFile); err != nil {
+		t.Fatalf("DecompressFile error %s", err)
+	}
+	data, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatalf("ReadFile error %s", err)
+	}
+	if string(data) != text {
+		t.Fatalf("decompressed data differs")
+	}
+
+	// a failure leaves the destination unchanged
+	if err = DecompressFile(out, src); err == nil {
+		t.Fatalf("DecompressFile accepted uncompressed data")
+	}
+	if data, err = ioutil.ReadFile(out); err != nil || string(data) != text {
+		t.Fatalf("destination changed by failed DecompressFile")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir error %s", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("got %d files; want 3", len(entries))
+	}
+
+	if err = CompressFile(xzFile, src, WithDictSize(1)); err == nil {
+		t.Fatalf("CompressFile accepted an invalid option")
+	}
+}
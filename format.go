@@ -52,21 +52,29 @@ const (
 )
 
 // errInvalidFlags indicates that flags are invalid.
-var errInvalidFlags = errors.New("xz: invalid flags")
+var errInvalidFlags = errorf(ErrStreamFlags, "xz: invalid flags")
+
+// errUnsupportedCheck indicates a check type defined by the
+// specification that is not supported by the package.
+var errUnsupportedCheck = errorf(ErrUnsupported,
+	"xz: unsupported check type")
 
 // verifyFlags returns the error errInvalidFlags if the value is
-// invalid.
+// invalid and errUnsupportedCheck if the check type is not supported.
 func verifyFlags(flags byte) error {
 	switch flags {
 	case CRC32, CRC64, SHA256:
 		return nil
-	default:
+	}
+	if flags > 0x0f {
 		return errInvalidFlags
 	}
+	return errUnsupportedCheck
 }
 
 // flagstrings maps flag values to strings.
 var flagstrings = map[byte]string{
+	0:      "None",
 	CRC32:  "CRC-32",
 	CRC64:  "CRC-64",
 	SHA256: "SHA-256",
@@ -76,13 +84,15 @@ var flagstrings = map[byte]string{
 func flagString(flags byte) string {
 	s, ok := flagstrings[flags]
 	if !ok {
-		return "invalid"
+		return fmt.Sprintf("check %#02x", flags)
 	}
 	return s
 }
 
 // newHashFunc returns a function that creates hash instances for the
-// hash method encoded in flags.
+// hash method encoded in flags. The check types None and the check
+// types reserved by the specification are returned as unverified
+// checks with the size defined by the specification.
 func newHashFunc(flags byte) (newHash func() hash.Hash, err error) {
 	switch flags {
 	case CRC32:
@@ -92,18 +102,60 @@ func newHashFunc(flags byte) (newHash func() hash.Hash, err error) {
 	case SHA256:
 		newHash = sha256.New
 	default:
-		err = errInvalidFlags
+		if flags > 0x0f {
+			return nil, errInvalidFlags
+		}
+		size := checkLen(flags)
+		newHash = func() hash.Hash { return unverifiedCheck(size) }
 	}
 	return
 }
 
+// checkLen returns the size of the check field for the check type
+// given by flags as defined by the xz specification.
+func checkLen(flags byte) int {
+	if flags == 0 {
+		return 0
+	}
+	return 4 << ((flags - 1) / 3)
+}
+
+// unverifiedCheck is the hash used for check types that are not
+// verified. Its size is the length of the check field.
+type unverifiedCheck int
+
+func (h unverifiedCheck) Write(p []byte) (n int, err error) {
+	return len(p), nil
+}
+
+func (h unverifiedCheck) Sum(b []byte) []byte {
+	return append(b, make([]byte, h)...)
+}
+
+func (h unverifiedCheck) Reset() {}
+
+func (h unverifiedCheck) Size() int { return int(h) }
+
+func (h unverifiedCheck) BlockSize() int { return 1 }
+
+// supportedCheck returns whether the check type is None or one of the
+// check types supported by the package.
+func supportedCheck(flags byte) bool {
+	switch flags {
+	case 0, CRC32, CRC64, SHA256:
+		return true
+	}
+	return false
+}
+
 // header provides the actual content of the xz file header: the flags.
 type header struct {
 	flags byte
 }
 
 // Errors returned by readHeader.
-var errHeaderMagic = errors.New("xz: invalid header magic bytes")
+var errHeaderMagic = errorf(ErrStreamHeader,
+	"xz: invalid header magic bytes")
 
 // ValidHeader checks whether data is a correct xz file header. The
 // length of data must be HeaderLen.
@@ -122,7 +174,7 @@ func (h header) String() string {
 func (h *header) UnmarshalBinary(data []byte) error {
 	// header length
 	if len(data) != HeaderLen {
-		return errors.New("xz: wrong file header length")
+		return errorf(ErrStreamHeader, "xz: wrong file header length")
 	}
 
 	// magic header
@@ -134,7 +186,8 @@ func (h *header) UnmarshalBinary(data []byte) error {
 	crc := crc32.NewIEEE()
 	crc.Write(data[6:8])
 	if uint32LE(data[8:]) != crc.Sum32() {
-		return errors.New("xz: invalid checksum for file header")
+		return errorf(ErrStreamHeader,
+			"xz: invalid checksum for file header")
 	}
 
 	// stream flags
@@ -142,8 +195,8 @@ func (h *header) UnmarshalBinary(data []byte) error {
 		return errInvalidFlags
 	}
 	flags := data[7]
-	if err := verifyFlags(flags); err != nil {
-		return err
+	if flags > 0x0f {
+		return errInvalidFlags
 	}
 
 	h.flags = flags
@@ -192,6 +245,25 @@ const (
 	maxIndexSize = (1 << 32) * 4
 )
 
+// errFooterIndexSize returns the error for a backward size in the
+// footer that differs from the actual size of the index.
+func errFooterIndexSize(f *footer, indexSize int64) error {
+	return errorf(ErrStreamFooter, "xz: backward size %d in stream "+
+		"footer doesn't match index size %d", f.indexSize, indexSize)
+}
+
+// verifyHeader checks that the stream flags of the footer equal the
+// stream flags of the stream header.
+func (f *footer) verifyHeader(h *header) error {
+	if f.flags != h.flags {
+		return errorf(ErrStreamFlags, "xz: stream footer flags (%s) "+
+			"differ from "+
+			"header flags (%s)", flagString(f.flags),
+			flagString(h.flags))
+	}
+	return nil
+}
+
 // MarshalBinary converts footer values into an xz file footer. Note
 // that the footer value is checked for correctness.
 func (f *footer) MarshalBinary() (data []byte, err error) {
@@ -228,19 +300,19 @@ func (f *footer) MarshalBinary() (data []byte, err error) {
 // footer.
 func (f *footer) UnmarshalBinary(data []byte) error {
 	if len(data) != footerLen {
-		return errors.New("xz: wrong footer length")
+		return errorf(ErrStreamFooter, "xz: wrong footer length")
 	}
 
 	// magic bytes
 	if !bytes.Equal(data[10:], footerMagic) {
-		return errors.New("xz: footer magic invalid")
+		return errorf(ErrStreamFooter, "xz: footer magic invalid")
 	}
 
 	// CRC-32
 	crc := crc32.NewIEEE()
 	crc.Write(data[4:10])
 	if uint32LE(data) != crc.Sum32() {
-		return errors.New("xz: footer checksum error")
+		return errorf(ErrStreamFooter, "xz: footer checksum error")
 	}
 
 	var g footer
@@ -252,8 +324,8 @@ func (f *footer) UnmarshalBinary(data []byte) error {
 		return errInvalidFlags
 	}
 	g.flags = data[9]
-	if err := verifyFlags(g.flags); err != nil {
-		return err
+	if g.flags > 0x0f {
+		return errInvalidFlags
 	}
 
 	*f = g
@@ -267,6 +339,8 @@ type blockHeader struct {
 	compressedSize   int64
 	uncompressedSize int64
 	filters          []filter
+	// paddingLen is the length of the header padding
+	paddingLen int
 }
 
 // String converts the block header into a string.
@@ -328,13 +402,17 @@ func readBlockHeader(r io.Reader) (h *blockHeader, n int, err error) {
 	z, err = io.CopyN(&buf, r, int64(headerLen-1))
 	n += int(z)
 	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
 		return nil, n, err
 	}
 
-	// unmarshal block header
+	// unmarshal block header; the CRC-32 is verified before any
+	// other field is interpreted
 	h = new(blockHeader)
 	if err = h.UnmarshalBinary(buf.Bytes()); err != nil {
-		return nil, n, err
+		return nil, n, withClass(ErrBlockHeader, err)
 	}
 
 	return h, n, nil
@@ -360,8 +438,11 @@ func readSizeInBlockHeader(r io.ByteReader, present bool) (n int64, err error) {
 // UnmarshalBinary unmarshals the block header.
 func (h *blockHeader) UnmarshalBinary(data []byte) error {
 	// Check header length
+	if len(data) == 0 {
+		return errors.New("xz: block header is empty")
+	}
 	s := data[0]
-	if data[0] == 0 {
+	if s == 0 {
 		return errIndexIndicator
 	}
 	headerLen := (int(s) + 1) * 4
@@ -393,6 +474,9 @@ func (h *blockHeader) UnmarshalBinary(data []byte) error {
 	if err != nil {
 		return err
 	}
+	if h.compressedSize == 0 {
+		return errors.New("xz: compressed size in block header is zero")
+	}
 
 	// Uncompressed size
 	h.uncompressedSize, err = readSizeInBlockHeader(
@@ -405,6 +489,9 @@ func (h *blockHeader) UnmarshalBinary(data []byte) error {
 	if err != nil {
 		return err
 	}
+	if err = verifyFilters(h.filters); err != nil {
+		return err
+	}
 
 	// Check padding
 	// Since headerLen is a multiple of 4 we don't need to check
@@ -418,29 +505,16 @@ func (h *blockHeader) UnmarshalBinary(data []byte) error {
 	// The only reasonable approach seems to be to ignore the
 	// padding size. We still check that all padding bytes are zero.
 	if !allZeros(data[n-k : n]) {
-		return errPadding
+		return errors.New("xz: non-zero byte in block header padding")
 	}
+	h.paddingLen = k
 	return nil
 }
 
 // MarshalBinary marshals the binary header.
 func (h *blockHeader) MarshalBinary() (data []byte, err error) {
-	if !(minFilters <= len(h.filters) && len(h.filters) <= maxFilters) {
-		return nil, errors.New("xz: filter count wrong")
-	}
-	for i, f := range h.filters {
-		if i < len(h.filters)-1 {
-			if f.id() == lzmaFilterID {
-				return nil, errors.New(
-					"xz: LZMA2 filter is not the last")
-			}
-		} else {
-			// last filter
-			if f.id() != lzmaFilterID {
-				return nil, errors.New("xz: " +
-					"last filter must be the LZMA2 filter")
-			}
-		}
+	if err = verifyFilters(h.filters); err != nil {
+		return nil, err
 	}
 
 	var buf bytes.Buffer
@@ -514,13 +588,13 @@ type filter interface {
 	UnmarshalBinary(data []byte) error
 	MarshalBinary() (data []byte, err error)
 	reader(r io.Reader, c *ReaderConfig) (fr io.Reader, err error)
-	writeCloser(w io.WriteCloser, c *WriterConfig) (fw io.WriteCloser, err error)
+	filterWriter
 	// filter must be last filter
 	last() bool
 }
 
-// readFilter reads a block filter from the block header. At this point
-// in time only the LZMA2 filter is supported.
+// readFilter reads a block filter from the block header. The delta and
+// BCJ filters are read, but only the LZMA2 filter is supported.
 func readFilter(r io.Reader) (f filter, err error) {
 	br := lzma.ByteReader(r)
 
@@ -539,6 +613,22 @@ func readFilter(r io.Reader) (f filter, err error) {
 			return nil, err
 		}
 		f = new(lzmaFilter)
+	case deltaFilterID, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b:
+		size, _, err := readUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		if size > 4 {
+			return nil, fmt.Errorf(
+				"xz: wrong properties size for %s filter",
+				specFilterNames[id])
+		}
+		data = make([]byte, 2+size)
+		data[0], data[1] = byte(id), byte(size)
+		if _, err = io.ReadFull(r, data[2:]); err != nil {
+			return nil, err
+		}
+		f = new(specFilter)
 	default:
 		if id >= minReservedID {
 			return nil, errors.New(
@@ -552,17 +642,17 @@ func readFilter(r io.Reader) (f filter, err error) {
 	return f, err
 }
 
-// readFilters reads count filters. At this point in time only the count
-// 1 is supported.
+// readFilters reads count filters.
 func readFilters(r io.Reader, count int) (filters []filter, err error) {
-	if count != 1 {
-		return nil, errors.New("xz: unsupported filter count")
-	}
-	f, err := readFilter(r)
-	if err != nil {
-		return nil, err
+	filters = make([]filter, 0, count)
+	for i := 0; i < count; i++ {
+		f, err := readFilter(r)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
 	}
-	return []filter{f}, err
+	return filters, nil
 }
 
 // writeFilters writes the filters.
@@ -594,21 +684,22 @@ func readRecord(r io.ByteReader) (rec record, n int, err error) {
 	u, k, err := readUvarint(r)
 	n += k
 	if err != nil {
-		return rec, n, err
+		return rec, n, classifyVLI(ErrIndex, err)
 	}
 	rec.unpaddedSize = int64(u)
 	if rec.unpaddedSize < 0 {
-		return rec, n, errors.New("xz: unpadded size negative")
+		return rec, n, errorf(ErrIndex, "xz: unpadded size negative")
 	}
 
 	u, k, err = readUvarint(r)
 	n += k
 	if err != nil {
-		return rec, n, err
+		return rec, n, classifyVLI(ErrIndex, err)
 	}
 	rec.uncompressedSize = int64(u)
 	if rec.uncompressedSize < 0 {
-		return rec, n, errors.New("xz: uncompressed size negative")
+		return rec, n, errorf(ErrIndex,
+			"xz: uncompressed size negative")
 	}
 
 	return rec, n, nil
@@ -672,9 +763,22 @@ func writeIndex(w io.Writer, index []record) (n int64, err error) {
 	return n, err
 }
 
+// maxIndexRecords is the maximum number of records an index can have.
+// The backward size field of the footer limits the index size to 16
+// GiB and every record requires at least two bytes.
+const maxIndexRecords = 1 << 33
+
 // readIndexBody reads the index from the reader. It assumes that the
-// index indicator has already been read.
-func readIndexBody(r io.Reader) (records []record, n int64, err error) {
+// index indicator has already been read. The number of records must
+// not exceed maxRecords, which the caller derives from the number of
+// blocks or the size of the index. A negative value or a value
+// exceeding maxIndexRecords selects maxIndexRecords.
+func readIndexBody(r io.Reader, maxRecords int64) (records []record,
+	n int64, err error) {
+
+	if maxRecords < 0 || maxRecords > maxIndexRecords {
+		maxRecords = maxIndexRecords
+	}
 	crc := crc32.NewIEEE()
 	// index indicator
 	crc.Write([]byte{0})
@@ -685,21 +789,39 @@ func readIndexBody(r io.Reader) (records []record, n int64, err error) {
 	u, k, err := readUvarint(br)
 	n += int64(k)
 	if err != nil {
-		return nil, n, err
+		return nil, n, classifyVLI(ErrIndex, err)
+	}
+	if u > uint64(maxRecords) {
+		return nil, n, errorf(ErrIndex,
+			"xz: index has %d records; at most %d are possible",
+			u, maxRecords)
 	}
 	recLen := int(u)
 	if recLen < 0 || uint64(recLen) != u {
-		return nil, n, errors.New("xz: record number overflow")
+		return nil, n, errorf(ErrIndex, "xz: record number overflow")
 	}
 
-	// list of records
-	records = make([]record, recLen)
-	for i := range records {
-		records[i], k, err = readRecord(br)
+	// list of records; the slice grows with the records read, since
+	// the number of records hasn't been validated; the sums of the
+	// sizes must not overflow
+	var compressed, uncompressed int64
+	for i := 0; i < recLen; i++ {
+		rec, k, err := readRecord(br)
 		n += int64(k)
 		if err != nil {
 			return nil, n, err
 		}
+		if rec.unpaddedSize > maxInt64-3-compressed {
+			return nil, n, errorf(ErrIndex,
+				"xz: sum of unpadded sizes in index overflows")
+		}
+		compressed += rec.unpaddedSize + int64(padLen(rec.unpaddedSize))
+		if rec.uncompressedSize > maxInt64-uncompressed {
+			return nil, n, errorf(ErrIndex,
+				"xz: sum of uncompressed sizes in index overflows")
+		}
+		uncompressed += rec.uncompressedSize
+		records = append(records, rec)
 	}
 
 	p := make([]byte, padLen(int64(n+1)), 4)
@@ -709,7 +831,8 @@ func readIndexBody(r io.Reader) (records []record, n int64, err error) {
 		return nil, n, err
 	}
 	if !allZeros(p) {
-		return nil, n, errors.New("xz: non-zero byte in index padding")
+		return nil, n, errorf(ErrIndex,
+			"xz: non-zero byte in index padding")
 	}
 
 	// crc32
@@ -721,7 +844,7 @@ func readIndexBody(r io.Reader) (records []record, n int64, err error) {
 		return records, n, err
 	}
 	if uint32LE(p) != s {
-		return nil, n, errors.New("xz: wrong checksum for index")
+		return nil, n, errorf(ErrIndex, "xz: wrong checksum for index")
 	}
 
 	return records, n, nil
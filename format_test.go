@@ -6,6 +6,9 @@ package xz
 
 import (
 	"bytes"
+	"errors"
+	"hash/crc32"
+	"strings"
 	"testing"
 )
 
@@ -85,7 +88,7 @@ func TestIndex(t *testing.T) {
 		t.Fatalf("indicator %d; want %d", c, 0)
 	}
 
-	g, m, err := readIndexBody(&buf)
+	g, m, err := readIndexBody(&buf, -1)
 	if err != nil {
 		for i, r := range g {
 			t.Logf("records[%d] %v", i, r)
@@ -102,6 +105,33 @@ func TestIndex(t *testing.T) {
 	}
 }
 
+func TestIndexRecordLimit(t *testing.T) {
+	records := []record{{1234, 1}, {2345, 2}}
+	var buf bytes.Buffer
+	if _, err := writeIndex(&buf, records); err != nil {
+		t.Fatalf("writeIndex error %s", err)
+	}
+	index := buf.Bytes()[1:]
+	if _, _, err := readIndexBody(bytes.NewReader(index), 2); err != nil {
+		t.Fatalf("readIndexBody error %s", err)
+	}
+	if _, _, err := readIndexBody(bytes.NewReader(index), 1); err == nil {
+		t.Fatalf("readIndexBody accepted 2 records for limit 1")
+	}
+
+	// An index claiming 2^50 records must be rejected before the
+	// records are read.
+	p := make([]byte, maxVLILen)
+	p = p[:putUvarint(p, 1<<50)]
+	_, n, err := readIndexBody(bytes.NewReader(p), -1)
+	if err == nil {
+		t.Fatalf("readIndexBody accepted 2^50 records")
+	}
+	if n != int64(len(p)) {
+		t.Fatalf("readIndexBody read %d bytes; want %d", n, len(p))
+	}
+}
+
 func TestBlockHeader(t *testing.T) {
 	h := blockHeader{
 		compressedSize:   1234,
@@ -140,3 +170,107 @@ func TestBlockHeader(t *testing.T) {
 		t.Errorf("got dictCap %d; want %d", glf.dictCap, hlf.dictCap)
 	}
 }
+
+// rawBlockHeader creates a block header containing the given filters
+// without verifying them.
+func rawBlockHeader(t *testing.T, filters []filter) []byte {
+	var buf bytes.Buffer
+	buf.Write([]byte{0, byte(len(filters) - 1)})
+	if _, err := writeFilters(&buf, filters); err != nil {
+		t.Fatalf("writeFilters error %s", err)
+	}
+	buf.Write(make([]byte, padLen(int64(buf.Len()))))
+	data := buf.Bytes()
+	data[0] = byte(len(data) / 4)
+	p := make([]byte, 4)
+	putUint32LE(p, crc32.ChecksumIEEE(data))
+	return append(data, p...)
+}
+
+func TestFilterChain(t *testing.T) {
+	lzma2 := &lzmaFilter{1 << 20}
+	delta := &specFilter{filterID: deltaFilterID, props: []byte{3}}
+	x86 := &specFilter{filterID: 0x04}
+	arm := &specFilter{filterID: 0x07, props: []byte{0, 1, 0, 0}}
+	tests := []struct {
+		filters []filter
+		err     error
+	}{
+		{[]filter{lzma2}, nil},
+		{[]filter{delta, x86, arm, lzma2}, nil},
+		{[]filter{delta, x86, arm, delta, lzma2}, ErrTooManyFilters},
+		{[]filter{lzma2, lzma2}, ErrLZMA2NotLast},
+		{[]filter{lzma2, x86}, ErrLZMA2NotLast},
+		{[]filter{x86}, ErrLastFilter},
+		{[]filter{lzma2, delta}, ErrLZMA2NotLast},
+		{[]filter{x86, delta}, ErrLastFilter},
+		{[]filter{x86, x86, lzma2}, ErrDuplicateFilter},
+	}
+	for _, tc := range tests {
+		if err := verifyFilters(tc.filters); err != tc.err {
+			t.Errorf("verifyFilters(%v) returned %v; want %v",
+				tc.filters, err, tc.err)
+		}
+		if len(tc.filters) > maxFilters {
+			continue
+		}
+		data := rawBlockHeader(t, tc.filters)
+		h, _, err := readBlockHeader(bytes.NewReader(data))
+		if !errors.Is(err, tc.err) ||
+			(err != nil && !errors.Is(err, ErrBlockHeader)) {
+			t.Errorf("readBlockHeader for %v returned %v; want %v",
+				tc.filters, err, tc.err)
+		}
+		if err != nil {
+			continue
+		}
+		if len(h.filters) != len(tc.filters) {
+			t.Fatalf("got %d filters; want %d", len(h.filters),
+				len(tc.filters))
+		}
+		for i, f := range h.filters {
+			if f.id() != tc.filters[i].id() {
+				t.Errorf("filter %d has id %#x; want %#x", i,
+					f.id(), tc.filters[i].id())
+			}
+		}
+	}
+}
+
+func TestSpecFilterProps(t *testing.T) {
+	tests := []*specFilter{
+		{filterID: deltaFilterID},
+		{filterID: deltaFilterID, props: []byte{1, 2}},
+		{filterID: 0x04, props: []byte{1}},
+	}
+	for _, f := range tests {
+		data := rawBlockHeader(t, []filter{f, &lzmaFilter{1 << 20}})
+		if _, _, err := readBlockHeader(bytes.NewReader(data)); err == nil {
+			t.Errorf("filter %s with %d property bytes accepted",
+				f, len(f.props))
+		}
+	}
+}
+
+func TestBlockHeaderCRC(t *testing.T) {
+	h := blockHeader{
+		compressedSize:   1234,
+		uncompressedSize: 5678,
+		filters:          []filter{&lzmaFilter{4096}},
+	}
+	data, err := h.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary error %s", err)
+	}
+	n := len(data) - 4
+	if crc32.ChecksumIEEE(data[:n]) != uint32LE(data[n:]) {
+		t.Fatalf("MarshalBinary wrote wrong CRC-32")
+	}
+	// The CRC-32 must be checked before the invalid flags are seen.
+	data[1] |= reservedBlockFlags
+	_, _, err = readBlockHeader(bytes.NewReader(data))
+	if err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Fatalf("readBlockHeader returned %v; want checksum error",
+			err)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package xz
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// TestReaderMutations decodes randomly modified valid and invalid files.
+// The test must neither panic nor hang and must not allocate more than
+// fuzzAllocLimit bytes per input. Use the flag -mutations to change the
+// number of inputs.
+func TestReaderMutations(t *testing.T) {
+	var seeds [][]byte
+	for _, pattern := range []string{"fox.xz", "testdata/*.xz",
+		"lzma/examples/*.lzma"} {
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			t.Fatalf("Glob error %s", err)
+		}
+		for _, file := range files {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatalf("ReadFile error %s", err)
+			}
+			seeds = append(seeds, data)
+		}
+	}
+	seeds = append(seeds, multiBlockStream(t, "a", "bb", "ccc"))
+	n := *mutationCount
+	if testing.Short() {
+		n /= 10
+	}
+	rng := rand.New(rand.NewSource(int64(n)))
+	for i := 0; i < n; i++ {
+		data := mutate(rng, seeds[rng.Intn(len(seeds))])
+		if err := decodeMutation(data); err != nil {
+			t.Fatalf("mutation %d: %s\ninput %x", i, err, data)
+		}
+	}
+}
+
+// TestReaderDeclaredDictCap checks that the reader doesn't allocate the
+// dictionary capacity declared by the block header before the data
+// requires it.
+func TestReaderDeclaredDictCap(t *testing.T) {
+	if Backend != "go" {
+		t.Skip("the allocations of the backend aren't measured")
+	}
+	const txt = "hello\n"
+	var buf bytes.Buffer
+	w, err := WriterConfig{DictCap: 4096}.NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	if _, err = w.Write([]byte(txt)); err != nil {
+		t.Fatalf("Write error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("Close error %s", err)
+	}
+	data := buf.Bytes()
+	bh, n, err := readBlockHeader(bytes.NewReader(data[HeaderLen:]))
+	if err != nil {
+		t.Fatalf("readBlockHeader error %s", err)
+	}
+	bh.filters = []filter{&lzmaFilter{DefaultDictCapLimit}}
+	p, err := bh.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary error %s", err)
+	}
+	if len(p) != n {
+		t.Fatalf("block header has %d bytes; want %d", len(p), n)
+	}
+	copy(data[HeaderLen:], p)
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	alloc := ms.TotalAlloc
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll error %s", err)
+	}
+	runtime.ReadMemStats(&ms)
+	if string(out) != txt {
+		t.Fatalf("got %q; want %q", out, txt)
+	}
+	if n := ms.TotalAlloc - alloc; n > 1<<20 {
+		t.Fatalf("decoding %d bytes allocated %d bytes", len(txt), n)
+	}
+}
@@ -0,0 +1,261 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"testing"
+	"time"
+
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// fuzzDictCapLimit keeps the memory used by the fuzz targets small.
+const fuzzDictCapLimit = 1 << 20
+
+// fuzzOutputLimit limits the uncompressed data read by the fuzz
+// targets. The LZMA compression ratio is large enough that small inputs
+// may produce very long outputs.
+const fuzzOutputLimit = 1 << 24
+
+// fuzzAllocLimit limits the memory allocated while a single input is
+// decoded. The readers must allocate memory in proportion to the data
+// they read and write, not to the sizes declared by headers and
+// indexes.
+const fuzzAllocLimit = 64 << 20
+
+// addSeedFiles adds the files matching the pattern to the seed corpus
+// of the fuzz target.
+func addSeedFiles(f *testing.F, pattern string) {
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		f.Fatalf("Glob error %s", err)
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			f.Fatalf("ReadFile error %s", err)
+		}
+		f.Add(data)
+	}
+}
+
+// decodeAll decodes data with the readers of the package in strict,
+// permissive and recovery mode. Decoding errors are ignored, but an
+// error is returned if the results of the functions are inconsistent.
+func decodeAll(data []byte) error {
+	modes := []ReaderConfig{
+		{DictCapLimit: fuzzDictCapLimit},
+		{DictCapLimit: fuzzDictCapLimit, Strict: true},
+		{DictCapLimit: fuzzDictCapLimit, Recover: true},
+	}
+	for _, c := range modes {
+		r, err := c.NewReader(bytes.NewReader(data))
+		if err == nil {
+			io.CopyN(ioutil.Discard, r, fuzzOutputLimit)
+		}
+		if c.Recover {
+			continue
+		}
+		_, err = c.VerifyStructure(bytes.NewReader(data),
+			int64(len(data)))
+		if err != nil {
+			continue
+		}
+		streams, err := ReadStreamInfo(bytes.NewReader(data),
+			int64(len(data)))
+		if err != nil {
+			return fmt.Errorf("ReadStreamInfo error %s after "+
+				"successful VerifyStructure", err)
+		}
+		for i := range streams {
+			s := &streams[i]
+			for j := range s.Blocks {
+				br, err := c.NewBlockReader(
+					bytes.NewReader(data), s, &s.Blocks[j])
+				if err != nil {
+					continue
+				}
+				io.CopyN(ioutil.Discard, br, fuzzOutputLimit)
+			}
+		}
+	}
+	c := ReaderConfig{DictCapLimit: fuzzDictCapLimit}
+	if t, err := ReadSeekTable(bytes.NewReader(data),
+		int64(len(data))); err == nil {
+		sr, err := c.NewSeekTableReader(bytes.NewReader(data), t)
+		if err != nil {
+			return fmt.Errorf("NewSeekTableReader error %s", err)
+		}
+		p := make([]byte, 1<<10)
+		size := t.UncompressedSize()
+		for _, off := range []int64{0, size / 2, size - 1} {
+			sr.ReadAt(p, off)
+		}
+	}
+	if _, dr, err := DetectFormat(bytes.NewReader(data)); err == nil {
+		io.Copy(ioutil.Discard, dr)
+	}
+	if rr, err := c.NewRawReader(bytes.NewReader(data)); err == nil {
+		io.CopyN(ioutil.Discard, rr, fuzzOutputLimit)
+	}
+	lr, err := lzma.ReaderConfig{DictCapLimit: fuzzDictCapLimit}.NewReader(
+		bytes.NewReader(data))
+	if err == nil {
+		io.CopyN(ioutil.Discard, lr, fuzzOutputLimit)
+	}
+	return nil
+}
+
+// decodeBounded calls decodeAll and returns an error if more than
+// fuzzAllocLimit bytes have been allocated.
+func decodeBounded(data []byte) error {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	alloc := ms.TotalAlloc
+	if err := decodeAll(data); err != nil {
+		return err
+	}
+	runtime.ReadMemStats(&ms)
+	if n := ms.TotalAlloc - alloc; n > fuzzAllocLimit {
+		return fmt.Errorf("decoding allocated %d bytes; limit %d",
+			n, fuzzAllocLimit)
+	}
+	return nil
+}
+
+// FuzzReader decodes the input with all readers. The regression inputs
+// in testdata/fuzz/FuzzReader declare sizes exceeding the limits of the
+// readers.
+func FuzzReader(f *testing.F) {
+	addSeedFiles(f, "fox.xz")
+	addSeedFiles(f, "testdata/*.xz")
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if err := decodeBounded(data); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+var mutationCount = flag.Int("mutations", 20000,
+	"number of mutated inputs decoded by TestReaderMutations")
+
+// mutate returns a copy of data with random modifications as they are
+// caused by transmission errors, truncation or concatenation.
+func mutate(rng *rand.Rand, data []byte) []byte {
+	m := append([]byte(nil), data...)
+	for k := 1 + rng.Intn(3); k > 0; k-- {
+		if len(m) == 0 {
+			m = append(m, byte(rng.Intn(256)))
+		}
+		i := rng.Intn(len(m))
+		switch rng.Intn(8) {
+		case 0, 1:
+			m[i] ^= 1 << uint(rng.Intn(8))
+		case 2:
+			m[i] = byte(rng.Intn(256))
+		case 3:
+			m = m[:i]
+		case 4:
+			j := i + rng.Intn(len(m)-i)
+			m = append(m[:i], m[j:]...)
+		case 5:
+			j := i + rng.Intn(len(m)-i)
+			p := append([]byte(nil), m[i:j]...)
+			m = append(m[:j], append(p, m[j:]...)...)
+		case 6:
+			p := make([]byte, 1+rng.Intn(16))
+			rng.Read(p)
+			m = append(m[:i], append(p, m[i:]...)...)
+		case 7:
+			m = append(m, data...)
+		}
+	}
+	return m
+}
+
+// mutationTimeout is the time a single mutated input may take to be
+// decoded before the decoder is assumed to hang.
+const mutationTimeout = 30 * time.Second
+
+// decodeMutation calls decodeBounded and reports panics and hangs as
+// errors.
+func decodeMutation(data []byte) error {
+	ch := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				ch <- fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+			}
+		}()
+		ch <- decodeBounded(data)
+	}()
+	select {
+	case err := <-ch:
+		return err
+	case <-time.After(mutationTimeout):
+		return fmt.Errorf("no result after %s", mutationTimeout)
+	}
+}
+
+func FuzzBlockHeader(f *testing.F) {
+	for _, h := range []blockHeader{
+		{compressedSize: -1, uncompressedSize: -1,
+			filters: []filter{&lzmaFilter{8 << 20}}},
+		{compressedSize: 1234, uncompressedSize: 5678,
+			filters: []filter{&lzmaFilter{1 << 16}}},
+		{compressedSize: -1, uncompressedSize: 17,
+			filters: []filter{
+				&specFilter{filterID: deltaFilterID,
+					props: []byte{3}},
+				&specFilter{filterID: 0x04},
+				&lzmaFilter{1 << 20}}},
+	} {
+		data, err := h.MarshalBinary()
+		if err != nil {
+			f.Fatalf("MarshalBinary error %s", err)
+		}
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		new(blockHeader).UnmarshalBinary(data)
+		// Correct the header size and the CRC-32, so that the
+		// fuzzer explores the parsing of the fields.
+		if k := len(data); k%4 == 0 && 8 <= k && k <= 1024 {
+			data = append([]byte(nil), data...)
+			data[0] = byte(k/4 - 1)
+			putUint32LE(data[k-4:], crc32.ChecksumIEEE(data[:k-4]))
+		}
+		h, n, err := readBlockHeader(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		if n > len(data) {
+			t.Fatalf("readBlockHeader read %d bytes; only %d "+
+				"available", n, len(data))
+		}
+		p, err := h.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary error %s", err)
+		}
+		var g blockHeader
+		if err = g.UnmarshalBinary(p); err != nil {
+			t.Fatalf("UnmarshalBinary error %s", err)
+		}
+		if g.String() != h.String() {
+			t.Fatalf("block header after marshalling %s; want %s",
+				&g, h)
+		}
+	})
+}
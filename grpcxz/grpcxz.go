@@ -0,0 +1,165 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+// Package grpcxz provides the xz message compression for gRPC. The
+// package registers a Compressor with the default writer and reader
+// configurations, a dictionary capacity of 1 MiB, under the name xz
+// when it is imported:
+//
+//	import _ "github.com/ulikunitz/xz/grpcxz"
+//
+// Clients request the compression with grpc.UseCompressor(grpcxz.Name).
+// A compressor with other parameters replaces the registered one:
+//
+//	c, err := grpcxz.NewCompressor(xz.WriterConfig{DictCap: 1 << 16},
+//		xz.ReaderConfig{})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	encoding.RegisterCompressor(c)
+//
+// Writers and readers are pooled, since gRPC compresses every message
+// separately. The pooled writers and readers are reused with Reset,
+// which keeps their dictionaries, so only the first messages allocate
+// them.
+//
+// The package is a separate module, so that the xz module doesn't
+// depend on gRPC.
+package grpcxz
+
+import (
+	"io"
+	"sync"
+
+	"github.com/ulikunitz/xz"
+	"google.golang.org/grpc/encoding"
+)
+
+// Name is the name of the encoding negotiated by gRPC.
+const Name = "xz"
+
+// defaultDictCap is the dictionary capacity of the registered
+// compressor. gRPC messages are usually much smaller than the default
+// capacity of 8 MiB.
+const defaultDictCap = 1 << 20
+
+func init() {
+	c, err := NewCompressor(xz.WriterConfig{DictCap: defaultDictCap},
+		xz.ReaderConfig{})
+	if err != nil {
+		panic(err)
+	}
+	encoding.RegisterCompressor(c)
+}
+
+// Compressor implements encoding.Compressor.
+var _ encoding.Compressor = (*Compressor)(nil)
+
+// Compressor compresses gRPC messages using xz. Every message is
+// compressed into a single xz stream.
+type Compressor struct {
+	wc      xz.WriterConfig
+	rc      xz.ReaderConfig
+	writers sync.Pool
+	readers sync.Pool
+}
+
+// NewCompressor creates a compressor using the writer configuration wc
+// and the reader configuration rc. The default dictionary capacity of 8
+// MiB is often larger than the messages; a smaller value reduces the
+// memory required by the writers.
+func NewCompressor(wc xz.WriterConfig, rc xz.ReaderConfig) (*Compressor,
+	error) {
+	if err := wc.Verify(); err != nil {
+		return nil, err
+	}
+	if err := rc.Verify(); err != nil {
+		return nil, err
+	}
+	return &Compressor{wc: wc, rc: rc}, nil
+}
+
+// Name returns the name of the encoding.
+func (c *Compressor) Name() string {
+	return Name
+}
+
+// writer returns the xz writer to the pool on Close.
+type writer struct {
+	*xz.Writer
+	c *Compressor
+}
+
+// Close completes the xz stream and puts the xz writer back into the
+// pool.
+func (w *writer) Close() error {
+	if w.Writer == nil {
+		return nil
+	}
+	err := w.Writer.Close()
+	if err == nil {
+		w.c.writers.Put(w.Writer)
+	}
+	w.Writer = nil
+	return err
+}
+
+// Compress returns a writer compressing the message written to it into
+// w. The message is complete after the writer has been closed.
+func (c *Compressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	xw, ok := c.writers.Get().(*xz.Writer)
+	if !ok {
+		var err error
+		if xw, err = c.wc.NewWriter(w); err != nil {
+			return nil, err
+		}
+		return &writer{Writer: xw, c: c}, nil
+	}
+	// an error of Reset is returned by Write and Close of the writer
+	xw.Reset(w)
+	return &writer{Writer: xw, c: c}, nil
+}
+
+// reader returns the xz reader to the pool after the end of the stream
+// has been reached.
+type reader struct {
+	xr  *xz.Reader
+	c   *Compressor
+	err error
+}
+
+// Read reads decompressed data from the message.
+func (r *reader) Read(p []byte) (n int, err error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, err = r.xr.Read(p)
+	if err != nil {
+		r.err = err
+		if err == io.EOF {
+			r.c.readers.Put(r.xr)
+		}
+		r.xr = nil
+	}
+	return n, err
+}
+
+// Decompress returns a reader for the decompressed message read from r.
+func (c *Compressor) Decompress(r io.Reader) (io.Reader, error) {
+	xr, ok := c.readers.Get().(*xz.Reader)
+	if !ok {
+		var err error
+		if xr, err = c.rc.NewReader(r); err != nil {
+			return nil, err
+		}
+		return &reader{xr: xr, c: c}, nil
+	}
+	if err := xr.Reset(r); err != nil {
+		return nil, err
+	}
+	return &reader{xr: xr, c: c}, nil
+}
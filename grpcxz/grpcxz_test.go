@@ -0,0 +1,179 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package grpcxz
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/internal/randtxt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestCompressor(t *testing.T) {
+	var c encoding.Compressor
+	c, err := NewCompressor(xz.WriterConfig{DictCap: 1 << 16},
+		xz.ReaderConfig{})
+	if err != nil {
+		t.Fatalf("NewCompressor error %s", err)
+	}
+	if c.Name() != "xz" {
+		t.Fatalf("Name returned %q; want %q", c.Name(), "xz")
+	}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 10; i++ {
+		var msg bytes.Buffer
+		io.CopyN(&msg, randtxt.NewReader(rng), rng.Int63n(5000))
+		var buf bytes.Buffer
+		w, err := c.Compress(&buf)
+		if err != nil {
+			t.Fatalf("Compress error %s", err)
+		}
+		if _, err = w.Write(msg.Bytes()); err != nil {
+			t.Fatalf("Write error %s", err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("Close error %s", err)
+		}
+		r, err := c.Decompress(&buf)
+		if err != nil {
+			t.Fatalf("Decompress error %s", err)
+		}
+		out, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("ReadAll error %s", err)
+		}
+		if !bytes.Equal(out, msg.Bytes()) {
+			t.Fatalf("message %d: decompressed message differs",
+				i)
+		}
+	}
+}
+
+func TestRegistered(t *testing.T) {
+	if _, ok := encoding.GetCompressor(Name).(*Compressor); !ok {
+		t.Fatalf("no xz compressor registered")
+	}
+
+	lis := bufconn.Listen(1 << 16)
+	sh := new(compressionHandler)
+	s := grpc.NewServer(grpc.StatsHandler(sh))
+	healthpb.RegisterHealthServer(s, health.NewServer())
+	go s.Serve(lis)
+	defer s.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(
+			func(ctx context.Context, _ string) (net.Conn, error) {
+				return lis.DialContext(ctx)
+			}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.UseCompressor(Name)))
+	if err != nil {
+		t.Fatalf("grpc.NewClient error %s", err)
+	}
+	defer conn.Close()
+	resp, err := healthpb.NewHealthClient(conn).Check(
+		context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("Check error %s", err)
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("Check returned status %s", resp.Status)
+	}
+	if c := sh.compression(); c != Name {
+		t.Fatalf("request compressed with %q; want %q", c, Name)
+	}
+}
+
+// compressionHandler records the compression of the incoming RPCs.
+type compressionHandler struct {
+	mu sync.Mutex
+	c  string
+}
+
+func (h *compressionHandler) TagRPC(ctx context.Context,
+	_ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (h *compressionHandler) HandleRPC(_ context.Context, s stats.RPCStats) {
+	if in, ok := s.(*stats.InHeader); ok {
+		h.mu.Lock()
+		h.c = in.Compression
+		h.mu.Unlock()
+	}
+}
+
+func (h *compressionHandler) TagConn(ctx context.Context,
+	_ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (h *compressionHandler) HandleConn(context.Context, stats.ConnStats) {}
+
+// compression returns the compression of the last RPC.
+func (h *compressionHandler) compression() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.c
+}
+
+func TestCompressorCorrupted(t *testing.T) {
+	c, err := NewCompressor(xz.WriterConfig{}, xz.ReaderConfig{})
+	if err != nil {
+		t.Fatalf("NewCompressor error %s", err)
+	}
+	// the liblzma backend reports the error only on Read
+	r, err := c.Decompress(bytes.NewReader([]byte("no xz")))
+	if err == nil {
+		_, err = ioutil.ReadAll(r)
+	}
+	if err == nil {
+		t.Fatal("invalid data accepted")
+	}
+}
+
+// BenchmarkCompress shows that the pooled writers don't allocate their
+// dictionaries for every message.
+func BenchmarkCompress(b *testing.B) {
+	c, err := NewCompressor(xz.WriterConfig{}, xz.ReaderConfig{})
+	if err != nil {
+		b.Fatalf("NewCompressor error %s", err)
+	}
+	var msg bytes.Buffer
+	io.CopyN(&msg, randtxt.NewReader(rand.NewSource(1)), 4096)
+	b.SetBytes(int64(msg.Len()))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w, err := c.Compress(ioutil.Discard)
+		if err != nil {
+			b.Fatalf("Compress error %s", err)
+		}
+		if _, err = w.Write(msg.Bytes()); err != nil {
+			b.Fatalf("Write error %s", err)
+		}
+		if err = w.Close(); err != nil {
+			b.Fatalf("Close error %s", err)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import "time"
+
+// BlockEvent describes a block to the Hooks.
+type BlockEvent struct {
+	// Stream is the index of the stream containing the block.
+	Stream int
+	// Block is the index of the block in the stream.
+	Block int
+	// BlockInfo provides the position of the block in the compressed
+	// and uncompressed data and its sizes. Values that are not known
+	// yet are -1.
+	BlockInfo
+	// Duration is the time elapsed since the start of the block. It
+	// is zero for OnBlockStart.
+	Duration time.Duration
+}
+
+// Hooks provides callbacks for the lifecycle of the blocks read by a
+// Reader or written by a Writer, for instance to create a tracing span
+// for every block. Functions that are nil are not called.
+//
+// OnBlockStart is called by the reader after the block header has been
+// read and by the writer when it starts to compress the block. In
+// parallel mode the position of a block is only known when it is
+// written, because it depends on the compressed sizes of the blocks
+// still being compressed. So Stream, Block and Offset are -1 for
+// OnBlockStart, while UncompressedSize is already known; OnBlockEnd
+// reports all of them.
+// OnBlockEnd is called after the block has been completely read or
+// written, but not for blocks that couldn't be completed because of an
+// error. The callbacks are called by the goroutine calling the methods
+// of the reader or writer. Readers and writers using the liblzma
+// backend don't call them.
+type Hooks struct {
+	OnBlockStart func(e BlockEvent)
+	OnBlockEnd   func(e BlockEvent)
+}
+
+// blockStart reports the start of a block and returns the start time.
+func (h *Hooks) blockStart(e *BlockEvent) time.Time {
+	if h == nil {
+		return time.Time{}
+	}
+	if h.OnBlockStart != nil {
+		h.OnBlockStart(*e)
+	}
+	return time.Now()
+}
+
+// blockEnd reports the end of a block started at the given time.
+func (h *Hooks) blockEnd(e *BlockEvent, start time.Time) {
+	if h == nil || h.OnBlockEnd == nil {
+		return
+	}
+	e.Duration = time.Since(start)
+	h.OnBlockEnd(*e)
+}
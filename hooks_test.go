@@ -0,0 +1,174 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package xz
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// recordHooks returns hooks appending the events to starts and ends.
+func recordHooks(starts, ends *[]BlockEvent) *Hooks {
+	return &Hooks{
+		OnBlockStart: func(e BlockEvent) {
+			*starts = append(*starts, e)
+		},
+		OnBlockEnd: func(e BlockEvent) {
+			if len(*ends) >= len(*starts) {
+				panic("OnBlockEnd without OnBlockStart")
+			}
+			*ends = append(*ends, e)
+		},
+	}
+}
+
+// checkEvents compares the end events with the blocks of the stream.
+func checkEvents(t *testing.T, ends []BlockEvent, s *StreamInfo) {
+	t.Helper()
+	if len(ends) != len(s.Blocks) {
+		t.Fatalf("got %d end events; want %d", len(ends),
+			len(s.Blocks))
+	}
+	for i, e := range ends {
+		if e.Stream != 0 || e.Block != i {
+			t.Fatalf("event %d: stream %d block %d", i, e.Stream,
+				e.Block)
+		}
+		if e.BlockInfo != s.Blocks[i] {
+			t.Fatalf("event %d: block info %+v; want %+v", i,
+				e.BlockInfo, s.Blocks[i])
+		}
+		if e.Duration < 0 {
+			t.Fatalf("event %d: duration %v", i, e.Duration)
+		}
+	}
+}
+
+func TestHooks(t *testing.T) {
+	if Backend != "go" {
+		t.Skip("the backend doesn't call the hooks")
+	}
+	text := strings.Repeat("The quick brown fox jumps over the lazy dog.\n",
+		100)
+	for _, workers := range []int{1, 2} {
+		var starts, ends []BlockEvent
+		var buf bytes.Buffer
+		w, err := NewWriter(&buf, WithBlockSize(1000),
+			WithWorkers(workers),
+			WithHooks(recordHooks(&starts, &ends)))
+		if err != nil {
+			t.Fatalf("NewWriter error %s", err)
+		}
+		if _, err = w.Write([]byte(text)); err != nil {
+			t.Fatalf("Write error %s", err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("w.Close error %s", err)
+		}
+		data := buf.Bytes()
+		streams, err := ReadStreamInfo(bytes.NewReader(data),
+			int64(len(data)))
+		if err != nil {
+			t.Fatalf("ReadStreamInfo error %s", err)
+		}
+		if len(starts) != len(ends) {
+			t.Fatalf("workers %d: %d start events; want %d",
+				workers, len(starts), len(ends))
+		}
+		checkEvents(t, ends, &streams[0])
+		for i, e := range starts {
+			want := ends[i]
+			if workers > 1 {
+				// the position is only known after the
+				// compression
+				want.Stream, want.Block, want.Offset = -1, -1, -1
+			} else {
+				want.UncompressedSize = -1
+			}
+			want.UnpaddedSize, want.Duration = -1, 0
+			if e != want {
+				t.Fatalf("workers %d: start event %d is %+v; "+
+					"want %+v", workers, i, e, want)
+			}
+		}
+
+		starts, ends = nil, nil
+		r, err := NewReader(bytes.NewReader(data),
+			WithHooks(recordHooks(&starts, &ends)))
+		if err != nil {
+			t.Fatalf("NewReader error %s", err)
+		}
+		if _, err = ioutil.ReadAll(r); err != nil {
+			t.Fatalf("ReadAll error %s", err)
+		}
+		checkEvents(t, ends, &streams[0])
+		for i, e := range starts {
+			if e.Offset != ends[i].Offset || e.Duration != 0 {
+				t.Fatalf("start event %d: %+v", i, e)
+			}
+		}
+	}
+}
+
+func TestWithBlockCallback(t *testing.T) {
+	if Backend != "go" {
+		t.Skip("the backend doesn't call the hooks")
+	}
+	text := strings.Repeat("The quick brown fox jumps over the lazy dog.\n",
+		1000)
+	for _, workers := range []int{1, 2} {
+		var starts, ends []BlockEvent
+		var blocks []BlockInfo
+		var buf bytes.Buffer
+		w, err := NewWriter(&buf, WithBlockSize(1<<14),
+			WithWorkers(workers),
+			WithHooks(recordHooks(&starts, &ends)),
+			WithBlockCallback(func(b BlockInfo) {
+				blocks = append(blocks, b)
+			}))
+		if err != nil {
+			t.Fatalf("NewWriter error %s", err)
+		}
+		if _, err = w.Write([]byte(text[:1000])); err != nil {
+			t.Fatalf("Write error %s", err)
+		}
+		if err = w.EndBlock(); err != nil {
+			t.Fatalf("EndBlock error %s", err)
+		}
+		if _, err = w.Write([]byte(text[1000:])); err != nil {
+			t.Fatalf("Write error %s", err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("w.Close error %s", err)
+		}
+		data := buf.Bytes()
+		streams, err := ReadStreamInfo(bytes.NewReader(data),
+			int64(len(data)))
+		if err != nil {
+			t.Fatalf("ReadStreamInfo error %s", err)
+		}
+		want := streams[0].Blocks
+		if len(blocks) != len(want) || len(want) < 3 {
+			t.Fatalf("workers %d: got %d blocks; want %d",
+				workers, len(blocks), len(want))
+		}
+		for i, b := range blocks {
+			if b != want[i] {
+				t.Fatalf("workers %d: block %d is %+v; want %+v",
+					workers, i, b, want[i])
+			}
+		}
+		// the hooks set before are kept
+		if len(ends) != len(blocks) || len(starts) != len(blocks) {
+			t.Fatalf("workers %d: %d start and %d end events",
+				workers, len(starts), len(ends))
+		}
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+// Package httpxz supports the xz content coding for HTTP. The handler
+// returned by Handler compresses responses for clients accepting the
+// xz coding and the Transport decompresses xz-encoded responses
+// transparently. RangeReaderAt supports random access to remote xz
+// files using range requests.
+package httpxz
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ulikunitz/xz"
+)
+
+// acceptsXZ checks whether the value of an Accept-Encoding header
+// permits the xz coding. A quality value of zero excludes a coding;
+// the asterisk matches all codings not listed explicitly.
+func acceptsXZ(header string) bool {
+	star := false
+	for _, s := range strings.Split(header, ",") {
+		coding, q := parseCoding(s)
+		switch coding {
+		case encoding:
+			return q > 0
+		case "*":
+			star = q > 0
+		}
+	}
+	return star
+}
+
+// parseCoding parses an element of the Accept-Encoding header. The
+// coding is returned in lower case together with its quality value.
+func parseCoding(s string) (coding string, q float64) {
+	q = 1
+	params := strings.Split(s, ";")
+	coding = strings.ToLower(strings.TrimSpace(params[0]))
+	for _, p := range params[1:] {
+		p = strings.TrimSpace(p)
+		if !strings.HasPrefix(p, "q=") && !strings.HasPrefix(p, "Q=") {
+			continue
+		}
+		v, err := strconv.ParseFloat(p[2:], 64)
+		if err != nil {
+			return coding, 0
+		}
+		q = v
+	}
+	return coding, q
+}
+
+// Handler returns a handler that compresses the responses of h using
+// the default writer configuration if the client accepts the xz
+// coding.
+func Handler(h http.Handler) http.Handler {
+	return NewHandler(h, xz.WriterConfig{})
+}
+
+// NewHandler returns a handler that compresses the responses of h
+// using the writer configuration c if the client accepts the xz
+// coding. Responses that have already a Content-Encoding header,
+// responses without body and partial responses are not compressed. The
+// Accept-Ranges header of a compressed response is removed, because the
+// ranges would refer to the uncompressed data, and a strong ETag is
+// made weak.
+func NewHandler(h http.Handler, c xz.WriterConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsXZ(r.Header.Get("Accept-Encoding")) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		rw := &responseWriter{
+			ResponseWriter: w,
+			c:              c,
+			head:           r.Method == http.MethodHead,
+		}
+		defer rw.close()
+		h.ServeHTTP(rw, r)
+	})
+}
+
+// responseWriter compresses the body of a response.
+type responseWriter struct {
+	http.ResponseWriter
+	c    xz.WriterConfig
+	head bool
+	// wroteHeader is set after the header has been written
+	wroteHeader bool
+	// compress indicates that the body is compressed
+	compress bool
+	xw       *xz.Writer
+	err      error
+}
+
+// bodyAllowed reports whether a response with the status code may
+// have a body.
+func bodyAllowed(status int) bool {
+	switch {
+	case 100 <= status && status <= 199:
+		return false
+	case status == http.StatusNoContent:
+		return false
+	case status == http.StatusNotModified:
+		return false
+	}
+	return true
+}
+
+// WriteHeader decides whether the body will be compressed and writes
+// the header.
+func (w *responseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.wroteHeader = true
+	hdr := w.Header()
+	w.compress = !w.head && bodyAllowed(status) &&
+		status != http.StatusPartialContent &&
+		hdr.Get("Content-Range") == "" &&
+		hdr.Get("Content-Encoding") == ""
+	if w.compress {
+		hdr.Set("Content-Encoding", encoding)
+		hdr.Del("Content-Length")
+		hdr.Del("Accept-Ranges")
+		if etag := hdr.Get("ETag"); etag != "" &&
+			!strings.HasPrefix(etag, "W/") {
+			hdr.Set("ETag", "W/"+etag)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write compresses the data of the body. If the handler didn't set a
+// content type, it is detected from the uncompressed data.
+func (w *responseWriter) Write(p []byte) (n int, err error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type",
+				http.DetectContentType(p))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.compress {
+		return w.ResponseWriter.Write(p)
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.xw == nil {
+		if w.xw, err = w.c.NewWriter(w.ResponseWriter); err != nil {
+			w.err = err
+			return 0, err
+		}
+	}
+	n, err = w.xw.Write(p)
+	if err != nil {
+		w.err = err
+	}
+	return n, err
+}
+
+// Flush sends the data compressed so far to the client.
+func (w *responseWriter) Flush() {
+	if w.xw != nil && w.err == nil {
+		if err := w.xw.Flush(); err != nil {
+			w.err = err
+			return
+		}
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// close completes the xz stream. A handler that doesn't write a body
+// gets an empty xz stream.
+func (w *responseWriter) close() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.compress || w.err != nil {
+		return
+	}
+	if w.xw == nil {
+		var err error
+		if w.xw, err = w.c.NewWriter(w.ResponseWriter); err != nil {
+			return
+		}
+	}
+	w.xw.Close()
+}
@@ -0,0 +1,221 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package httpxz
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/internal/randtxt"
+)
+
+func TestAcceptsXZ(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{"gzip", false},
+		{"xz", true},
+		{"gzip, XZ", true},
+		{"xz;q=0", false},
+		{"xz; q=0.5", true},
+		{"*", true},
+		{"*;q=0", false},
+		{"xz;q=0, *", false},
+		{"gzip;q=1.0, *;q=0.1", true},
+	}
+	for _, tc := range tests {
+		if got := acceptsXZ(tc.header); got != tc.want {
+			t.Errorf("acceptsXZ(%q) = %t; want %t", tc.header, got,
+				tc.want)
+		}
+	}
+}
+
+func newText(t *testing.T) []byte {
+	var buf bytes.Buffer
+	io.CopyN(&buf, randtxt.NewReader(rand.NewSource(42)), 50000)
+	return buf.Bytes()
+}
+
+func TestHandler(t *testing.T) {
+	txt := newText(t)
+	ts := httptest.NewServer(Handler(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write(txt)
+		})))
+	defer ts.Close()
+
+	req, err := http.NewRequest("GET", ts.URL, nil)
+	if err != nil {
+		t.Fatalf("NewRequest error %s", err)
+	}
+	req.Header.Set("Accept-Encoding", "xz")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Do error %s", err)
+	}
+	defer resp.Body.Close()
+	if ce := resp.Header.Get("Content-Encoding"); ce != "xz" {
+		t.Fatalf("Content-Encoding %q; want %q", ce, "xz")
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Fatalf("Content-Type %q; want text/plain", ct)
+	}
+	xr, err := xz.NewReader(resp.Body)
+	if err != nil {
+		t.Fatalf("xz.NewReader error %s", err)
+	}
+	out, err := ioutil.ReadAll(xr)
+	if err != nil {
+		t.Fatalf("ReadAll error %s", err)
+	}
+	if !bytes.Equal(out, txt) {
+		t.Fatalf("decompressed body differs from original")
+	}
+}
+
+func TestHandlerNotAccepted(t *testing.T) {
+	ts := httptest.NewServer(Handler(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "hello")
+		})))
+	defer ts.Close()
+
+	req, err := http.NewRequest("GET", ts.URL, nil)
+	if err != nil {
+		t.Fatalf("NewRequest error %s", err)
+	}
+	req.Header.Set("Accept-Encoding", "identity")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Do error %s", err)
+	}
+	defer resp.Body.Close()
+	if ce := resp.Header.Get("Content-Encoding"); ce != "" {
+		t.Fatalf("Content-Encoding %q; want none", ce)
+	}
+	out, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("ReadAll error %s", err)
+	}
+	if string(out) != "hello" {
+		t.Fatalf("body %q; want %q", out, "hello")
+	}
+}
+
+func TestHandlerRange(t *testing.T) {
+	txt := newText(t)
+	dir := t.TempDir()
+	err := ioutil.WriteFile(filepath.Join(dir, "a.txt"), txt, 0644)
+	if err != nil {
+		t.Fatalf("WriteFile error %s", err)
+	}
+	fs := http.FileServer(http.Dir(dir))
+	ts := httptest.NewServer(Handler(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ETag", `"v1"`)
+			fs.ServeHTTP(w, r)
+		})))
+	defer ts.Close()
+
+	req, err := http.NewRequest("GET", ts.URL+"/a.txt", nil)
+	if err != nil {
+		t.Fatalf("NewRequest error %s", err)
+	}
+	req.Header.Set("Accept-Encoding", "xz")
+	req.Header.Set("Range", "bytes=100-199")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Do error %s", err)
+	}
+	out, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("ReadAll error %s", err)
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		t.Fatalf("status %d; want %d", resp.StatusCode,
+			http.StatusPartialContent)
+	}
+	if ce := resp.Header.Get("Content-Encoding"); ce != "" {
+		t.Fatalf("Content-Encoding %q for range; want none", ce)
+	}
+	if !bytes.Equal(out, txt[100:200]) {
+		t.Fatalf("range body differs from original")
+	}
+
+	req.Header.Del("Range")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Do error %s", err)
+	}
+	resp.Body.Close()
+	if ce := resp.Header.Get("Content-Encoding"); ce != "xz" {
+		t.Fatalf("Content-Encoding %q; want %q", ce, "xz")
+	}
+	if ar := resp.Header.Get("Accept-Ranges"); ar != "" {
+		t.Fatalf("Accept-Ranges %q for compressed body; want none",
+			ar)
+	}
+	if etag := resp.Header.Get("ETag"); etag != `W/"v1"` {
+		t.Fatalf("ETag %q; want %q", etag, `W/"v1"`)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	txt := newText(t)
+	ts := httptest.NewServer(Handler(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/empty":
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				w.Write(txt)
+			}
+		})))
+	defer ts.Close()
+
+	client := &http.Client{Transport: &Transport{}}
+	resp, err := client.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Get error %s", err)
+	}
+	out, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("ReadAll error %s", err)
+	}
+	if !resp.Uncompressed {
+		t.Fatalf("response not marked as uncompressed")
+	}
+	if !bytes.Equal(out, txt) {
+		t.Fatalf("body differs from original")
+	}
+
+	resp, err = client.Get(ts.URL + "/empty")
+	if err != nil {
+		t.Fatalf("Get error %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("status %d; want %d", resp.StatusCode,
+			http.StatusNoContent)
+	}
+	if resp.Uncompressed {
+		t.Fatalf("response without body marked as uncompressed")
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpxz
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// RangeReaderAt reads a remote file using HTTP range requests. It
+// implements io.ReaderAt and can be combined with xz.ReadSeekTable or
+// a seek table loaded from a sidecar file to access the uncompressed
+// data of xz files on object storage without downloading them.
+type RangeReaderAt struct {
+	// Client is used for the requests. If nil http.DefaultClient is
+	// used.
+	Client *http.Client
+	// URL of the remote file.
+	URL string
+	// Size of the remote file.
+	Size int64
+}
+
+// NewRangeReaderAt determines the size of the remote file with a HEAD
+// request and returns the reader for it. The server must support range
+// requests.
+func NewRangeReaderAt(client *http.Client, url string) (*RangeReaderAt,
+	error) {
+	r := &RangeReaderAt{Client: client, URL: url}
+	resp, err := r.client().Head(url)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("httpxz: HEAD %s: %s", url, resp.Status)
+	}
+	if resp.Header.Get("Accept-Ranges") != "bytes" {
+		return nil, fmt.Errorf("httpxz: %s doesn't support range "+
+			"requests", url)
+	}
+	if resp.ContentLength < 0 {
+		return nil, fmt.Errorf("httpxz: size of %s unknown", url)
+	}
+	r.Size = resp.ContentLength
+	return r, nil
+}
+
+// client returns the client for the requests.
+func (r *RangeReaderAt) client() *http.Client {
+	if r.Client != nil {
+		return r.Client
+	}
+	return http.DefaultClient
+}
+
+// ReadAt reads len(p) bytes at offset off using a single range request.
+func (r *RangeReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("httpxz: negative offset")
+	}
+	if off >= r.Size {
+		return 0, io.EOF
+	}
+	k := int64(len(p))
+	if k > r.Size-off {
+		k = r.Size - off
+		err = io.EOF
+	}
+	if k == 0 {
+		return 0, err
+	}
+	req, rerr := http.NewRequest(http.MethodGet, r.URL, nil)
+	if rerr != nil {
+		return 0, rerr
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+k-1))
+	resp, rerr := r.client().Do(req)
+	if rerr != nil {
+		return 0, rerr
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, fmt.Errorf("httpxz: range request for %s: %s",
+			r.URL, resp.Status)
+	}
+	n, rerr = io.ReadFull(resp.Body, p[:k])
+	if rerr != nil {
+		if rerr == io.EOF {
+			rerr = io.ErrUnexpectedEOF
+		}
+		return n, rerr
+	}
+	return n, err
+}
@@ -0,0 +1,73 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package httpxz
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ulikunitz/xz"
+)
+
+func TestRangeReaderAt(t *testing.T) {
+	txt := newText(t)
+	var buf bytes.Buffer
+	w, err := xz.WriterConfig{BlockSize: 4096}.NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	if _, err = w.Write(txt); err != nil {
+		t.Fatalf("Write error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("Close error %s", err)
+	}
+	data := buf.Bytes()
+	ranges := 0
+	ts := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Range") != "" {
+				ranges++
+			}
+			http.ServeContent(w, r, "file.xz", time.Time{},
+				bytes.NewReader(data))
+		}))
+	defer ts.Close()
+
+	ra, err := NewRangeReaderAt(nil, ts.URL)
+	if err != nil {
+		t.Fatalf("NewRangeReaderAt error %s", err)
+	}
+	if ra.Size != int64(len(data)) {
+		t.Fatalf("Size is %d; want %d", ra.Size, len(data))
+	}
+	st, err := xz.ReadSeekTable(ra, ra.Size)
+	if err != nil {
+		t.Fatalf("ReadSeekTable error %s", err)
+	}
+	ranges = 0
+	r, err := xz.NewSeekTableReader(ra, st)
+	if err != nil {
+		t.Fatalf("NewSeekTableReader error %s", err)
+	}
+	off := int64(len(txt) / 2)
+	p := make([]byte, 100)
+	n, err := r.ReadAt(p, off)
+	if err != nil {
+		t.Fatalf("ReadAt error %s", err)
+	}
+	if !bytes.Equal(p[:n], txt[off:off+int64(len(p))]) {
+		t.Fatal("ReadAt returned wrong data")
+	}
+	if ranges == 0 || ranges > 4 {
+		t.Fatalf("ReadAt required %d range requests", ranges)
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpxz
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/ulikunitz/xz"
+)
+
+// encoding is the name of the content coding.
+const encoding = "xz"
+
+// Transport is an http.RoundTripper that requests the xz coding and
+// decompresses xz-encoded responses. Like the transport of the net/http
+// package it doesn't touch requests setting Accept-Encoding or Range
+// headers and returns their responses unchanged.
+type Transport struct {
+	// Base is the underlying round tripper. If nil
+	// http.DefaultTransport is used.
+	Base http.RoundTripper
+	// ReaderConfig is used to decompress the responses.
+	ReaderConfig xz.ReaderConfig
+}
+
+// base returns the underlying round tripper.
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+// RoundTrip executes a single HTTP transaction. The request is not
+// modified; a copy is used if the Accept-Encoding header has to be
+// added.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Accept-Encoding") != "" ||
+		req.Header.Get("Range") != "" || req.Method == http.MethodHead {
+		return t.base().RoundTrip(req)
+	}
+	r := req.Clone(req.Context())
+	r.Header.Set("Accept-Encoding", encoding)
+	resp, err := t.base().RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(resp.Header.Get("Content-Encoding"), encoding) {
+		return resp, nil
+	}
+	resp.Body = &body{rc: resp.Body, c: t.ReaderConfig}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return resp, nil
+}
+
+// body decompresses the body of a response. The xz reader is created
+// on the first call to Read, because it reads the stream header.
+type body struct {
+	rc  io.ReadCloser
+	c   xz.ReaderConfig
+	xr  *xz.Reader
+	err error
+}
+
+// Read reads decompressed data.
+func (b *body) Read(p []byte) (n int, err error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	if b.xr == nil {
+		if b.xr, err = b.c.NewReader(b.rc); err != nil {
+			b.err = err
+			return 0, err
+		}
+	}
+	n, err = b.xr.Read(p)
+	if err != nil {
+		b.err = err
+	}
+	return n, err
+}
+
+// Close closes the body of the response.
+func (b *body) Close() error {
+	return b.rc.Close()
+}
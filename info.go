@@ -0,0 +1,381 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// BlockInfo describes a single block of an xz stream as recorded in
+// the stream index.
+type BlockInfo struct {
+	// Offset of the block header in the file.
+	Offset int64
+	// UncompressedOffset is the position of the first uncompressed
+	// byte of the block in the uncompressed file.
+	UncompressedOffset int64
+	// UnpaddedSize is the sum of the block header size, the
+	// compressed size and the check size.
+	UnpaddedSize int64
+	// UncompressedSize is the size of the uncompressed data.
+	UncompressedSize int64
+}
+
+// TotalSize returns the size of the block including the block padding.
+func (b *BlockInfo) TotalSize() int64 {
+	return b.UnpaddedSize + int64(padLen(b.UnpaddedSize))
+}
+
+// StreamInfo describes a single xz stream in a file.
+type StreamInfo struct {
+	// Offset of the stream header in the file.
+	Offset int64
+	// UncompressedOffset is the position of the first uncompressed
+	// byte of the stream in the uncompressed file.
+	UncompressedOffset int64
+	// Size is the size of the stream including header, index and
+	// footer but without the stream padding.
+	Size int64
+	// UncompressedSize is the size of the uncompressed data.
+	UncompressedSize int64
+	// CheckSum identifies the check method: CRC32, CRC64 or SHA256.
+	CheckSum byte
+	// IndexSize gives the size of the index.
+	IndexSize int64
+	// Padding is the size of the stream padding following the
+	// stream.
+	Padding int64
+	// Blocks lists the blocks of the stream.
+	Blocks []BlockInfo
+}
+
+// errFileSize indicates that the file size is not a multiple of four.
+// It matches io.ErrUnexpectedEOF, since the most common cause is a
+// truncated file.
+var errFileSize = fmt.Errorf("xz: file size is not a multiple of four: %w",
+	io.ErrUnexpectedEOF)
+
+// ReadStreamInfo reads the stream footers, indexes and headers of an
+// xz file starting from its end. The data of the blocks is not read
+// and therefore not checked. The argument size must provide the size
+// of the file. The returned streams are ordered by their offset.
+func ReadStreamInfo(xz io.ReaderAt, size int64) (streams []StreamInfo,
+	err error) {
+
+	if size%4 != 0 {
+		return nil, errFileSize
+	}
+	pos := size
+	for pos > 0 {
+		var s StreamInfo
+		if pos, err = readStreamInfo(xz, pos, &s); err != nil {
+			return nil, err
+		}
+		streams = append(streams, s)
+	}
+	if len(streams) == 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	// reverse the streams and compute the uncompressed offsets
+	for i, j := 0, len(streams)-1; i < j; i, j = i+1, j-1 {
+		streams[i], streams[j] = streams[j], streams[i]
+	}
+	var u int64
+	for i := range streams {
+		s := &streams[i]
+		s.UncompressedOffset = u
+		c := s.Offset + HeaderLen
+		for j := range s.Blocks {
+			b := &s.Blocks[j]
+			b.Offset = c
+			b.UncompressedOffset = u
+			c += b.TotalSize()
+			u += b.UncompressedSize
+		}
+	}
+	return streams, nil
+}
+
+// errBackwardSize returns the error for a backward size in the footer
+// that doesn't point to the start of an index.
+func errBackwardSize(f *footer) error {
+	return errorf(ErrStreamFooter, "xz: backward size %d in stream "+
+		"footer doesn't point to an index", f.indexSize)
+}
+
+// readStreamInfo reads the information for the stream that ends at
+// position end, possibly followed by stream padding. The function
+// returns the offset of the stream header.
+func readStreamInfo(xz io.ReaderAt, end int64, s *StreamInfo) (start int64,
+	err error) {
+
+	p := make([]byte, footerLen)
+
+	// stream padding
+	for {
+		if end < 4 {
+			return 0, io.ErrUnexpectedEOF
+		}
+		if _, err = xz.ReadAt(p[:4], end-4); err != nil {
+			return 0, err
+		}
+		if !allZeros(p[:4]) {
+			break
+		}
+		end -= 4
+		s.Padding += 4
+	}
+
+	// footer
+	if end < HeaderLen+footerLen {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if _, err = xz.ReadAt(p, end-footerLen); err != nil {
+		return 0, err
+	}
+	var f footer
+	if err = f.UnmarshalBinary(p); err != nil {
+		return 0, err
+	}
+
+	// index
+	indexStart := end - footerLen - f.indexSize
+	if indexStart < HeaderLen {
+		return 0, errBackwardSize(&f)
+	}
+	br := bufio.NewReader(io.NewSectionReader(xz, indexStart,
+		f.indexSize))
+	c, err := br.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if c != 0 {
+		return 0, errBackwardSize(&f)
+	}
+	// Every record requires at least two bytes. The index indicator,
+	// the number of records and the CRC-32 need at least six bytes.
+	maxRecords := int64(0)
+	if f.indexSize > 6 {
+		maxRecords = (f.indexSize - 6) / 2
+	}
+	records, n, err := readIndexBody(br, maxRecords)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
+	if n+1 != f.indexSize {
+		return 0, errFooterIndexSize(&f, n+1)
+	}
+
+	// header
+	start = indexStart - HeaderLen
+	s.Blocks = make([]BlockInfo, len(records))
+	for i, rec := range records {
+		b := &s.Blocks[i]
+		b.UnpaddedSize = rec.unpaddedSize
+		b.UncompressedSize = rec.uncompressedSize
+		start -= b.TotalSize()
+		if start < 0 {
+			return 0, errIndex
+		}
+		s.UncompressedSize += rec.uncompressedSize
+	}
+	if _, err = xz.ReadAt(p, start); err != nil {
+		return 0, err
+	}
+	var h header
+	if err = h.UnmarshalBinary(p); err != nil {
+		return 0, err
+	}
+	if err = f.verifyHeader(&h); err != nil {
+		return 0, err
+	}
+
+	s.Offset = start
+	s.Size = end - start
+	s.CheckSum = h.flags
+	s.IndexSize = f.indexSize
+	return start, nil
+}
+
+// blockReadBufLen is the size of the buffer used to read a block with
+// NewBlockReader.
+const blockReadBufLen = 1 << 16
+
+// NewBlockReader returns a reader for the uncompressed data of the
+// block b of the stream s. Both must have been returned by
+// ReadStreamInfo. The checksum of the block is verified after all data
+// has been read and the sizes of the block are compared with the values
+// of b, which come from the index. The function allows the
+// decompression of parts of a file without reading the blocks in front
+// of it.
+func (c ReaderConfig) NewBlockReader(xz io.ReaderAt, s *StreamInfo,
+	b *BlockInfo) (r io.Reader, err error) {
+
+	if err = c.Verify(); err != nil {
+		return nil, err
+	}
+	if err = c.checkFlags(s.CheckSum); err != nil {
+		return nil, err
+	}
+	newHash, err := newHashFunc(s.CheckSum)
+	if err != nil {
+		return nil, err
+	}
+	// The buffer reduces the number of calls to ReadAt, which may be
+	// expensive for remote files.
+	sr := bufio.NewReaderSize(
+		io.NewSectionReader(xz, b.Offset, b.TotalSize()),
+		blockReadBufLen)
+	bh, hlen, err := readBlockHeader(sr)
+	if err != nil {
+		if err == errIndexIndicator {
+			err = errorf(ErrBlockHeader,
+				"xz: no block header at block offset")
+		}
+		return nil, err
+	}
+	if err = c.checkBlockHeader(bh); err != nil {
+		return nil, err
+	}
+	br, err := c.newBlockReader(sr, bh, hlen, newHash(), nil)
+	if err != nil {
+		return nil, err
+	}
+	br.setPosition(s.CheckSum, blockIndex(s, b), b.Offset,
+		b.UncompressedOffset)
+	br.index = &record{b.UnpaddedSize, b.UncompressedSize}
+	return br, nil
+}
+
+// blockIndex returns the index of b in the blocks of s or -1 if b
+// isn't an element of s.Blocks.
+func blockIndex(s *StreamInfo, b *BlockInfo) int {
+	for i := range s.Blocks {
+		if &s.Blocks[i] == b {
+			return i
+		}
+	}
+	return -1
+}
+
+// maxBlockHeaderLen is the maximum length of a block header.
+const maxBlockHeaderLen = 1024
+
+// VerifyStructure checks the structure of an xz file using the default
+// reader configuration. See ReaderConfig.VerifyStructure.
+func VerifyStructure(xz io.ReaderAt, size int64) (streams []StreamInfo,
+	err error) {
+	return ReaderConfig{}.VerifyStructure(xz, size)
+}
+
+// VerifyStructure checks the structure of an xz file without reading
+// the compressed data. Only the stream footers, indexes, stream
+// headers and block headers are read, which is a small fraction of the
+// file. This makes the function suitable for auditing large files
+// accessed by range requests. The block headers must be consistent
+// with the index and use supported filters within the dictionary
+// capacity limit of the configuration. The checks of the data are not
+// verified. The function returns the same information as
+// ReadStreamInfo.
+func (c ReaderConfig) VerifyStructure(xz io.ReaderAt, size int64,
+) (streams []StreamInfo, err error) {
+	if err = c.Verify(); err != nil {
+		return nil, err
+	}
+	if streams, err = ReadStreamInfo(xz, size); err != nil {
+		return nil, err
+	}
+	for i := range streams {
+		s := &streams[i]
+		if err = c.checkFlags(s.CheckSum); err != nil {
+			return nil, err
+		}
+		newHash, err := newHashFunc(s.CheckSum)
+		if err != nil {
+			return nil, err
+		}
+		checkLen := int64(newHash().Size())
+		for j := range s.Blocks {
+			err = c.verifyBlockHeader(xz, &s.Blocks[j], checkLen)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return streams, nil
+}
+
+// readBlockHeaderAt reads the header of block b.
+func readBlockHeaderAt(xz io.ReaderAt, b *BlockInfo) (bh *blockHeader,
+	hlen int, err error) {
+
+	// a single read is sufficient for the header
+	sr := bufio.NewReaderSize(
+		io.NewSectionReader(xz, b.Offset, b.TotalSize()),
+		maxBlockHeaderLen)
+	bh, hlen, err = readBlockHeader(sr)
+	if err != nil {
+		if err == errIndexIndicator {
+			err = errorf(ErrBlockHeader,
+				"xz: no block header at block offset")
+		}
+		return nil, 0, err
+	}
+	return bh, hlen, nil
+}
+
+// verifyBlockHeader reads the header of block b and checks it against
+// the index record.
+func (c *ReaderConfig) verifyBlockHeader(xz io.ReaderAt, b *BlockInfo,
+	checkLen int64) error {
+
+	bh, hlen, err := readBlockHeaderAt(xz, b)
+	if err != nil {
+		return err
+	}
+	if err = c.checkBlockHeader(bh); err != nil {
+		return err
+	}
+	n := b.UnpaddedSize - int64(hlen) - checkLen
+	if n <= 0 {
+		return errorf(ErrIndex, "xz: unpadded size in index too "+
+			"small for block")
+	}
+	if bh.compressedSize >= 0 && bh.compressedSize != n {
+		return errorf(ErrBlockHeader, "xz: compressed size in "+
+			"block header doesn't match index")
+	}
+	if bh.uncompressedSize >= 0 &&
+		bh.uncompressedSize != b.UncompressedSize {
+		return errorf(ErrBlockHeader, "xz: uncompressed size in "+
+			"block header doesn't match index")
+	}
+	if err = verifyFilters(bh.filters); err != nil {
+		return err
+	}
+	for _, f := range bh.filters {
+		if sf, ok := f.(*specFilter); ok {
+			return sf.errUnsupported()
+		}
+		lf, ok := f.(*lzmaFilter)
+		if !ok {
+			continue
+		}
+		if c.DictCapLimit > 0 && lf.dictCap > int64(c.DictCapLimit) {
+			return &lzma.DictCapLimitError{
+				DictCap: lf.dictCap,
+				Limit:   int64(c.DictCapLimit),
+			}
+		}
+	}
+	return nil
+}
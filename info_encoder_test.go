@@ -0,0 +1,128 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package xz
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/ulikunitz/xz/internal/randtxt"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+func TestNewBlockReader(t *testing.T) {
+	parts := []string{"The quick brown fox ", "jumps over ",
+		"the lazy dog."}
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	for _, s := range parts {
+		if _, err = io.WriteString(w, s); err != nil {
+			t.Fatalf("WriteString error %s", err)
+		}
+		if err = w.EndBlock(); err != nil {
+			t.Fatalf("EndBlock error %s", err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("Close error %s", err)
+	}
+	xz := bytes.NewReader(buf.Bytes())
+	streams, err := ReadStreamInfo(xz, int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("ReadStreamInfo error %s", err)
+	}
+	s := &streams[0]
+	// read the blocks in reverse order
+	for i := len(s.Blocks) - 1; i >= 0; i-- {
+		r, err := ReaderConfig{}.NewBlockReader(xz, s, &s.Blocks[i])
+		if err != nil {
+			t.Fatalf("NewBlockReader error %s", err)
+		}
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("ReadAll error %s", err)
+		}
+		if string(data) != parts[i] {
+			t.Fatalf("block %d: got %q; want %q", i, data, parts[i])
+		}
+	}
+
+	// The block must be checked against the index record.
+	b := s.Blocks[0]
+	b.UncompressedSize++
+	r, err := ReaderConfig{}.NewBlockReader(xz, s, &b)
+	if err != nil {
+		t.Fatalf("NewBlockReader error %s", err)
+	}
+	_, err = ioutil.ReadAll(r)
+	if err == nil || !strings.Contains(err.Error(), "index record") {
+		t.Fatalf("ReadAll returned %v; want index record error", err)
+	}
+
+	// A checksum error reports the position of the block.
+	data := append([]byte(nil), buf.Bytes()...)
+	c := &s.Blocks[2]
+	data[c.Offset+c.TotalSize()-1] ^= 1
+	r, err = ReaderConfig{}.NewBlockReader(bytes.NewReader(data), s, c)
+	if err != nil {
+		t.Fatalf("NewBlockReader error %s", err)
+	}
+	_, err = ioutil.ReadAll(r)
+	var ce *ChecksumError
+	if !errors.As(err, &ce) {
+		t.Fatalf("ReadAll returned %v; want ChecksumError", err)
+	}
+	if ce.Block != 2 || ce.Offset != c.Offset ||
+		ce.UncompressedOffset != c.UncompressedOffset {
+		t.Fatalf("got %s; want block 2 at offset %d, uncompressed "+
+			"offset %d", ce, c.Offset, c.UncompressedOffset)
+	}
+}
+
+func TestVerifyStructureReads(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := WriterConfig{BlockSize: 1 << 16}.NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	txt := randtxt.NewReader(rand.NewSource(5))
+	if _, err = io.CopyN(w, txt, 1<<20); err != nil {
+		t.Fatalf("CopyN error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("Close error %s", err)
+	}
+	ra := &countingReaderAt{r: bytes.NewReader(buf.Bytes())}
+	streams, err := VerifyStructure(ra, int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("VerifyStructure error %s", err)
+	}
+	if n := len(streams[0].Blocks); n != 16 {
+		t.Fatalf("got %d blocks; want %d", n, 16)
+	}
+	// at most the maximum block header length is read per block
+	if ra.n > int64(buf.Len())/10 {
+		t.Fatalf("read %d of %d bytes", ra.n, buf.Len())
+	}
+
+	c := ReaderConfig{DictCapLimit: 1 << 20}
+	ra.n = 0
+	_, err = c.VerifyStructure(ra, int64(buf.Len()))
+	if _, ok := err.(*lzma.DictCapLimitError); !ok {
+		t.Fatalf("VerifyStructure returned %v; want DictCapLimitError",
+			err)
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadStreamInfo(t *testing.T) {
+	data, err := ioutil.ReadFile("fox.xz")
+	if err != nil {
+		t.Fatalf("ReadFile error %s", err)
+	}
+	m := make([]byte, 0, 2*len(data)+8)
+	m = append(m, data...)
+	m = append(m, 0, 0, 0, 0, 0, 0, 0, 0)
+	m = append(m, data...)
+	streams, err := ReadStreamInfo(bytes.NewReader(m), int64(len(m)))
+	if err != nil {
+		t.Fatalf("ReadStreamInfo error %s", err)
+	}
+	if len(streams) != 2 {
+		t.Fatalf("got %d streams; want %d", len(streams), 2)
+	}
+	s := streams[0]
+	if s.Offset != 0 {
+		t.Errorf("streams[0].Offset is %d; want %d", s.Offset, 0)
+	}
+	if s.Size != int64(len(data)) {
+		t.Errorf("streams[0].Size is %d; want %d", s.Size, len(data))
+	}
+	if s.Padding != 8 {
+		t.Errorf("streams[0].Padding is %d; want %d", s.Padding, 8)
+	}
+	if len(s.Blocks) != 1 {
+		t.Fatalf("streams[0] has %d blocks; want %d",
+			len(s.Blocks), 1)
+	}
+	if s.Blocks[0].Offset != HeaderLen {
+		t.Errorf("block offset is %d; want %d", s.Blocks[0].Offset,
+			HeaderLen)
+	}
+	if s.CheckSum != CRC64 {
+		t.Errorf("check is %s; want %s", flagString(s.CheckSum),
+			flagString(CRC64))
+	}
+	s = streams[1]
+	if s.Offset != int64(len(data))+8 {
+		t.Errorf("streams[1].Offset is %d; want %d", s.Offset,
+			len(data)+8)
+	}
+	if s.UncompressedOffset != streams[0].UncompressedSize {
+		t.Errorf("streams[1].UncompressedOffset is %d; want %d",
+			s.UncompressedOffset, streams[0].UncompressedSize)
+	}
+	if s.Blocks[0].UncompressedOffset != s.UncompressedOffset {
+		t.Errorf("block uncompressed offset is %d; want %d",
+			s.Blocks[0].UncompressedOffset, s.UncompressedOffset)
+	}
+}
+
+func TestReadStreamInfoTruncated(t *testing.T) {
+	data, err := ioutil.ReadFile("fox.xz")
+	if err != nil {
+		t.Fatalf("ReadFile error %s", err)
+	}
+	data = data[4:]
+	if _, err = ReadStreamInfo(bytes.NewReader(data),
+		int64(len(data))); err == nil {
+		t.Fatal("ReadStreamInfo succeeded for truncated file")
+	}
+}
+
+// countingReaderAt counts the bytes read.
+type countingReaderAt struct {
+	r io.ReaderAt
+	n int64
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	n, err = c.r.ReadAt(p, off)
+	c.n += int64(n)
+	return n, err
+}
+
+func TestVerifyStructure(t *testing.T) {
+	for _, name := range []string{"good-1-block_header-sizes.xz",
+		"good-2-blocks.xz", "good-0cat-empty.xz"} {
+		data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatalf("ReadFile error %s", err)
+		}
+		if _, err = VerifyStructure(bytes.NewReader(data),
+			int64(len(data))); err != nil {
+			t.Errorf("%s: VerifyStructure error %s", name, err)
+		}
+	}
+	for _, name := range []string{
+		"bad-1-block_header-compressed_size.xz",
+		"bad-1-block_header-uncompressed_size.xz",
+		"bad-1-block_header-filter.xz",
+		"bad-1-block_header-dict_size.xz",
+		"bad-1-block_header-crc.xz",
+		"bad-1-index-unpadded_size.xz",
+		"bad-0-footer_magic.xz",
+	} {
+		data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatalf("ReadFile error %s", err)
+		}
+		if _, err = VerifyStructure(bytes.NewReader(data),
+			int64(len(data))); err == nil {
+			t.Errorf("%s: VerifyStructure returned no error", name)
+		}
+	}
+}
+
+func TestVerifyStructureUnsupportedFilter(t *testing.T) {
+	for _, name := range []string{"good-1-delta-lzma2.xz",
+		"good-1-x86-lzma2.xz"} {
+		data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatalf("ReadFile error %s", err)
+		}
+		_, err = VerifyStructure(bytes.NewReader(data),
+			int64(len(data)))
+		if err == nil || !strings.Contains(err.Error(), "unsupported") {
+			t.Errorf("%s: VerifyStructure returned %v; "+
+				"want unsupported filter error", name, err)
+		}
+	}
+}
+
+// TestTruncatedConcatenation checks that a truncated stream followed
+// by a complete stream is rejected. The footer of the complete stream
+// must not be mistaken for the footer of the truncated one.
+func TestTruncatedConcatenation(t *testing.T) {
+	data, err := ioutil.ReadFile("fox.xz")
+	if err != nil {
+		t.Fatalf("ReadFile error %s", err)
+	}
+	for n := HeaderLen; n < len(data); n++ {
+		xz := append(append([]byte(nil), data[:n]...), data...)
+		if _, err = ReadStreamInfo(bytes.NewReader(xz),
+			int64(len(xz))); err == nil {
+			t.Fatalf("ReadStreamInfo accepted stream truncated "+
+				"to %d bytes", n)
+		}
+		r, err := NewReader(bytes.NewReader(xz))
+		if err == nil {
+			_, err = ioutil.ReadAll(r)
+		}
+		if err == nil {
+			t.Fatalf("Reader accepted stream truncated to %d bytes",
+				n)
+		}
+	}
+}
+
+func TestFooterBackwardSize(t *testing.T) {
+	data, err := ioutil.ReadFile("fox.xz")
+	if err != nil {
+		t.Fatalf("ReadFile error %s", err)
+	}
+	f := footer{indexSize: 16, flags: CRC64}
+	p, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary error %s", err)
+	}
+	copy(data[len(data)-footerLen:], p)
+	_, err = ReadStreamInfo(bytes.NewReader(data), int64(len(data)))
+	if err == nil || !strings.Contains(err.Error(), "backward size") {
+		t.Errorf("ReadStreamInfo returned %v; want backward size error",
+			err)
+	}
+	if Backend != "go" {
+		return
+	}
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	_, err = ioutil.ReadAll(r)
+	if err == nil || !strings.Contains(err.Error(), "backward size") {
+		t.Errorf("ReadAll returned %v; want backward size error", err)
+	}
+}
+
+func TestIndexRecordCount(t *testing.T) {
+	data, err := ioutil.ReadFile("fox.xz")
+	if err != nil {
+		t.Fatalf("ReadFile error %s", err)
+	}
+	var f footer
+	if err = f.UnmarshalBinary(data[len(data)-footerLen:]); err != nil {
+		t.Fatalf("footer UnmarshalBinary error %s", err)
+	}
+	// the index of fox.xz has a single record
+	i := int64(len(data)-footerLen) - f.indexSize + 1
+	data[i] = 0x7f
+	_, err = ReadStreamInfo(bytes.NewReader(data), int64(len(data)))
+	if err == nil || !strings.Contains(err.Error(), "at most") {
+		t.Errorf("ReadStreamInfo returned %v; want record limit error",
+			err)
+	}
+	if Backend != "go" {
+		return
+	}
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	_, err = ioutil.ReadAll(r)
+	if err == nil || !strings.Contains(err.Error(), "at most 1") {
+		t.Errorf("ReadAll returned %v; want record limit error", err)
+	}
+}
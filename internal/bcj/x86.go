@@ -0,0 +1,113 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package bcj implements the branch/call/jump converters of the LZMA
+// SDK and XZ Utils. They convert the relative addresses of branch
+// instructions into absolute addresses, which improves the compression
+// of executable code.
+package bcj
+
+// X86 converts the relative addresses of the x86 CALL (E8) and JMP
+// (E9) instructions. The converter keeps state between the calls of
+// Convert, so data can be converted in pieces. The algorithm is the one
+// of XZ Utils.
+type X86 struct {
+	encoding bool
+	// pos is the position of the next byte to convert
+	pos uint32
+	// prevPos is the position of the last E8 or E9 byte
+	prevPos  uint32
+	prevMask uint32
+}
+
+// NewX86 creates a converter. Encoding converts relative addresses into
+// absolute addresses, decoding reverts the conversion. The argument pos
+// gives the start position of the data, which is zero for the formats
+// supported by the module.
+func NewX86(encoding bool, pos uint32) *X86 {
+	return &X86{encoding: encoding, pos: pos, prevPos: pos - 5}
+}
+
+// test86MSByte checks whether the byte is 0x00 or 0xff.
+func test86MSByte(b byte) bool {
+	return (b+1)&0xfe == 0
+}
+
+var (
+	maskToAllowed = [8]bool{true, true, true, false, true, false,
+		false, false}
+	maskToBitNumber = [8]uint32{0, 1, 2, 2, 3, 3, 3, 3}
+)
+
+// Convert converts the data in place and returns the number of bytes
+// converted. The remaining bytes at the end of data, at most four, need
+// the following bytes for their conversion; they must be provided again
+// at the start of the next call. At the end of the input the remaining
+// bytes are left unconverted.
+func (x *X86) Convert(data []byte) int {
+	if len(data) < 5 {
+		return 0
+	}
+	prevMask, prevPos := x.prevMask, x.prevPos
+	if x.pos-prevPos > 5 {
+		prevPos = x.pos - 5
+	}
+	limit := len(data) - 5
+	i := 0
+	for i <= limit {
+		b := data[i]
+		if b != 0xe8 && b != 0xe9 {
+			i++
+			continue
+		}
+		off := x.pos + uint32(i) - prevPos
+		prevPos = x.pos + uint32(i)
+		if off > 5 {
+			prevMask = 0
+		} else {
+			for k := uint32(0); k < off; k++ {
+				prevMask &= 0x77
+				prevMask <<= 1
+			}
+		}
+		b = data[i+4]
+		if !(test86MSByte(b) && maskToAllowed[(prevMask>>1)&7] &&
+			prevMask>>1 < 0x10) {
+			i++
+			prevMask |= 1
+			if test86MSByte(b) {
+				prevMask |= 0x10
+			}
+			continue
+		}
+		src := uint32(b)<<24 | uint32(data[i+3])<<16 |
+			uint32(data[i+2])<<8 | uint32(data[i+1])
+		cur := x.pos + uint32(i) + 5
+		var dest uint32
+		for {
+			if x.encoding {
+				dest = src + cur
+			} else {
+				dest = src - cur
+			}
+			if prevMask == 0 {
+				break
+			}
+			n := maskToBitNumber[prevMask>>1]
+			if !test86MSByte(byte(dest >> (24 - n*8))) {
+				break
+			}
+			src = dest ^ (1<<(32-n*8) - 1)
+		}
+		data[i+4] = ^byte((dest>>24)&1 - 1)
+		data[i+3] = byte(dest >> 16)
+		data[i+2] = byte(dest >> 8)
+		data[i+1] = byte(dest)
+		i += 5
+		prevMask = 0
+	}
+	x.prevMask, x.prevPos = prevMask, prevPos
+	x.pos += uint32(i)
+	return i
+}
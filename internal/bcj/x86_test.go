@@ -0,0 +1,79 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bcj
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// codeLike creates random data with many CALL and JMP opcodes and
+// addresses starting with 0x00 or 0xff.
+func codeLike(n int) []byte {
+	rng := rand.New(rand.NewSource(1))
+	data := make([]byte, n)
+	for i := range data {
+		switch rng.Intn(8) {
+		case 0:
+			data[i] = 0xe8
+		case 1:
+			data[i] = 0xe9
+		case 2:
+			data[i] = 0x00
+		case 3:
+			data[i] = 0xff
+		default:
+			data[i] = byte(rng.Intn(256))
+		}
+	}
+	return data
+}
+
+// convertPieces converts the data in pieces of the given size like a
+// streaming filter.
+func convertPieces(x *X86, data []byte, size int) {
+	start, end := 0, 0
+	for end < len(data) {
+		end += size
+		if end > len(data) {
+			end = len(data)
+		}
+		start += x.Convert(data[start:end])
+	}
+}
+
+func TestX86(t *testing.T) {
+	orig := codeLike(10000)
+	want := append([]byte(nil), orig...)
+	NewX86(true, 0).Convert(want)
+	if bytes.Equal(want, orig) {
+		t.Fatal("encoding didn't change the data")
+	}
+	for _, size := range []int{1, 3, 5, 17, 4096} {
+		data := append([]byte(nil), orig...)
+		convertPieces(NewX86(true, 0), data, size)
+		if !bytes.Equal(data, want) {
+			t.Fatalf("size %d: encoding in pieces differs", size)
+		}
+		convertPieces(NewX86(false, 0), data, size)
+		if !bytes.Equal(data, orig) {
+			t.Fatalf("size %d: decoding didn't restore the data",
+				size)
+		}
+	}
+}
+
+func TestX86Call(t *testing.T) {
+	// CALL with relative address 0x10 at position 0x20
+	data := make([]byte, 0x30)
+	copy(data[0x20:], []byte{0xe8, 0x10, 0x00, 0x00, 0x00})
+	NewX86(true, 0).Convert(data)
+	// absolute address: 0x20 + 5 + 0x10
+	want := []byte{0xe8, 0x35, 0x00, 0x00, 0x00}
+	if !bytes.Equal(data[0x20:0x25], want) {
+		t.Fatalf("got % x; want % x", data[0x20:0x25], want)
+	}
+}
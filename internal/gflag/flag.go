@@ -486,6 +486,39 @@ func Var(value Value, name string, hasArg HasArg) {
 	CommandLine.Var(value, name, hasArg)
 }
 
+// VisitAll calls fn for each flag of the flag set. Every flag is
+// visited only once, even if it has multiple names. The flags are
+// visited in lexicographical order of their long names; flags having
+// only shorthands are sorted by their shorthands.
+func (f *FlagSet) VisitAll(fn func(*Flag)) {
+	seen := make(map[*Flag]bool, len(f.formal))
+	flags := make([]*Flag, 0, len(f.formal))
+	for _, flag := range f.formal {
+		if seen[flag] {
+			continue
+		}
+		seen[flag] = true
+		flags = append(flags, flag)
+	}
+	key := func(flag *Flag) string {
+		if flag.Name != "" {
+			return flag.Name
+		}
+		return flag.Shorthands
+	}
+	sort.Slice(flags, func(i, j int) bool {
+		return key(flags[i]) < key(flags[j])
+	})
+	for _, flag := range flags {
+		fn(flag)
+	}
+}
+
+// VisitAll calls fn for each flag of the command line.
+func VisitAll(fn func(*Flag)) {
+	CommandLine.VisitAll(fn)
+}
+
 // addLine adds a usage line to the flag set.
 func (f *FlagSet) addLine(l line) {
 	if l.flags == "" {
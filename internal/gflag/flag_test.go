@@ -145,3 +145,25 @@ func TestFlagSet_Preset(t *testing.T) {
 		t.Errorf("preset is %d; want %d", *n, 8)
 	}
 }
+
+func TestFlagSet_VisitAll(t *testing.T) {
+	f := NewFlagSet("VisitAll", ContinueOnError)
+	f.BoolP("test-b", "b", false, "")
+	f.String("test-a", "", "")
+	var preset int
+	f.PresetVar(&preset, 1, 2, 1, "")
+
+	var names []string
+	f.VisitAll(func(flag *Flag) {
+		names = append(names, flag.Name+"/"+flag.Shorthands)
+	})
+	want := []string{"/1", "/2", "test-a/", "test-b/b"}
+	if len(names) != len(want) {
+		t.Fatalf("visited %v; want %v", names, want)
+	}
+	for i, name := range names {
+		if name != want[i] {
+			t.Fatalf("visited %v; want %v", names, want)
+		}
+	}
+}
@@ -44,6 +44,7 @@ const (
 	Lnowarn                   // suppresses output from Warn[f|ln]
 	Lnoprint                  // suppresses output from Print[f|ln]
 	Lnodebug                  // suppresses output from Debug[f|ln]
+	Lnoerror                  // suppresses output from Error[f|ln]
 	// initial values for the standard logger
 	Lstdflags = Ldate | Ltime | Lnodebug
 )
@@ -288,6 +289,42 @@ func Fatalln(format string, v ...interface{}) {
 	os.Exit(1)
 }
 
+// Error prints the message like Print. The printing might be
+// suppressed by the flag Lnoerror.
+func (l *Logger) Error(v ...interface{}) {
+	l.Output(2, Lnoerror, v...)
+}
+
+// Error prints the message like Print. The printing might be
+// suppressed by the flag Lnoerror.
+func Error(v ...interface{}) {
+	std.Output(2, Lnoerror, v...)
+}
+
+// Errorf prints the message like Printf. The printing might be
+// suppressed by the flag Lnoerror.
+func (l *Logger) Errorf(format string, v ...interface{}) {
+	l.Outputf(2, Lnoerror, format, v...)
+}
+
+// Errorf prints the message like Printf. The printing might be
+// suppressed by the flag Lnoerror.
+func Errorf(format string, v ...interface{}) {
+	std.Outputf(2, Lnoerror, format, v...)
+}
+
+// Errorln prints the message like Println. The printing might be
+// suppressed by the flag Lnoerror.
+func (l *Logger) Errorln(v ...interface{}) {
+	l.Outputln(2, Lnoerror, v...)
+}
+
+// Errorln prints the message like Println. The printing might be
+// suppressed by the flag Lnoerror.
+func Errorln(v ...interface{}) {
+	std.Outputln(2, Lnoerror, v...)
+}
+
 // Warn prints the message like Print. The printing might be suppressed
 // by the flag Lnowarn.
 func (l *Logger) Warn(v ...interface{}) {
@@ -0,0 +1,250 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// The compression levels correspond to the presets -0 to -9 of the xz
+// tool. The constants have the names of the compress/gzip package, so
+// that code using NewWriterLevel of gzip can be migrated easily. The
+// level values of gzip between BestSpeed and BestCompression are valid
+// xz levels. The xz format has no equivalents for NoCompression and
+// HuffmanOnly.
+const (
+	BestSpeed          = 0
+	BestCompression    = 9
+	DefaultCompression = -1
+)
+
+// defaultLevel is the level used for DefaultCompression.
+const defaultLevel = 6
+
+// ExtremeDepth is the match finder depth of the extreme presets of the
+// xz tool, the levels with suffix e. It compresses slightly better than
+// the default depth but takes more time.
+const ExtremeDepth = 256
+
+// levelDictCaps gives the dictionary capacities of the compression
+// levels. They follow the xz tool.
+var levelDictCaps = [10]int{
+	1 << 18, 1 << 20, 1 << 21, 1 << 22, 1 << 22,
+	1 << 23, 1 << 23, 1 << 24, 1 << 25, 1 << 26,
+}
+
+// LevelConfig returns the writer configuration for the given
+// compression level.
+func LevelConfig(level int) (WriterConfig, error) {
+	if level == DefaultCompression {
+		level = defaultLevel
+	}
+	if !(BestSpeed <= level && level <= BestCompression) {
+		return WriterConfig{}, fmt.Errorf(
+			"xz: invalid compression level: %d", level)
+	}
+	c := WriterConfig{
+		Properties: &lzma.Properties{LC: 3, LP: 0, PB: 2},
+		DictCap:    levelDictCaps[level],
+		Matcher:    lzma.HashTable4,
+	}
+	// Verify fills in the defaults, which must not be fixed before
+	// the caller adjusted parameters like Workers.
+	v := c
+	if err := v.Verify(); err != nil {
+		return WriterConfig{}, err
+	}
+	return c, nil
+}
+
+// presetMatchers maps the match finder names of the xz tool to the
+// match algorithms.
+var presetMatchers = map[string]lzma.MatchAlgorithm{
+	"hc4": lzma.HashTable4,
+	"bt4": lzma.BinaryTree,
+}
+
+// presetChecks maps the check names of the xz tool to the check types.
+var presetChecks = map[string]byte{
+	"crc32":  CRC32,
+	"crc64":  CRC64,
+	"sha256": SHA256,
+}
+
+// parseLevel parses a preset level with an optional suffix e for the
+// extreme variant.
+func parseLevel(s string) (level int, extreme bool, err error) {
+	t := strings.TrimSuffix(s, "e")
+	extreme = t != s
+	level, err = strconv.Atoi(t)
+	if err != nil || s == "" || s[0] < '0' || s[0] > '9' ||
+		level > BestCompression {
+		return 0, false, fmt.Errorf("xz: invalid preset %q", s)
+	}
+	return level, extreme, nil
+}
+
+// presetConfig returns the configuration for a level parsed by
+// parseLevel.
+func presetConfig(level int, extreme bool) (WriterConfig, error) {
+	c, err := LevelConfig(level)
+	if err != nil {
+		return WriterConfig{}, err
+	}
+	if extreme {
+		c.Depth = ExtremeDepth
+	}
+	return c, nil
+}
+
+// parseSize parses a byte count that may be followed by one of the
+// binary suffixes KiB, MiB or GiB. As in the xz tool the suffixes K, M
+// and G are binary units as well.
+func parseSize(s string) (n int64, err error) {
+	t := strings.ToLower(s)
+	var shift uint
+	for i, suffixes := range [][]string{
+		{"kib", "ki", "kb", "k"},
+		{"mib", "mi", "mb", "m"},
+		{"gib", "gi", "gb", "g"},
+	} {
+		for _, suffix := range suffixes {
+			if strings.HasSuffix(t, suffix) {
+				t = strings.TrimSuffix(t, suffix)
+				shift = 10 * uint(i+1)
+				break
+			}
+		}
+		if shift > 0 {
+			break
+		}
+	}
+	n, err = strconv.ParseInt(t, 10, 64)
+	if err != nil || n < 0 || n > math.MaxInt64>>shift {
+		return 0, fmt.Errorf("xz: invalid size %q", s)
+	}
+	return n << shift, nil
+}
+
+// ParsePreset returns the writer configuration for a preset given in
+// the notation of the xz tool, so that command line tools and
+// configuration files can specify compression settings portably. The
+// preset is either a level from "0" to "9" or a comma-separated list of
+// name=value pairs, for instance "preset=3,dict=32MiB". The following
+// names are supported:
+//
+//	preset  level from 0 to 9; resets the LZMA2 options given before
+//	depth   number of match candidates checked per position
+//	dict    dictionary capacity with an optional suffix KiB, MiB or GiB
+//	lc      number of literal context bits
+//	lp      number of literal position bits
+//	pb      number of position bits
+//	mf      match finder: hc4 or bt4
+//	check   check type: crc32, crc64 or sha256
+//	block   block size with an optional suffix
+//
+// Levels may have the suffix e for the extreme presets of the xz tool,
+// which set Depth to ExtremeDepth. Like LevelConfig the function
+// returns the configuration without the defaults filled in.
+func ParsePreset(preset string) (WriterConfig, error) {
+	s := strings.TrimSpace(preset)
+	if !strings.Contains(s, "=") {
+		level, extreme, err := parseLevel(s)
+		if err != nil {
+			return WriterConfig{}, err
+		}
+		return presetConfig(level, extreme)
+	}
+	c, err := LevelConfig(DefaultCompression)
+	if err != nil {
+		return WriterConfig{}, err
+	}
+	for _, opt := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(opt), "=")
+		if !ok || value == "" {
+			return WriterConfig{}, fmt.Errorf(
+				"xz: preset option %q has no value", opt)
+		}
+		switch name {
+		case "preset":
+			level, extreme, err := parseLevel(value)
+			if err != nil {
+				return WriterConfig{}, err
+			}
+			lc, err := presetConfig(level, extreme)
+			if err != nil {
+				return WriterConfig{}, err
+			}
+			c.Properties = lc.Properties
+			c.DictCap = lc.DictCap
+			c.Matcher = lc.Matcher
+			c.Depth = lc.Depth
+		case "dict", "block":
+			n, err := parseSize(value)
+			if err != nil {
+				return WriterConfig{}, err
+			}
+			if name == "block" {
+				c.BlockSize = n
+				break
+			}
+			if n > lzma.MaxDictCap || n > maxInt {
+				return WriterConfig{}, fmt.Errorf(
+					"xz: dictionary size %s too large", value)
+			}
+			c.DictCap = int(n)
+		case "depth":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return WriterConfig{}, fmt.Errorf(
+					"xz: invalid value %q for %s", value, name)
+			}
+			c.Depth = n
+		case "lc", "lp", "pb":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return WriterConfig{}, fmt.Errorf(
+					"xz: invalid value %q for %s", value, name)
+			}
+			p := *c.Properties
+			switch name {
+			case "lc":
+				p.LC = n
+			case "lp":
+				p.LP = n
+			case "pb":
+				p.PB = n
+			}
+			c.Properties = &p
+		case "mf":
+			m, ok := presetMatchers[value]
+			if !ok {
+				return WriterConfig{}, fmt.Errorf(
+					"xz: unsupported match finder %q", value)
+			}
+			c.Matcher = m
+		case "check":
+			check, ok := presetChecks[strings.ToLower(value)]
+			if !ok {
+				return WriterConfig{}, fmt.Errorf(
+					"xz: unsupported check %q", value)
+			}
+			c.CheckSum = check
+		default:
+			return WriterConfig{}, fmt.Errorf(
+				"xz: unsupported preset option %q", name)
+		}
+	}
+	v := c
+	if err := v.Verify(); err != nil {
+		return WriterConfig{}, err
+	}
+	return c, nil
+}
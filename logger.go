@@ -0,0 +1,23 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+// Logger receives the debug messages of readers and writers, which
+// describe the headers, blocks and footers of the streams. The
+// *log.Logger type of the standard library satisfies the interface.
+// Writers compressing in parallel call the logger from several
+// goroutines. The package has no global logger; nothing is logged if
+// the Logger of the configuration is nil.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// logf writes a message to the logger. Nothing happens if the logger is
+// nil.
+func logf(l Logger, format string, v ...interface{}) {
+	if l != nil {
+		l.Printf(format, v...)
+	}
+}
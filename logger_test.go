@@ -0,0 +1,94 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package xz
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingLogger stores the messages logged.
+type recordingLogger struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (l *recordingLogger) Printf(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.msgs = append(l.msgs, fmt.Sprintf(format, v...))
+}
+
+// count returns the number of messages with the given prefix.
+func (l *recordingLogger) count(prefix string) int {
+	n := 0
+	for _, m := range l.msgs {
+		if strings.HasPrefix(m, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestLogger(t *testing.T) {
+	if Backend != "go" {
+		t.Skip("the backend doesn't log")
+	}
+	const text = "The quick brown fox jumps over the lazy dog.\n"
+	for _, workers := range []int{1, 2} {
+		var wl recordingLogger
+		var buf bytes.Buffer
+		w, err := NewWriter(&buf, WithLogger(&wl),
+			WithWorkers(workers), WithBlockSize(100))
+		if err != nil {
+			t.Fatalf("NewWriter error %s", err)
+		}
+		for i := 0; i < 10; i++ {
+			if _, err = io.WriteString(w, text); err != nil {
+				t.Fatalf("WriteString error %s", err)
+			}
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("w.Close error %s", err)
+		}
+		var rl recordingLogger
+		r, err := NewReader(&buf, WithLogger(&rl))
+		if err != nil {
+			t.Fatalf("NewReader error %s", err)
+		}
+		if _, err = io.Copy(ioutil.Discard, r); err != nil {
+			t.Fatalf("io.Copy error %s", err)
+		}
+		// every block has a data and an EOS chunk
+		tests := []struct {
+			l      *recordingLogger
+			prefix string
+			n      int
+		}{
+			{&wl, "xz header", 1},
+			{&wl, "block record", 5},
+			{&wl, "chunk header", 10},
+			{&wl, "xz footer", 1},
+			{&rl, "xz header", 1},
+			{&rl, "block", 5},
+			{&rl, "chunk header", 10},
+			{&rl, "xz footer", 1},
+		}
+		for _, tc := range tests {
+			if k := tc.l.count(tc.prefix); k != tc.n {
+				t.Errorf("workers %d: %d messages %q; want %d",
+					workers, k, tc.prefix, tc.n)
+			}
+		}
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lzip
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// magic is the header magic of every lzip member.
+var magic = []byte("LZIP")
+
+// version is the only supported version of the lzip format.
+const version = 1
+
+// Length of the member header and trailer.
+const (
+	headerLen  = 6
+	trailerLen = 20
+)
+
+// MinDictCap and MaxDictCap provide the range of the dictionary
+// capacities supported by the lzip format.
+const (
+	MinDictCap = 1 << 12
+	MaxDictCap = 1 << 29
+)
+
+// props are the LZMA properties used by lzip. They cannot be changed.
+var props = lzma.Properties{LC: 3, LP: 0, PB: 2}
+
+// errHeaderMagic indicates that the data doesn't start with the lzip
+// header magic.
+var errHeaderMagic = errors.New("lzip: invalid header magic")
+
+// ValidHeader checks whether data is a correct lzip member header. The
+// data must contain at least 6 bytes.
+func ValidHeader(data []byte) bool {
+	var h header
+	return h.UnmarshalBinary(data) == nil
+}
+
+// header represents the header of an lzip member.
+type header struct {
+	dictCap int
+}
+
+// decodeDictCap decodes the dictionary capacity byte of the header. The
+// bits 4-0 contain the base-2 logarithm of the base size; bits 7-5 the
+// number of sixteenths of the base size to subtract.
+func decodeDictCap(b byte) (int, error) {
+	n := uint(b & 0x1f)
+	if !(12 <= n && n <= 29) {
+		return 0, errors.New("lzip: invalid dictionary capacity")
+	}
+	c := 1 << n
+	c -= (c >> 4) * int(b>>5)
+	if c < MinDictCap {
+		return 0, errors.New("lzip: invalid dictionary capacity")
+	}
+	return c, nil
+}
+
+// encodeDictCap returns the byte encoding the smallest dictionary
+// capacity that is larger or equal to dictCap.
+func encodeDictCap(dictCap int) (byte, error) {
+	if !(MinDictCap <= dictCap && dictCap <= MaxDictCap) {
+		return 0, errors.New("lzip: dictionary capacity out of range")
+	}
+	n := uint(12)
+	for 1<<n < dictCap {
+		n++
+	}
+	b := byte(n)
+	if n > 12 {
+		c := 1 << n
+		f := (c - dictCap) / (c >> 4)
+		if f > 7 {
+			f = 7
+		}
+		b |= byte(f) << 5
+	}
+	return b, nil
+}
+
+// MarshalBinary encodes the member header.
+func (h *header) MarshalBinary() (data []byte, err error) {
+	b, err := encodeDictCap(h.dictCap)
+	if err != nil {
+		return nil, err
+	}
+	data = make([]byte, headerLen)
+	copy(data, magic)
+	data[4] = version
+	data[5] = b
+	return data, nil
+}
+
+// UnmarshalBinary decodes the member header.
+func (h *header) UnmarshalBinary(data []byte) error {
+	if len(data) < headerLen {
+		return errors.New("lzip: header too short")
+	}
+	if !bytes.Equal(data[:4], magic) {
+		return errHeaderMagic
+	}
+	if data[4] != version {
+		return fmt.Errorf("lzip: unsupported version %d", data[4])
+	}
+	var err error
+	h.dictCap, err = decodeDictCap(data[5])
+	return err
+}
+
+// trailer represents the trailer of an lzip member.
+type trailer struct {
+	crc        uint32
+	dataSize   int64
+	memberSize int64
+}
+
+// putUint32LE puts the little-endian representation of x into the
+// first four bytes of p.
+func putUint32LE(p []byte, x uint32) {
+	for i := 0; i < 4; i++ {
+		p[i] = byte(x >> (8 * uint(i)))
+	}
+}
+
+// putUint64LE puts the little-endian representation of x into the
+// first eight bytes of p.
+func putUint64LE(p []byte, x uint64) {
+	for i := 0; i < 8; i++ {
+		p[i] = byte(x >> (8 * uint(i)))
+	}
+}
+
+// uint32LE converts a little-endian representation to an uint32 value.
+func uint32LE(p []byte) uint32 {
+	var x uint32
+	for i := 3; i >= 0; i-- {
+		x = x<<8 | uint32(p[i])
+	}
+	return x
+}
+
+// uint64LE converts a little-endian representation to an uint64 value.
+func uint64LE(p []byte) uint64 {
+	var x uint64
+	for i := 7; i >= 0; i-- {
+		x = x<<8 | uint64(p[i])
+	}
+	return x
+}
+
+// MarshalBinary encodes the member trailer.
+func (t *trailer) MarshalBinary() (data []byte, err error) {
+	data = make([]byte, trailerLen)
+	putUint32LE(data, t.crc)
+	putUint64LE(data[4:], uint64(t.dataSize))
+	putUint64LE(data[12:], uint64(t.memberSize))
+	return data, nil
+}
+
+// UnmarshalBinary decodes the member trailer.
+func (t *trailer) UnmarshalBinary(data []byte) error {
+	if len(data) < trailerLen {
+		return errors.New("lzip: trailer too short")
+	}
+	t.crc = uint32LE(data)
+	t.dataSize = int64(uint64LE(data[4:]))
+	t.memberSize = int64(uint64LE(data[12:]))
+	if t.dataSize < 0 || t.memberSize < headerLen+trailerLen {
+		return errors.New("lzip: invalid sizes in trailer")
+	}
+	return nil
+}
+
+// alonePrefix returns the classic LZMA header that lets the lzma
+// package decode the LZMA data of an lzip member. The uncompressed size
+// is unknown and the data is terminated by an end-of-stream marker.
+func alonePrefix(dictCap int) []byte {
+	p := make([]byte, lzma.HeaderLen)
+	p[0] = props.Code()
+	putUint32LE(p[1:], uint32(dictCap))
+	for i := 5; i < len(p); i++ {
+		p[i] = 0xff
+	}
+	return p
+}
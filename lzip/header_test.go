@@ -0,0 +1,42 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lzip
+
+import "testing"
+
+func TestDictCapCoding(t *testing.T) {
+	tests := []struct {
+		dictCap int
+		b       byte
+		coded   int
+	}{
+		{MinDictCap, 0x0c, 1 << 12},
+		{1 << 16, 0x10, 1 << 16},
+		{1<<16 + 1, 0xf1, 1<<17 - 7*(1<<13)},
+		{3 << 22, 0x98, 3 << 22},
+		{MaxDictCap, 0x1d, 1 << 29},
+	}
+	for _, tc := range tests {
+		b, err := encodeDictCap(tc.dictCap)
+		if err != nil {
+			t.Fatalf("encodeDictCap(%d) error %s", tc.dictCap, err)
+		}
+		if b != tc.b {
+			t.Errorf("encodeDictCap(%d) = %#02x; want %#02x",
+				tc.dictCap, b, tc.b)
+		}
+		c, err := decodeDictCap(b)
+		if err != nil {
+			t.Fatalf("decodeDictCap(%#02x) error %s", b, err)
+		}
+		if c != tc.coded {
+			t.Errorf("decodeDictCap(%#02x) = %d; want %d", b, c,
+				tc.coded)
+		}
+	}
+	if _, err := encodeDictCap(MaxDictCap + 1); err == nil {
+		t.Errorf("encodeDictCap(%d) didn't fail", MaxDictCap+1)
+	}
+}
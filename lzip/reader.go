@@ -0,0 +1,247 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package lzip supports the compression and decompression of lzip
+// files as created by the lzip and plzip tools. An lzip file consists
+// of one or more members. Each member contains an LZMA stream with
+// fixed properties framed by a short header and a trailer containing
+// the CRC-32 checksum and the sizes of the member. See
+// http://www.nongnu.org/lzip/manual/lzip_manual.html#File-format
+package lzip
+
+import (
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// ReaderConfig defines the parameters for the lzip reader. The
+// SingleMember parameter requests the reader to decompress only the
+// first member. DictCapLimit limits the dictionary capacity a member
+// may require; the value zero means that there is no limit. If
+// IgnoreTrailingData is set the reader stops at data following the
+// last member; otherwise such data is reported as error.
+type ReaderConfig struct {
+	DictCapLimit       int
+	SingleMember       bool
+	IgnoreTrailingData bool
+}
+
+// Verify checks the reader parameters for validity.
+func (c *ReaderConfig) Verify() error {
+	if c == nil {
+		return errors.New("lzip: reader parameters are nil")
+	}
+	if c.DictCapLimit < 0 {
+		return errors.New("lzip: dictionary capacity limit is negative")
+	}
+	return nil
+}
+
+// countingReader counts the bytes read from the underlying reader. It
+// reads not more data than requested, so that the members can be read
+// one after the other.
+type countingReader struct {
+	r  io.Reader
+	br io.ByteReader
+	n  int64
+}
+
+// newCountingReader creates a new counting reader.
+func newCountingReader(r io.Reader) *countingReader {
+	return &countingReader{r: r, br: lzma.ByteReader(r)}
+}
+
+// Read reads data from the underlying reader.
+func (r *countingReader) Read(p []byte) (n int, err error) {
+	n, err = r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// ReadByte reads a single byte from the underlying reader.
+func (r *countingReader) ReadByte() (c byte, err error) {
+	c, err = r.br.ReadByte()
+	if err == nil {
+		r.n++
+	}
+	return c, err
+}
+
+// prefixReader returns the prefix before the data of the counting
+// reader.
+type prefixReader struct {
+	prefix []byte
+	r      *countingReader
+}
+
+// Read reads the prefix and then the data of the counting reader.
+func (r *prefixReader) Read(p []byte) (n int, err error) {
+	if len(r.prefix) > 0 {
+		n = copy(p, r.prefix)
+		r.prefix = r.prefix[n:]
+		return n, nil
+	}
+	return r.r.Read(p)
+}
+
+// ReadByte reads a single byte.
+func (r *prefixReader) ReadByte() (c byte, err error) {
+	if len(r.prefix) > 0 {
+		c = r.prefix[0]
+		r.prefix = r.prefix[1:]
+		return c, nil
+	}
+	return r.r.ReadByte()
+}
+
+// Reader decompresses lzip files consisting of one or more members.
+type Reader struct {
+	ReaderConfig
+
+	cr *countingReader
+	mr *memberReader
+}
+
+// NewReader creates a new lzip reader using the default parameters.
+// The function reads and checks the header of the first member.
+func NewReader(lz io.Reader) (r *Reader, err error) {
+	return ReaderConfig{}.NewReader(lz)
+}
+
+// NewReader creates a new lzip reader. The function reads and checks
+// the header of the first member.
+func (c ReaderConfig) NewReader(lz io.Reader) (r *Reader, err error) {
+	if err = c.Verify(); err != nil {
+		return nil, err
+	}
+	r = &Reader{
+		ReaderConfig: c,
+		cr:           newCountingReader(lz),
+	}
+	if r.mr, err = c.newMemberReader(r.cr); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return r, nil
+}
+
+var errUnexpectedData = errors.New("lzip: unexpected data after member")
+
+// Read reads uncompressed data from the members.
+func (r *Reader) Read(p []byte) (n int, err error) {
+	for n < len(p) {
+		if r.mr == nil {
+			if r.SingleMember && r.IgnoreTrailingData {
+				return n, io.EOF
+			}
+			r.mr, err = r.ReaderConfig.newMemberReader(r.cr)
+			if err != nil {
+				if err == io.EOF {
+					return n, io.EOF
+				}
+				if r.IgnoreTrailingData {
+					return n, io.EOF
+				}
+				if err == errHeaderMagic ||
+					err == io.ErrUnexpectedEOF ||
+					r.SingleMember {
+					err = errUnexpectedData
+				}
+				return n, err
+			}
+			if r.SingleMember {
+				return n, errUnexpectedData
+			}
+		}
+		k, err := r.mr.Read(p[n:])
+		n += k
+		if err != nil {
+			if err == io.EOF {
+				r.mr = nil
+				continue
+			}
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// memberReader decompresses a single lzip member.
+type memberReader struct {
+	cr   *countingReader
+	lr   *lzma.Reader
+	crc  hash.Hash32
+	size int64
+}
+
+// newMemberReader reads the header of the next member and creates a
+// reader for its content. The function returns io.EOF if no data is
+// available.
+func (c ReaderConfig) newMemberReader(cr *countingReader) (r *memberReader,
+	err error) {
+
+	cr.n = 0
+	data := make([]byte, headerLen)
+	if _, err = io.ReadFull(cr, data); err != nil {
+		return nil, err
+	}
+	var h header
+	if err = h.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	if c.DictCapLimit > 0 && h.dictCap > c.DictCapLimit {
+		return nil, &lzma.DictCapLimitError{
+			DictCap: int64(h.dictCap),
+			Limit:   int64(c.DictCapLimit),
+		}
+	}
+	pr := &prefixReader{prefix: alonePrefix(h.dictCap), r: cr}
+	lr, err := lzma.ReaderConfig{DictCap: h.dictCap}.NewReader(pr)
+	if err != nil {
+		return nil, err
+	}
+	r = &memberReader{cr: cr, lr: lr, crc: crc32.NewIEEE()}
+	return r, nil
+}
+
+// Read reads the uncompressed data of the member. At the end of the
+// LZMA stream the trailer is read and checked.
+func (r *memberReader) Read(p []byte) (n int, err error) {
+	n, err = r.lr.Read(p)
+	r.crc.Write(p[:n])
+	r.size += int64(n)
+	if err != io.EOF {
+		return n, err
+	}
+	data := make([]byte, trailerLen)
+	if _, err = io.ReadFull(r.cr, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return n, err
+	}
+	var t trailer
+	if err = t.UnmarshalBinary(data); err != nil {
+		return n, err
+	}
+	if t.crc != r.crc.Sum32() {
+		return n, errors.New("lzip: CRC-32 checksum mismatch")
+	}
+	if t.dataSize != r.size {
+		return n, fmt.Errorf("lzip: data size is %d; want %d",
+			r.size, t.dataSize)
+	}
+	if t.memberSize != r.cr.n {
+		return n, fmt.Errorf("lzip: member size is %d; want %d",
+			r.cr.n, t.memberSize)
+	}
+	return n, io.EOF
+}
@@ -0,0 +1,139 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lzip
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+const foxSentence = "The quick brown fox jumps over the lazy dog.\n"
+
+func readFox(t *testing.T) []byte {
+	data, err := ioutil.ReadFile("fox.lz")
+	if err != nil {
+		t.Fatalf("ReadFile error %s", err)
+	}
+	return data
+}
+
+func TestReader(t *testing.T) {
+	f, err := os.Open("fox.lz")
+	if err != nil {
+		t.Fatalf("os.Open(%q) error %s", "fox.lz", err)
+	}
+	defer f.Close()
+	r, err := NewReader(f)
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	var buf bytes.Buffer
+	if _, err = io.Copy(&buf, r); err != nil {
+		t.Fatalf("io.Copy error %s", err)
+	}
+	if s := buf.String(); s != foxSentence {
+		t.Fatalf("got %q; want %q", s, foxSentence)
+	}
+}
+
+func TestReaderMultipleMembers(t *testing.T) {
+	fox := readFox(t)
+	data := append(append([]byte{}, fox...), fox...)
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll error %s", err)
+	}
+	if s, want := string(out), foxSentence+foxSentence; s != want {
+		t.Fatalf("got %q; want %q", s, want)
+	}
+
+	r, err = ReaderConfig{SingleMember: true}.NewReader(
+		bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	if _, err = ioutil.ReadAll(r); err != errUnexpectedData {
+		t.Fatalf("ReadAll returned error %v; want %v", err,
+			errUnexpectedData)
+	}
+}
+
+func TestReaderTrailingData(t *testing.T) {
+	data := append(readFox(t), "garbage"...)
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	if _, err = ioutil.ReadAll(r); err != errUnexpectedData {
+		t.Fatalf("ReadAll returned error %v; want %v", err,
+			errUnexpectedData)
+	}
+
+	cfg := ReaderConfig{IgnoreTrailingData: true}
+	r, err = cfg.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll error %s", err)
+	}
+	if s := string(out); s != foxSentence {
+		t.Fatalf("got %q; want %q", s, foxSentence)
+	}
+}
+
+func TestReaderCorrupt(t *testing.T) {
+	fox := readFox(t)
+	tests := []struct {
+		name string
+		pos  int
+	}{
+		{"version", 4},
+		{"crc", len(fox) - trailerLen},
+		{"data size", len(fox) - 16},
+		{"member size", len(fox) - 8},
+	}
+	for _, tc := range tests {
+		data := append([]byte{}, fox...)
+		data[tc.pos]++
+		r, err := NewReader(bytes.NewReader(data))
+		if err != nil {
+			continue
+		}
+		if _, err = ioutil.ReadAll(r); err == nil {
+			t.Errorf("%s: corruption not detected", tc.name)
+		}
+	}
+}
+
+func TestReaderDictCapLimit(t *testing.T) {
+	cfg := ReaderConfig{DictCapLimit: 1 << 15}
+	_, err := cfg.NewReader(bytes.NewReader(readFox(t)))
+	if err == nil {
+		t.Fatalf("NewReader didn't detect dictionary capacity limit")
+	}
+}
+
+func TestReaderTruncated(t *testing.T) {
+	fox := readFox(t)
+	for n := 0; n < len(fox); n++ {
+		r, err := NewReader(bytes.NewReader(fox[:n]))
+		if err == nil {
+			_, err = ioutil.ReadAll(r)
+		}
+		if err != io.ErrUnexpectedEOF {
+			t.Fatalf("member truncated to %d bytes: got error %v; "+
+				"want %v", n, err, io.ErrUnexpectedEOF)
+		}
+	}
+}
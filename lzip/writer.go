@@ -0,0 +1,118 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package lzip
+
+import (
+	"hash"
+	"hash/crc32"
+	"io"
+
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// Writer compresses data into a single lzip member.
+type Writer struct {
+	lz   io.Writer
+	cw   *countingWriter
+	lw   *lzma.Writer
+	crc  hash.Hash32
+	size int64
+}
+
+// countingWriter counts the bytes written to the underlying writer. The
+// first skip bytes are not written.
+type countingWriter struct {
+	w    io.Writer
+	skip int
+	n    int64
+}
+
+// Write writes data to the underlying writer.
+func (w *countingWriter) Write(p []byte) (n int, err error) {
+	if w.skip > 0 {
+		k := w.skip
+		if k > len(p) {
+			k = len(p)
+		}
+		w.skip -= k
+		n, err = w.w.Write(p[k:])
+		w.n += int64(n)
+		return n + k, err
+	}
+	n, err = w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// NewWriter creates a new lzip writer using the default parameters. The
+// member header is written immediately.
+func NewWriter(lz io.Writer) (w *Writer, err error) {
+	return WriterConfig{}.NewWriter(lz)
+}
+
+// NewWriter creates a new lzip writer. The member header is written
+// immediately.
+func (c WriterConfig) NewWriter(lz io.Writer) (w *Writer, err error) {
+	if err = c.Verify(); err != nil {
+		return nil, err
+	}
+	b, err := encodeDictCap(c.DictCap)
+	if err != nil {
+		return nil, err
+	}
+	h := header{}
+	if h.dictCap, err = decodeDictCap(b); err != nil {
+		return nil, err
+	}
+	data, err := h.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	w = &Writer{lz: lz, crc: crc32.NewIEEE()}
+	// The LZMA writer writes the header of the classic format that
+	// has to be skipped.
+	w.cw = &countingWriter{w: lz, skip: lzma.HeaderLen}
+	n, err := lz.Write(data)
+	w.cw.n += int64(n)
+	if err != nil {
+		return nil, err
+	}
+	lc := c.lzmaConfig()
+	lc.DictCap = h.dictCap
+	if w.lw, err = lc.NewWriter(w.cw); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write compresses the data.
+func (w *Writer) Write(p []byte) (n int, err error) {
+	n, err = w.lw.Write(p)
+	w.crc.Write(p[:n])
+	w.size += int64(n)
+	return n, err
+}
+
+// Close finishes the LZMA stream and writes the member trailer. It
+// doesn't close the underlying writer.
+func (w *Writer) Close() error {
+	if err := w.lw.Close(); err != nil {
+		return err
+	}
+	t := trailer{
+		crc:        w.crc.Sum32(),
+		dataSize:   w.size,
+		memberSize: w.cw.n + trailerLen,
+	}
+	data, err := t.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	_, err = w.lz.Write(data)
+	return err
+}
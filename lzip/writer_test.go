@@ -0,0 +1,80 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package lzip
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/ulikunitz/xz/internal/randtxt"
+)
+
+func TestWriter(t *testing.T) {
+	const txtlen = 100000
+	var orig bytes.Buffer
+	io.CopyN(&orig, randtxt.NewReader(rand.NewSource(41)), txtlen)
+
+	var buf bytes.Buffer
+	w, err := WriterConfig{DictCap: 50000}.NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	if _, err = w.Write(orig.Bytes()); err != nil {
+		t.Fatalf("w.Write error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("w.Close error %s", err)
+	}
+	if !ValidHeader(buf.Bytes()) {
+		t.Fatalf("invalid member header")
+	}
+	var tr trailer
+	if err = tr.UnmarshalBinary(buf.Bytes()[buf.Len()-trailerLen:]); err != nil {
+		t.Fatalf("UnmarshalBinary error %s", err)
+	}
+	if tr.memberSize != int64(buf.Len()) {
+		t.Fatalf("member size %d; want %d", tr.memberSize, buf.Len())
+	}
+
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll error %s", err)
+	}
+	if !bytes.Equal(out, orig.Bytes()) {
+		t.Fatalf("decompressed data differs from original")
+	}
+}
+
+func TestWriterEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("w.Close error %s", err)
+	}
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll error %s", err)
+	}
+	if len(out) != 0 {
+		t.Fatalf("got %d bytes; want 0", len(out))
+	}
+}
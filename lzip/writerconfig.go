@@ -0,0 +1,61 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lzip
+
+import (
+	"errors"
+
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// WriterConfig describes the parameters for the lzip writer. The LZMA
+// properties are fixed by the lzip format.
+type WriterConfig struct {
+	// DictCap is the dictionary capacity. It will be rounded up to
+	// the next value that can be represented in the member header.
+	// The default is 8 MiB.
+	DictCap int
+	// BufSize is the size of the lookahead buffer; the default is
+	// 4096.
+	BufSize int
+	// Matcher selects the match algorithm.
+	Matcher lzma.MatchAlgorithm
+}
+
+// fill replaces zero values with default values.
+func (c *WriterConfig) fill() {
+	if c.DictCap == 0 {
+		c.DictCap = 8 * 1024 * 1024
+	}
+	if c.BufSize == 0 {
+		c.BufSize = 4096
+	}
+}
+
+// Verify checks the configuration for errors. Zero values will be
+// replaced by default values.
+func (c *WriterConfig) Verify() error {
+	if c == nil {
+		return errors.New("lzip: writer configuration is nil")
+	}
+	c.fill()
+	if !(MinDictCap <= c.DictCap && c.DictCap <= MaxDictCap) {
+		return errors.New("lzip: dictionary capacity is out of range")
+	}
+	lc := c.lzmaConfig()
+	return lc.Verify()
+}
+
+// lzmaConfig returns the configuration for the LZMA writer.
+func (c *WriterConfig) lzmaConfig() lzma.WriterConfig {
+	p := props
+	return lzma.WriterConfig{
+		Properties: &p,
+		DictCap:    c.DictCap,
+		BufSize:    c.BufSize,
+		Matcher:    c.Matcher,
+		EOSMarker:  true,
+	}
+}
@@ -2,6 +2,9 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
 package lzma
 
 import (
@@ -65,6 +68,11 @@ func newBinTree(capacity int) (t *binTree, err error) {
 		return nil, errors.New(
 			"newBinTree: capacity must less 2^{32}-1")
 	}
+	// a node has 16 bytes
+	if capacity > maxBufferSize/16 {
+		return nil, errors.New(
+			"newBinTree: capacity exceeds the address space")
+	}
 	t = &binTree{
 		node: make([]node, capacity),
 		hoff: -int64(wordLen),
@@ -76,6 +84,15 @@ func newBinTree(capacity int) (t *binTree, err error) {
 
 func (t *binTree) SetDict(d *encoderDict) { t.dict = d }
 
+// Reset empties the binary tree. The nodes are initialized when they
+// are added, so the node buffer is not cleared.
+func (t *binTree) Reset() {
+	t.hoff = -int64(wordLen)
+	t.front = 0
+	t.root = null
+	t.x = 0
+}
+
 // WriteByte writes a single byte into the binary tree.
 func (t *binTree) WriteByte(c byte) error {
 	t.x = (t.x << 8) | uint32(c)
@@ -2,6 +2,9 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
 package lzma
 
 import (
@@ -18,7 +18,13 @@ type buffer struct {
 	rear  int
 }
 
-// newBuffer creates a buffer with the given size.
+// maxBufferSize is the maximum size of a buffer. The data slice has an
+// additional byte, so the size must be less than the maximum int value.
+// On 32-bit platforms this limits dictionaries to less than 2 GiB.
+const maxBufferSize = int(^uint(0)>>1) - 1
+
+// newBuffer creates a buffer with the given size. The size must not
+// exceed maxBufferSize.
 func newBuffer(size int) *buffer {
 	return &buffer{data: make([]byte, size+1)}
 }
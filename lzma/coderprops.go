@@ -0,0 +1,156 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lzma
+
+import "errors"
+
+// The 7z archive format stores the parameters of a coder as property
+// blob. The LZMA coder uses five bytes: the properties code followed by
+// the dictionary capacity as little-endian 32-bit value. The LZMA2
+// coder uses a single byte encoding the dictionary capacity as
+// described for EncodeDictCap. The LZMA data itself doesn't contain a
+// header. A classic header for the Reader can be created by
+// CoderPropsHeader.
+
+// CoderPropsLen is the length of the property blob of the LZMA coder.
+const CoderPropsLen = 5
+
+// Coder2PropsLen is the length of the property blob of the LZMA2 coder.
+const Coder2PropsLen = 1
+
+// DecodeCoderProps decodes the property blob of the LZMA coder.
+// Dictionary capacities smaller than MinDictCap are increased to
+// MinDictCap.
+func DecodeCoderProps(p []byte) (props Properties, dictCap int,
+	err error) {
+
+	if len(p) != CoderPropsLen {
+		return props, 0, errors.New(
+			"lzma: coder properties have wrong length")
+	}
+	if props, err = PropertiesForCode(p[0]); err != nil {
+		return props, 0, err
+	}
+	dictCap = int(uint32LE(p[1:]))
+	if dictCap < 0 {
+		return props, 0, errors.New(
+			"lzma: dictionary capacity exceeds maximum integer")
+	}
+	if dictCap < MinDictCap {
+		dictCap = MinDictCap
+	}
+	return props, dictCap, nil
+}
+
+// EncodeCoderProps returns the property blob of the LZMA coder.
+func EncodeCoderProps(props Properties, dictCap int) ([]byte, error) {
+	if err := props.verify(); err != nil {
+		return nil, err
+	}
+	if !(MinDictCap <= dictCap && int64(dictCap) <= MaxDictCap) {
+		return nil, errors.New("lzma: dictionary capacity is out of range")
+	}
+	p := make([]byte, CoderPropsLen)
+	p[0] = props.Code()
+	putUint32LE(p[1:], uint32(dictCap))
+	return p, nil
+}
+
+// CoderPropsHeader returns the header of the classic LZMA format for
+// the property blob of the LZMA coder. Prepending the header to the
+// LZMA data allows the decoding with the Reader. A negative size
+// indicates that the uncompressed size is unknown and the data is
+// terminated by an end-of-stream marker.
+func CoderPropsHeader(p []byte, size int64) ([]byte, error) {
+	props, dictCap, err := DecodeCoderProps(p)
+	if err != nil {
+		return nil, err
+	}
+	h := header{properties: props, dictCap: dictCap, size: size}
+	if size < 0 {
+		h.size = -1
+	}
+	return h.marshalBinary()
+}
+
+// CoderProps returns the property blob of the LZMA coder for the writer
+// configuration. Zero values of the configuration will be replaced by
+// default values.
+func (c *WriterConfig) CoderProps() ([]byte, error) {
+	if err := c.Verify(); err != nil {
+		return nil, err
+	}
+	return EncodeCoderProps(*c.Properties, c.DictCap)
+}
+
+// WriterConfigForCoderProps returns the writer configuration for the
+// property blob of the LZMA coder.
+func WriterConfigForCoderProps(p []byte) (c WriterConfig, err error) {
+	props, dictCap, err := DecodeCoderProps(p)
+	if err != nil {
+		return c, err
+	}
+	c = WriterConfig{Properties: &props, DictCap: dictCap}
+	return c, nil
+}
+
+// ReaderConfigForCoderProps returns the reader configuration for the
+// property blob of the LZMA coder.
+func ReaderConfigForCoderProps(p []byte) (c ReaderConfig, err error) {
+	_, dictCap, err := DecodeCoderProps(p)
+	if err != nil {
+		return c, err
+	}
+	return ReaderConfig{DictCap: dictCap}, nil
+}
+
+// decodeCoder2Props decodes the property blob of the LZMA2 coder.
+func decodeCoder2Props(p []byte) (dictCap int, err error) {
+	if len(p) != Coder2PropsLen {
+		return 0, errors.New(
+			"lzma: LZMA2 coder properties have wrong length")
+	}
+	d, err := DecodeDictCap(p[0])
+	if err != nil {
+		return 0, err
+	}
+	dictCap = int(d)
+	if int64(dictCap) != d {
+		return 0, errors.New(
+			"lzma: dictionary capacity exceeds maximum integer")
+	}
+	return dictCap, nil
+}
+
+// CoderProps returns the property blob of the LZMA2 coder for the
+// writer configuration. The dictionary capacity is rounded up to the
+// next value that can be encoded. Zero values of the configuration will
+// be replaced by default values.
+func (c *Writer2Config) CoderProps() ([]byte, error) {
+	if err := c.Verify(); err != nil {
+		return nil, err
+	}
+	return []byte{EncodeDictCap(int64(c.DictCap))}, nil
+}
+
+// Writer2ConfigForCoderProps returns the writer configuration for the
+// property blob of the LZMA2 coder.
+func Writer2ConfigForCoderProps(p []byte) (c Writer2Config, err error) {
+	dictCap, err := decodeCoder2Props(p)
+	if err != nil {
+		return c, err
+	}
+	return Writer2Config{DictCap: dictCap}, nil
+}
+
+// Reader2ConfigForCoderProps returns the reader configuration for the
+// property blob of the LZMA2 coder.
+func Reader2ConfigForCoderProps(p []byte) (c Reader2Config, err error) {
+	dictCap, err := decodeCoder2Props(p)
+	if err != nil {
+		return c, err
+	}
+	return Reader2Config{DictCap: dictCap}, nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package lzma
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestCoderPropsHeader(t *testing.T) {
+	const text = "The quick brown fox jumps over the lazy dog.\n"
+	var buf bytes.Buffer
+	cfg := WriterConfig{DictCap: 1 << 16, Size: int64(len(text))}
+	w, err := cfg.NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	io.WriteString(w, text)
+	if err = w.Close(); err != nil {
+		t.Fatalf("w.Close error %s", err)
+	}
+	p, err := cfg.CoderProps()
+	if err != nil {
+		t.Fatalf("CoderProps error %s", err)
+	}
+
+	// decode the raw data like a 7z reader knowing the size
+	h, err := CoderPropsHeader(p, int64(len(text)))
+	if err != nil {
+		t.Fatalf("CoderPropsHeader error %s", err)
+	}
+	raw := buf.Bytes()[HeaderLen:]
+	rc, err := ReaderConfigForCoderProps(p)
+	if err != nil {
+		t.Fatalf("ReaderConfigForCoderProps error %s", err)
+	}
+	r, err := rc.NewReader(io.MultiReader(bytes.NewReader(h),
+		bytes.NewReader(raw)))
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll error %s", err)
+	}
+	if string(out) != text {
+		t.Fatalf("got %q; want %q", out, text)
+	}
+}
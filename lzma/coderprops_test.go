@@ -0,0 +1,66 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lzma
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCoderProps(t *testing.T) {
+	// properties of 7-Zip for LZMA with a 1 MiB dictionary
+	p := []byte{0x5d, 0x00, 0x00, 0x10, 0x00}
+	props, dictCap, err := DecodeCoderProps(p)
+	if err != nil {
+		t.Fatalf("DecodeCoderProps error %s", err)
+	}
+	want := Properties{LC: 3, LP: 0, PB: 2}
+	if props != want {
+		t.Fatalf("props %s; want %s", &props, &want)
+	}
+	if dictCap != 1<<20 {
+		t.Fatalf("dictCap %d; want %d", dictCap, 1<<20)
+	}
+
+	wc, err := WriterConfigForCoderProps(p)
+	if err != nil {
+		t.Fatalf("WriterConfigForCoderProps error %s", err)
+	}
+	q, err := wc.CoderProps()
+	if err != nil {
+		t.Fatalf("CoderProps error %s", err)
+	}
+	if !bytes.Equal(q, p) {
+		t.Fatalf("CoderProps returned %x; want %x", q, p)
+	}
+
+	if _, _, err = DecodeCoderProps(p[:4]); err == nil {
+		t.Fatalf("DecodeCoderProps accepted short blob")
+	}
+	if _, _, err = DecodeCoderProps([]byte{225, 0, 0, 1, 0}); err == nil {
+		t.Fatalf("DecodeCoderProps accepted invalid properties")
+	}
+}
+
+func TestCoder2Props(t *testing.T) {
+	wc := Writer2Config{DictCap: 3 << 20}
+	p, err := wc.CoderProps()
+	if err != nil {
+		t.Fatalf("CoderProps error %s", err)
+	}
+	if len(p) != Coder2PropsLen || p[0] != 19 {
+		t.Fatalf("CoderProps returned %x; want %x", p, []byte{19})
+	}
+	rc, err := Reader2ConfigForCoderProps(p)
+	if err != nil {
+		t.Fatalf("Reader2ConfigForCoderProps error %s", err)
+	}
+	if rc.DictCap != 3<<20 {
+		t.Fatalf("DictCap %d; want %d", rc.DictCap, 3<<20)
+	}
+	if _, err = Writer2ConfigForCoderProps([]byte{41}); err == nil {
+		t.Fatalf("Writer2ConfigForCoderProps accepted invalid code")
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package lzma
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/ulikunitz/xz/internal/randtxt"
+)
+
+// TestConcurrentReadersWriters runs LZMA and LZMA2 readers and writers
+// in parallel. It is most useful with the race detector enabled by the
+// -race flag.
+func TestConcurrentReadersWriters(t *testing.T) {
+	const txtlen = 1 << 16
+	var buf bytes.Buffer
+	io.CopyN(&buf, randtxt.NewReader(rand.NewSource(44)), txtlen)
+	txt := buf.Bytes()
+
+	props := &Properties{LC: 3, LP: 0, PB: 2}
+	wc := WriterConfig{Properties: props, DictCap: 1 << 16}
+	w2c := Writer2Config{Properties: props, DictCap: 1 << 16,
+		Matcher: BinaryTree}
+	const n = 16
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var buf bytes.Buffer
+			var w io.WriteCloser
+			var err error
+			if i%2 == 0 {
+				w, err = wc.NewWriter(&buf)
+			} else {
+				w, err = w2c.NewWriter2(&buf)
+			}
+			if err != nil {
+				t.Errorf("goroutine %d: NewWriter error %s", i, err)
+				return
+			}
+			if _, err = w.Write(txt); err != nil {
+				t.Errorf("goroutine %d: Write error %s", i, err)
+				return
+			}
+			if err = w.Close(); err != nil {
+				t.Errorf("goroutine %d: Close error %s", i, err)
+				return
+			}
+			var r io.Reader
+			if i%2 == 0 {
+				r, err = NewReader(&buf)
+			} else {
+				r, err = Reader2Config{DictCap: 1 << 16}.NewReader2(
+					&buf)
+			}
+			if err != nil {
+				t.Errorf("goroutine %d: NewReader error %s", i, err)
+				return
+			}
+			out, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Errorf("goroutine %d: ReadAll error %s", i, err)
+				return
+			}
+			if !bytes.Equal(out, txt) {
+				t.Errorf("goroutine %d: decompressed data "+
+					"differs from original", i)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,35 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lzma
+
+// Decision describes an operation chosen by the encoder. A writer with
+// a DecisionTrace writes every decision as a JSON object on a line of
+// its own, so that the traces of two versions of the package can be
+// compared decision by decision to find the cause of a change of the
+// compression ratio.
+type Decision struct {
+	// Pos is the position of the operation in the uncompressed data
+	// of the encoder.
+	Pos int64 `json:"pos"`
+	// Op is one of "lit", "match", "rep" or "shortrep". A rep
+	// operation repeats one of the last four distances and a
+	// shortrep a single byte at the last distance.
+	Op string `json:"op"`
+	// Byte is the literal byte; it is zero for the other operations.
+	Byte byte `json:"byte"`
+	// Dist is the distance of the match; it is zero for literals.
+	Dist int64 `json:"dist"`
+	// Len is the number of bytes covered by the operation.
+	Len int `json:"len"`
+	// Rep is the index of the repeated distance or -1 if no
+	// distance is repeated.
+	Rep int `json:"rep"`
+	// State is the state of the LZMA state machine before the
+	// operation.
+	State uint32 `json:"state"`
+	// Price is the number of bits required by the range encoder for
+	// the operation. It is rounded to three decimal places.
+	Price float64 `json:"price"`
+}
@@ -0,0 +1,110 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package lzma
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+// decisionTrace compresses text and returns the decisions and the
+// compressed size.
+func decisionTrace(t *testing.T, text string) (ds []Decision, n int) {
+	t.Helper()
+	var buf, trace bytes.Buffer
+	w, err := WriterConfig{DecisionTrace: &trace}.NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	if _, err = io.WriteString(w, text); err != nil {
+		t.Fatalf("WriteString error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("w.Close error %s", err)
+	}
+	dec := json.NewDecoder(&trace)
+	for {
+		var d Decision
+		if err = dec.Decode(&d); err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Decode error %s", err)
+		}
+		ds = append(ds, d)
+	}
+	return ds, buf.Len()
+}
+
+func TestDecisionTrace(t *testing.T) {
+	text := strings.Repeat("The quick brown fox jumps over the lazy dog.\n",
+		20) + "abcabcabd"
+	ds, n := decisionTrace(t, text)
+	var pos int64
+	var price float64
+	ops := make(map[string]int)
+	for _, d := range ds {
+		if d.Pos != pos {
+			t.Fatalf("decision at %d; want %d", d.Pos, pos)
+		}
+		switch d.Op {
+		case "lit":
+			if d.Byte != text[pos] || d.Len != 1 || d.Rep >= 0 {
+				t.Fatalf("unexpected literal %+v", d)
+			}
+		case "match":
+			if d.Rep >= 0 || d.Dist < 1 || d.Len < minMatchLen {
+				t.Fatalf("unexpected match %+v", d)
+			}
+		case "rep", "shortrep":
+			if d.Rep < 0 || d.Rep > 3 {
+				t.Fatalf("unexpected rep %+v", d)
+			}
+		default:
+			t.Fatalf("unexpected op %q", d.Op)
+		}
+		if d.Op != "lit" &&
+			text[pos:pos+int64(d.Len)] !=
+				text[pos-d.Dist:pos-d.Dist+int64(d.Len)] {
+			t.Fatalf("%+v doesn't match", d)
+		}
+		if d.Price <= 0 {
+			t.Fatalf("price of %+v not positive", d)
+		}
+		ops[d.Op]++
+		price += d.Price
+		pos += int64(d.Len)
+	}
+	if pos != int64(len(text)) {
+		t.Fatalf("decisions cover %d bytes; want %d", pos, len(text))
+	}
+	if ops["lit"] == 0 || ops["match"] == 0 || ops["rep"] == 0 {
+		t.Fatalf("ops %v; want literals, matches and reps", ops)
+	}
+	// the header has 13 bytes; the range encoder adds about five
+	// bytes and the EOS marker
+	if bits := 8 * float64(n-13); price > bits || price < bits-120 {
+		t.Fatalf("sum of prices %.1f bits; compressed %.0f bits",
+			price, bits)
+	}
+	// the trace must be reproducible to support diffing
+	ds2, _ := decisionTrace(t, text)
+	if len(ds) != len(ds2) {
+		t.Fatalf("second trace has %d decisions; want %d",
+			len(ds2), len(ds))
+	}
+	for i := range ds {
+		if ds[i] != ds2[i] {
+			t.Fatalf("decision %d differs: %+v and %+v", i, ds[i],
+				ds2[i])
+		}
+	}
+}
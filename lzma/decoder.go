@@ -28,6 +28,11 @@ type decoder struct {
 	eos bool
 	// EOS marker found
 	eosMarker bool
+	// noEOSMarker rejects EOS markers as required for LZMA2 chunks
+	noEOSMarker bool
+	// err is the decompression error that is reported after the
+	// data decompressed before the error has been read
+	err error
 }
 
 // newDecoder creates a new decoder instance. The parameter size provides
@@ -203,11 +208,14 @@ func (d *decoder) decompress() error {
 			break
 		case errEOS:
 			d.eos = true
+			if d.noEOSMarker {
+				return errEOSMarker
+			}
 			if !d.rd.possiblyAtEnd() {
 				return errDataAfterEOS
 			}
 			if d.size >= 0 && d.size != d.Decompressed() {
-				return errSize
+				return ErrUncompressedSize
 			}
 			return io.EOF
 		case io.EOF:
@@ -222,16 +230,21 @@ func (d *decoder) decompress() error {
 		if d.size >= 0 && d.Decompressed() >= d.size {
 			d.eos = true
 			if d.Decompressed() > d.size {
-				return errSize
+				return ErrUncompressedSize
 			}
 			if !d.rd.possiblyAtEnd() {
+				if d.noEOSMarker {
+					return errRangeDecoder
+				}
 				switch _, err = d.readOp(); err {
 				case nil:
-					return errSize
+					return ErrUncompressedSize
 				case io.EOF:
 					return io.ErrUnexpectedEOF
 				case errEOS:
-					break
+					if !d.rd.possiblyAtEnd() {
+						return errDataAfterEOS
+					}
 				default:
 					return err
 				}
@@ -242,14 +255,26 @@ func (d *decoder) decompress() error {
 	return nil
 }
 
-// Errors that may be returned while decoding data.
-var (
-	errDataAfterEOS = errors.New("lzma: data after end of stream marker")
-	errSize         = errors.New("lzma: wrong uncompressed data size")
-)
+// errDataAfterEOS indicates that the range coder contains data after
+// the end of stream marker.
+var errDataAfterEOS = errors.New("lzma: data after end of stream marker")
+
+// errEOSMarker indicates an EOS marker in an LZMA2 chunk, which doesn't
+// support it.
+var errEOSMarker = errors.New("lzma: end of stream marker in LZMA2 chunk")
+
+// errRangeDecoder indicates that the range decoder has not reached its
+// final state after all uncompressed data has been decoded.
+var errRangeDecoder = errors.New(
+	"lzma: range decoder not finished at end of data")
+
+// ErrUncompressedSize indicates that the size of the uncompressed data
+// differs from the size given in the header. The stream is corrupt.
+var ErrUncompressedSize = errors.New("lzma: wrong uncompressed data size")
 
 // Read reads data from the buffer. If no more data is available io.EOF is
-// returned.
+// returned. A decompression error is returned only after all data
+// decompressed before the error has been read.
 func (d *decoder) Read(p []byte) (n int, err error) {
 	var k int
 	for {
@@ -258,15 +283,19 @@ func (d *decoder) Read(p []byte) (n int, err error) {
 		if err != nil {
 			panic(fmt.Errorf("dictionary read error %s", err))
 		}
+		n += k
+		if d.err != nil && d.Dict.buffered() == 0 {
+			err, d.err = d.err, nil
+			return n, err
+		}
 		if k == 0 && d.eos {
 			return n, io.EOF
 		}
-		n += k
 		if n >= len(p) {
 			return n, nil
 		}
 		if err = d.decompress(); err != nil && err != io.EOF {
-			return n, err
+			d.err = err
 		}
 	}
 }
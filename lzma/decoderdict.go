@@ -10,12 +10,21 @@ import (
 )
 
 // decoderDict provides the dictionary for the decoder. The whole
-// dictionary is used as reader buffer.
+// dictionary is used as reader buffer. The buffer grows with the
+// decompressed data until it reaches the capacity of the dictionary, so
+// that a stream declaring a large dictionary but producing little data
+// cannot cause a large allocation.
 type decoderDict struct {
 	buf  buffer
 	head int64
+	// capacity is the dictionary capacity the buffer may grow to
+	capacity int
 }
 
+// initialDictLen is the initial size of the buffer of the decoder
+// dictionary.
+const initialDictLen = 1 << 16
+
 // newDecoderDict creates a new decoder dictionary. The whole dictionary
 // will be used as reader buffer.
 func newDecoderDict(dictCap int) (d *decoderDict, err error) {
@@ -23,10 +32,55 @@ func newDecoderDict(dictCap int) (d *decoderDict, err error) {
 	if !(1 <= dictCap && int64(dictCap) <= MaxDictCap) {
 		return nil, errors.New("lzma: dictCap out of range")
 	}
-	d = &decoderDict{buf: *newBuffer(dictCap)}
+	if dictCap > maxBufferSize {
+		return nil, errors.New(
+			"lzma: dictCap exceeds the maximum buffer size")
+	}
+	size := dictCap
+	if size > initialDictLen {
+		size = initialDictLen
+	}
+	d = &decoderDict{buf: *newBuffer(size), capacity: dictCap}
 	return d, nil
 }
 
+// grow enlarges the buffer, so that n bytes can be written without
+// overwriting the dictionary or buffered data. The buffer doesn't grow
+// beyond the dictionary capacity.
+func (d *decoderDict) grow(n int) {
+	c := d.buf.Cap()
+	if c >= d.capacity {
+		return
+	}
+	// k is the number of bytes that must be preserved
+	k := d.buf.Buffered()
+	if int64(k) < d.head {
+		k = d.dictLen()
+	}
+	if int64(k)+int64(n) <= int64(c) {
+		return
+	}
+	size := 2 * c
+	if size < k+n {
+		size = k + n
+	}
+	if size > d.capacity || size < 0 {
+		size = d.capacity
+	}
+	data := make([]byte, size+1)
+	i := d.buf.front - k
+	if i < 0 {
+		i += len(d.buf.data)
+		m := copy(data, d.buf.data[i:])
+		copy(data[m:], d.buf.data[:d.buf.front])
+	} else {
+		copy(data, d.buf.data[i:d.buf.front])
+	}
+	d.buf.rear = k - d.buf.Buffered()
+	d.buf.front = k
+	d.buf.data = data
+}
+
 // Reset clears the dictionary. The read buffer is not changed, so the
 // buffered data can still be read.
 func (d *decoderDict) Reset() {
@@ -36,6 +90,7 @@ func (d *decoderDict) Reset() {
 // WriteByte writes a single byte into the dictionary. It is used to
 // write literals into the dictionary.
 func (d *decoderDict) WriteByte(c byte) error {
+	d.grow(1)
 	if err := d.buf.WriteByte(c); err != nil {
 		return err
 	}
@@ -78,11 +133,12 @@ func (d *decoderDict) byteAt(dist int) byte {
 // first.
 func (d *decoderDict) writeMatch(dist int64, length int) error {
 	if !(0 < dist && dist <= int64(d.dictLen())) {
-		return errors.New("writeMatch: distance out of range")
+		return errors.New("lzma: match distance out of range")
 	}
 	if !(0 < length && length <= maxMatchLen) {
-		return errors.New("writeMatch: length out of range")
+		return errors.New("lzma: match length out of range")
 	}
+	d.grow(length)
 	if length > d.buf.Available() {
 		return ErrNoSpace
 	}
@@ -115,14 +171,17 @@ func (d *decoderDict) writeMatch(dist int64, length int) error {
 // Write writes the given bytes into the dictionary and advances the
 // head.
 func (d *decoderDict) Write(p []byte) (n int, err error) {
+	d.grow(len(p))
 	n, err = d.buf.Write(p)
 	d.head += int64(n)
 	return n, err
 }
 
 // Available returns the number of available bytes for writing into the
-// decoder dictionary.
-func (d *decoderDict) Available() int { return d.buf.Available() }
+// decoder dictionary. It takes into account that the buffer may grow.
+func (d *decoderDict) Available() int {
+	return d.capacity - d.buf.Buffered()
+}
 
 // Read reads data from the buffer contained in the decoder dictionary.
 func (d *decoderDict) Read(p []byte) (n int, err error) { return d.buf.Read(p) }
@@ -0,0 +1,43 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package lzma
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestDictMaxBufferSize(t *testing.T) {
+	if _, err := newDecoderDict(maxBufferSize + 1); err == nil {
+		t.Fatalf("newDecoderDict(%d) returned no error",
+			maxBufferSize+1)
+	}
+	if strconv.IntSize == 32 {
+		// the dictionary grows with the data, so the maximum
+		// capacity doesn't require an allocation
+		if _, err := newDecoderDict(maxBufferSize); err != nil {
+			t.Fatalf("newDecoderDict(%d) error %s",
+				maxBufferSize, err)
+		}
+	}
+	if _, err := newEncoderDict(maxBufferSize, 1, nil); err == nil {
+		t.Fatalf("newEncoderDict(%d, 1) returned no error",
+			maxBufferSize)
+	}
+	if _, err := newHashTable(maxBufferSize, 4, DefaultDepth); err == nil {
+		t.Fatalf("newHashTable(%d) returned no error", maxBufferSize)
+	}
+	if _, err := newBinTree(maxBufferSize); err == nil {
+		t.Fatalf("newBinTree(%d) returned no error", maxBufferSize)
+	}
+	c := Writer2Config{DictCap: maxBufferSize - maxMatchLen}
+	if err := c.Verify(); err == nil {
+		t.Fatalf("Writer2Config.Verify returned no error for "+
+			"DictCap %d", c.DictCap)
+	}
+}
@@ -5,7 +5,10 @@
 package lzma
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
+	"runtime"
 	"testing"
 )
 
@@ -31,3 +34,65 @@ func TestNewDecoderDict(t *testing.T) {
 		t.Fatalf("error %s", err)
 	}
 }
+
+func TestDecoderDictGrow(t *testing.T) {
+	d, err := newDecoderDict(1 << 30)
+	if err != nil {
+		t.Fatalf("newDecoderDict error %s", err)
+	}
+	if c := d.buf.Cap(); c != initialDictLen {
+		t.Fatalf("buffer capacity %d; want %d", c, initialDictLen)
+	}
+	// write and read in portions, so that the buffer wraps
+	var want, got bytes.Buffer
+	p := make([]byte, 5000)
+	for i := 0; i < 100; i++ {
+		for j := range p {
+			p[j] = byte(i + j/7)
+		}
+		if _, err = d.Write(p); err != nil {
+			t.Fatalf("Write error %s", err)
+		}
+		want.Write(p)
+		if err = d.writeMatch(int64(want.Len()), 200); err != nil {
+			t.Fatalf("writeMatch error %s", err)
+		}
+		want.Write(want.Bytes()[:200])
+		q := make([]byte, 3000)
+		n, _ := d.Read(q)
+		got.Write(q[:n])
+	}
+	q := make([]byte, d.buffered())
+	n, _ := d.Read(q)
+	got.Write(q[:n])
+	if !bytes.Equal(got.Bytes(), want.Bytes()) {
+		t.Fatalf("data read from dictionary differs from data written")
+	}
+	if c := d.buf.Cap(); c >= 1<<20 {
+		t.Fatalf("buffer capacity %d; expected less than 1 MiB", c)
+	}
+}
+
+func TestReaderLargeDictCap(t *testing.T) {
+	data, err := ioutil.ReadFile("examples/a.lzma")
+	if err != nil {
+		t.Fatalf("ReadFile error %s", err)
+	}
+	// The file declares a dictionary of 1 GiB, but the memory used
+	// must depend on the data.
+	data = append([]byte(nil), data...)
+	putUint32LE(data[1:5], 1<<30)
+	var m1, m2 runtime.MemStats
+	runtime.ReadMemStats(&m1)
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	if _, err = ioutil.ReadAll(r); err != nil {
+		t.Fatalf("ReadAll error %s", err)
+	}
+	runtime.ReadMemStats(&m2)
+	if n := m2.TotalAlloc - m1.TotalAlloc; n > 16<<20 {
+		t.Fatalf("decoding allocated %d bytes", n)
+	}
+}
@@ -24,17 +24,6 @@ func (dc directCodec) Bits() int {
 	return int(dc)
 }
 
-// Encode uses the range encoder to encode a value with the fixed number of
-// bits. The most-significant bit is encoded first.
-func (dc directCodec) Encode(e *rangeEncoder, v uint32) error {
-	for i := int(dc) - 1; i >= 0; i-- {
-		if err := e.DirectEncodeBit(v >> uint(i)); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
 // Decode uses the range decoder to decode a value with the given number of
 // given bits. The most-significant bit is decoded first.
 func (dc directCodec) Decode(d *rangeDecoder) (v uint32, err error) {
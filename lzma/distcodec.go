@@ -80,40 +80,6 @@ func lenState(l uint32) uint32 {
 	return l
 }
 
-// Encode encodes the distance using the parameter l. Dist can have values from
-// the full range of uint32 values. To get the distance offset the actual match
-// distance has to be decreased by 1. A distance offset of 0xffffffff (eos)
-// indicates the end of the stream.
-func (dc *distCodec) Encode(e *rangeEncoder, dist uint32, l uint32) (err error) {
-	// Compute the posSlot using nlz32
-	var posSlot uint32
-	var bits uint32
-	if dist < startPosModel {
-		posSlot = dist
-	} else {
-		bits = uint32(30 - nlz32(dist))
-		posSlot = startPosModel - 2 + (bits << 1)
-		posSlot += (dist >> uint(bits)) & 1
-	}
-
-	if err = dc.posSlotCodecs[lenState(l)].Encode(e, posSlot); err != nil {
-		return
-	}
-
-	switch {
-	case posSlot < startPosModel:
-		return nil
-	case posSlot < endPosModel:
-		tc := &dc.posModel[posSlot-startPosModel]
-		return tc.Encode(dist, e)
-	}
-	dic := directCodec(bits - alignBits)
-	if err = dic.Encode(e, dist>>alignBits); err != nil {
-		return
-	}
-	return dc.alignCodec.Encode(dist, e)
-}
-
 // Decode decodes the distance offset using the parameter l. The dist value
 // 0xffffffff (eos) indicates the end of the stream. Add one to the distance
 // offset to get the actual match distance.
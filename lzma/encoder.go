@@ -2,11 +2,16 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
 package lzma
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 )
 
 // opLenMargin provides the upper limit of the number of bytes required
@@ -43,6 +48,8 @@ type encoder struct {
 	marker bool
 	limit  bool
 	margin int
+	// trace receives the decisions if it is not nil
+	trace *json.Encoder
 }
 
 // newEncoder creates a new encoder. If the byte writer must be
@@ -202,21 +209,55 @@ func (e *encoder) writeMatch(m match) error {
 	return e.state.repLenCodec.Encode(e.re, n, posState)
 }
 
+// decision describes the operation before it is written.
+func (e *encoder) decision(op operation) Decision {
+	d := Decision{Pos: e.dict.Pos(), Rep: -1, State: e.state.state}
+	switch x := op.(type) {
+	case lit:
+		d.Op, d.Byte, d.Len = "lit", x.b, 1
+	case match:
+		d.Op, d.Dist, d.Len = "match", x.distance, x.n
+		for g, r := range e.state.rep {
+			if r == x.dist() {
+				d.Op, d.Rep = "rep", g
+				break
+			}
+		}
+		if d.Rep == 0 && x.n == 1 {
+			d.Op = "shortrep"
+		}
+	}
+	return d
+}
+
 // writeOp writes a single operation to the range encoder. The function
 // checks whether there is enough space available to close the LZMA
-// stream.
+// stream. The operation is added to the decision trace if there is
+// one.
 func (e *encoder) writeOp(op operation) error {
 	if e.re.Available() < int64(e.margin) {
 		return ErrLimit
 	}
+	var d Decision
+	var m bitMark
+	if e.trace != nil {
+		d = e.decision(op)
+		m = e.re.mark()
+	}
+	var err error
 	switch x := op.(type) {
 	case lit:
-		return e.writeLiteral(x)
+		err = e.writeLiteral(x)
 	case match:
-		return e.writeMatch(x)
+		err = e.writeMatch(x)
 	default:
 		panic("unexpected operation")
 	}
+	if err != nil || e.trace == nil {
+		return err
+	}
+	d.Price = math.Round(e.re.bitsSince(m)*1000) / 1000
+	return e.trace.Encode(d)
 }
 
 // compress compressed data from the dictionary buffer. If the flag all
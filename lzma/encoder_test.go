@@ -2,6 +2,9 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
 package lzma
 
 import (
@@ -35,7 +38,7 @@ func cycle(t *testing.T, n int) {
 			len(testString))
 	}
 	const dictCap = MinDictCap
-	m, err := newHashTable(dictCap, 4)
+	m, err := newHashTable(dictCap, 4, DefaultDepth)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -100,7 +103,7 @@ func TestEncoderCycle2(t *testing.T) {
 	txt := buf.String()
 	buf.Reset()
 	const dictCap = MinDictCap
-	m, err := newHashTable(dictCap, 4)
+	m, err := newHashTable(dictCap, 4, DefaultDepth)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -2,6 +2,9 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
 package lzma
 
 import (
@@ -16,6 +19,18 @@ type matcher interface {
 	io.Writer
 	SetDict(d *encoderDict)
 	NextOp(rep [4]uint32) operation
+	Reset()
+}
+
+// new creates the matcher for the match algorithm.
+func (a MatchAlgorithm) new(dictCap, depth int) (m matcher, err error) {
+	switch a {
+	case HashTable4:
+		return newHashTable(dictCap, 4, depth)
+	case BinaryTree:
+		return newBinTree(dictCap)
+	}
+	return nil, errUnsupportedMatchAlgorithm
 }
 
 // encoderDict provides the dictionary of the encoder. It includes an
@@ -40,6 +55,10 @@ func newEncoderDict(dictCap, bufSize int, m matcher) (d *encoderDict, err error)
 		return nil, errors.New(
 			"lzma: buffer size must be larger than zero")
 	}
+	if dictCap > maxBufferSize-bufSize {
+		return nil, errors.New("lzma: dictionary capacity and " +
+			"buffer size exceed the maximum buffer size")
+	}
 	d = &encoderDict{
 		buf:      *newBuffer(dictCap + bufSize),
 		capacity: dictCap,
@@ -49,6 +68,14 @@ func newEncoderDict(dictCap, bufSize int, m matcher) (d *encoderDict, err error)
 	return d, nil
 }
 
+// Reset clears the dictionary and the matcher, so that they can be
+// used for a new stream without allocating them again.
+func (d *encoderDict) Reset() {
+	d.buf.Reset()
+	d.head = 0
+	d.m.Reset()
+}
+
 // Discard discards n bytes. Note that n must not be larger than
 // MaxMatchLen.
 func (d *encoderDict) Discard(n int) {
@@ -0,0 +1,43 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lzma
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func FuzzLZMADecode(f *testing.F) {
+	files, err := filepath.Glob("examples/*.lzma")
+	if err != nil {
+		f.Fatalf("Glob error %s", err)
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			f.Fatalf("ReadFile error %s", err)
+		}
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		c := ReaderConfig{DictCapLimit: 1 << 20}
+		r, err := c.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		// io.CopyN returns io.EOF if the stream ended regularly
+		n, err := io.CopyN(ioutil.Discard, r, 1<<24)
+		if err != io.EOF {
+			return
+		}
+		if r.h.size >= 0 && n != r.h.size {
+			t.Fatalf("read %d bytes; header declares %d", n,
+				r.h.size)
+		}
+	})
+}
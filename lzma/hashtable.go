@@ -2,6 +2,9 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
 package lzma
 
 import (
@@ -16,24 +19,12 @@ import (
  * provide this capability.
  */
 
-// maxMatches limits the number of matches requested from the Matches
-// function. This controls the speed of the overall encoding.
-const maxMatches = 16
-
 // shortDists defines the number of short distances supported by the
 // implementation.
 const shortDists = 8
 
-// The minimum is somehow arbitrary but the maximum is limited by the
-// memory requirements of the hash table.
-const (
-	minTableExponent = 9
-	maxTableExponent = 20
-)
-
-// newRoller contains the function used to create an instance of the
-// hash.Roller.
-var newRoller = func(n int) hash.Roller { return hash.NewCyclicPoly(n) }
+// newRoller creates an instance of the hash.Roller.
+func newRoller(n int) hash.Roller { return hash.NewCyclicPoly(n) }
 
 // hashTable stores the hash table including the rolling hash method.
 //
@@ -58,53 +49,64 @@ type hashTable struct {
 	wr hash.Roller
 	// hash roller for computing arbitrary hashes
 	hr hash.Roller
-	// preallocated slices
-	p         [maxMatches]int64
-	distances [maxMatches + shortDists]int
-}
-
-// hashTableExponent derives the hash table exponent from the dictionary
-// capacity.
-func hashTableExponent(n uint32) int {
-	e := 30 - nlz32(n)
-	switch {
-	case e < minTableExponent:
-		e = minTableExponent
-	case e > maxTableExponent:
-		e = maxTableExponent
-	}
-	return e
+	// preallocated slices; the length of p limits the number of
+	// matches requested from the Matches function
+	p         []int64
+	distances []int
 }
 
-// newHashTable creates a new hash table for words of length wordLen
-func newHashTable(capacity int, wordLen int) (t *hashTable, err error) {
+// newHashTable creates a new hash table for words of length wordLen.
+// The depth gives the maximum number of match candidates checked per
+// position.
+func newHashTable(capacity, wordLen, depth int) (t *hashTable, err error) {
 	if !(0 < capacity) {
 		return nil, errors.New(
 			"newHashTable: capacity must not be negative")
 	}
+	if capacity > maxBufferSize/4 {
+		return nil, errors.New(
+			"newHashTable: capacity exceeds the address space")
+	}
 	exp := hashTableExponent(uint32(capacity))
 	if !(1 <= wordLen && wordLen <= 4) {
 		return nil, errors.New("newHashTable: " +
 			"argument wordLen out of range")
 	}
+	if !(1 <= depth && depth <= MaxDepth) {
+		return nil, errors.New("newHashTable: " +
+			"argument depth out of range")
+	}
 	n := 1 << uint(exp)
 	if n <= 0 {
 		panic("newHashTable: exponent is too large")
 	}
 	t = &hashTable{
-		t:       make([]int64, n),
-		data:    make([]uint32, capacity),
-		mask:    (uint64(1) << uint(exp)) - 1,
-		hoff:    -int64(wordLen),
-		wordLen: wordLen,
-		wr:      newRoller(wordLen),
-		hr:      newRoller(wordLen),
+		t:         make([]int64, n),
+		data:      make([]uint32, capacity),
+		mask:      (uint64(1) << uint(exp)) - 1,
+		hoff:      -int64(wordLen),
+		wordLen:   wordLen,
+		wr:        newRoller(wordLen),
+		hr:        newRoller(wordLen),
+		p:         make([]int64, depth),
+		distances: make([]int, 0, depth+shortDists),
 	}
 	return t, nil
 }
 
 func (t *hashTable) SetDict(d *encoderDict) { t.dict = d }
 
+// Reset clears the hash table. The chain buffer doesn't need to be
+// cleared, because only the entries for the positions hashed after the
+// reset are followed.
+func (t *hashTable) Reset() {
+	clear(t.t)
+	t.front = 0
+	t.hoff = -int64(t.wordLen)
+	t.wr = newRoller(t.wordLen)
+	t.hr = newRoller(t.wordLen)
+}
+
 // buffered returns the number of bytes that are currently hashed.
 func (t *hashTable) buffered() int {
 	n := t.hoff + 1
@@ -245,7 +247,7 @@ func (t *hashTable) NextOp(rep [4]uint32) operation {
 	if n < t.wordLen {
 		p = t.p[:0]
 	} else {
-		p = t.p[:maxMatches]
+		p = t.p
 		n = t.Matches(data[:t.wordLen], p)
 		p = p[:n]
 	}
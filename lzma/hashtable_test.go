@@ -2,6 +2,9 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
 package lzma
 
 import (
@@ -10,7 +13,7 @@ import (
 )
 
 func TestHashTable(t *testing.T) {
-	ht, err := newHashTable(32, 2)
+	ht, err := newHashTable(32, 2, DefaultDepth)
 	if err != nil {
 		t.Fatalf("newHashTable: error %s", err)
 	}
@@ -175,8 +175,10 @@ func (h *chunkHeader) UnmarshalBinary(data []byte) error {
 		return nil
 	}
 
-	h.props, err = PropertiesForCode(data[5])
-	return err
+	if h.props, err = PropertiesForCode(data[5]); err != nil {
+		return err
+	}
+	return h.props.verify2()
 }
 
 // MarshalBinary encodes the chunk header value. The function checks
@@ -185,7 +187,7 @@ func (h *chunkHeader) MarshalBinary() (data []byte, err error) {
 	if h.ctype > cLRND {
 		return nil, errors.New("invalid chunk type")
 	}
-	if err = h.props.verify(); err != nil {
+	if err = h.props.verify2(); err != nil {
 		return nil, err
 	}
 
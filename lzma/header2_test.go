@@ -151,3 +151,34 @@ func TestReadEOS(t *testing.T) {
 		t.Errorf("props got %v; want %v", h.props, wantProps)
 	}
 }
+
+func TestChunkHeaderProperties(t *testing.T) {
+	h := chunkHeader{ctype: cLRND, uncompressed: 99, compressed: 9}
+	data, err := h.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary error %s", err)
+	}
+	tests := []struct {
+		code byte
+		err  error
+	}{
+		{Properties{LC: 3, LP: 0, PB: 2}.Code(), nil},
+		{Properties{LC: 0, LP: 4, PB: 4}.Code(), nil},
+		{Properties{LC: 4, LP: 1, PB: 2}.Code(), ErrLCLPTooLarge},
+		{Properties{LC: 8, LP: 0, PB: 0}.Code(), ErrLCLPTooLarge},
+		{maxPropertyCode + 1, ErrInvalidPropertiesCode},
+	}
+	for _, tc := range tests {
+		data[5] = tc.code
+		var g chunkHeader
+		if err = g.UnmarshalBinary(data); err != tc.err {
+			t.Errorf("properties code %d: UnmarshalBinary "+
+				"returned %v; want %v", tc.code, err, tc.err)
+		}
+	}
+	h.props = Properties{LC: 3, LP: 2, PB: 2}
+	if _, err = h.MarshalBinary(); err != ErrLCLPTooLarge {
+		t.Errorf("MarshalBinary returned %v; want %v", err,
+			ErrLCLPTooLarge)
+	}
+}
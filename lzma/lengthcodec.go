@@ -4,8 +4,6 @@
 
 package lzma
 
-import "errors"
-
 // maxPosBits defines the number of bits of the position value that are used to
 // to compute the posState value. The value is used to select the tree codec
 // for length encoding and decoding.
@@ -69,40 +67,6 @@ func lBits(l uint32) int {
 	}
 }
 
-// Encode encodes the length offset. The length offset l can be compute by
-// subtracting minMatchLen (2) from the actual length.
-//
-//   l = length - minMatchLen
-//
-func (lc *lengthCodec) Encode(e *rangeEncoder, l uint32, posState uint32,
-) (err error) {
-	if l > maxMatchLen-minMatchLen {
-		return errors.New("lengthCodec.Encode: l out of range")
-	}
-	if l < 8 {
-		if err = lc.choice[0].Encode(e, 0); err != nil {
-			return
-		}
-		return lc.low[posState].Encode(e, l)
-	}
-	if err = lc.choice[0].Encode(e, 1); err != nil {
-		return
-	}
-	if l < 16 {
-		if err = lc.choice[1].Encode(e, 0); err != nil {
-			return
-		}
-		return lc.mid[posState].Encode(e, l-8)
-	}
-	if err = lc.choice[1].Encode(e, 1); err != nil {
-		return
-	}
-	if err = lc.high.Encode(e, l-16); err != nil {
-		return
-	}
-	return nil
-}
-
 // Decode reads the length offset. Add minMatchLen to compute the actual length
 // to the length offset l.
 func (lc *lengthCodec) Decode(d *rangeDecoder, posState uint32,
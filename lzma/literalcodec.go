@@ -16,7 +16,9 @@ func (c *literalCodec) deepcopy(src *literalCodec) {
 	if c == src {
 		return
 	}
-	c.probs = make([]prob, len(src.probs))
+	if len(c.probs) != len(src.probs) {
+		c.probs = make([]prob, len(src.probs))
+	}
 	copy(c.probs, src.probs)
 }
 
@@ -34,46 +36,6 @@ func (c *literalCodec) init(lc, lp int) {
 	}
 }
 
-// Encode encodes the byte s using a range encoder as well as the current LZMA
-// encoder state, a match byte and the literal state.
-func (c *literalCodec) Encode(e *rangeEncoder, s byte,
-	state uint32, match byte, litState uint32,
-) (err error) {
-	k := litState * 0x300
-	probs := c.probs[k : k+0x300]
-	symbol := uint32(1)
-	r := uint32(s)
-	if state >= 7 {
-		m := uint32(match)
-		for {
-			matchBit := (m >> 7) & 1
-			m <<= 1
-			bit := (r >> 7) & 1
-			r <<= 1
-			i := ((1 + matchBit) << 8) | symbol
-			if err = probs[i].Encode(e, bit); err != nil {
-				return
-			}
-			symbol = (symbol << 1) | bit
-			if matchBit != bit {
-				break
-			}
-			if symbol >= 0x100 {
-				break
-			}
-		}
-	}
-	for symbol < 0x100 {
-		bit := (r >> 7) & 1
-		r <<= 1
-		if err = probs[symbol].Encode(e, bit); err != nil {
-			return
-		}
-		symbol = (symbol << 1) | bit
-	}
-	return nil
-}
-
 // Decode decodes a literal byte using the range decoder as well as the LZMA
 // state, a match byte, and the literal state.
 func (c *literalCodec) Decode(d *rangeDecoder,
@@ -0,0 +1,19 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lzma
+
+// Logger receives the debug messages of the LZMA2 readers and writers.
+// The *log.Logger type of the standard library satisfies the interface.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// logf writes a message to the logger. Nothing happens if the logger is
+// nil.
+func logf(l Logger, format string, v ...interface{}) {
+	if l != nil {
+		l.Printf(format, v...)
+	}
+}
@@ -40,13 +40,3 @@ func (a MatchAlgorithm) verify() error {
 	}
 	return nil
 }
-
-func (a MatchAlgorithm) new(dictCap int) (m matcher, err error) {
-	switch a {
-	case HashTable4:
-		return newHashTable(dictCap, 4)
-	case BinaryTree:
-		return newBinTree(dictCap)
-	}
-	return nil, errUnsupportedMatchAlgorithm
-}
@@ -0,0 +1,139 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lzma
+
+import "errors"
+
+// The EstimateMemoryUsage methods estimate the maximum memory in bytes
+// that a reader or writer created with the configuration allocates,
+// like the memusage functions of liblzma. They allow schedulers to
+// admit or reject jobs based on the available memory. The estimates
+// cover the dictionary, the match finder and the probability tables,
+// which dominate the memory usage, but not the garbage collector
+// overhead. Decoders grow the dictionary with the decompressed data, so
+// short streams use less memory than estimated.
+
+// stateOverhead estimates the size of the state without the literal
+// codec.
+const stateOverhead = 1 << 13
+
+// stateSize estimates the memory required by a state with the given
+// properties.
+func stateSize(lc, lp int) int64 {
+	// the literal codec has 0x300 probabilities of 2 bytes for every
+	// combination of the lc and lp bits
+	return stateOverhead + 2*(0x300<<uint(lc+lp))
+}
+
+// The minimum is somehow arbitrary but the maximum is limited by the
+// memory requirements of the hash table.
+const (
+	minTableExponent = 9
+	maxTableExponent = 20
+)
+
+// hashTableExponent derives the hash table exponent from the dictionary
+// capacity.
+func hashTableExponent(n uint32) int {
+	e := 30 - nlz32(n)
+	switch {
+	case e < minTableExponent:
+		e = minTableExponent
+	case e > maxTableExponent:
+		e = maxTableExponent
+	}
+	return e
+}
+
+// matcherSize estimates the memory required by the match finder.
+func matcherSize(a MatchAlgorithm, dictCap int) int64 {
+	switch a {
+	case HashTable4:
+		// int64 slots of the table and a uint32 for every
+		// position in the dictionary
+		exp := hashTableExponent(uint32(dictCap))
+		return 8<<uint(exp) + 4*int64(dictCap)
+	case BinaryTree:
+		// a node has 16 bytes
+		return 16*int64(dictCap) + maxMatchLen
+	}
+	return 0
+}
+
+// encoderSize estimates the memory required by an encoder with states
+// copies of the state.
+func encoderSize(p *Properties, dictCap, bufSize int, m MatchAlgorithm,
+	states int) int64 {
+
+	n := int64(dictCap) + int64(bufSize) + 1
+	n += matcherSize(m, dictCap)
+	n += int64(states) * stateSize(p.LC, p.LP)
+	return n
+}
+
+// EstimateMemoryUsage estimates the memory required by a writer created
+// with the configuration.
+func (c WriterConfig) EstimateMemoryUsage() (int64, error) {
+	if err := c.Verify(); err != nil {
+		return 0, err
+	}
+	return encoderSize(c.Properties, c.DictCap, c.BufSize, c.Matcher, 1),
+		nil
+}
+
+// EstimateMemoryUsage estimates the memory required by a writer created
+// with the configuration.
+func (c Writer2Config) EstimateMemoryUsage() (int64, error) {
+	if err := c.Verify(); err != nil {
+		return 0, err
+	}
+	// the writer keeps the start state and buffers a compressed
+	// chunk
+	n := encoderSize(c.Properties, c.DictCap, c.BufSize, c.Matcher, 2)
+	return n + maxCompressed, nil
+}
+
+// EstimateMemoryUsage estimates the memory required by a reader created
+// with the configuration for the LZMA stream starting with data, which
+// must have a length of at least HeaderLen. Like NewReader it
+// returns a *DictCapLimitError if the dictionary capacity of the
+// header exceeds DictCapLimit.
+func (c ReaderConfig) EstimateMemoryUsage(data []byte) (int64, error) {
+	if err := c.Verify(); err != nil {
+		return 0, err
+	}
+	if len(data) < HeaderLen {
+		return 0, errors.New("lzma: header too short")
+	}
+	var h header
+	if err := h.unmarshalBinary(data[:HeaderLen]); err != nil {
+		return 0, err
+	}
+	if h.dictCap < MinDictCap {
+		return 0, errors.New("lzma: dictionary capacity too small")
+	}
+	if c.DictCapLimit > 0 && h.dictCap > c.DictCapLimit {
+		return 0, &DictCapLimitError{
+			DictCap: int64(h.dictCap),
+			Limit:   int64(c.DictCapLimit),
+		}
+	}
+	dictCap := h.dictCap
+	if c.DictCap > dictCap {
+		dictCap = c.DictCap
+	}
+	return int64(dictCap) + 1 + stateSize(h.properties.LC,
+		h.properties.LP), nil
+}
+
+// EstimateMemoryUsage estimates the memory required by a reader created
+// with the configuration. The properties of LZMA2 chunks may change, so
+// the estimate assumes the largest literal codec supported.
+func (c Reader2Config) EstimateMemoryUsage() (int64, error) {
+	if err := c.Verify(); err != nil {
+		return 0, err
+	}
+	return int64(c.DictCap) + 1 + stateSize(4, 0), nil
+}
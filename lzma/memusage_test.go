@@ -0,0 +1,112 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package lzma
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"runtime"
+	"testing"
+)
+
+// allocated returns the growth of the heap caused by the object
+// returned by f.
+func allocated(f func() interface{}) int64 {
+	var m0, m1 runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&m0)
+	x := f()
+	runtime.GC()
+	runtime.ReadMemStats(&m1)
+	runtime.KeepAlive(x)
+	return int64(m1.HeapAlloc) - int64(m0.HeapAlloc)
+}
+
+// checkEstimate checks that the estimate doesn't differ from the
+// allocated memory by more than a factor of two.
+func checkEstimate(t *testing.T, name string, estimate, alloc int64) {
+	if !(alloc <= 2*estimate && estimate <= 2*alloc) {
+		t.Errorf("%s: estimate %d; allocated %d", name, estimate,
+			alloc)
+	}
+}
+
+func TestEstimateMemoryUsage(t *testing.T) {
+	const dictCap = 1 << 20
+	data := make([]byte, 2*dictCap)
+	rand.New(rand.NewSource(1)).Read(data)
+	for _, m := range []MatchAlgorithm{HashTable4, BinaryTree} {
+		c := Writer2Config{DictCap: dictCap, Matcher: m}
+		estimate, err := c.EstimateMemoryUsage()
+		if err != nil {
+			t.Fatalf("EstimateMemoryUsage error %s", err)
+		}
+		alloc := allocated(func() interface{} {
+			w, err := c.NewWriter2(ioutil.Discard)
+			if err != nil {
+				t.Fatalf("NewWriter2 error %s", err)
+			}
+			if _, err = w.Write(data[:dictCap/2]); err != nil {
+				t.Fatalf("Write error %s", err)
+			}
+			return w
+		})
+		checkEstimate(t, "writer "+m.String(), estimate, alloc)
+	}
+
+	var buf bytes.Buffer
+	w, err := Writer2Config{DictCap: dictCap}.NewWriter2(&buf)
+	if err != nil {
+		t.Fatalf("NewWriter2 error %s", err)
+	}
+	if _, err = w.Write(data); err != nil {
+		t.Fatalf("Write error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("w.Close error %s", err)
+	}
+	c := Reader2Config{DictCap: dictCap}
+	estimate, err := c.EstimateMemoryUsage()
+	if err != nil {
+		t.Fatalf("EstimateMemoryUsage error %s", err)
+	}
+	alloc := allocated(func() interface{} {
+		r, err := c.NewReader2(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("NewReader2 error %s", err)
+		}
+		if _, err = io.Copy(ioutil.Discard, r); err != nil {
+			t.Fatalf("Copy error %s", err)
+		}
+		return r
+	})
+	checkEstimate(t, "reader", estimate, alloc)
+
+	h := header{properties: Properties{LC: 3, LP: 0, PB: 2},
+		dictCap: dictCap, size: -1}
+	p, err := h.marshalBinary()
+	if err != nil {
+		t.Fatalf("marshalBinary error %s", err)
+	}
+	estimate, err = ReaderConfig{}.EstimateMemoryUsage(p)
+	if err != nil {
+		t.Fatalf("ReaderConfig.EstimateMemoryUsage error %s", err)
+	}
+	if estimate < dictCap {
+		t.Fatalf("ReaderConfig.EstimateMemoryUsage returned %d; "+
+			"less than dictionary capacity", estimate)
+	}
+	_, err = ReaderConfig{DictCapLimit: dictCap / 2}.EstimateMemoryUsage(p)
+	if !errors.Is(err, ErrDictTooLarge) {
+		t.Fatalf("ReaderConfig.EstimateMemoryUsage returned error %v; "+
+			"want ErrDictTooLarge", err)
+	}
+}
@@ -32,10 +32,22 @@ func (p *Properties) String() string {
 	return fmt.Sprintf("LC %d LP %d PB %d", p.LC, p.LP, p.PB)
 }
 
+// Errors returned for invalid properties.
+var (
+	ErrInvalidPropertiesCode = errors.New("lzma: invalid properties code")
+	ErrLCOutOfRange          = errors.New("lzma: lc out of range")
+	ErrLPOutOfRange          = errors.New("lzma: lp out of range")
+	ErrPBOutOfRange          = errors.New("lzma: pb out of range")
+	ErrLCLPTooLarge          = errors.New("lzma: sum of lc and lp exceeds 4")
+)
+
+// maxLCLP is the maximum of the sum of LC and LP supported by LZMA2.
+const maxLCLP = 4
+
 // PropertiesForCode converts a properties code byte into a Properties value.
 func PropertiesForCode(code byte) (p Properties, err error) {
 	if code > maxPropertyCode {
-		return p, errors.New("lzma: invalid properties code")
+		return p, ErrInvalidPropertiesCode
 	}
 	p.LC = int(code % 9)
 	code /= 9
@@ -51,13 +63,25 @@ func (p *Properties) verify() error {
 		return errors.New("lzma: properties are nil")
 	}
 	if !(minLC <= p.LC && p.LC <= maxLC) {
-		return errors.New("lzma: lc out of range")
+		return ErrLCOutOfRange
 	}
 	if !(minLP <= p.LP && p.LP <= maxLP) {
-		return errors.New("lzma: lp out of range")
+		return ErrLPOutOfRange
 	}
 	if !(minPB <= p.PB && p.PB <= maxPB) {
-		return errors.New("lzma: pb out of range")
+		return ErrPBOutOfRange
+	}
+	return nil
+}
+
+// verify2 checks the properties for use in an LZMA2 stream, which
+// restricts the sum of LC and LP.
+func (p *Properties) verify2() error {
+	if err := p.verify(); err != nil {
+		return err
+	}
+	if p.LC+p.LP > maxLCLP {
+		return ErrLCLPTooLarge
 	}
 	return nil
 }
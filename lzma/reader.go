@@ -7,11 +7,14 @@
 // Writer2 support the decoding and encoding of LZMA2 streams.
 //
 // The package is written completely in Go and doesn't rely on any external
-// library.
+// library. It has no mutable package-level state, so readers and writers
+// may be used in different goroutines concurrently. A single reader or
+// writer must not be used by multiple goroutines at the same time.
 package lzma
 
 import (
 	"errors"
+	"fmt"
 	"io"
 )
 
@@ -19,12 +22,24 @@ import (
 // format.
 type ReaderConfig struct {
 	DictCap int
+	// DictCapLimit limits the dictionary capacity a stream may
+	// require. The value zero means that there is no limit.
+	DictCapLimit int
+	// RejectTrailingData requests that the reader returns
+	// ErrTrailingData if data follows the LZMA stream. The xz tool
+	// handles .lzma files this way. The option must not be set if the
+	// stream is followed by other data, for instance in a container
+	// format.
+	RejectTrailingData bool
 }
 
 // fill converts the zero values of the configuration to the default values.
 func (c *ReaderConfig) fill() {
 	if c.DictCap == 0 {
 		c.DictCap = 8 * 1024 * 1024
+		if 0 < c.DictCapLimit && c.DictCapLimit < c.DictCap {
+			c.DictCap = c.DictCapLimit
+		}
 	}
 }
 
@@ -35,14 +50,53 @@ func (c *ReaderConfig) Verify() error {
 	if !(MinDictCap <= c.DictCap && int64(c.DictCap) <= MaxDictCap) {
 		return errors.New("lzma: dictionary capacity is out of range")
 	}
+	if c.DictCapLimit < 0 {
+		return errors.New("lzma: dictionary capacity limit is negative")
+	}
+	if c.DictCapLimit > 0 && c.DictCap > c.DictCapLimit {
+		return errors.New(
+			"lzma: dictionary capacity exceeds the limit")
+	}
 	return nil
 }
 
+// DictCapLimitError is returned by the readers if the dictionary
+// capacity required by a stream exceeds the configured limit.
+type DictCapLimitError struct {
+	// DictCap is the dictionary capacity required by the stream.
+	DictCap int64
+	// Limit is the configured limit.
+	Limit int64
+}
+
+// Error returns the error message.
+func (e *DictCapLimitError) Error() string {
+	return fmt.Sprintf("lzma: dictionary capacity %d exceeds limit %d",
+		e.DictCap, e.Limit)
+}
+
+// ErrDictTooLarge is matched by all values of DictCapLimitError using
+// errors.Is.
+var ErrDictTooLarge = errors.New("lzma: dictionary capacity too large")
+
+// Is reports whether target is ErrDictTooLarge.
+func (e *DictCapLimitError) Is(target error) bool {
+	return target == ErrDictTooLarge
+}
+
+// ErrTrailingData is returned by the reader if data follows the LZMA
+// stream and ReaderConfig.RejectTrailingData is set.
+var ErrTrailingData = errors.New("lzma: data after end of stream")
+
 // Reader provides a reader for LZMA files or streams.
 type Reader struct {
 	lzma io.Reader
 	h    header
 	d    *decoder
+	// rejectTrailing requests the check for trailing data
+	rejectTrailing bool
+	// trailingErr is the result of the check for trailing data
+	trailingErr error
 }
 
 // NewReader creates a new reader for an LZMA stream using the classic
@@ -61,17 +115,23 @@ func (c ReaderConfig) NewReader(lzma io.Reader) (r *Reader, err error) {
 	data := make([]byte, HeaderLen)
 	if _, err := io.ReadFull(lzma, data); err != nil {
 		if err == io.EOF {
-			return nil, errors.New("lzma: unexpected EOF")
+			err = io.ErrUnexpectedEOF
 		}
 		return nil, err
 	}
-	r = &Reader{lzma: lzma}
+	r = &Reader{lzma: lzma, rejectTrailing: c.RejectTrailingData}
 	if err = r.h.unmarshalBinary(data); err != nil {
 		return nil, err
 	}
 	if r.h.dictCap < MinDictCap {
 		return nil, errors.New("lzma: dictionary capacity too small")
 	}
+	if c.DictCapLimit > 0 && r.h.dictCap > c.DictCapLimit {
+		return nil, &DictCapLimitError{
+			DictCap: int64(r.h.dictCap),
+			Limit:   int64(c.DictCapLimit),
+		}
+	}
 	dictCap := r.h.dictCap
 	if c.DictCap > dictCap {
 		dictCap = c.DictCap
@@ -84,6 +144,9 @@ func (c ReaderConfig) NewReader(lzma io.Reader) (r *Reader, err error) {
 	}
 	r.d, err = newDecoder(ByteReader(lzma), state, dict, r.h.size)
 	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
 		return nil, err
 	}
 	return r, nil
@@ -94,7 +157,32 @@ func (r *Reader) EOSMarker() bool {
 	return r.d.eosMarker
 }
 
-// Read returns uncompressed data.
+// Read returns uncompressed data. If the header declares the
+// uncompressed size, ErrUncompressedSize is returned if the stream
+// provides less or more data. All data decompressed before an error
+// is returned before the error is reported, so that the valid prefix of
+// a damaged stream can be recovered.
 func (r *Reader) Read(p []byte) (n int, err error) {
-	return r.d.Read(p)
+	n, err = r.d.Read(p)
+	if err == io.EOF && r.rejectTrailing {
+		if r.trailingErr == nil {
+			r.trailingErr = r.checkTrailingData()
+		}
+		err = r.trailingErr
+	}
+	return n, err
+}
+
+// checkTrailingData returns ErrTrailingData if the underlying reader
+// provides data after the end of the LZMA stream and io.EOF otherwise.
+func (r *Reader) checkTrailingData() error {
+	var p [1]byte
+	k, err := io.ReadFull(r.lzma, p[:])
+	if k > 0 {
+		return ErrTrailingData
+	}
+	if err == io.EOF {
+		return io.EOF
+	}
+	return err
 }
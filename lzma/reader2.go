@@ -7,14 +7,14 @@ package lzma
 import (
 	"errors"
 	"io"
-
-	"github.com/ulikunitz/xz/internal/xlog"
 )
 
 // Reader2Config stores the parameters for the LZMA2 reader.
 // format.
 type Reader2Config struct {
 	DictCap int
+	// Logger receives debug messages if it is not nil.
+	Logger Logger
 }
 
 // fill converts the zero values of the configuration to the default values.
@@ -46,9 +46,13 @@ type Reader2 struct {
 	ur          *uncompressedReader
 	decoder     *decoder
 	chunkReader io.Reader
+	// lr provides the compressed data of the current chunk
+	lr *io.LimitedReader
 
 	cstate chunkState
 	ctype  chunkType
+
+	logger Logger
 }
 
 // NewReader2 creates a reader for an LZMA2 chunk sequence.
@@ -61,7 +65,7 @@ func (c Reader2Config) NewReader2(lzma2 io.Reader) (r *Reader2, err error) {
 	if err = c.Verify(); err != nil {
 		return nil, err
 	}
-	r = &Reader2{r: lzma2, cstate: start}
+	r = &Reader2{r: lzma2, cstate: start, logger: c.Logger}
 	r.dict, err = newDecoderDict(c.DictCap)
 	if err != nil {
 		return nil, err
@@ -72,6 +76,22 @@ func (c Reader2Config) NewReader2(lzma2 io.Reader) (r *Reader2, err error) {
 	return r, nil
 }
 
+// Reset discards the state of the reader and prepares it for reading
+// the LZMA2 chunk sequence from lzma2. The dictionary buffer is kept, so
+// that the reader can be reused without allocating it again. As for
+// NewReader2 an error reading the first chunk header is returned by
+// Read.
+func (r *Reader2) Reset(lzma2 io.Reader) {
+	r.r = lzma2
+	r.err = nil
+	r.cstate = start
+	r.dict.buf.Reset()
+	r.dict.Reset()
+	if err := r.startChunk(); err != nil {
+		r.err = err
+	}
+}
+
 // uncompressed tests whether the chunk type specifies an uncompressed
 // chunk.
 func uncompressed(ctype chunkType) bool {
@@ -88,7 +108,7 @@ func (r *Reader2) startChunk() error {
 		}
 		return err
 	}
-	xlog.Debugf("chunk header %v", header)
+	logf(r.logger, "chunk header %v", header)
 	if err = r.cstate.next(header.ctype); err != nil {
 		return err
 	}
@@ -96,6 +116,7 @@ func (r *Reader2) startChunk() error {
 		return io.EOF
 	}
 	if header.ctype == cUD || header.ctype == cLRND {
+		logf(r.logger, "dictionary reset")
 		r.dict.Reset()
 	}
 	size := int64(header.uncompressed) + 1
@@ -108,13 +129,15 @@ func (r *Reader2) startChunk() error {
 		r.chunkReader = r.ur
 		return nil
 	}
-	br := ByteReader(io.LimitReader(r.r, int64(header.compressed)+1))
+	r.lr = &io.LimitedReader{R: r.r, N: int64(header.compressed) + 1}
+	br := ByteReader(r.lr)
 	if r.decoder == nil {
 		state := newState(header.props)
 		r.decoder, err = newDecoder(br, state, r.dict, size)
 		if err != nil {
 			return err
 		}
+		r.decoder.noEOSMarker = true
 		r.chunkReader = r.decoder
 		return nil
 	}
@@ -132,7 +155,21 @@ func (r *Reader2) startChunk() error {
 	return nil
 }
 
-// Read reads data from the LZMA2 chunk sequence.
+// errChunkData indicates that the range decoder didn't use all
+// compressed data of a chunk.
+var errChunkData = errors.New("lzma: unused compressed data at end of chunk")
+
+// endChunk checks that all compressed data of a compressed chunk has been
+// used after its uncompressed data has been read.
+func (r *Reader2) endChunk() error {
+	if r.chunkReader == io.Reader(r.decoder) && r.lr.N > 0 {
+		return errChunkData
+	}
+	return nil
+}
+
+// Read reads data from the LZMA2 chunk sequence. The data decompressed
+// before an error is returned before the error is reported.
 func (r *Reader2) Read(p []byte) (n int, err error) {
 	if r.err != nil {
 		return 0, r.err
@@ -143,7 +180,9 @@ func (r *Reader2) Read(p []byte) (n int, err error) {
 		n += k
 		if err != nil {
 			if err == io.EOF {
-				err = r.startChunk()
+				if err = r.endChunk(); err == nil {
+					err = r.startChunk()
+				}
 				if err == nil {
 					continue
 				}
@@ -207,26 +246,19 @@ func (ur *uncompressedReader) fill() error {
 	return io.EOF
 }
 
-// Read reads uncompressed data from the limited reader.
+// Read reads uncompressed data from the limited reader. An error is
+// returned only after the data copied into the dictionary has been read.
 func (ur *uncompressedReader) Read(p []byte) (n int, err error) {
-	if ur.err != nil {
-		return 0, ur.err
-	}
 	for {
-		var k int
-		k, err = ur.Dict.Read(p[n:])
+		k, _ := ur.Dict.Read(p[n:])
 		n += k
 		if n >= len(p) {
 			return n, nil
 		}
-		if err != nil {
-			break
-		}
-		err = ur.fill()
-		if err != nil {
-			break
+		// The dictionary buffer is empty.
+		if ur.err != nil {
+			return n, ur.err
 		}
+		ur.err = ur.fill()
 	}
-	ur.err = err
-	return n, err
 }
@@ -0,0 +1,78 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package lzma
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"testing"
+)
+
+func newCodeReader(r io.Reader) *io.PipeReader {
+	pr, pw := io.Pipe()
+	go func() {
+		bw := bufio.NewWriter(pw)
+		lw, err := NewWriter(bw)
+		if err != nil {
+			log.Fatalf("NewWriter error %s", err)
+		}
+		if _, err = io.Copy(lw, r); err != nil {
+			log.Fatalf("io.Copy error %s", err)
+		}
+		if err = lw.Close(); err != nil {
+			log.Fatalf("lw.Close error %s", err)
+		}
+		if err = bw.Flush(); err != nil {
+			log.Fatalf("bw.Flush() error %s", err)
+		}
+		if err = pw.CloseWithError(io.EOF); err != nil {
+			log.Fatalf("pw.CloseWithError(io.EOF) error %s", err)
+		}
+	}()
+	return pr
+}
+
+func TestReaderErrAgain(t *testing.T) {
+	lengths := []int64{0, 128, 1024, 4095, 4096, 4097, 8191, 8192, 8193}
+	buf := make([]byte, 128)
+	const c = 'A'
+	for _, n := range lengths {
+		t.Logf("n: %d", n)
+		pr := newCodeReader(newRepReader(c, n))
+		r, err := NewReader(pr)
+		if err != nil {
+			t.Fatalf("NewReader(pr) error %s", err)
+		}
+		k := int64(0)
+		for {
+			m, err := r.Read(buf)
+			k += int64(m)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Errorf("r.Read(buf) error %s", err)
+				break
+			}
+			if m > len(buf) {
+				t.Fatalf("r.Read(buf) %d; want <= %d", m,
+					len(buf))
+			}
+			for i, b := range buf[:m] {
+				if b != c {
+					t.Fatalf("buf[%d]=%c; want %c", i, b,
+						c)
+				}
+			}
+		}
+		if k != n {
+			t.Errorf("Read %d bytes; want %d", k, n)
+		}
+	}
+}
@@ -112,7 +112,6 @@ func TestReaderAll(t *testing.T) {
 	}
 }
 
-//
 func Example_reader() {
 	f, err := os.Open("fox.lzma")
 	if err != nil {
@@ -248,65 +247,173 @@ func newRepReader(c byte, n int64) *io.LimitedReader {
 	return &io.LimitedReader{R: repReader(c), N: n}
 }
 
-func newCodeReader(r io.Reader) *io.PipeReader {
-	pr, pw := io.Pipe()
-	go func() {
-		bw := bufio.NewWriter(pw)
-		lw, err := NewWriter(bw)
-		if err != nil {
-			log.Fatalf("NewWriter error %s", err)
+func TestReaderDictCapLimit(t *testing.T) {
+	f, err := os.Open("examples/a.lzma")
+	if err != nil {
+		t.Fatalf("open examples/a.lzma: %s", err)
+	}
+	defer f.Close()
+	cfg := ReaderConfig{DictCapLimit: MinDictCap}
+	_, err = cfg.NewReader(bufio.NewReader(f))
+	if _, ok := err.(*DictCapLimitError); !ok {
+		t.Fatalf("NewReader returned error %v; want DictCapLimitError",
+			err)
+	}
+}
+
+func TestReaderTruncated(t *testing.T) {
+	data, err := ioutil.ReadFile("examples/a.lzma")
+	if err != nil {
+		t.Fatalf("ReadFile error %s", err)
+	}
+	for n := 0; n < 64; n++ {
+		r, err := NewReader(bytes.NewReader(data[:n]))
+		if err == nil {
+			_, err = ioutil.ReadAll(r)
 		}
-		if _, err = io.Copy(lw, r); err != nil {
-			log.Fatalf("io.Copy error %s", err)
+		if err != io.ErrUnexpectedEOF {
+			t.Fatalf("stream truncated to %d bytes: got error %v; "+
+				"want %v", n, err, io.ErrUnexpectedEOF)
 		}
-		if err = lw.Close(); err != nil {
-			log.Fatalf("lw.Close error %s", err)
+	}
+}
+
+func TestReaderUncompressedSize(t *testing.T) {
+	tests := []struct {
+		file string
+		size uint64
+		err  error
+	}{
+		{"a.lzma", 327, nil},
+		{"a.lzma", 1, ErrUncompressedSize},
+		{"a.lzma", 326, ErrUncompressedSize},
+		// without end of stream marker more data is expected
+		{"a.lzma", 328, io.ErrUnexpectedEOF},
+		{"a_eos_and_size.lzma", 327, nil},
+		{"a_eos_and_size.lzma", 326, ErrUncompressedSize},
+		{"a_eos_and_size.lzma", 328, ErrUncompressedSize},
+	}
+	for _, tc := range tests {
+		data, err := ioutil.ReadFile(filepath.Join("examples", tc.file))
+		if err != nil {
+			t.Fatalf("ReadFile error %s", err)
 		}
-		if err = bw.Flush(); err != nil {
-			log.Fatalf("bw.Flush() error %s", err)
+		putUint64LE(data[5:], tc.size)
+		r, err := NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("NewReader error %s", err)
 		}
-		if err = pw.CloseWithError(io.EOF); err != nil {
-			log.Fatalf("pw.CloseWithError(io.EOF) error %s", err)
+		if _, err = ioutil.ReadAll(r); err != tc.err {
+			t.Errorf("%s with size %d: ReadAll returned %v; "+
+				"want %v", tc.file, tc.size, err, tc.err)
 		}
-	}()
-	return pr
+	}
+}
+
+func TestReaderTrailingData(t *testing.T) {
+	data, err := ioutil.ReadFile("examples/a_eos_and_size.lzma")
+	if err != nil {
+		t.Fatalf("ReadFile error %s", err)
+	}
+	for _, trailer := range []string{"", "\x00", "garbage"} {
+		p := append(append([]byte(nil), data...), trailer...)
+		for _, reject := range []bool{false, true} {
+			c := ReaderConfig{RejectTrailingData: reject}
+			r, err := c.NewReader(bytes.NewReader(p))
+			if err != nil {
+				t.Fatalf("NewReader error %s", err)
+			}
+			_, err = ioutil.ReadAll(r)
+			var want error
+			if reject && trailer != "" {
+				want = ErrTrailingData
+			}
+			if err != want {
+				t.Errorf("trailer %q, RejectTrailingData %t: "+
+					"ReadAll returned %v; want %v",
+					trailer, reject, err, want)
+			}
+		}
+	}
 }
 
-func TestReaderErrAgain(t *testing.T) {
-	lengths := []int64{0, 128, 1024, 4095, 4096, 4097, 8191, 8192, 8193}
-	buf := make([]byte, 128)
-	const c = 'A'
-	for _, n := range lengths {
-		t.Logf("n: %d", n)
-		pr := newCodeReader(newRepReader(c, n))
-		r, err := NewReader(pr)
+// readChunks reads r with reads of the given size until an error
+// occurs.
+func readChunks(r io.Reader, size int) (data []byte, err error) {
+	p := make([]byte, size)
+	for {
+		n, err := r.Read(p)
+		data = append(data, p[:n]...)
 		if err != nil {
-			t.Fatalf("NewReader(pr) error %s", err)
+			return data, err
 		}
-		k := int64(0)
-		for {
-			m, err := r.Read(buf)
-			k += int64(m)
-			if err == io.EOF {
-				break
-			}
+	}
+}
+
+func TestReaderPartialOutput(t *testing.T) {
+	orig := readOrigFile(t)
+	data, err := ioutil.ReadFile("examples/a.lzma")
+	if err != nil {
+		t.Fatalf("ReadFile error %s", err)
+	}
+	prev := 0
+	for n := HeaderLen + 5; n < len(data); n++ {
+		var want []byte
+		for _, size := range []int{1, 7, 4096} {
+			r, err := NewReader(bytes.NewReader(data[:n]))
 			if err != nil {
-				t.Errorf("r.Read(buf) error %s", err)
-				break
+				t.Fatalf("NewReader error %s", err)
+			}
+			out, err := readChunks(r, size)
+			if err != io.ErrUnexpectedEOF {
+				t.Fatalf("stream truncated to %d bytes: got "+
+					"error %v; want %v", n, err,
+					io.ErrUnexpectedEOF)
+			}
+			if !bytes.HasPrefix(orig, out) {
+				t.Fatalf("stream truncated to %d bytes: output "+
+					"is not a prefix of the original", n)
 			}
-			if m > len(buf) {
-				t.Fatalf("r.Read(buf) %d; want <= %d", m,
-					len(buf))
+			if want == nil {
+				want = out
+				continue
 			}
-			for i, b := range buf[:m] {
-				if b != c {
-					t.Fatalf("buf[%d]=%c; want %c", i, b,
-						c)
-				}
+			if len(out) != len(want) {
+				t.Fatalf("stream truncated to %d bytes: "+
+					"read %d bytes with buffer size %d; "+
+					"want %d", n, len(out), size, len(want))
 			}
 		}
-		if k != n {
-			t.Errorf("Read %d bytes; want %d", k, n)
+		// more compressed data must not provide less output
+		if len(want) < prev {
+			t.Fatalf("stream truncated to %d bytes: read %d bytes; "+
+				"want at least %d", n, len(want), prev)
+		}
+		prev = len(want)
+	}
+	// only the last operations may be missing
+	if prev < len(orig)/2 {
+		t.Fatalf("stream missing one byte: read %d bytes; want at "+
+			"least %d", prev, len(orig)/2)
+	}
+}
+
+func TestReaderDataAfterEOS(t *testing.T) {
+	for _, file := range []string{"a_eos.lzma", "a_eos_and_size.lzma"} {
+		data, err := ioutil.ReadFile(filepath.Join(dirname, file))
+		if err != nil {
+			t.Fatalf("ReadFile error %s", err)
+		}
+		// the range decoder must be in its final state after the
+		// EOS marker
+		data[len(data)-1] ^= 1
+		r, err := NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("NewReader error %s", err)
+		}
+		if _, err = ioutil.ReadAll(r); err != errDataAfterEOS {
+			t.Fatalf("%s: got error %v; want %v", file, err,
+				errDataAfterEOS)
 		}
 	}
 }
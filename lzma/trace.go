@@ -0,0 +1,38 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lzma
+
+// The range coders can trace every bit they encode or decode. The trace
+// statements and counters are only compiled in if the debugtrace build
+// tag is given; otherwise the trace functions are empty and are removed
+// by the compiler, so that the release builds don't pay for them.
+//
+//	$ go test -tags debugtrace ./lzma
+//
+// The trace output and the counters are global, because the range
+// coders don't know the configuration of their reader or writer. They
+// are meant for the diagnosis of single streams and not for production
+// use.
+
+// TraceCounts provides the number of bits processed by the range coders
+// since the start of the program or the last call of ResetTraceCounts.
+// Direct bits are coded with a fixed probability of one half.
+type TraceCounts struct {
+	DecodedBits       int64
+	DirectDecodedBits int64
+	EncodedBits       int64
+	DirectEncodedBits int64
+	// Normalizations counts the bytes shifted into the code of the
+	// range decoder and out of the low value of the range encoder.
+	Normalizations int64
+}
+
+// Trace operations reported by traceBit.
+const (
+	traceDecode       = 'D'
+	traceDirectDecode = 'd'
+	traceEncode       = 'E'
+	traceDirectEncode = 'e'
+)
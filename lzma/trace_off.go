@@ -0,0 +1,29 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !debugtrace
+// +build !debugtrace
+
+package lzma
+
+import "io"
+
+// TraceEnabled reports whether the package has been built with the
+// debugtrace tag.
+const TraceEnabled = false
+
+// SetTraceWriter does nothing without the debugtrace tag.
+func SetTraceWriter(w io.Writer) {}
+
+// ReadTraceCounts returns zero counters without the debugtrace tag.
+func ReadTraceCounts() TraceCounts { return TraceCounts{} }
+
+// ResetTraceCounts does nothing without the debugtrace tag.
+func ResetTraceCounts() {}
+
+// traceBit is removed by the compiler.
+func traceBit(op byte, p prob, b uint32, nrange uint32) {}
+
+// traceNormalize is removed by the compiler.
+func traceNormalize() {}
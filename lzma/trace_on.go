@@ -0,0 +1,88 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build debugtrace
+// +build debugtrace
+
+package lzma
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// TraceEnabled reports whether the package has been built with the
+// debugtrace tag.
+const TraceEnabled = true
+
+// traceCounts holds the counters, which are updated atomically.
+var traceCounts TraceCounts
+
+// traceMu protects traceOut.
+var (
+	traceMu  sync.Mutex
+	traceOut io.Writer
+)
+
+// SetTraceWriter sets the writer receiving a line for every bit coded.
+// A nil writer switches the output off. The counters are always
+// maintained.
+func SetTraceWriter(w io.Writer) {
+	traceMu.Lock()
+	traceOut = w
+	traceMu.Unlock()
+}
+
+// ReadTraceCounts returns the current counters.
+func ReadTraceCounts() TraceCounts {
+	return TraceCounts{
+		DecodedBits:       atomic.LoadInt64(&traceCounts.DecodedBits),
+		DirectDecodedBits: atomic.LoadInt64(&traceCounts.DirectDecodedBits),
+		EncodedBits:       atomic.LoadInt64(&traceCounts.EncodedBits),
+		DirectEncodedBits: atomic.LoadInt64(&traceCounts.DirectEncodedBits),
+		Normalizations:    atomic.LoadInt64(&traceCounts.Normalizations),
+	}
+}
+
+// ResetTraceCounts sets all counters to zero.
+func ResetTraceCounts() {
+	atomic.StoreInt64(&traceCounts.DecodedBits, 0)
+	atomic.StoreInt64(&traceCounts.DirectDecodedBits, 0)
+	atomic.StoreInt64(&traceCounts.EncodedBits, 0)
+	atomic.StoreInt64(&traceCounts.DirectEncodedBits, 0)
+	atomic.StoreInt64(&traceCounts.Normalizations, 0)
+}
+
+// traceBit records the bit b coded by operation op. The probability p
+// is the value before the update; it is zero for direct bits. The
+// range is the value after the bit has been coded.
+func traceBit(op byte, p prob, b uint32, nrange uint32) {
+	var c *int64
+	switch op {
+	case traceDecode:
+		c = &traceCounts.DecodedBits
+	case traceDirectDecode:
+		c = &traceCounts.DirectDecodedBits
+	case traceEncode:
+		c = &traceCounts.EncodedBits
+	case traceDirectEncode:
+		c = &traceCounts.DirectEncodedBits
+	default:
+		panic("unknown trace operation")
+	}
+	atomic.AddInt64(c, 1)
+	traceMu.Lock()
+	defer traceMu.Unlock()
+	if traceOut != nil {
+		fmt.Fprintf(traceOut, "%c prob %4d bit %d range %#08x\n",
+			op, p, b, nrange)
+	}
+}
+
+// traceNormalize counts a normalization of the range.
+func traceNormalize() {
+	atomic.AddInt64(&traceCounts.Normalizations, 1)
+}
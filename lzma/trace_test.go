@@ -0,0 +1,66 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build debugtrace && !xz_noencoder
+// +build debugtrace,!xz_noencoder
+
+package lzma
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestTrace(t *testing.T) {
+	if !TraceEnabled {
+		t.Fatalf("TraceEnabled is false")
+	}
+	const text = "The quick brown fox jumps over the lazy dog.\n"
+	var trace bytes.Buffer
+	SetTraceWriter(&trace)
+	defer SetTraceWriter(nil)
+	ResetTraceCounts()
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	if _, err = io.WriteString(w, strings.Repeat(text, 20)); err != nil {
+		t.Fatalf("WriteString error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("w.Close error %s", err)
+	}
+	c := ReadTraceCounts()
+	if c.EncodedBits == 0 || c.DirectEncodedBits == 0 {
+		t.Fatalf("encoder counts %+v; want bits", c)
+	}
+	if c.DecodedBits != 0 || c.DirectDecodedBits != 0 {
+		t.Fatalf("decoder counts %+v; want zero", c)
+	}
+	lines := int64(strings.Count(trace.String(), "\n"))
+	if n := c.EncodedBits + c.DirectEncodedBits; lines != n {
+		t.Fatalf("got %d trace lines; want %d", lines, n)
+	}
+
+	ResetTraceCounts()
+	SetTraceWriter(nil)
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	if _, err = io.Copy(ioutil.Discard, r); err != nil {
+		t.Fatalf("io.Copy error %s", err)
+	}
+	d := ReadTraceCounts()
+	// the decoder reads the same bits the encoder has written
+	if d.DecodedBits != c.EncodedBits ||
+		d.DirectDecodedBits != c.DirectEncodedBits {
+		t.Fatalf("decoder counts %+v; encoder counts %+v", d, c)
+	}
+}
@@ -21,19 +21,6 @@ func (tc *treeCodec) deepcopy(src *treeCodec) {
 	tc.probTree.deepcopy(&src.probTree)
 }
 
-// Encode uses the range encoder to encode a fixed-bit-size value.
-func (tc *treeCodec) Encode(e *rangeEncoder, v uint32) (err error) {
-	m := uint32(1)
-	for i := int(tc.bits) - 1; i >= 0; i-- {
-		b := (v >> uint(i)) & 1
-		if err := e.EncodeBit(b, &tc.probs[m]); err != nil {
-			return err
-		}
-		m = (m << 1) | b
-	}
-	return nil
-}
-
 // Decodes uses the range decoder to decode a fixed-bit-size value. Errors may
 // be caused by the range decoder.
 func (tc *treeCodec) Decode(d *rangeDecoder) (v uint32, err error) {
@@ -66,20 +53,6 @@ func makeTreeReverseCodec(bits int) treeReverseCodec {
 	return treeReverseCodec{makeProbTree(bits)}
 }
 
-// Encode uses range encoder to encode a fixed-bit-size value. The range
-// encoder may cause errors.
-func (tc *treeReverseCodec) Encode(v uint32, e *rangeEncoder) (err error) {
-	m := uint32(1)
-	for i := uint(0); i < uint(tc.bits); i++ {
-		b := (v >> i) & 1
-		if err := e.EncodeBit(b, &tc.probs[m]); err != nil {
-			return err
-		}
-		m = (m << 1) | b
-	}
-	return nil
-}
-
 // Decodes uses the range decoder to decode a fixed-bit-size value. Errors
 // returned by the range decoder will be returned.
 func (tc *treeReverseCodec) Decode(d *rangeDecoder) (v uint32, err error) {
@@ -107,7 +80,9 @@ func (t *probTree) deepcopy(src *probTree) {
 	if t == src {
 		return
 	}
-	t.probs = make([]prob, len(src.probs))
+	if len(t.probs) != len(src.probs) {
+		t.probs = make([]prob, len(src.probs))
+	}
 	copy(t.probs, src.probs)
 	t.bits = src.bits
 }
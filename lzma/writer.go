@@ -2,112 +2,17 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
 package lzma
 
 import (
 	"bufio"
-	"errors"
+	"encoding/json"
 	"io"
 )
 
-// MinDictCap and MaxDictCap provide the range of supported dictionary
-// capacities.
-const (
-	MinDictCap = 1 << 12
-	MaxDictCap = 1<<32 - 1
-)
-
-// WriterConfig defines the configuration parameter for a writer.
-type WriterConfig struct {
-	// Properties for the encoding. If the it is nil the value
-	// {LC: 3, LP: 0, PB: 2} will be chosen.
-	Properties *Properties
-	// The capacity of the dictionary. If DictCap is zero, the value
-	// 8 MiB will be chosen.
-	DictCap int
-	// Size of the lookahead buffer; value 0 indicates default size
-	// 4096
-	BufSize int
-	// Match algorithm
-	Matcher MatchAlgorithm
-	// SizeInHeader indicates that the header will contain an
-	// explicit size.
-	SizeInHeader bool
-	// Size of the data to be encoded. A positive value will imply
-	// than an explicit size will be set in the header.
-	Size int64
-	// EOSMarker requests whether the EOSMarker needs to be written.
-	// If no explicit size is been given the EOSMarker will be
-	// set automatically.
-	EOSMarker bool
-}
-
-// fill converts zero-value fields to their explicit default values.
-func (c *WriterConfig) fill() {
-	if c.Properties == nil {
-		c.Properties = &Properties{LC: 3, LP: 0, PB: 2}
-	}
-	if c.DictCap == 0 {
-		c.DictCap = 8 * 1024 * 1024
-	}
-	if c.BufSize == 0 {
-		c.BufSize = 4096
-	}
-	if c.Size > 0 {
-		c.SizeInHeader = true
-	}
-	if !c.SizeInHeader {
-		c.EOSMarker = true
-	}
-}
-
-// Verify checks WriterConfig for errors. Verify will replace zero
-// values with default values.
-func (c *WriterConfig) Verify() error {
-	c.fill()
-	var err error
-	if c == nil {
-		return errors.New("lzma: WriterConfig is nil")
-	}
-	if c.Properties == nil {
-		return errors.New("lzma: WriterConfig has no Properties set")
-	}
-	if err = c.Properties.verify(); err != nil {
-		return err
-	}
-	if !(MinDictCap <= c.DictCap && int64(c.DictCap) <= MaxDictCap) {
-		return errors.New("lzma: dictionary capacity is out of range")
-	}
-	if !(maxMatchLen <= c.BufSize) {
-		return errors.New("lzma: lookahead buffer size too small")
-	}
-	if c.SizeInHeader {
-		if c.Size < 0 {
-			return errors.New("lzma: negative size not supported")
-		}
-	} else if !c.EOSMarker {
-		return errors.New("lzma: EOS marker is required")
-	}
-	if err = c.Matcher.verify(); err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// header returns the header structure for this configuration.
-func (c *WriterConfig) header() header {
-	h := header{
-		properties: *c.Properties,
-		dictCap:    c.DictCap,
-		size:       -1,
-	}
-	if c.SizeInHeader {
-		h.size = c.Size
-	}
-	return h
-}
-
 // Writer writes an LZMA stream in the classic format.
 type Writer struct {
 	h   header
@@ -131,7 +36,7 @@ func (c WriterConfig) NewWriter(lzma io.Writer) (w *Writer, err error) {
 		w.bw = w.buf
 	}
 	state := newState(w.h.properties)
-	m, err := c.Matcher.new(w.h.dictCap)
+	m, err := c.Matcher.new(w.h.dictCap, c.Depth)
 	if err != nil {
 		return nil, err
 	}
@@ -146,6 +51,9 @@ func (c WriterConfig) NewWriter(lzma io.Writer) (w *Writer, err error) {
 	if w.e, err = newEncoder(w.bw, state, dict, flags); err != nil {
 		return nil, err
 	}
+	if c.DecisionTrace != nil {
+		w.e.trace = json.NewEncoder(c.DecisionTrace)
+	}
 
 	if err = w.writeHeader(); err != nil {
 		return nil, err
@@ -195,7 +103,7 @@ func (w *Writer) Close() error {
 	if w.h.size >= 0 {
 		n := w.e.Compressed() + int64(w.e.dict.Buffered())
 		if n != w.h.size {
-			return errSize
+			return ErrUncompressedSize
 		}
 	}
 	err := w.e.Close()
@@ -2,71 +2,18 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
 package lzma
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"io"
 )
 
-// Writer2Config is used to create a Writer2 using parameters.
-type Writer2Config struct {
-	// The properties for the encoding. If the it is nil the value
-	// {LC: 3, LP: 0, PB: 2} will be chosen.
-	Properties *Properties
-	// The capacity of the dictionary. If DictCap is zero, the value
-	// 8 MiB will be chosen.
-	DictCap int
-	// Size of the lookahead buffer; value 0 indicates default size
-	// 4096
-	BufSize int
-	// Match algorithm
-	Matcher MatchAlgorithm
-}
-
-// fill replaces zero values with default values.
-func (c *Writer2Config) fill() {
-	if c.Properties == nil {
-		c.Properties = &Properties{LC: 3, LP: 0, PB: 2}
-	}
-	if c.DictCap == 0 {
-		c.DictCap = 8 * 1024 * 1024
-	}
-	if c.BufSize == 0 {
-		c.BufSize = 4096
-	}
-}
-
-// Verify checks the Writer2Config for correctness. Zero values will be
-// replaced by default values.
-func (c *Writer2Config) Verify() error {
-	c.fill()
-	var err error
-	if c == nil {
-		return errors.New("lzma: WriterConfig is nil")
-	}
-	if c.Properties == nil {
-		return errors.New("lzma: WriterConfig has no Properties set")
-	}
-	if err = c.Properties.verify(); err != nil {
-		return err
-	}
-	if !(MinDictCap <= c.DictCap && int64(c.DictCap) <= MaxDictCap) {
-		return errors.New("lzma: dictionary capacity is out of range")
-	}
-	if !(maxMatchLen <= c.BufSize) {
-		return errors.New("lzma: lookahead buffer size too small")
-	}
-	if c.Properties.LC+c.Properties.LP > 4 {
-		return errors.New("lzma: sum of lc and lp exceeds 4")
-	}
-	if err = c.Matcher.verify(); err != nil {
-		return err
-	}
-	return nil
-}
-
 // Writer2 supports the creation of an LZMA2 stream. But note that
 // written data is buffered, so call Flush or Close to write data to the
 // underlying writer. The Close method writes the end-of-stream marker
@@ -79,7 +26,10 @@ func (c *Writer2Config) Verify() error {
 type Writer2 struct {
 	w io.Writer
 
+	// start is the state at the start of the current chunk; initial
+	// is the state after a reset
 	start   *state
+	initial *state
 	encoder *encoder
 
 	cstate chunkState
@@ -87,6 +37,8 @@ type Writer2 struct {
 
 	buf bytes.Buffer
 	lbw LimitedByteWriter
+
+	logger Logger
 }
 
 // NewWriter2 creates an LZMA2 chunk sequence writer with the default
@@ -101,14 +53,16 @@ func (c Writer2Config) NewWriter2(lzma2 io.Writer) (w *Writer2, err error) {
 		return nil, err
 	}
 	w = &Writer2{
-		w:      lzma2,
-		start:  newState(*c.Properties),
-		cstate: start,
-		ctype:  start.defaultChunkType(),
+		w:       lzma2,
+		start:   newState(*c.Properties),
+		initial: newState(*c.Properties),
+		cstate:  start,
+		ctype:   start.defaultChunkType(),
+		logger:  c.Logger,
 	}
 	w.buf.Grow(maxCompressed)
 	w.lbw = LimitedByteWriter{BW: &w.buf, N: maxCompressed}
-	m, err := c.Matcher.new(c.DictCap)
+	m, err := c.Matcher.new(c.DictCap, c.Depth)
 	if err != nil {
 		return nil, err
 	}
@@ -120,9 +74,28 @@ func (c Writer2Config) NewWriter2(lzma2 io.Writer) (w *Writer2, err error) {
 	if err != nil {
 		return nil, err
 	}
+	if c.DecisionTrace != nil {
+		w.encoder.trace = json.NewEncoder(c.DecisionTrace)
+	}
 	return w, nil
 }
 
+// Reset discards the state of the writer and prepares it for writing a
+// new LZMA2 stream to lzma2. The dictionary and the match finder are
+// kept, so that the writer can be reused without allocating them again.
+// Data not written by Close is discarded.
+func (w *Writer2) Reset(lzma2 io.Writer) error {
+	w.w = lzma2
+	w.start.deepcopy(w.initial)
+	w.cstate = start
+	w.ctype = start.defaultChunkType()
+	w.buf.Reset()
+	w.lbw.N = maxCompressed
+	w.encoder.dict.Reset()
+	w.encoder.state.deepcopy(w.initial)
+	return w.encoder.Reopen(&w.lbw)
+}
+
 // written returns the number of bytes written to the current chunk
 func (w *Writer2) written() int {
 	if w.encoder == nil {
@@ -182,7 +155,7 @@ func (w *Writer2) writeUncompressedChunk() error {
 	default:
 		w.ctype = cU
 	}
-	w.encoder.state = w.start
+	w.encoder.state.deepcopy(w.start)
 
 	header := chunkHeader{
 		ctype:        w.ctype,
@@ -192,6 +165,7 @@ func (w *Writer2) writeUncompressedChunk() error {
 	if err != nil {
 		return err
 	}
+	logf(w.logger, "chunk header %v", header)
 	if _, err = w.w.Write(hdata); err != nil {
 		return err
 	}
@@ -230,6 +204,7 @@ func (w *Writer2) writeCompressedChunk() error {
 	if err != nil {
 		return err
 	}
+	logf(w.logger, "chunk header %v", header)
 	if _, err = w.w.Write(hdata); err != nil {
 		return err
 	}
@@ -269,7 +244,7 @@ func (w *Writer2) flushChunk() error {
 		return err
 	}
 	w.ctype = w.cstate.defaultChunkType()
-	w.start = cloneState(w.encoder.state)
+	w.start.deepcopy(w.encoder.state)
 	return nil
 }
 
@@ -293,9 +268,10 @@ func (w *Writer2) Close() error {
 		return errClosed
 	}
 	if err := w.Flush(); err != nil {
-		return nil
+		return err
 	}
 	// write zero byte EOS chunk
+	logf(w.logger, "chunk header %v", chunkHeader{ctype: cEOS})
 	_, err := w.w.Write([]byte{0})
 	if err != nil {
 		return err
@@ -2,6 +2,9 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
 package lzma
 
 import (
@@ -107,3 +110,223 @@ func TestCycle2(t *testing.T) {
 		t.Fatal("decompressed data differs from original")
 	}
 }
+
+func TestWriter2ConfigProperties(t *testing.T) {
+	tests := []struct {
+		props Properties
+		err   error
+	}{
+		{Properties{LC: 3, LP: 1, PB: 4}, nil},
+		{Properties{LC: -1, LP: 0, PB: 2}, ErrLCOutOfRange},
+		{Properties{LC: 9, LP: 0, PB: 2}, ErrLCOutOfRange},
+		{Properties{LC: 0, LP: 5, PB: 2}, ErrLPOutOfRange},
+		{Properties{LC: 0, LP: 0, PB: 5}, ErrPBOutOfRange},
+		{Properties{LC: 3, LP: 2, PB: 2}, ErrLCLPTooLarge},
+	}
+	for _, tc := range tests {
+		props := tc.props
+		c := Writer2Config{Properties: &props}
+		if err := c.Verify(); err != tc.err {
+			t.Errorf("%v: Verify returned %v; want %v", &props,
+				err, tc.err)
+		}
+	}
+}
+
+// readLZMA2 decompresses the LZMA2 chunk sequence in data.
+func readLZMA2(data []byte) (out []byte, err error) {
+	r, err := NewReader2(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	_, err = io.Copy(&buf, r)
+	return buf.Bytes(), err
+}
+
+func TestReader2Termination(t *testing.T) {
+	txt := strings.Repeat("The quick brown fox jumps over the lazy dog.",
+		20)
+
+	// chunk with an unused byte of compressed data
+	var buf bytes.Buffer
+	w, err := NewWriter2(&buf)
+	if err != nil {
+		t.Fatalf("NewWriter2 error %s", err)
+	}
+	if _, err = io.WriteString(w, txt); err != nil {
+		t.Fatalf("WriteString error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("w.Close error %s", err)
+	}
+	data := buf.Bytes()
+	if _, err = readLZMA2(data); err != nil {
+		t.Fatalf("readLZMA2 error %s", err)
+	}
+	hp, err := readChunkHeader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("readChunkHeader error %s", err)
+	}
+	h := *hp
+	if uncompressed(h.ctype) {
+		t.Fatalf("chunk type %s; want compressed chunk", h.ctype)
+	}
+	hlen := headerLen(h.ctype)
+	end := hlen + int(h.compressed) + 1
+	h.compressed++
+	p, err := h.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary error %s", err)
+	}
+	p = append(p, data[hlen:end]...)
+	p = append(p, 0)
+	p = append(p, data[end:]...)
+	if _, err = readLZMA2(p); err != errChunkData {
+		t.Fatalf("unused chunk data: got error %v; want %v", err,
+			errChunkData)
+	}
+
+	// chunk terminated by an end-of-stream marker
+	buf.Reset()
+	lw, err := WriterConfig{EOSMarker: true}.NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	if _, err = io.WriteString(lw, txt); err != nil {
+		t.Fatalf("WriteString error %s", err)
+	}
+	if err = lw.Close(); err != nil {
+		t.Fatalf("lw.Close error %s", err)
+	}
+	lzma := buf.Bytes()[HeaderLen:]
+	tests := []struct {
+		size int
+		err  error
+	}{
+		{len(txt), errRangeDecoder},
+		{len(txt) + 1, errEOSMarker},
+	}
+	for _, tc := range tests {
+		h = chunkHeader{
+			ctype:        cLRND,
+			uncompressed: uint32(tc.size - 1),
+			compressed:   uint16(len(lzma) - 1),
+			props:        Properties{LC: 3, LP: 0, PB: 2},
+		}
+		p, err = h.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary error %s", err)
+		}
+		p = append(p, lzma...)
+		p = append(p, 0)
+		if _, err = readLZMA2(p); err != tc.err {
+			t.Fatalf("EOS marker with chunk size %d: got error %v; "+
+				"want %v", tc.size, err, tc.err)
+		}
+	}
+}
+
+func TestWriter2Reset(t *testing.T) {
+	texts := []string{
+		strings.Repeat("The quick brown fox jumps over the lazy dog.", 50),
+		strings.Repeat("Hello\nWorld!\n", 40),
+	}
+	for _, m := range []MatchAlgorithm{HashTable4, BinaryTree} {
+		cfg := Writer2Config{DictCap: 4096, Matcher: m}
+		var w *Writer2
+		var r *Reader2
+		for i, txt := range texts {
+			var want bytes.Buffer
+			fw, err := cfg.NewWriter2(&want)
+			if err != nil {
+				t.Fatalf("NewWriter2 error %s", err)
+			}
+			if _, err = io.WriteString(fw, txt); err != nil {
+				t.Fatalf("WriteString error %s", err)
+			}
+			if err = fw.Close(); err != nil {
+				t.Fatalf("Close error %s", err)
+			}
+
+			var buf bytes.Buffer
+			if w == nil {
+				if w, err = cfg.NewWriter2(&buf); err != nil {
+					t.Fatalf("NewWriter2 error %s", err)
+				}
+			} else if err = w.Reset(&buf); err != nil {
+				t.Fatalf("Reset error %s", err)
+			}
+			if _, err = io.WriteString(w, txt); err != nil {
+				t.Fatalf("WriteString error %s", err)
+			}
+			if err = w.Close(); err != nil {
+				t.Fatalf("Close error %s", err)
+			}
+			if !bytes.Equal(buf.Bytes(), want.Bytes()) {
+				t.Fatalf("%s, text %d: output after Reset "+
+					"differs from new writer", m, i)
+			}
+
+			if r == nil {
+				r, err = Reader2Config{DictCap: 4096}.NewReader2(
+					&buf)
+				if err != nil {
+					t.Fatalf("NewReader2 error %s", err)
+				}
+			} else {
+				r.Reset(&buf)
+			}
+			out, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("ReadAll error %s", err)
+			}
+			if string(out) != txt {
+				t.Fatalf("%s, text %d: got %q; want %q", m, i,
+					out, txt)
+			}
+		}
+	}
+}
+
+func TestWriter2Depth(t *testing.T) {
+	var txt bytes.Buffer
+	io.CopyN(&txt, randtxt.NewReader(rand.NewSource(42)), 200000)
+	sizes := make(map[int]int)
+	for _, depth := range []int{0, 4, 256} {
+		cfg := Writer2Config{Depth: depth}
+		var buf bytes.Buffer
+		w, err := cfg.NewWriter2(&buf)
+		if err != nil {
+			t.Fatalf("NewWriter2 error %s", err)
+		}
+		if _, err = w.Write(txt.Bytes()); err != nil {
+			t.Fatalf("Write error %s", err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("Close error %s", err)
+		}
+		sizes[depth] = buf.Len()
+		r, err := Reader2Config{DictCap: cfg.DictCap}.NewReader2(&buf)
+		if err != nil {
+			t.Fatalf("NewReader2 error %s", err)
+		}
+		out, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("ReadAll error %s", err)
+		}
+		if !bytes.Equal(out, txt.Bytes()) {
+			t.Fatalf("depth %d: decompressed text differs", depth)
+		}
+	}
+	if !(sizes[256] < sizes[0] && sizes[0] < sizes[4]) {
+		t.Fatalf("compressed sizes %v don't decrease with depth",
+			sizes)
+	}
+	for _, depth := range []int{-1, MaxDepth + 1} {
+		cfg := Writer2Config{Depth: depth}
+		if err := cfg.Verify(); err == nil {
+			t.Fatalf("Verify accepted depth %d", depth)
+		}
+	}
+}
@@ -2,6 +2,9 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
 package lzma
 
 import (
@@ -120,8 +123,8 @@ func TestWriter_Size(t *testing.T) {
 		}
 		q[0]++
 	}
-	if err := w.Close(); err != errSize {
-		t.Fatalf("expected errSize, but got %v", err)
+	if err := w.Close(); err != ErrUncompressedSize {
+		t.Fatalf("expected ErrUncompressedSize, but got %v", err)
 	}
 	n, err := w.Write(q)
 	if err != nil {
@@ -0,0 +1,58 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package lzma86
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	txt := readFile(t, "testdata/code.bin")
+	for _, cfg := range []WriterConfig{
+		{},
+		{X86: true},
+		{X86: true, Size: int64(len(txt))},
+	} {
+		var buf bytes.Buffer
+		w, err := cfg.NewWriter(&buf)
+		if err != nil {
+			t.Fatalf("NewWriter error %s", err)
+		}
+		// odd write sizes test the buffering of the filter
+		for p := txt; len(p) > 0; {
+			k := 999
+			if k > len(p) {
+				k = len(p)
+			}
+			if _, err = w.Write(p[:k]); err != nil {
+				t.Fatalf("Write error %s", err)
+			}
+			p = p[k:]
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("Close error %s", err)
+		}
+		data := buf.Bytes()
+		if cfg.X86 != (data[0] == 1) {
+			t.Fatalf("X86 %t: filter byte %d", cfg.X86, data[0])
+		}
+		r, err := NewReader(&buf)
+		if err != nil {
+			t.Fatalf("NewReader error %s", err)
+		}
+		out, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("ReadAll error %s", err)
+		}
+		if !bytes.Equal(out, txt) {
+			t.Fatalf("%+v: decompressed data differs", cfg)
+		}
+	}
+}
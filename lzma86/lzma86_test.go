@@ -0,0 +1,49 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lzma86
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func readFile(t *testing.T, name string) []byte {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatalf("ReadFile error %s", err)
+	}
+	return data
+}
+
+func TestReader(t *testing.T) {
+	want := readFile(t, "testdata/code.bin")
+	data := readFile(t, "testdata/code.lzma86")
+	if !ValidHeader(data) {
+		t.Fatal("ValidHeader returned false")
+	}
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll error %s", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatal("decompressed data differs")
+	}
+}
+
+func TestReaderFilter(t *testing.T) {
+	data := readFile(t, "testdata/code.lzma86")
+	data[0] = 2
+	if ValidHeader(data) {
+		t.Fatal("ValidHeader accepted filter byte 2")
+	}
+	if _, err := NewReader(bytes.NewReader(data)); err == nil {
+		t.Fatal("NewReader accepted filter byte 2")
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package lzma86 supports the lzma86 format of the LZMA SDK. It is used
+// by some installers and firmware images. The format adds a single
+// byte in front of the classic LZMA format (LZMA_Alone) that indicates
+// whether the x86 BCJ filter has been applied to the data before
+// compression. The filter converts the relative addresses of the x86
+// CALL and JMP instructions into absolute addresses, which improves the
+// compression of executables.
+package lzma86
+
+import (
+	"errors"
+	"io"
+
+	"github.com/ulikunitz/xz/internal/bcj"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// Values of the filter byte.
+const (
+	filterNone = 0
+	filterX86  = 1
+)
+
+// HeaderLen is the length of the lzma86 header.
+const HeaderLen = 1 + lzma.HeaderLen
+
+// ValidHeader checks whether data is a correct lzma86 header. The data
+// must contain at least HeaderLen bytes.
+func ValidHeader(data []byte) bool {
+	if len(data) < HeaderLen || data[0] > filterX86 {
+		return false
+	}
+	return lzma.ValidHeader(data[1:HeaderLen])
+}
+
+// ReaderConfig defines the parameters for the lzma86 reader.
+// DictCapLimit limits the dictionary capacity the stream may require;
+// the value zero means that there is no limit.
+type ReaderConfig struct {
+	DictCapLimit int
+}
+
+// Verify checks the reader parameters for validity.
+func (c *ReaderConfig) Verify() error {
+	if c == nil {
+		return errors.New("lzma86: reader parameters are nil")
+	}
+	if c.DictCapLimit < 0 {
+		return errors.New(
+			"lzma86: dictionary capacity limit is negative")
+	}
+	return nil
+}
+
+// Reader decompresses an lzma86 stream.
+type Reader struct {
+	lr *lzma.Reader
+	// x is nil if the x86 filter is not used
+	x *bcj.X86
+	// data is the buffer for the x86 filter
+	data []byte
+	// buf contains the decompressed data not returned yet
+	buf []byte
+	// conv is the number of converted bytes at the start of buf
+	conv int
+	err  error
+}
+
+// NewReader creates a new lzma86 reader using the default parameters.
+// The function reads and checks the header.
+func NewReader(lz io.Reader) (r *Reader, err error) {
+	return ReaderConfig{}.NewReader(lz)
+}
+
+// NewReader creates a new lzma86 reader. The function reads and checks
+// the header.
+func (c ReaderConfig) NewReader(lz io.Reader) (r *Reader, err error) {
+	if err = c.Verify(); err != nil {
+		return nil, err
+	}
+	p := make([]byte, 1)
+	if _, err = io.ReadFull(lz, p); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	r = &Reader{}
+	switch p[0] {
+	case filterNone:
+	case filterX86:
+		r.x = bcj.NewX86(false, 0)
+		r.data = make([]byte, bufSize)
+	default:
+		return nil, errors.New("lzma86: unsupported filter")
+	}
+	lc := lzma.ReaderConfig{DictCapLimit: c.DictCapLimit}
+	if r.lr, err = lc.NewReader(lz); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// bufSize is the size of the buffer used for the x86 filter.
+const bufSize = 1 << 16
+
+// Read reads uncompressed data.
+func (r *Reader) Read(p []byte) (n int, err error) {
+	if r.x == nil {
+		return r.lr.Read(p)
+	}
+	for {
+		if r.conv > 0 {
+			n = copy(p, r.buf[:r.conv])
+			r.buf = r.buf[n:]
+			r.conv -= n
+			return n, nil
+		}
+		if r.err != nil {
+			// the last bytes are not converted
+			if r.err == io.EOF && len(r.buf) > 0 {
+				n = copy(p, r.buf)
+				r.buf = r.buf[n:]
+				return n, nil
+			}
+			return 0, r.err
+		}
+		k := copy(r.data, r.buf)
+		m, err := r.lr.Read(r.data[k:])
+		r.buf = r.data[:k+m]
+		r.err = err
+		r.conv = r.x.Convert(r.buf)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package lzma86
+
+import (
+	"io"
+
+	"github.com/ulikunitz/xz/internal/bcj"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// Writer compresses data into an lzma86 stream.
+type Writer struct {
+	lw *lzma.Writer
+	// x is nil if the x86 filter is not used
+	x *bcj.X86
+	// buf contains the data that hasn't been converted yet
+	buf []byte
+}
+
+// NewWriter creates a new lzma86 writer using the default parameters.
+// The header is written immediately.
+func NewWriter(lz io.Writer) (w *Writer, err error) {
+	return WriterConfig{}.NewWriter(lz)
+}
+
+// NewWriter creates a new lzma86 writer. The header is written
+// immediately.
+func (c WriterConfig) NewWriter(lz io.Writer) (w *Writer, err error) {
+	if err = c.Verify(); err != nil {
+		return nil, err
+	}
+	w = &Writer{}
+	filter := byte(filterNone)
+	if c.X86 {
+		filter = filterX86
+		w.x = bcj.NewX86(true, 0)
+	}
+	if _, err = lz.Write([]byte{filter}); err != nil {
+		return nil, err
+	}
+	if w.lw, err = c.lzmaConfig().NewWriter(lz); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write compresses the data.
+func (w *Writer) Write(p []byte) (n int, err error) {
+	if w.x == nil {
+		return w.lw.Write(p)
+	}
+	for len(p) > 0 {
+		k := bufSize - len(w.buf)
+		if k > len(p) {
+			k = len(p)
+		}
+		w.buf = append(w.buf, p[:k]...)
+		p = p[k:]
+		m := w.x.Convert(w.buf)
+		if _, err = w.lw.Write(w.buf[:m]); err != nil {
+			return n, err
+		}
+		n += k
+		w.buf = append(w.buf[:0], w.buf[m:]...)
+	}
+	return n, nil
+}
+
+// Close writes the remaining data and finishes the LZMA stream. It
+// doesn't close the underlying writer.
+func (w *Writer) Close() error {
+	if len(w.buf) > 0 {
+		// the last bytes are not converted
+		if _, err := w.lw.Write(w.buf); err != nil {
+			return err
+		}
+		w.buf = nil
+	}
+	return w.lw.Close()
+}
@@ -0,0 +1,55 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lzma86
+
+import (
+	"errors"
+
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// WriterConfig defines the parameters for the lzma86 writer. X86
+// requests the x86 BCJ filter. The other parameters are those of the
+// classic LZMA writer. Note that the functions of the LZMA SDK require
+// a size in the header; it is written if SizeInHeader is set or Size is
+// positive.
+type WriterConfig struct {
+	Properties   *lzma.Properties
+	DictCap      int
+	BufSize      int
+	Matcher      lzma.MatchAlgorithm
+	SizeInHeader bool
+	Size         int64
+	X86          bool
+}
+
+// lzmaConfig returns the configuration of the LZMA writer.
+func (c *WriterConfig) lzmaConfig() lzma.WriterConfig {
+	return lzma.WriterConfig{
+		Properties:   c.Properties,
+		DictCap:      c.DictCap,
+		BufSize:      c.BufSize,
+		Matcher:      c.Matcher,
+		SizeInHeader: c.SizeInHeader,
+		Size:         c.Size,
+	}
+}
+
+// Verify checks the writer parameters for validity. Zero values will
+// be replaced by default values.
+func (c *WriterConfig) Verify() error {
+	if c == nil {
+		return errors.New("lzma86: writer parameters are nil")
+	}
+	lc := c.lzmaConfig()
+	if err := lc.Verify(); err != nil {
+		return err
+	}
+	c.Properties = lc.Properties
+	c.DictCap = lc.DictCap
+	c.BufSize = lc.BufSize
+	c.SizeInHeader = lc.SizeInHeader
+	return nil
+}
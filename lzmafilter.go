@@ -63,19 +63,10 @@ func (f *lzmaFilter) UnmarshalBinary(data []byte) error {
 func (f lzmaFilter) reader(r io.Reader, c *ReaderConfig) (fr io.Reader,
 	err error) {
 
-	config := new(lzma.Reader2Config)
-	if c != nil {
-		config.DictCap = c.DictCap
-	}
-	dc := int(f.dictCap)
-	if dc < 1 {
-		return nil, errors.New("xz: LZMA2 filter parameter " +
-			"dictionary capacity overflow")
-	}
-	if dc > config.DictCap {
-		config.DictCap = dc
+	config, err := f.reader2Config(c)
+	if err != nil {
+		return nil, err
 	}
-
 	fr, err = config.NewReader2(r)
 	if err != nil {
 		return nil, err
@@ -83,33 +74,59 @@ func (f lzmaFilter) reader(r io.Reader, c *ReaderConfig) (fr io.Reader,
 	return fr, nil
 }
 
-// writeCloser creates a io.WriteCloser for the LZMA2 filter.
-func (f lzmaFilter) writeCloser(w io.WriteCloser, c *WriterConfig,
-) (fw io.WriteCloser, err error) {
-	config := new(lzma.Writer2Config)
+// reader2Config returns the configuration of the LZMA2 reader for the
+// filter.
+func (f lzmaFilter) reader2Config(c *ReaderConfig) (config lzma.Reader2Config,
+	err error) {
+
 	if c != nil {
-		*config = lzma.Writer2Config{
-			Properties: c.Properties,
-			DictCap:    c.DictCap,
-			BufSize:    c.BufSize,
-			Matcher:    c.Matcher,
+		config.DictCap = c.DictCap
+		config.Logger = c.Logger
+		if c.debug != nil {
+			config.Logger = c.debug.chunks()
 		}
 	}
-
-	dc := int(f.dictCap)
-	if dc < 1 {
-		return nil, errors.New("xz: LZMA2 filter parameter " +
-			"dictionary capacity overflow")
+	if c != nil && c.DictCapLimit > 0 &&
+		f.dictCap > int64(c.DictCapLimit) {
+		return config, &lzma.DictCapLimitError{
+			DictCap: f.dictCap,
+			Limit:   int64(c.DictCapLimit),
+		}
+	}
+	if f.dictCap > maxInt {
+		return config, errorf(ErrUnsupported, "xz: LZMA2 filter "+
+			"parameter dictionary capacity overflow")
 	}
+	dc := int(f.dictCap)
 	if dc > config.DictCap {
 		config.DictCap = dc
 	}
+	return config, nil
+}
 
-	fw, err = config.NewWriter2(w)
-	if err != nil {
+// decoderCache keeps the LZMA2 reader of the last block, so that the
+// dictionary buffer can be reused for the next block instead of being
+// allocated again. The reader is only reused for the same dictionary
+// capacity; it keeps its Logger.
+type decoderCache struct {
+	r       *lzma.Reader2
+	dictCap int
+}
+
+// reader returns an LZMA2 reader for the configuration reading from
+// lzma2. The cached reader is reset if it has been created for the same
+// dictionary capacity; otherwise a new reader replaces it.
+func (d *decoderCache) reader(c lzma.Reader2Config, lzma2 io.Reader,
+) (r *lzma.Reader2, err error) {
+	if d.r != nil && d.dictCap == c.DictCap {
+		d.r.Reset(lzma2)
+		return d.r, nil
+	}
+	if r, err = c.NewReader2(lzma2); err != nil {
 		return nil, err
 	}
-	return fw, nil
+	d.r, d.dictCap = r, c.DictCap
+	return r, nil
 }
 
 // last returns true, because an LZMA2 filter must be the last filter in
@@ -0,0 +1,102 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"io"
+
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// EstimateMemoryUsage estimates the maximum memory in bytes allocated by
+// a writer created with the configuration. It allows schedulers to
+// admit or reject jobs based on the available memory. In parallel mode
+// every worker requires an encoder and keeps the uncompressed and the
+// compressed data of its block. The estimate is computed for the Go
+// implementation; see the EstimateMemoryUsage methods of the lzma
+// package.
+func (c WriterConfig) EstimateMemoryUsage() (int64, error) {
+	if err := c.Verify(); err != nil {
+		return 0, err
+	}
+	lc := lzma.Writer2Config{
+		Properties: c.Properties,
+		DictCap:    c.DictCap,
+		BufSize:    c.BufSize,
+		Matcher:    c.Matcher,
+		Depth:      c.Depth,
+	}
+	n, err := lc.EstimateMemoryUsage()
+	if err != nil {
+		return 0, err
+	}
+	if c.Workers <= 1 && c.PartSize == 0 {
+		return n, nil
+	}
+	workers := int64(c.Workers)
+	if workers < 1 {
+		workers = 1
+	}
+	// the data of the next block is collected while the workers
+	// compress theirs
+	return workers*(n+2*c.BlockSize) + c.BlockSize, nil
+}
+
+// EstimateMemoryUsage estimates the maximum memory in bytes allocated by
+// a reader created with the configuration for blocks with an LZMA2
+// dictionary capacity of dictCap bytes. A *lzma.DictCapLimitError is
+// returned if dictCap exceeds DictCapLimit. The reader grows the
+// dictionary with the decompressed data, so short blocks require less
+// memory than estimated.
+func (c ReaderConfig) EstimateMemoryUsage(dictCap int64) (int64, error) {
+	if err := c.Verify(); err != nil {
+		return 0, err
+	}
+	if c.DictCapLimit > 0 && dictCap > int64(c.DictCapLimit) {
+		return 0, &lzma.DictCapLimitError{
+			DictCap: dictCap,
+			Limit:   int64(c.DictCapLimit),
+		}
+	}
+	if dictCap > maxInt {
+		return 0, errorf(ErrUnsupported, "xz: dictionary capacity "+
+			"%d exceeds the address space", dictCap)
+	}
+	lc := lzma.Reader2Config{DictCap: c.DictCap}
+	if dictCap > int64(lc.DictCap) {
+		lc.DictCap = int(dictCap)
+	}
+	return lc.EstimateMemoryUsage()
+}
+
+// EstimateFileMemoryUsage estimates the memory required to decompress
+// the xz file of the given size with a reader created with the
+// configuration. Only the stream footers, indexes, stream headers and
+// block headers are read to find the largest dictionary capacity of the
+// blocks.
+func (c ReaderConfig) EstimateFileMemoryUsage(xz io.ReaderAt, size int64,
+) (int64, error) {
+	streams, err := ReadStreamInfo(xz, size)
+	if err != nil {
+		return 0, err
+	}
+	var dictCap int64
+	for i := range streams {
+		for j := range streams[i].Blocks {
+			bh, _, err := readBlockHeaderAt(xz,
+				&streams[i].Blocks[j])
+			if err != nil {
+				return 0, err
+			}
+			for _, f := range bh.filters {
+				lf, ok := f.(*lzmaFilter)
+				if ok && lf.dictCap > dictCap {
+					dictCap = lf.dictCap
+				}
+			}
+		}
+	}
+	return c.EstimateMemoryUsage(dictCap)
+}
@@ -0,0 +1,65 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"bytes"
+	"errors"
+	"hash/crc32"
+	"io/ioutil"
+	"testing"
+)
+
+func TestWriterEstimateMemoryUsage(t *testing.T) {
+	seq, err := WriterConfig{DictCap: 1 << 20}.EstimateMemoryUsage()
+	if err != nil {
+		t.Fatalf("EstimateMemoryUsage error %s", err)
+	}
+	if seq < 1<<20 {
+		t.Fatalf("estimate %d less than dictionary capacity", seq)
+	}
+	c := WriterConfig{DictCap: 1 << 20, Workers: 4, BlockSize: 1 << 21}
+	par, err := c.EstimateMemoryUsage()
+	if err != nil {
+		t.Fatalf("EstimateMemoryUsage error %s", err)
+	}
+	if want := 4*(seq+2<<21) + 1<<21; par != want {
+		t.Fatalf("parallel estimate %d; want %d", par, want)
+	}
+	if _, err = (WriterConfig{Workers: -1}).EstimateMemoryUsage(); err == nil {
+		t.Fatalf("EstimateMemoryUsage accepted invalid configuration")
+	}
+}
+
+func TestReaderEstimateMemoryUsage(t *testing.T) {
+	data, err := ioutil.ReadFile("fox.xz")
+	if err != nil {
+		t.Fatalf("ReadFile error %s", err)
+	}
+	c := ReaderConfig{DictCap: 1 << 16}
+	n, err := c.EstimateFileMemoryUsage(bytes.NewReader(data),
+		int64(len(data)))
+	if err != nil {
+		t.Fatalf("EstimateFileMemoryUsage error %s", err)
+	}
+	// the LZMA2 filter of fox.xz has a dictionary capacity of 8 MiB
+	m, err := c.EstimateMemoryUsage(8 << 20)
+	if err != nil {
+		t.Fatalf("EstimateMemoryUsage error %s", err)
+	}
+	if n != m || n < 8<<20 {
+		t.Fatalf("EstimateFileMemoryUsage returned %d; want %d", n, m)
+	}
+
+	// dictionary capacity 3 GiB in the LZMA2 filter
+	data[16] = 39
+	putUint32LE(data[20:], crc32.ChecksumIEEE(data[12:20]))
+	_, err = c.EstimateFileMemoryUsage(bytes.NewReader(data),
+		int64(len(data)))
+	if !errors.Is(err, ErrDictTooLarge) {
+		t.Fatalf("EstimateFileMemoryUsage returned error %v; "+
+			"want ErrDictTooLarge", err)
+	}
+}
@@ -0,0 +1,12 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build xz_noencoder
+// +build xz_noencoder
+
+package xz
+
+// filterWriter is empty because decoder-only builds don't write
+// filters.
+type filterWriter interface{}
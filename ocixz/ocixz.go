@@ -0,0 +1,120 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package ocixz converts the layers of OCI and Docker images between
+// the gzip and the xz compression. The tar stream of a layer is copied
+// unchanged, so the DiffID of the layer, the digest of the uncompressed
+// tar stream, stays the same. The functions compute the DiffID and the
+// digest and size of the new compressed layer, which are required for
+// the image manifest and configuration. GzipToXZ requires the encoder,
+// so it is not available with the xz_noencoder build tag.
+package ocixz
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+
+	"github.com/ulikunitz/xz"
+)
+
+// Media types of compressed layers.
+const (
+	MediaTypeGzip       = "application/vnd.oci.image.layer.v1.tar+gzip"
+	MediaTypeXZ         = "application/vnd.oci.image.layer.v1.tar+xz"
+	DockerMediaTypeGzip = "application/vnd.docker.image.rootfs.diff.tar.gzip"
+)
+
+// Layer describes a converted layer.
+type Layer struct {
+	// MediaType of the compressed layer.
+	MediaType string
+	// Digest of the compressed layer in the form sha256:<hex>.
+	Digest string
+	// Size of the compressed layer.
+	Size int64
+	// DiffID is the digest of the uncompressed tar stream.
+	DiffID string
+}
+
+// Config defines the parameters of the conversion. WriterConfig and
+// ReaderConfig are used for the xz compression and decompression.
+// GzipLevel is the compression level of gzip; the zero value selects
+// gzip.DefaultCompression.
+type Config struct {
+	WriterConfig xz.WriterConfig
+	ReaderConfig xz.ReaderConfig
+	GzipLevel    int
+}
+
+// digest returns the digest string for the hash.
+func digest(h hash.Hash) string {
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// countingWriter counts the bytes written.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+// Write writes the data to the underlying writer.
+func (w *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// compress compresses the tar stream using the writer returned by
+// newWriter.
+func compress(dst io.Writer, tar io.Reader, mediaType string,
+	newWriter func(w io.Writer) (io.WriteCloser, error)) (*Layer, error) {
+
+	dh := sha256.New()
+	cw := &countingWriter{w: io.MultiWriter(dst, dh)}
+	w, err := newWriter(cw)
+	if err != nil {
+		return nil, err
+	}
+	diff := sha256.New()
+	if _, err = io.Copy(io.MultiWriter(w, diff), tar); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return &Layer{
+		MediaType: mediaType,
+		Digest:    digest(dh),
+		Size:      cw.n,
+		DiffID:    digest(diff),
+	}, nil
+}
+
+// XZToGzip converts an xz-compressed layer using the default
+// configuration.
+func XZToGzip(dst io.Writer, src io.Reader) (*Layer, error) {
+	return Config{}.XZToGzip(dst, src)
+}
+
+// XZToGzip reads the xz-compressed layer from src and writes the
+// gzip-compressed layer to dst. The media type of the returned layer
+// is the OCI type; the Docker type DockerMediaTypeGzip can be used
+// instead.
+func (c Config) XZToGzip(dst io.Writer, src io.Reader) (*Layer, error) {
+	level := c.GzipLevel
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	xr, err := c.ReaderConfig.NewReader(src)
+	if err != nil {
+		return nil, err
+	}
+	return compress(dst, xr, MediaTypeGzip,
+		func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriterLevel(w, level)
+		})
+}
@@ -0,0 +1,110 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package ocixz
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"testing"
+
+	"github.com/ulikunitz/xz"
+)
+
+func sha256Digest(data []byte) string {
+	h := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(h[:])
+}
+
+func newTar(t *testing.T) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	files := []struct{ name, body string }{
+		{"etc/hostname", "layer\n"},
+		{"usr/share/doc/fox.txt",
+			"The quick brown fox jumps over the lazy dog.\n"},
+	}
+	for _, f := range files {
+		hdr := &tar.Header{Name: f.name, Mode: 0644,
+			Size: int64(len(f.body))}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("WriteHeader error %s", err)
+		}
+		if _, err := tw.Write([]byte(f.body)); err != nil {
+			t.Fatalf("Write error %s", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Close error %s", err)
+	}
+	return buf.Bytes()
+}
+
+func TestConversion(t *testing.T) {
+	tarData := newTar(t)
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(tarData)
+	if err := zw.Close(); err != nil {
+		t.Fatalf("gzip Close error %s", err)
+	}
+
+	var xzBuf bytes.Buffer
+	l, err := GzipToXZ(&xzBuf, &gz)
+	if err != nil {
+		t.Fatalf("GzipToXZ error %s", err)
+	}
+	if l.MediaType != MediaTypeXZ {
+		t.Errorf("media type %q; want %q", l.MediaType, MediaTypeXZ)
+	}
+	if l.DiffID != sha256Digest(tarData) {
+		t.Errorf("DiffID %s; want %s", l.DiffID, sha256Digest(tarData))
+	}
+	if l.Digest != sha256Digest(xzBuf.Bytes()) {
+		t.Errorf("Digest %s doesn't match output", l.Digest)
+	}
+	if l.Size != int64(xzBuf.Len()) {
+		t.Errorf("Size %d; want %d", l.Size, xzBuf.Len())
+	}
+	r, err := xz.NewReader(bytes.NewReader(xzBuf.Bytes()))
+	if err != nil {
+		t.Fatalf("xz.NewReader error %s", err)
+	}
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll error %s", err)
+	}
+	if !bytes.Equal(out, tarData) {
+		t.Fatal("tar stream changed")
+	}
+
+	var gz2 bytes.Buffer
+	l2, err := XZToGzip(&gz2, &xzBuf)
+	if err != nil {
+		t.Fatalf("XZToGzip error %s", err)
+	}
+	if l2.DiffID != l.DiffID {
+		t.Errorf("DiffID changed to %s", l2.DiffID)
+	}
+	if l2.Digest != sha256Digest(gz2.Bytes()) {
+		t.Errorf("Digest %s doesn't match output", l2.Digest)
+	}
+	zr, err := gzip.NewReader(&gz2)
+	if err != nil {
+		t.Fatalf("gzip.NewReader error %s", err)
+	}
+	if out, err = ioutil.ReadAll(zr); err != nil {
+		t.Fatalf("ReadAll error %s", err)
+	}
+	if !bytes.Equal(out, tarData) {
+		t.Fatal("tar stream changed")
+	}
+}
@@ -0,0 +1,36 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package ocixz
+
+import (
+	"compress/gzip"
+	"io"
+)
+
+// GzipToXZ converts a gzip-compressed layer using the default
+// configuration.
+func GzipToXZ(dst io.Writer, src io.Reader) (*Layer, error) {
+	return Config{}.GzipToXZ(dst, src)
+}
+
+// GzipToXZ reads the gzip-compressed layer from src and writes the
+// xz-compressed layer to dst.
+func (c Config) GzipToXZ(dst io.Writer, src io.Reader) (*Layer, error) {
+	if err := c.WriterConfig.Verify(); err != nil {
+		return nil, err
+	}
+	zr, err := gzip.NewReader(src)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return compress(dst, zr, MediaTypeXZ,
+		func(w io.Writer) (io.WriteCloser, error) {
+			return c.WriterConfig.NewWriter(w)
+		})
+}
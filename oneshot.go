@@ -0,0 +1,114 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+)
+
+// ErrLimit indicates that the uncompressed data exceeds the limit given
+// to Decompress.
+var ErrLimit = errors.New("xz: uncompressed data exceeds limit")
+
+// Decompress appends the uncompressed data of the xz file src to dst
+// and returns the extended slice. As for Compress the capacity of dst is
+// reused. Decompress returns ErrLimit if the uncompressed data exceeds
+// limit bytes; a limit of zero or less removes the limit. The
+// uncompressed data is only appended if no error occurred.
+func Decompress(dst, src []byte, limit int64) ([]byte, error) {
+	r, err := NewReader(bytes.NewReader(src))
+	if err != nil {
+		return dst, err
+	}
+	var lr io.Reader = r
+	if 0 < limit && limit < maxInt64 {
+		// an additional byte detects data exceeding the limit
+		lr = io.LimitReader(r, limit+1)
+	}
+	buf := bytes.NewBuffer(dst)
+	n, err := buf.ReadFrom(lr)
+	if err != nil {
+		return dst, err
+	}
+	if limit > 0 && n > limit {
+		return dst, ErrLimit
+	}
+	return buf.Bytes(), nil
+}
+
+// decoderState is the pooled state of a Decoder.
+type decoderState struct {
+	r  *Reader
+	br bytes.Reader
+}
+
+// Decoder decompresses complete xz files provided as byte slices. It
+// may be used by multiple goroutines concurrently; every call of
+// DecodeAll uses a reader taken from an internal pool.
+type Decoder struct {
+	c    ReaderConfig
+	pool sync.Pool
+}
+
+// NewDecoder returns a decoder using the default parameters changed by
+// the options.
+func NewDecoder(opts ...Option) (*Decoder, error) {
+	c, err := readerConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	return c.NewDecoder()
+}
+
+// NewDecoder returns a decoder using the configuration.
+func (c ReaderConfig) NewDecoder() (*Decoder, error) {
+	if err := c.Verify(); err != nil {
+		return nil, err
+	}
+	return &Decoder{c: c}, nil
+}
+
+// DecodeAll appends the uncompressed data of the xz file input to dst
+// and returns the extended slice. The uncompressed data is only
+// appended if no error occurred.
+func (d *Decoder) DecodeAll(input, dst []byte) ([]byte, error) {
+	s, _ := d.pool.Get().(*decoderState)
+	if s == nil {
+		s = new(decoderState)
+		addStat(d.c.Stats, StatPoolMisses, 1)
+	} else {
+		addStat(d.c.Stats, StatPoolHits, 1)
+	}
+	defer d.pool.Put(s)
+	s.br.Reset(input)
+	// the reader must not keep a reference to input
+	defer s.br.Reset(nil)
+	var err error
+	if s.r == nil {
+		s.r, err = d.c.NewReader(&s.br)
+	} else {
+		err = s.r.Reset(&s.br)
+	}
+	if err != nil {
+		return dst, err
+	}
+	p := dst
+	for {
+		if len(p) == cap(p) {
+			p = append(p, 0)[:len(p)]
+		}
+		n, err := s.r.Read(p[len(p):cap(p)])
+		p = p[:len(p)+n]
+		if err == io.EOF {
+			return p, nil
+		}
+		if err != nil {
+			return dst, err
+		}
+	}
+}
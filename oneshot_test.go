@@ -0,0 +1,64 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package xz
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCompressDecompress(t *testing.T) {
+	text := []byte(strings.Repeat(
+		"The quick brown fox jumps over the lazy dog.\n", 50))
+	buf := make([]byte, 0, 4096)
+	c, err := Compress(buf, text, WriterConfig{CheckSum: SHA256})
+	if err != nil {
+		t.Fatalf("Compress error %s", err)
+	}
+	if &c[:1][0] != &buf[:1][0] {
+		t.Fatalf("Compress didn't reuse the buffer")
+	}
+	c = append([]byte(nil), c...)
+
+	prefix := []byte("prefix")
+	out := make([]byte, len(prefix), 4096)
+	copy(out, prefix)
+	d, err := Decompress(out, c, 0)
+	if err != nil {
+		t.Fatalf("Decompress error %s", err)
+	}
+	if &d[0] != &out[0] {
+		t.Fatalf("Decompress didn't reuse the buffer")
+	}
+	if !bytes.Equal(d, append(prefix, text...)) {
+		t.Fatalf("Decompress returned wrong data")
+	}
+
+	d, err = Decompress(nil, c, int64(len(text)))
+	if err != nil {
+		t.Fatalf("Decompress with limit %d error %s", len(text), err)
+	}
+	if !bytes.Equal(d, text) {
+		t.Fatalf("Decompress with limit returned wrong data")
+	}
+	d, err = Decompress(prefix, c, int64(len(text)-1))
+	if err != ErrLimit {
+		t.Fatalf("Decompress with limit %d returned error %v; "+
+			"want ErrLimit", len(text)-1, err)
+	}
+	if !bytes.Equal(d, prefix) {
+		t.Fatalf("Decompress changed dst after an error")
+	}
+	if _, err = Decompress(nil, c[:len(c)-1], 0); err == nil {
+		t.Fatalf("Decompress accepted truncated data")
+	}
+	if _, err = Compress(nil, text, WriterConfig{Workers: -1}); err == nil {
+		t.Fatalf("Compress accepted invalid configuration")
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"fmt"
+	"io"
+)
+
+// Option changes a parameter of the reader created by NewReader or of
+// the writer created by NewWriter. Every option sets a field of
+// ReaderConfig or WriterConfig, so new parameters can be added without
+// breaking the users of either form. An option without meaning for the
+// constructor it is passed to is reported as an error.
+type Option struct {
+	name   string
+	reader func(c *ReaderConfig)
+	writer func(c *WriterConfig)
+}
+
+// String returns the name of the option.
+func (o Option) String() string {
+	return o.name
+}
+
+// WithDictSize sets the dictionary capacity DictCap of readers and
+// writers.
+func WithDictSize(n int) Option {
+	return Option{
+		name:   fmt.Sprintf("WithDictSize(%d)", n),
+		reader: func(c *ReaderConfig) { c.DictCap = n },
+		writer: func(c *WriterConfig) { c.DictCap = n },
+	}
+}
+
+// WithDictCapLimit sets the DictCapLimit of readers.
+func WithDictCapLimit(n int) Option {
+	return Option{
+		name:   fmt.Sprintf("WithDictCapLimit(%d)", n),
+		reader: func(c *ReaderConfig) { c.DictCapLimit = n },
+	}
+}
+
+// WithSingleStream sets SingleStream for readers.
+func WithSingleStream() Option {
+	return Option{
+		name:   "WithSingleStream()",
+		reader: func(c *ReaderConfig) { c.SingleStream = true },
+	}
+}
+
+// WithCheck sets the CheckSum of writers: CRC32, CRC64 or SHA256.
+func WithCheck(check byte) Option {
+	return Option{
+		name:   fmt.Sprintf("WithCheck(%#02x)", check),
+		writer: func(c *WriterConfig) { c.CheckSum = check },
+	}
+}
+
+// WithBlockSize sets the BlockSize of writers.
+func WithBlockSize(n int64) Option {
+	return Option{
+		name:   fmt.Sprintf("WithBlockSize(%d)", n),
+		writer: func(c *WriterConfig) { c.BlockSize = n },
+	}
+}
+
+// WithWorkers sets the number of Workers compressing blocks in
+// parallel.
+func WithWorkers(n int) Option {
+	return Option{
+		name:   fmt.Sprintf("WithWorkers(%d)", n),
+		writer: func(c *WriterConfig) { c.Workers = n },
+	}
+}
+
+// WithFlushMode sets the FlushMode of writers.
+func WithFlushMode(m FlushMode) Option {
+	return Option{
+		name:   fmt.Sprintf("WithFlushMode(%s)", m),
+		writer: func(c *WriterConfig) { c.FlushMode = m },
+	}
+}
+
+// WithEmptyBlock sets EmptyBlock for writers.
+func WithEmptyBlock() Option {
+	return Option{
+		name:   "WithEmptyBlock()",
+		writer: func(c *WriterConfig) { c.EmptyBlock = true },
+	}
+}
+
+// WithDecisionTrace sets the DecisionTrace of writers.
+func WithDecisionTrace(w io.Writer) Option {
+	return Option{
+		name:   fmt.Sprintf("WithDecisionTrace(%T)", w),
+		writer: func(c *WriterConfig) { c.DecisionTrace = w },
+	}
+}
+
+// WithReadIndex sets ReadIndex for readers.
+func WithReadIndex() Option {
+	return Option{
+		name:   "WithReadIndex()",
+		reader: func(c *ReaderConfig) { c.ReadIndex = true },
+	}
+}
+
+// WithStats sets the Stats of readers and writers.
+func WithStats(s Stats) Option {
+	return Option{
+		name:   fmt.Sprintf("WithStats(%T)", s),
+		reader: func(c *ReaderConfig) { c.Stats = s },
+		writer: func(c *WriterConfig) { c.Stats = s },
+	}
+}
+
+// WithLogger sets the Logger of readers and writers.
+func WithLogger(l Logger) Option {
+	return Option{
+		name:   fmt.Sprintf("WithLogger(%T)", l),
+		reader: func(c *ReaderConfig) { c.Logger = l },
+		writer: func(c *WriterConfig) { c.Logger = l },
+	}
+}
+
+// WithHooks sets the block lifecycle Hooks of readers and writers.
+func WithHooks(h *Hooks) Option {
+	return Option{
+		name:   "WithHooks()",
+		reader: func(c *ReaderConfig) { c.Hooks = h },
+		writer: func(c *WriterConfig) { c.Hooks = h },
+	}
+}
+
+// WithBlockCallback calls f with the position and the sizes of every
+// block after the writer has written it, so that applications can
+// persist their own seek tables or content indexes. The offsets are
+// relative to the start of the output of the writer. The callback is
+// added to the OnBlockEnd function of the Hooks set by a preceding
+// WithHooks option; a following WithHooks option replaces it. Like the
+// Hooks it is not called by writers using the liblzma backend.
+func WithBlockCallback(f func(b BlockInfo)) Option {
+	return Option{
+		name: "WithBlockCallback()",
+		writer: func(c *WriterConfig) {
+			h := new(Hooks)
+			if c.Hooks != nil {
+				*h = *c.Hooks
+			}
+			end := h.OnBlockEnd
+			h.OnBlockEnd = func(e BlockEvent) {
+				if end != nil {
+					end(e)
+				}
+				f(e.BlockInfo)
+			}
+			c.Hooks = h
+		},
+	}
+}
+
+// readerConfig returns the reader configuration for the options.
+func readerConfig(opts []Option) (c ReaderConfig, err error) {
+	for _, o := range opts {
+		if o.reader == nil {
+			return c, fmt.Errorf(
+				"xz: option %q not supported by NewReader", o)
+		}
+		o.reader(&c)
+	}
+	return c, nil
+}
+
+// writerConfig returns the writer configuration for the options.
+func writerConfig(opts []Option) (c WriterConfig, err error) {
+	for _, o := range opts {
+		if o.writer == nil {
+			return c, fmt.Errorf(
+				"xz: option %q not supported by NewWriter", o)
+		}
+		o.writer(&c)
+	}
+	return c, nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package xz
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestOptions(t *testing.T) {
+	text := strings.Repeat("The quick brown fox jumps over the lazy dog.\n",
+		100)
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, WithCheck(SHA256), WithDictSize(1<<16),
+		WithBlockSize(1000), WithWorkers(2))
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	if _, err = w.Write([]byte(text)); err != nil {
+		t.Fatalf("Write error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("w.Close error %s", err)
+	}
+	data := buf.Bytes()
+
+	streams, err := ReadStreamInfo(bytes.NewReader(data),
+		int64(len(data)))
+	if err != nil {
+		t.Fatalf("ReadStreamInfo error %s", err)
+	}
+	if len(streams) != 1 {
+		t.Fatalf("got %d streams; want 1", len(streams))
+	}
+	s := streams[0]
+	if s.CheckSum != SHA256 {
+		t.Fatalf("check is %#02x; want %#02x", s.CheckSum, SHA256)
+	}
+	if n := (len(text) + 999) / 1000; len(s.Blocks) != n {
+		t.Fatalf("got %d blocks; want %d", len(s.Blocks), n)
+	}
+
+	r, err := NewReader(bytes.NewReader(data), WithDictSize(1<<16),
+		WithDictCapLimit(1<<20), WithSingleStream())
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll error %s", err)
+	}
+	if string(out) != text {
+		t.Fatalf("uncompressed data differs from the original text")
+	}
+	if r.DictCap != 1<<16 || r.DictCapLimit != 1<<20 ||
+		!r.SingleStream {
+		t.Fatalf("options not applied to reader configuration %+v",
+			r.ReaderConfig)
+	}
+}
+
+func TestOptionsErrors(t *testing.T) {
+	if _, err := NewReader(bytes.NewReader(nil),
+		WithCheck(CRC32)); err == nil {
+		t.Fatalf("NewReader accepted writer option")
+	}
+	if _, err := NewWriter(ioutil.Discard,
+		WithDictCapLimit(1<<20)); err == nil {
+		t.Fatalf("NewWriter accepted reader option")
+	}
+	if _, err := NewWriter(ioutil.Discard, WithWorkers(-1)); err == nil {
+		t.Fatalf("NewWriter accepted negative number of workers")
+	}
+}
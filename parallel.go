@@ -0,0 +1,291 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package xz
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash"
+	"sync/atomic"
+	"time"
+)
+
+// blockJob describes the compression of a single block by a go
+// routine. The done channel is closed after the block has been
+// compressed.
+type blockJob struct {
+	data   []byte
+	header []byte
+	body   bytes.Buffer
+	rec    record
+	err    error
+	done   chan struct{}
+	// event and start describe the block for the hooks
+	event BlockEvent
+	start time.Time
+	// enc provides the LZMA2 writer for the block
+	enc *encoderCache
+}
+
+// compressBlock compresses the data of the job into a single block.
+// Since the complete block is known the block header contains the
+// compressed and uncompressed sizes.
+func (c *WriterConfig) compressBlock(job *blockJob, h hash.Hash) {
+	defer close(job.done)
+	bw, err := c.newBlockWriter(&job.body, h, int64(len(job.data)),
+		job.enc)
+	if err != nil {
+		job.err = err
+		return
+	}
+	if _, err = bw.Write(job.data); err != nil {
+		job.err = err
+		return
+	}
+	if err = bw.Close(); err != nil {
+		job.err = err
+		return
+	}
+	var hdr bytes.Buffer
+	if err = bw.writeHeader(&hdr); err != nil {
+		job.err = err
+		return
+	}
+	job.header = hdr.Bytes()
+	job.rec = bw.record()
+	job.data = nil
+}
+
+// parallelWriter collects the uncompressed data for the blocks and
+// compresses the blocks using multiple go routines. The blocks are
+// written in their original order. The writer is also used to write
+// parts of a fixed size, which requires that the blocks are completely
+// compressed before they are written.
+type parallelWriter struct {
+	buf     []byte
+	pending []*blockJob
+	blocks  int
+	err     error
+	// partLen is the number of bytes written to the current part
+	partLen int64
+	// workers is the number of blocks compressed in parallel; it
+	// may be changed by SetConcurrency
+	workers atomic.Int64
+	// free keeps the encoders of the completed blocks for reuse
+	free []*encoderCache
+}
+
+// encoder returns an encoder cache for a new block.
+func (pw *parallelWriter) encoder() *encoderCache {
+	n := len(pw.free)
+	if n == 0 {
+		return new(encoderCache)
+	}
+	enc := pw.free[n-1]
+	pw.free[n-1] = nil
+	pw.free = pw.free[:n-1]
+	return enc
+}
+
+// wait waits for the completion of the job and returns its encoder for
+// reuse.
+func (pw *parallelWriter) wait(job *blockJob) {
+	<-job.done
+	pw.free = append(pw.free, job.enc)
+	job.enc = nil
+}
+
+// discard waits for the pending blocks and discards them. It leaves no
+// go routine running.
+func (pw *parallelWriter) discard() {
+	for i, job := range pw.pending {
+		pw.wait(job)
+		pw.pending[i] = nil
+	}
+	pw.pending = pw.pending[:0]
+	pw.buf = nil
+}
+
+// newParallelWriter creates the parallel writer for the configuration.
+func (c *WriterConfig) newParallelWriter() *parallelWriter {
+	pw := &parallelWriter{partLen: HeaderLen}
+	pw.workers.Store(int64(c.Workers))
+	return pw
+}
+
+// SetConcurrency changes the number of blocks compressed in parallel,
+// so that services can adapt the parallelism to the load without
+// recreating the writer. The change applies to the blocks started next;
+// if the concurrency is reduced, the blocks already started are
+// completed. SetConcurrency may be called concurrently with the other
+// methods of the writer. It returns an error for values smaller than
+// one and for writers that don't compress in parallel, because Workers
+// had been smaller than two and PartSize had not been set, or because
+// the liblzma backend is used. The Workers field of the configuration
+// isn't changed.
+func (w *Writer) SetConcurrency(n int) error {
+	if n < 1 {
+		return fmt.Errorf("xz: concurrency %d is less than one", n)
+	}
+	if w.pw == nil {
+		return errors.New("xz: writer doesn't compress in parallel")
+	}
+	w.pw.workers.Store(int64(n))
+	return nil
+}
+
+// startBlock starts the compression of the buffered data in a new go
+// routine. If the maximum number of workers is busy, the oldest block
+// is written first.
+func (w *Writer) startBlock() error {
+	pw := w.pw
+	workers := int(pw.workers.Load())
+	if workers < 1 {
+		workers = 1
+	}
+	for len(pw.pending) >= workers {
+		if err := w.writeBlock(); err != nil {
+			return err
+		}
+	}
+	job := &blockJob{
+		data: pw.buf,
+		done: make(chan struct{}),
+		enc:  pw.encoder(),
+	}
+	if w.Hooks != nil {
+		job.event = BlockEvent{
+			Stream: -1,
+			Block:  -1,
+			BlockInfo: BlockInfo{
+				Offset:             -1,
+				UncompressedOffset: w.uoff,
+				UnpaddedSize:       -1,
+				UncompressedSize:   int64(len(pw.buf)),
+			},
+		}
+		job.start = w.Hooks.blockStart(&job.event)
+	}
+	w.uoff += int64(len(pw.buf))
+	pw.buf = nil
+	pw.blocks++
+	pw.pending = append(pw.pending, job)
+	go w.WriterConfig.compressBlock(job, w.newHash())
+	return nil
+}
+
+// writeBlock waits for the oldest pending block and writes it to the
+// underlying writer.
+func (w *Writer) writeBlock() error {
+	pw := w.pw
+	job := pw.pending[0]
+	pw.pending[0] = nil
+	pw.pending = pw.pending[1:]
+	pw.wait(job)
+	if job.err != nil {
+		return job.err
+	}
+	if w.PartSize > 0 {
+		if err := w.fitPart(job); err != nil {
+			return err
+		}
+	}
+	job.event.Stream = w.stream
+	job.event.Block = len(w.index)
+	job.event.Offset = w.cxz.n
+	if _, err := w.xz.Write(job.header); err != nil {
+		return err
+	}
+	if _, err := job.body.WriteTo(w.xz); err != nil {
+		return err
+	}
+	logf(w.Logger, "block record %+v", job.rec)
+	w.index = append(w.index, job.rec)
+	addStat(w.Stats, StatBlocks, 1)
+	if w.Hooks != nil {
+		job.event.UnpaddedSize = job.rec.unpaddedSize
+		w.Hooks.blockEnd(&job.event, job.start)
+	}
+	return nil
+}
+
+// writeParallel buffers the data and starts the compression of a block
+// if the block size has been reached.
+func (w *Writer) writeParallel(p []byte) (n int, err error) {
+	pw := w.pw
+	if pw.err != nil {
+		return 0, pw.err
+	}
+	for len(p) > 0 {
+		size := w.blockSize(pw.blocks)
+		if pw.buf == nil {
+			c := size
+			if c > 1<<20 {
+				c = 1 << 20
+			}
+			pw.buf = make([]byte, 0, c)
+		}
+		k := int(size - int64(len(pw.buf)))
+		if k > len(p) {
+			k = len(p)
+		}
+		pw.buf = append(pw.buf, p[:k]...)
+		n += k
+		p = p[k:]
+		if int64(len(pw.buf)) == size {
+			if err = w.startBlock(); err != nil {
+				pw.err = err
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// flushParallel compresses the buffered data into a block and writes
+// all pending blocks.
+func (w *Writer) flushParallel() error {
+	pw := w.pw
+	if pw.err != nil {
+		return pw.err
+	}
+	if len(pw.buf) > 0 {
+		if err := w.startBlock(); err != nil {
+			pw.err = err
+			return err
+		}
+	}
+	for len(pw.pending) > 0 {
+		if err := w.writeBlock(); err != nil {
+			pw.err = err
+			return err
+		}
+	}
+	return nil
+}
+
+// closeParallel compresses the remaining data and writes all pending
+// blocks.
+func (w *Writer) closeParallel() error {
+	pw := w.pw
+	if pw.err != nil {
+		return pw.err
+	}
+	if len(pw.buf) > 0 || (pw.blocks == 0 && w.EmptyBlock) {
+		if err := w.startBlock(); err != nil {
+			return err
+		}
+	}
+	for len(pw.pending) > 0 {
+		if err := w.writeBlock(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package xz
+
+import (
+	"errors"
+	"io/ioutil"
+)
+
+// The writer supports output that is split into parts of a fixed size,
+// which are independently decodable. A part consists of a single xz
+// stream filled up with stream padding. Since the xz index and the
+// stream footer have to be written after the last block of the stream,
+// the writer must know the compressed size of a block before it
+// decides whether the block still fits into the current part. The
+// blocks are therefore compressed in memory by the parallel writer.
+
+// fitPart checks whether the block of the job fits into the current
+// part. If it doesn't, the stream is closed, padded to the part size
+// and a new stream is started.
+func (w *Writer) fitPart(job *blockJob) error {
+	pw := w.pw
+	n := int64(len(job.header) + job.body.Len())
+	index := append(w.index[:len(w.index):len(w.index)], job.rec)
+	k, err := writeIndex(ioutil.Discard, index)
+	if err != nil {
+		return err
+	}
+	if pw.partLen+n+k+footerLen <= w.PartSize {
+		pw.partLen += n
+		return nil
+	}
+	if len(w.index) == 0 {
+		return errors.New("xz: block doesn't fit into part")
+	}
+	if k, err = w.writeFooter(); err != nil {
+		return err
+	}
+	pad := w.PartSize - pw.partLen - k
+	if _, err = w.xz.Write(make([]byte, pad)); err != nil {
+		return err
+	}
+	data, err := w.h.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if _, err = w.xz.Write(data); err != nil {
+		return err
+	}
+	w.index = w.index[:0]
+	pw.partLen = HeaderLen + n
+	return nil
+}
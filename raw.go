@@ -0,0 +1,34 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import "io"
+
+// A raw stream consists only of the data produced by a filter chain
+// without stream header, blocks, index and footer. It is created by
+// the xz tool using the option --format=raw. Since the raw stream
+// doesn't describe its filter chain, the chain must be supplied out of
+// band. The package supports only the LZMA2 filter; its parameters are
+// taken from the reader and writer configurations.
+
+// NewRawReader creates a reader for a raw LZMA2 stream using the
+// default configuration.
+func NewRawReader(raw io.Reader) (r io.Reader, err error) {
+	return ReaderConfig{}.NewRawReader(raw)
+}
+
+// NewRawReader creates a reader for a raw LZMA2 stream. The dictionary
+// capacity DictCap of the configuration must not be smaller than the
+// dictionary capacity used for compression. The reader returns io.EOF
+// after the end marker of the LZMA2 stream; data following it is not
+// read.
+func (c ReaderConfig) NewRawReader(raw io.Reader) (r io.Reader,
+	err error) {
+	if err = c.Verify(); err != nil {
+		return nil, err
+	}
+	f := []filter{&lzmaFilter{int64(c.DictCap)}}
+	return c.newFilterReader(raw, f, nil)
+}
@@ -0,0 +1,55 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package xz
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/ulikunitz/xz/internal/randtxt"
+)
+
+func TestRawRoundTrip(t *testing.T) {
+	const txtlen = 50000
+	var buf bytes.Buffer
+	io.CopyN(&buf, randtxt.NewReader(rand.NewSource(44)), txtlen)
+	txt := buf.String()
+
+	buf.Reset()
+	c := WriterConfig{DictCap: 1 << 16}
+	w, err := c.NewRawWriter(&buf)
+	if err != nil {
+		t.Fatalf("NewRawWriter error %s", err)
+	}
+	if _, err = io.WriteString(w, txt); err != nil {
+		t.Fatalf("WriteString error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("Close error %s", err)
+	}
+	// trailing data must not be read
+	buf.WriteString("trailer")
+
+	r, err := ReaderConfig{DictCap: 1 << 16}.NewRawReader(&buf)
+	if err != nil {
+		t.Fatalf("NewRawReader error %s", err)
+	}
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll error %s", err)
+	}
+	if string(out) != txt {
+		t.Fatalf("raw round trip changed the data")
+	}
+	if buf.String() != "trailer" {
+		t.Fatalf("raw reader consumed %q", "trailer")
+	}
+}
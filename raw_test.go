@@ -0,0 +1,33 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// TestRawReaderXZ decodes a file created by
+// xz --format=raw --lzma2=dict=64KiB.
+func TestRawReaderXZ(t *testing.T) {
+	f, err := os.Open("testdata/fox.raw")
+	if err != nil {
+		t.Fatalf("Open error %s", err)
+	}
+	defer f.Close()
+	r, err := NewRawReader(f)
+	if err != nil {
+		t.Fatalf("NewRawReader error %s", err)
+	}
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll error %s", err)
+	}
+	const want = "The quick brown fox jumps over the lazy dog.\n"
+	if string(out) != want {
+		t.Fatalf("got %q; want %q", out, want)
+	}
+}
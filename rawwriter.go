@@ -0,0 +1,29 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package xz
+
+import "io"
+
+// NewRawWriter creates a writer for a raw LZMA2 stream using the
+// default configuration.
+func NewRawWriter(raw io.Writer) (w io.WriteCloser, err error) {
+	return WriterConfig{}.NewRawWriter(raw)
+}
+
+// NewRawWriter creates a writer for a raw LZMA2 stream. The
+// properties, the dictionary capacity, the buffer size and the matcher
+// of the configuration are used; the other fields are ignored. Close
+// writes the end marker of the LZMA2 stream but doesn't close the
+// underlying writer.
+func (c WriterConfig) NewRawWriter(raw io.Writer) (w io.WriteCloser,
+	err error) {
+	if err = c.Verify(); err != nil {
+		return nil, err
+	}
+	return c.newFilterWriteCloser(raw, c.filters())
+}
@@ -5,6 +5,11 @@
 // Package xz supports the compression and decompression of xz files. It
 // supports version 1.0.4 of the specification without the non-LZMA2
 // filters. See http://tukaani.org/xz/xz-file-format-1.0.4.txt
+//
+// The package has no mutable package-level state. Readers and writers
+// may be used in different goroutines concurrently, but a single reader
+// or writer must not be used by multiple goroutines at the same time.
+// Configurations are copied by the constructors and may be shared.
 package xz
 
 import (
@@ -13,45 +18,257 @@ import (
 	"fmt"
 	"hash"
 	"io"
+	"iter"
+	"time"
 
-	"github.com/ulikunitz/xz/internal/xlog"
 	"github.com/ulikunitz/xz/lzma"
 )
 
 // ReaderConfig defines the parameters for the xz reader. The
 // SingleStream parameter requests the reader to assume that the
-// underlying stream contains only a single stream.
+// underlying stream contains only a single stream. DictCapLimit limits
+// the dictionary capacity that the LZMA2 filter of a block may
+// require. Blocks exceeding it are rejected with an error matching
+// ErrDictTooLarge before the dictionary is allocated. The value zero
+// selects DefaultDictCapLimit, a negative value removes the limit. The
+// Go implementation grows the dictionary with the decompressed data, so
+// a short stream uses little memory even if it declares a large
+// dictionary. On 32-bit platforms dictionaries of 2 GiB or more cannot
+// be addressed and are rejected with an error matching ErrUnsupported.
+// If IgnoreTrailingData is set in addition to SingleStream, the reader
+// stops after the first stream without checking the data following it.
+// SkipLeadingGarbage requests the reader to search for the first valid
+// stream header, so that xz streams embedded in firmware images or
+// self-extracting archives can be decompressed.
+//
+// Strict requests the rejection of all deviations from the xz
+// specification. By default the reader is permissive in the same way
+// as the xz tool. Only the following is handled differently:
+//
+//   - Check types reserved by the specification are rejected in strict
+//     mode. The permissive reader skips the check field without
+//     verifying it, as the xz tool does after printing a warning.
+//   - Block header padding longer than 3 bytes is rejected in strict
+//     mode. Such padding has been found in files created by other
+//     implementations and is accepted by the xz tool.
+//
+// All other errors, for instance non-zero padding bytes or non-zero
+// reserved bits in the flags, are reported in both modes. The check
+// type None is valid and accepted in both modes. The liblzma backend
+// isn't used in strict mode.
+//
+// Recover requests the recovery mode, which salvages the data of
+// damaged files. If an error is detected in a stream, the reader skips
+// the input until the next valid block header of the stream or the
+// next stream header and continues. The skipped ranges are reported by
+// the Skipped method of the reader. The data of a damaged block that
+// has been decompressed before the error has been detected is
+// returned. The index of a stream with skipped blocks isn't checked.
+// Errors of the underlying reader are always returned. The liblzma
+// backend isn't used in recovery mode.
+//
+// Timeout and MaxInputPerOutput limit the work a reader may do, so that
+// pathological input cannot occupy a goroutine of a service
+// indefinitely. Timeout limits the time from the creation of the reader
+// until the end of the decoding. The time is checked at the start of
+// every Read call and while compressed data is read. MaxInputPerOutput
+// limits the compressed bytes read per uncompressed byte. The reader
+// may read MaxInputPerOutput times the number of uncompressed bytes
+// returned so far plus the length of the buffer of the current Read
+// call and an allowance of 1 MiB for headers and padding. Exceeding a
+// budget is reported by an error matching ErrBudget. The value zero
+// disables the respective limit. The limits apply only to the Reader
+// created by NewReader.
+//
+// ReadIndex requests that NewReader reads the stream footers and
+// indexes up front if the underlying reader supports io.Seeker. The
+// reader then provides the uncompressed size with Size, the progress
+// with Progress and the positions of all blocks with Streams, and Seek
+// skips whole blocks. The position of the underlying reader is restored
+// before the decoding starts. Errors in the footers and indexes are
+// reported by NewReader.
+// ReadIndex cannot be combined with SkipLeadingGarbage or Recover.
+//
+// Stats receives the counters of the reader, Hooks the block lifecycle
+// callbacks and Logger the debug messages if they are not nil. The
+// Logger is also used by the LZMA2 decoder.
 type ReaderConfig struct {
-	DictCap      int
-	SingleStream bool
+	DictCap            int
+	DictCapLimit       int
+	SingleStream       bool
+	IgnoreTrailingData bool
+	SkipLeadingGarbage bool
+	Strict             bool
+	Recover            bool
+	Timeout            time.Duration
+	MaxInputPerOutput  int
+	ReadIndex          bool
+	Stats              Stats
+	Hooks              *Hooks
+	Logger             Logger
+
+	// debug receives the structures of the data for DebugReader
+	debug *annotator
 }
 
+// DefaultDictCapLimit is the dictionary capacity limit of 1.5 GiB used
+// by the reader if DictCapLimit is zero. It is the maximum dictionary
+// capacity of the xz tool and prevents that a corrupt or malicious
+// stream exhausts the memory of the process.
+const DefaultDictCapLimit = 3 << 29
+
+// ErrDictTooLarge is matched by the errors reporting a dictionary
+// capacity exceeding the limit. The errors have the type
+// *lzma.DictCapLimitError, which provides the declared dictionary
+// capacity.
+var ErrDictTooLarge = lzma.ErrDictTooLarge
+
 // fill replaces all zero values with their default values.
 func (c *ReaderConfig) fill() {
+	if c.DictCapLimit == 0 {
+		c.DictCapLimit = DefaultDictCapLimit
+	}
 	if c.DictCap == 0 {
 		c.DictCap = 8 * 1024 * 1024
+		if 0 < c.DictCapLimit && c.DictCapLimit < c.DictCap {
+			c.DictCap = c.DictCapLimit
+		}
 	}
 }
 
 // Verify checks the reader parameters for Validity. Zero values will be
-// replaced by default values.
+// replaced by default values. All invalid parameters are reported; if
+// there is more than one, the errors are combined with errors.Join.
+// The constructors of the package call Verify.
 func (c *ReaderConfig) Verify() error {
 	if c == nil {
 		return errors.New("xz: reader parameters are nil")
 	}
-	lc := lzma.Reader2Config{DictCap: c.DictCap}
-	if err := lc.Verify(); err != nil {
-		return err
+	c.fill()
+	var errs []error
+	if !(lzma.MinDictCap <= c.DictCap &&
+		int64(c.DictCap) <= lzma.MaxDictCap) {
+		errs = append(errs, fmt.Errorf("xz: DictCap %s not in [%s, %s]",
+			sizeString(int64(c.DictCap)),
+			sizeString(lzma.MinDictCap),
+			sizeString(lzma.MaxDictCap)))
+	} else if c.DictCapLimit > 0 && c.DictCap > c.DictCapLimit {
+		errs = append(errs, fmt.Errorf(
+			"xz: DictCap %s exceeds DictCapLimit %s",
+			sizeString(int64(c.DictCap)),
+			sizeString(int64(c.DictCapLimit))))
 	}
-	return nil
+	if c.Timeout < 0 {
+		errs = append(errs, fmt.Errorf("xz: Timeout %s is negative",
+			c.Timeout))
+	}
+	if c.MaxInputPerOutput < 0 {
+		errs = append(errs, fmt.Errorf(
+			"xz: MaxInputPerOutput %d is negative",
+			c.MaxInputPerOutput))
+	}
+	if c.ReadIndex && (c.SkipLeadingGarbage || c.Recover) {
+		errs = append(errs, errors.New("xz: ReadIndex cannot be "+
+			"combined with SkipLeadingGarbage or Recover"))
+	}
+	return joinErrors(errs)
 }
 
 // Reader supports the reading of one or multiple xz streams.
 type Reader struct {
 	ReaderConfig
 
-	xz io.Reader
+	xz *countingReader
 	sr *streamReader
+	// br is the reader of an alternative backend
+	br io.Reader
+	// offset of the first stream header
+	offset int64
+	// n counts the uncompressed bytes returned
+	n int64
+	// stream counts the completed streams
+	stream int
+	// streamOffset is the offset of the last stream header read
+	streamOffset int64
+	// pr supports the recovery mode
+	pr *pushbackReader
+	// skipped lists the ranges skipped in recovery mode
+	skipped []SkippedRange
+	// budget enforces Timeout and MaxInputPerOutput
+	budget *budgetReader
+	// single stops the reader at the end of the current stream
+	single bool
+	// header records the stream and check type of the last stream
+	// header read
+	header Header
+	// blocks collects the completed blocks for Blocks if it is not
+	// nil; pending keeps the blocks not yet yielded
+	blocks  *[]BlockInfo
+	pending []BlockInfo
+	// streams provides the index read for ReadIndex; seeker gives
+	// access to the underlying reader for Seek
+	streams []StreamInfo
+	seeker  *readSeekerAt
+	// src is the underlying reader, which may support deadlines;
+	// timeout records a timeout error of it
+	src     io.Reader
+	timeout error
+	// dec keeps the LZMA2 reader for the blocks
+	dec decoderCache
+	// err is the error of the last Reset
+	err error
+}
+
+// DecodeError provides the position at which the Reader detected an
+// error in the compressed data. The underlying error is available with
+// errors.Unwrap or the Err field.
+type DecodeError struct {
+	// Offset is the number of bytes read from the underlying reader,
+	// including leading garbage skipped, when the error was detected.
+	Offset int64
+	// UncompressedOffset is the number of uncompressed bytes
+	// returned by the reader before the error.
+	UncompressedOffset int64
+	// Stream is the index of the stream containing the error. It is
+	// -1 if the backend doesn't provide the stream index.
+	Stream int
+	// Block is the index of the block in the stream or -1 if the
+	// error has been detected outside of a block.
+	Block int
+	Err   error
+}
+
+// Error returns the message of the underlying error followed by the
+// position of the error.
+func (e *DecodeError) Error() string {
+	s := fmt.Sprintf("%s (offset %d, uncompressed offset %d",
+		e.Err, e.Offset, e.UncompressedOffset)
+	if e.Stream >= 0 {
+		s += fmt.Sprintf(", stream %d", e.Stream)
+	}
+	if e.Block >= 0 {
+		s += fmt.Sprintf(", block %d", e.Block)
+	}
+	return s + ")"
+}
+
+// Unwrap returns the underlying error.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout reports whether the error has been caused by a deadline of
+// the underlying reader or by the Timeout of the configuration, like
+// the method of net.Error.
+func (e *DecodeError) Timeout() bool {
+	return isTimeout(e.Err)
+}
+
+// Is reports whether the target is ErrCorrupt and the error is caused
+// by invalid compressed data. Other targets are matched by the
+// underlying error.
+func (e *DecodeError) Is(target error) bool {
+	return target == ErrCorrupt && isCorrupt(e.Err)
 }
 
 // streamReader decodes a single xz stream
@@ -63,42 +280,423 @@ type streamReader struct {
 	newHash func() hash.Hash
 	h       header
 	index   []record
+	// inBlock is set while the block len(index) is read
+	inBlock bool
+	// offset and uncompressedOffset give the position of the next
+	// block in the file and in the uncompressed data
+	offset             int64
+	uncompressedOffset int64
+	// damaged is set if blocks have been skipped in recovery mode;
+	// the index is then not compared with the blocks
+	damaged bool
+	// stream is the index of the stream; event and start describe
+	// the current block for the hooks
+	stream int
+	event  BlockEvent
+	start  time.Time
+	// blocks collects the completed blocks if it is not nil
+	blocks *[]BlockInfo
+	// dec is the decoder cache of the Reader
+	dec *decoderCache
 }
 
-// NewReader creates a new xz reader using the default parameters.
-// The function reads and checks the header of the first XZ stream. The
-// reader will process multiple streams including padding.
-func NewReader(xz io.Reader) (r *Reader, err error) {
-	return ReaderConfig{}.NewReader(xz)
+// NewReader creates a new xz reader using the default parameters
+// changed by the options. The function reads and checks the header of
+// the first XZ stream. The reader will process multiple streams
+// including padding.
+func NewReader(xz io.Reader, opts ...Option) (r *Reader, err error) {
+	c, err := readerConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	return c.NewReader(xz)
 }
 
 // NewReader creates an xz stream reader. The created reader will be
 // able to process multiple streams and padding unless a SingleStream
 // has been set in the reader configuration c.
 func (c ReaderConfig) NewReader(xz io.Reader) (r *Reader, err error) {
-	if err = c.Verify(); err != nil {
+	r = new(Reader)
+	if err = r.init(c, xz); err != nil {
 		return nil, err
 	}
-	r = &Reader{
+	return r, nil
+}
+
+// init initializes the reader for reading from xz and reads the header
+// of the first stream. The decoder of the reader is kept for reuse.
+func (r *Reader) init(c ReaderConfig, xz io.Reader) (err error) {
+	if err = c.Verify(); err != nil {
+		return err
+	}
+	var streams []StreamInfo
+	var seeker *readSeekerAt
+	if rs, ok := xz.(io.ReadSeeker); ok && c.ReadIndex {
+		if seeker, streams, err = readIndex(rs); err != nil {
+			return err
+		}
+	}
+	src := xz
+	xz = &ioReader{r: xz}
+	if c.Stats != nil {
+		xz = &statsReader{r: xz, s: c.Stats}
+	}
+	budget := c.newBudgetReader(xz)
+	if budget != nil {
+		if err = budget.start(c.MaxInputPerOutput, 0, 0); err != nil {
+			return err
+		}
+		xz = budget
+	}
+	var offset int64
+	if c.SkipLeadingGarbage {
+		if xz, offset, err = scanHeader(xz); err != nil {
+			return err
+		}
+	}
+	*r = Reader{
 		ReaderConfig: c,
-		xz:           xz,
+		offset:       offset,
+		budget:       budget,
+		header:       Header{Stream: -1, Block: -1},
+		streams:      streams,
+		seeker:       seeker,
+		src:          src,
+		dec:          r.dec,
+	}
+	if r.br, err = c.newBackendReader(xz); err != nil {
+		return err
 	}
-	if r.sr, err = c.newStreamReader(xz); err != nil {
+	if r.br != nil {
+		return nil
+	}
+	if c.Recover {
+		r.pr = &pushbackReader{r: xz}
+		xz = r.pr
+	}
+	r.xz = &countingReader{r: xz}
+	r.streamOffset = offset
+	if r.sr, err = c.newStreamReader(r.xz); err != nil {
 		if err == io.EOF {
 			err = io.ErrUnexpectedEOF
 		}
-		return nil, err
+		if !c.Recover {
+			return r.decodeError(err)
+		}
+		if err = r.recover(err, 0); err != nil && err != io.EOF {
+			return r.decodeError(err)
+		}
+		return nil
 	}
-	return r, nil
+	r.sr.offset = r.offset + r.xz.n
+	r.sr.dec = &r.dec
+	r.header.Stream, r.header.CheckType = 0, r.sr.h.flags
+	return nil
+}
+
+// Offset returns the offset of the first stream header in the
+// underlying reader. It is only different from zero if
+// SkipLeadingGarbage is set in the reader configuration.
+func (r *Reader) Offset() int64 {
+	return r.offset
+}
+
+// Reset discards the state of the reader and reads the header of the
+// first stream from xz using the configuration of the reader, so that a
+// Reader can be reused rather than allocated again. The LZMA2 decoder is
+// kept, which saves the allocation of the dictionary. It has the shape
+// of the Reset method of the compress/gzip reader. The xz format doesn't
+// support preset dictionaries, so the Resetter interface of
+// compress/flate isn't implemented. It returns the error verifying the
+// configuration or reading the stream header; the error is returned by
+// all following calls of Read as well.
+func (r *Reader) Reset(xz io.Reader) error {
+	if err := r.init(r.ReaderConfig, xz); err != nil {
+		*r = Reader{ReaderConfig: r.ReaderConfig, dec: r.dec, err: err}
+		return err
+	}
+	return nil
+}
+
+// Multistream controls whether the reader supports multiple streams,
+// like the method of the same name of the compress/gzip Reader. It is
+// enabled by default. If disabled the reader returns io.EOF at the end
+// of the current stream and doesn't read beyond its footer, so the
+// caller can inspect the data following the stream, which might be
+// stream padding, or call Reset to read the next stream. Reset enables
+// the support again. Readers using the liblzma backend read ahead and
+// always process multiple streams; the method has no effect for them.
+func (r *Reader) Multistream(ok bool) {
+	r.single = !ok
+}
+
+// Close exists for parity with the Reader of the compress/gzip package.
+// It doesn't close the underlying reader and always returns nil.
+func (r *Reader) Close() error {
+	return nil
 }
 
 var errUnexpectedData = errors.New("xz: unexpected data after stream")
 
-// Read reads uncompressed data from the stream.
+// inputCounter is implemented by backend readers providing the number
+// of compressed bytes consumed.
+type inputCounter interface {
+	inputCount() int64
+}
+
+// decodeError adds the current position of the reader to err.
+func (r *Reader) decodeError(err error) error {
+	if _, ok := err.(*DecodeError); ok {
+		return err
+	}
+	return &DecodeError{
+		Offset:             r.CompressedCount(),
+		UncompressedOffset: r.n,
+		Stream:             r.Stream(),
+		Block:              r.Block(),
+		Err:                err,
+	}
+}
+
+// CompressedCount returns the number of bytes consumed from the
+// underlying reader, including leading garbage skipped. It is -1 if the
+// backend doesn't provide the number.
+func (r *Reader) CompressedCount() int64 {
+	if r.br != nil {
+		if c, ok := r.br.(inputCounter); ok {
+			return r.offset + c.inputCount()
+		}
+		return -1
+	}
+	if r.xz == nil {
+		return r.offset
+	}
+	return r.offset + r.xz.n
+}
+
+// UncompressedCount returns the number of uncompressed bytes returned
+// by Read.
+func (r *Reader) UncompressedCount() int64 {
+	return r.n
+}
+
+// Ratio returns the ratio of the compressed and uncompressed counts as
+// reported by xz --list. It is zero if no uncompressed data has been
+// returned or the compressed count is unknown.
+func (r *Reader) Ratio() float64 {
+	return ratio(r.CompressedCount(), r.n)
+}
+
+// CompressedOffset returns the offset in the underlying reader from
+// which the decoding can be resumed: the offset of the header of the
+// block being decoded or, outside of a block, the number of bytes
+// consumed. UncompressedOffset returns the corresponding position in
+// the uncompressed data. A consumer checkpointing its position can
+// resume later by finding the block at CompressedOffset in the index
+// provided by ReadStreamInfo, reading it with the NewBlockReader
+// method of ReaderConfig and discarding UncompressedCount minus
+// UncompressedOffset bytes. Both methods return -1 if the backend
+// doesn't provide the position.
+func (r *Reader) CompressedOffset() int64 {
+	if r.br != nil {
+		return -1
+	}
+	if r.sr != nil && r.sr.br != nil {
+		return r.sr.offset
+	}
+	return r.offset + r.xz.n
+}
+
+// UncompressedOffset returns the position in the uncompressed data
+// corresponding to CompressedOffset.
+func (r *Reader) UncompressedOffset() int64 {
+	if r.br != nil {
+		return -1
+	}
+	if r.sr != nil && r.sr.br != nil {
+		return r.sr.uncompressedOffset
+	}
+	return r.n
+}
+
+// Stream returns the index of the stream being decoded. It is -1 if the
+// backend doesn't provide the index.
+func (r *Reader) Stream() int {
+	if r.br != nil {
+		return -1
+	}
+	return r.stream
+}
+
+// Block returns the index of the block being decoded in its stream. It
+// is -1 outside of a block or if the backend doesn't provide the index.
+func (r *Reader) Block() int {
+	if r.br == nil && r.sr != nil && r.sr.inBlock {
+		return len(r.sr.index)
+	}
+	return -1
+}
+
+// Header provides the metadata of the stream and the block decoded by a
+// Reader. Applications may use it to enforce policies, for instance to
+// reject streams without check.
+type Header struct {
+	// Stream is the index of the last stream whose header has been
+	// read. It is -1 if no header has been read or the backend
+	// doesn't provide the metadata.
+	Stream int
+	// CheckType identifies the check method of the stream: zero for
+	// None, CRC32, CRC64, SHA256 or a value reserved by the
+	// specification.
+	CheckType byte
+	// Block is the index of the block being decoded in the stream or
+	// -1 outside of a block.
+	Block int
+	// Filters lists the names of the filters of the block in the
+	// order of the filter chain. It is nil outside of a block.
+	Filters []string
+	// DictCap is the dictionary capacity of the LZMA2 filter of the
+	// block.
+	DictCap int64
+}
+
+// Header returns the metadata of the stream and block being decoded.
+// The stream metadata is available after NewReader returned, the block
+// metadata after the first Read of data of the block.
+func (r *Reader) Header() Header {
+	h := r.header
+	if r.br != nil {
+		return h
+	}
+	h.Block = r.Block()
+	if r.sr == nil || r.sr.br == nil {
+		return h
+	}
+	filters := r.sr.br.header.filters
+	h.Filters = make([]string, len(filters))
+	for i, f := range filters {
+		switch f := f.(type) {
+		case *lzmaFilter:
+			h.Filters[i] = "LZMA2"
+			h.DictCap = f.dictCap
+		case *specFilter:
+			h.Filters[i] = f.String()
+		default:
+			h.Filters[i] = fmt.Sprintf("filter %#x", f.id())
+		}
+	}
+	return h
+}
+
+// errNoBlocks reports that the backend doesn't provide the blocks.
+var errNoBlocks = errors.New("xz: backend doesn't provide block information")
+
+// Blocks returns an iterator decoding the remaining data of the reader
+// and yielding the metadata of every block after it has been decoded
+// and its check verified. The uncompressed data is discarded; tools
+// that need it should use Hooks instead. Blocks decoded but not yet
+// yielded when a loop is left are yielded first by the next iteration.
+// An error is yielded with a zero BlockInfo and ends the iteration.
+// The backend doesn't provide the blocks, so the iterator yields only
+// an error for readers using it.
+func (r *Reader) Blocks() iter.Seq2[BlockInfo, error] {
+	return func(yield func(BlockInfo, error) bool) {
+		if r.br != nil {
+			yield(BlockInfo{}, errNoBlocks)
+			return
+		}
+		r.setBlocks(&r.pending)
+		defer r.setBlocks(nil)
+		var buf []byte
+		for {
+			var err error
+			if len(r.pending) == 0 {
+				if buf == nil {
+					buf = make([]byte, 32<<10)
+				}
+				_, err = r.Read(buf)
+			}
+			for len(r.pending) > 0 {
+				b := r.pending[0]
+				r.pending = r.pending[1:]
+				if !yield(b, nil) {
+					return
+				}
+			}
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				yield(BlockInfo{}, err)
+				return
+			}
+		}
+	}
+}
+
+// setBlocks sets the slice collecting the completed blocks.
+func (r *Reader) setBlocks(blocks *[]BlockInfo) {
+	r.blocks = blocks
+	if r.sr != nil {
+		r.sr.blocks = blocks
+	}
+}
+
+// ratio computes the ratio of the compressed and uncompressed sizes.
+func ratio(compressed, uncompressed int64) float64 {
+	if compressed < 0 || uncompressed <= 0 {
+		return 0
+	}
+	return float64(compressed) / float64(uncompressed)
+}
+
+// Read reads uncompressed data from the stream. Errors in the
+// compressed data are reported as *DecodeError. All data decompressed
+// before an error is returned by the preceding calls or by the call
+// reporting the error, so callers can keep the valid prefix of a
+// damaged file. The data of a block is returned before its checksum is
+// verified.
 func (r *Reader) Read(p []byte) (n int, err error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if r.timeout != nil {
+		return 0, r.timeout
+	}
+	if r.budget != nil {
+		err = r.budget.start(r.MaxInputPerOutput, r.n, len(p))
+		if err != nil {
+			return 0, r.decodeError(err)
+		}
+	}
+	if r.br != nil {
+		n, err = r.br.Read(p)
+	} else {
+		n, err = r.read(p)
+	}
+	r.n += int64(n)
+	addStat(r.Stats, StatBytesOut, int64(n))
+	if err != nil && err != io.EOF {
+		addStat(r.Stats, StatErrors, 1)
+		err = r.decodeError(err)
+		if isTimeout(err) {
+			r.timeout = err
+		}
+	}
+	return n, err
+}
+
+// read reads uncompressed data using the Go implementation.
+func (r *Reader) read(p []byte) (n int, err error) {
 	for n < len(p) {
 		if r.sr == nil {
+			if r.single {
+				return n, io.EOF
+			}
 			if r.SingleStream {
+				if r.IgnoreTrailingData {
+					return n, io.EOF
+				}
 				data := make([]byte, 1)
 				_, err = io.ReadFull(r.xz, data)
 				if err != io.EOF {
@@ -107,23 +705,44 @@ func (r *Reader) Read(p []byte) (n int, err error) {
 				return n, io.EOF
 			}
 			for {
+				r.streamOffset = r.offset + r.xz.n
 				r.sr, err = r.ReaderConfig.newStreamReader(r.xz)
 				if err != errPadding {
 					break
 				}
 			}
 			if err != nil {
-				return n, err
+				if err == io.EOF || !r.Recover {
+					return n, err
+				}
+				if err = r.recover(err, n); err != nil {
+					return n, err
+				}
+				continue
 			}
+			r.sr.offset = r.offset + r.xz.n
+			r.sr.uncompressedOffset = r.n + int64(n)
+			r.sr.stream = r.stream
+			r.sr.blocks = r.blocks
+			r.sr.dec = &r.dec
+			r.header.Stream = r.stream
+			r.header.CheckType = r.sr.h.flags
 		}
 		k, err := r.sr.Read(p[n:])
 		n += k
 		if err != nil {
 			if err == io.EOF {
 				r.sr = nil
+				r.stream++
+				addStat(r.Stats, StatStreams, 1)
 				continue
 			}
-			return n, err
+			if !r.Recover {
+				return n, err
+			}
+			if err = r.recover(err, n); err != nil {
+				return n, err
+			}
 		}
 	}
 	return n, nil
@@ -131,6 +750,25 @@ func (r *Reader) Read(p []byte) (n int, err error) {
 
 var errPadding = errors.New("xz: padding (4 zero bytes) encountered")
 
+// checkFlags rejects the check types reserved by the specification in
+// strict mode.
+func (c *ReaderConfig) checkFlags(flags byte) error {
+	if c.Strict && !supportedCheck(flags) {
+		return errUnsupportedCheck
+	}
+	return nil
+}
+
+// checkBlockHeader rejects block header padding longer than 3 bytes in
+// strict mode.
+func (c *ReaderConfig) checkBlockHeader(h *blockHeader) error {
+	if c.Strict && h.paddingLen > 3 {
+		return errorf(ErrBlockHeader,
+			"xz: block header padding too long")
+	}
+	return nil
+}
+
 // newStreamReader creates a new xz stream reader using the given configuration
 // parameters. NewReader reads and checks the header of the xz stream.
 func (c ReaderConfig) newStreamReader(xz io.Reader) (r *streamReader, err error) {
@@ -158,7 +796,11 @@ func (c ReaderConfig) newStreamReader(xz io.Reader) (r *streamReader, err error)
 	if err = r.h.UnmarshalBinary(data); err != nil {
 		return nil, err
 	}
-	xlog.Debugf("xz header %s", r.h)
+	logf(r.Logger, "xz header %s", r.h)
+	c.debug.streamHeader(&r.h)
+	if err = c.checkFlags(r.h.flags); err != nil {
+		return nil, err
+	}
 	if r.newHash, err = newHashFunc(r.h.flags); err != nil {
 		return nil, err
 	}
@@ -166,25 +808,51 @@ func (c ReaderConfig) newStreamReader(xz io.Reader) (r *streamReader, err error)
 }
 
 // errIndex indicates an error with the xz file index.
-var errIndex = errors.New("xz: error in xz file index")
+var errIndex = errorf(ErrIndex, "xz: error in xz file index")
+
+// checkRecord compares the index record with the record computed for
+// the actual block. The name identifies the index record in the error
+// message.
+func checkRecord(name string, index, block record) error {
+	if index.unpaddedSize != block.unpaddedSize {
+		return errorf(ErrIndex, "xz: %s has unpadded size %d; "+
+			"block has %d", name, index.unpaddedSize,
+			block.unpaddedSize)
+	}
+	if index.uncompressedSize != block.uncompressedSize {
+		return errorf(ErrIndex, "xz: %s has uncompressed size %d; "+
+			"block has %d", name, index.uncompressedSize,
+			block.uncompressedSize)
+	}
+	return nil
+}
 
 // readTail reads the index body and the xz footer.
 func (r *streamReader) readTail() error {
-	index, n, err := readIndexBody(r.xz)
+	// the index must have a record for every block read
+	maxRecords := int64(len(r.index))
+	if r.damaged {
+		maxRecords = -1
+	}
+	index, n, err := readIndexBody(r.xz, maxRecords)
 	if err != nil {
 		if err == io.EOF {
 			err = io.ErrUnexpectedEOF
 		}
 		return err
 	}
-	if len(index) != len(r.index) {
-		return fmt.Errorf("xz: index length is %d; want %d",
+	r.debug.index(len(index), int64(n)+1)
+	if len(index) != len(r.index) && !r.damaged {
+		return errorf(ErrIndex, "xz: index has %d records for %d blocks",
 			len(index), len(r.index))
 	}
 	for i, rec := range r.index {
-		if rec != index[i] {
-			return fmt.Errorf("xz: record %d is %v; want %v",
-				i, rec, index[i])
+		if r.damaged {
+			break
+		}
+		name := fmt.Sprintf("index record %d", i)
+		if err = checkRecord(name, index[i], rec); err != nil {
+			return err
 		}
 	}
 
@@ -199,12 +867,13 @@ func (r *streamReader) readTail() error {
 	if err = f.UnmarshalBinary(p); err != nil {
 		return err
 	}
-	xlog.Debugf("xz footer %s", f)
-	if f.flags != r.h.flags {
-		return errors.New("xz: footer flags incorrect")
+	logf(r.Logger, "xz footer %s", f)
+	r.debug.streamFooter(&f)
+	if err = f.verifyHeader(&r.h); err != nil {
+		return err
 	}
 	if f.indexSize != int64(n)+1 {
-		return errors.New("xz: index size in footer wrong")
+		return errFooterIndexSize(&f, int64(n)+1)
 	}
 	return nil
 }
@@ -213,29 +882,64 @@ func (r *streamReader) readTail() error {
 func (r *streamReader) Read(p []byte) (n int, err error) {
 	for n < len(p) {
 		if r.br == nil {
+			r.inBlock = true
 			bh, hlen, err := readBlockHeader(r.xz)
 			if err != nil {
 				if err == errIndexIndicator {
+					r.inBlock = false
 					if err = r.readTail(); err != nil {
 						return n, err
 					}
 					return n, io.EOF
 				}
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return n, err
+			}
+			logf(r.Logger, "block %v", *bh)
+			r.debug.blockHeader(bh, r.stream, len(r.index),
+				r.offset, r.uncompressedOffset)
+			if err = r.checkBlockHeader(bh); err != nil {
 				return n, err
 			}
-			xlog.Debugf("block %v", *bh)
 			r.br, err = r.ReaderConfig.newBlockReader(r.xz, bh,
-				hlen, r.newHash())
+				hlen, r.newHash(), r.dec)
 			if err != nil {
 				return n, err
 			}
+			r.br.setPosition(r.h.flags, len(r.index), r.offset,
+				r.uncompressedOffset)
+			if r.Hooks != nil {
+				r.startBlock(bh, hlen)
+			}
 		}
 		k, err := r.br.Read(p[n:])
 		n += k
 		if err != nil {
 			if err == io.EOF {
-				r.index = append(r.index, r.br.record())
+				rec := r.br.record()
+				r.debug.blockEnd(rec)
+				if r.Hooks != nil {
+					r.event.UnpaddedSize = rec.unpaddedSize
+					r.event.UncompressedSize = rec.uncompressedSize
+					r.Hooks.blockEnd(&r.event, r.start)
+				}
+				if r.blocks != nil {
+					*r.blocks = append(*r.blocks, BlockInfo{
+						Offset:             r.offset,
+						UncompressedOffset: r.uncompressedOffset,
+						UnpaddedSize:       rec.unpaddedSize,
+						UncompressedSize:   rec.uncompressedSize,
+					})
+				}
+				r.index = append(r.index, rec)
+				r.offset += rec.unpaddedSize +
+					int64(padLen(rec.unpaddedSize))
+				r.uncompressedOffset += rec.uncompressedSize
 				r.br = nil
+				r.inBlock = false
+				addStat(r.Stats, StatBlocks, 1)
 			} else {
 				return n, err
 			}
@@ -244,16 +948,41 @@ func (r *streamReader) Read(p []byte) (n int, err error) {
 	return n, nil
 }
 
+// startBlock reports the start of the block with the given header to
+// the hooks.
+func (r *streamReader) startBlock(bh *blockHeader, hlen int) {
+	r.event = BlockEvent{
+		Stream: r.stream,
+		Block:  len(r.index),
+		BlockInfo: BlockInfo{
+			Offset:             r.offset,
+			UncompressedOffset: r.uncompressedOffset,
+			UnpaddedSize:       -1,
+			UncompressedSize:   bh.uncompressedSize,
+		},
+	}
+	if bh.compressedSize >= 0 {
+		r.event.UnpaddedSize = int64(hlen) + bh.compressedSize +
+			int64(checkLen(r.h.flags))
+	}
+	r.start = r.Hooks.blockStart(&r.event)
+}
+
 // countingReader is a reader that counts the bytes read.
 type countingReader struct {
 	r io.Reader
 	n int64
+	// err is the last error returned by the wrapped reader
+	err error
 }
 
 // Read reads data from the wrapped reader and adds it to the n field.
 func (lr *countingReader) Read(p []byte) (n int, err error) {
 	n, err = lr.r.Read(p)
 	lr.n += int64(n)
+	if err != nil {
+		lr.err = err
+	}
 	return n, err
 }
 
@@ -266,20 +995,81 @@ type blockReader struct {
 	hash      hash.Hash
 	r         io.Reader
 	err       error
+	// index is the index record for the block if it is known
+	// before the block is read
+	index *record
+	// checkType and the position of the block are reported in a
+	// ChecksumError
+	checkType          byte
+	block              int
+	offset             int64
+	uncompressedOffset int64
+	debug              *annotator
+}
+
+// setPosition sets the check type and the position of the block, which
+// are reported if the check fails.
+func (br *blockReader) setPosition(checkType byte, block int,
+	offset, uncompressedOffset int64) {
+
+	br.checkType = checkType
+	br.block = block
+	br.offset = offset
+	br.uncompressedOffset = uncompressedOffset
+}
+
+// ErrChecksum is matched by all values of ChecksumError using
+// errors.Is. The liblzma backend doesn't distinguish checksum errors
+// from other data errors.
+var ErrChecksum = errors.New("xz: checksum error for block")
+
+// ChecksumError reports a block whose check doesn't match the
+// uncompressed data. The position of the block allows to skip it or to
+// extract it for further analysis.
+type ChecksumError struct {
+	// Block is the index of the block in its stream. It is -1 if
+	// the index is unknown.
+	Block int
+	// Offset is the offset of the block header in the file.
+	Offset int64
+	// UncompressedOffset is the position of the first uncompressed
+	// byte of the block in the uncompressed file.
+	UncompressedOffset int64
+	// CheckType identifies the check method: CRC32, CRC64 or SHA256.
+	CheckType byte
+	// Expected is the check stored in the block.
+	Expected []byte
+	// Computed is the check computed for the uncompressed data.
+	Computed []byte
+}
+
+// Error returns the error message.
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("xz: checksum error for block %d at offset %d "+
+		"(uncompressed offset %d): %s is %x; computed %x",
+		e.Block, e.Offset, e.UncompressedOffset,
+		flagString(e.CheckType), e.Expected, e.Computed)
+}
+
+// Is reports whether target is ErrChecksum or ErrCorrupt.
+func (e *ChecksumError) Is(target error) bool {
+	return target == ErrChecksum || target == ErrCorrupt
 }
 
-// newBlockReader creates a new block reader.
+// newBlockReader creates a new block reader. If dec is not nil, the
+// LZMA2 reader is taken from the decoder cache.
 func (c *ReaderConfig) newBlockReader(xz io.Reader, h *blockHeader,
-	hlen int, hash hash.Hash) (br *blockReader, err error) {
+	hlen int, hash hash.Hash, dec *decoderCache) (br *blockReader, err error) {
 
 	br = &blockReader{
 		lxz:       countingReader{r: xz},
 		header:    h,
 		headerLen: hlen,
 		hash:      hash,
+		debug:     c.debug,
 	}
 
-	fr, err := c.newFilterReader(&br.lxz, h.filters)
+	fr, err := c.newFilterReader(&br.lxz, h.filters, dec)
 	if err != nil {
 		return nil, err
 	}
@@ -313,7 +1103,8 @@ func (br *blockReader) record() record {
 
 // errBlockSize indicates that the size of the block in the block header
 // is wrong.
-var errBlockSize = errors.New("xz: wrong uncompressed size for block")
+var errBlockSize = errorf(ErrBlockHeader,
+	"xz: wrong uncompressed size for block")
 
 // Read reads data from the block.
 func (br *blockReader) Read(p []byte) (n int, err error) {
@@ -322,13 +1113,19 @@ func (br *blockReader) Read(p []byte) (n int, err error) {
 
 	u := br.header.uncompressedSize
 	if u >= 0 && br.uncompressedSize() > u {
-		return n, errors.New("xz: wrong uncompressed size for block")
+		return n, errBlockSize
 	}
 	c := br.header.compressedSize
 	if c >= 0 && br.compressedSize() > c {
-		return n, errors.New("xz: wrong compressed size for block")
+		return n, errorf(ErrBlockHeader,
+			"xz: wrong compressed size for block")
 	}
 	if err != io.EOF {
+		if err != nil && err != io.ErrUnexpectedEOF &&
+			err != br.lxz.err {
+			// the error has been detected by the LZMA2 decoder
+			err = withClass(ErrData, err)
+		}
 		return n, err
 	}
 	if br.uncompressedSize() < u || br.compressedSize() < c {
@@ -345,18 +1142,35 @@ func (br *blockReader) Read(p []byte) (n int, err error) {
 		return n, err
 	}
 	if !allZeros(q[:k]) {
-		return n, errors.New("xz: non-zero block padding")
+		return n, errorf(ErrBlockPadding, "xz: non-zero block padding")
 	}
 	checkSum := q[k:]
 	computedSum := br.hash.Sum(checkSum[s:])
-	if !bytes.Equal(checkSum, computedSum) {
-		return n, errors.New("xz: checksum error for block")
+	_, unverified := br.hash.(unverifiedCheck)
+	br.debug.check(br.checkType, checkSum, computedSum, !unverified)
+	if !unverified && !bytes.Equal(checkSum, computedSum) {
+		return n, &ChecksumError{
+			Block:              br.block,
+			Offset:             br.offset,
+			UncompressedOffset: br.uncompressedOffset,
+			CheckType:          br.checkType,
+			Expected:           checkSum,
+			Computed:           computedSum,
+		}
+	}
+	if br.index != nil {
+		err = checkRecord("index record", *br.index, br.record())
+		if err != nil {
+			return n, err
+		}
 	}
 	return n, io.EOF
 }
 
-func (c *ReaderConfig) newFilterReader(r io.Reader, f []filter) (fr io.Reader,
-	err error) {
+// newFilterReader creates the reader for the filter list. If dec is not
+// nil, the LZMA2 reader is taken from the decoder cache.
+func (c *ReaderConfig) newFilterReader(r io.Reader, f []filter,
+	dec *decoderCache) (fr io.Reader, err error) {
 
 	if err = verifyFilters(f); err != nil {
 		return nil, err
@@ -364,10 +1178,21 @@ func (c *ReaderConfig) newFilterReader(r io.Reader, f []filter) (fr io.Reader,
 
 	fr = r
 	for i := len(f) - 1; i >= 0; i-- {
-		fr, err = f[i].reader(fr, c)
+		lf, ok := f[i].(*lzmaFilter)
+		if !ok || dec == nil {
+			fr, err = f[i].reader(fr, c)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		config, err := lf.reader2Config(c)
 		if err != nil {
 			return nil, err
 		}
+		if fr, err = dec.reader(config, fr); err != nil {
+			return nil, err
+		}
 	}
 	return fr, nil
 }
@@ -0,0 +1,356 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package xz
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestReaderHeader(t *testing.T) {
+	if Backend != "go" {
+		t.Skip("the backend doesn't provide the metadata")
+	}
+	var buf bytes.Buffer
+	wc := WriterConfig{CheckSum: CRC32, DictCap: 1 << 16}
+	w, err := wc.NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	if _, err = io.WriteString(w, "hello, world\n"); err != nil {
+		t.Fatalf("WriteString error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("w.Close error %s", err)
+	}
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	h := r.Header()
+	if h.Stream != 0 || h.CheckType != CRC32 || h.Block != -1 ||
+		h.Filters != nil {
+		t.Fatalf("header after NewReader %+v", h)
+	}
+	p := make([]byte, 1)
+	if _, err = r.Read(p); err != nil {
+		t.Fatalf("Read error %s", err)
+	}
+	h = r.Header()
+	if h.Block != 0 || len(h.Filters) != 1 || h.Filters[0] != "LZMA2" ||
+		h.DictCap != 1<<16 {
+		t.Fatalf("header in block %+v", h)
+	}
+	if _, err = io.Copy(ioutil.Discard, r); err != nil {
+		t.Fatalf("io.Copy error %s", err)
+	}
+	h = r.Header()
+	if h.Stream != 0 || h.CheckType != CRC32 || h.Block != -1 {
+		t.Fatalf("header at end %+v", h)
+	}
+}
+
+func TestReaderBlocks(t *testing.T) {
+	if Backend != "go" {
+		t.Skip("the backend doesn't provide the blocks")
+	}
+	text := strings.Repeat("The quick brown fox jumps over the lazy dog.\n",
+		100)
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, WithBlockSize(1000))
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	if _, err = io.WriteString(w, text); err != nil {
+		t.Fatalf("WriteString error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("w.Close error %s", err)
+	}
+	data := append(buf.Bytes(), buf.Bytes()...)
+	streams, err := ReadStreamInfo(bytes.NewReader(data),
+		int64(len(data)))
+	if err != nil {
+		t.Fatalf("ReadStreamInfo error %s", err)
+	}
+	var want []BlockInfo
+	for _, s := range streams {
+		want = append(want, s.Blocks...)
+	}
+
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	var got []BlockInfo
+	for b, err := range r.Blocks() {
+		if err != nil {
+			t.Fatalf("Blocks error %s", err)
+		}
+		got = append(got, b)
+		if len(got) == 2 {
+			break
+		}
+	}
+	for b, err := range r.Blocks() {
+		if err != nil {
+			t.Fatalf("Blocks error %s", err)
+		}
+		got = append(got, b)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d blocks; want %d", len(got), len(want))
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("block %d is %+v; want %+v", i, got[i],
+				want[i])
+		}
+	}
+
+	data[len(data)/2] ^= 0xff
+	if r, err = NewReader(bytes.NewReader(data)); err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	var blockErr error
+	for _, err := range r.Blocks() {
+		blockErr = err
+	}
+	if !errors.Is(blockErr, ErrCorrupt) {
+		t.Fatalf("Blocks ended with error %v; want corrupt data",
+			blockErr)
+	}
+}
+
+func TestReaderStrict(t *testing.T) {
+	const text = "The quick brown fox jumps over the lazy dog.\n"
+	var buf bytes.Buffer
+	w, err := WriterConfig{CheckSum: CRC32}.NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	if _, err = io.WriteString(w, text); err != nil {
+		t.Fatalf("WriteString error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("Close error %s", err)
+	}
+	reserved := append([]byte(nil), buf.Bytes()...)
+	// check type 0x02 has the same size as CRC-32
+	setCheckType(reserved, 0x02)
+	padded := padBlockHeader(t, buf.Bytes())
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"reserved check type", reserved},
+		{"long block header padding", padded},
+	}
+	for _, tc := range tests {
+		r, err := NewReader(bytes.NewReader(tc.data))
+		if err != nil {
+			t.Fatalf("%s: NewReader error %s", tc.name, err)
+		}
+		out, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("%s: ReadAll error %s", tc.name, err)
+		}
+		if string(out) != text {
+			t.Fatalf("%s: got %q; want %q", tc.name, out, text)
+		}
+
+		r, err = ReaderConfig{Strict: true}.NewReader(
+			bytes.NewReader(tc.data))
+		if err == nil {
+			_, err = ioutil.ReadAll(r)
+		}
+		if err == nil {
+			t.Fatalf("%s: strict reader accepted the stream",
+				tc.name)
+		}
+		if _, err = (ReaderConfig{Strict: true}).VerifyStructure(
+			bytes.NewReader(tc.data), int64(len(tc.data))); err == nil {
+			t.Fatalf("%s: VerifyStructure in strict mode "+
+				"accepted the stream", tc.name)
+		}
+	}
+}
+
+func TestReaderDecodeError(t *testing.T) {
+	const text = "The quick brown fox jumps over the lazy dog.\n"
+	var first, second bytes.Buffer
+	w, err := NewWriter(&first)
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	io.WriteString(w, text)
+	if err = w.Close(); err != nil {
+		t.Fatalf("Close error %s", err)
+	}
+	w, err = WriterConfig{BlockSize: 1024}.NewWriter(&second)
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	for i := 0; i < 3000/len(text)+1; i++ {
+		io.WriteString(w, text)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("Close error %s", err)
+	}
+	streams, err := ReadStreamInfo(bytes.NewReader(second.Bytes()),
+		int64(second.Len()))
+	if err != nil {
+		t.Fatalf("ReadStreamInfo error %s", err)
+	}
+	b := streams[0].Blocks[1]
+	data := append(first.Bytes(), second.Bytes()...)
+	// corrupt the last byte of the check of the second block
+	off := int64(first.Len()) + b.Offset + b.UnpaddedSize
+	data[off-1] ^= 0xff
+
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	_, err = ioutil.ReadAll(r)
+	var e *DecodeError
+	if !errors.As(err, &e) {
+		t.Fatalf("ReadAll returned error %v; want DecodeError", err)
+	}
+	want := DecodeError{
+		Offset:             off + int64(padLen(b.UnpaddedSize)),
+		UncompressedOffset: int64(len(text)) + 2*1024,
+		Stream:             1,
+		Block:              1,
+	}
+	if Backend != "go" {
+		// liblzma provides only the offsets
+		want.Stream, want.Block = -1, -1
+	}
+	if e.Offset != want.Offset ||
+		e.UncompressedOffset != want.UncompressedOffset ||
+		e.Stream != want.Stream || e.Block != want.Block {
+		t.Fatalf("got error %s; want offset %d, uncompressed "+
+			"offset %d, stream %d, block %d", e, want.Offset,
+			want.UncompressedOffset, want.Stream, want.Block)
+	}
+	if Backend != "go" {
+		return
+	}
+	if !strings.HasPrefix(e.Error(), "xz: checksum error for block") {
+		t.Fatalf("unexpected error message %q", e)
+	}
+	if !errors.Is(err, ErrChecksum) {
+		t.Fatalf("error %s doesn't match ErrChecksum", err)
+	}
+	var ce *ChecksumError
+	if !errors.As(err, &ce) {
+		t.Fatalf("ReadAll returned error %v; want ChecksumError", err)
+	}
+	if ce.Block != 1 || ce.Offset != int64(first.Len())+b.Offset ||
+		ce.UncompressedOffset != int64(len(text))+1024 {
+		t.Fatalf("got %s; want block 1 at offset %d, "+
+			"uncompressed offset %d", ce,
+			int64(first.Len())+b.Offset, len(text)+1024)
+	}
+	if ce.CheckType != CRC64 || len(ce.Expected) != 8 ||
+		bytes.Equal(ce.Expected, ce.Computed) {
+		t.Fatalf("unexpected check values in %s", ce)
+	}
+	// a single byte of the stored check has been inverted
+	var d int
+	for i := range ce.Expected {
+		if ce.Expected[i] != ce.Computed[i] {
+			if ce.Expected[i]^0xff != ce.Computed[i] {
+				d = 2
+				break
+			}
+			d++
+		}
+	}
+	if d != 1 {
+		t.Fatalf("expected check %x; computed %x", ce.Expected,
+			ce.Computed)
+	}
+}
+
+func TestReaderPartialOutput(t *testing.T) {
+	a := strings.Repeat("A", 1000)
+	b := strings.Repeat("B", 1000)
+	c := strings.Repeat("C", 1000)
+	orig := []byte(a + b + c)
+	data := multiBlockStream(t, a, b, c)
+	streams, err := ReadStreamInfo(bytes.NewReader(data),
+		int64(len(data)))
+	if err != nil {
+		t.Fatalf("ReadStreamInfo error %s", err)
+	}
+	blocks := streams[0].Blocks
+	sizes := []int{1, 7, 4096}
+
+	// The data of the block is returned before its checksum error.
+	d := append([]byte(nil), data...)
+	d[blocks[1].Offset+blocks[1].TotalSize()-1] ^= 0xff
+	for _, size := range sizes {
+		r, err := NewReader(bytes.NewReader(d))
+		if err != nil {
+			t.Fatalf("NewReader error %s", err)
+		}
+		out, err := readChunks(r, size)
+		if err == io.EOF ||
+			Backend == "go" && !errors.Is(err, ErrChecksum) {
+			t.Fatalf("got error %v; want %v", err, ErrChecksum)
+		}
+		if string(out) != a+b {
+			t.Fatalf("buffer size %d: read %d bytes; want %d",
+				size, len(out), len(a+b))
+		}
+	}
+
+	prev := 0
+	for n := HeaderLen; n < len(data); n++ {
+		want := -1
+		for _, size := range sizes {
+			r, err := NewReader(bytes.NewReader(data[:n]))
+			if err != nil {
+				t.Fatalf("NewReader error %s", err)
+			}
+			out, err := readChunks(r, size)
+			if !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Fatalf("file truncated to %d bytes: got "+
+					"error %v; want %v", n, err,
+					io.ErrUnexpectedEOF)
+			}
+			if !bytes.HasPrefix(orig, out) {
+				t.Fatalf("file truncated to %d bytes: output "+
+					"is not a prefix of the original", n)
+			}
+			if want < 0 {
+				want = len(out)
+			} else if len(out) != want {
+				t.Fatalf("file truncated to %d bytes: "+
+					"read %d bytes with buffer size %d; "+
+					"want %d", n, len(out), size, want)
+			}
+		}
+		if want < prev {
+			t.Fatalf("file truncated to %d bytes: read %d bytes; "+
+				"want at least %d", n, want, prev)
+		}
+		prev = want
+		if n >= int(blocks[1].Offset) && want < len(a) {
+			t.Fatalf("file truncated to %d bytes: read %d bytes; "+
+				"want at least the first block", n, want)
+		}
+	}
+}
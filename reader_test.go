@@ -6,10 +6,16 @@ package xz
 
 import (
 	"bytes"
+	"errors"
+	"hash/crc32"
 	"io"
 	"io/ioutil"
 	"os"
+	"runtime"
+	"strconv"
 	"testing"
+
+	"github.com/ulikunitz/xz/lzma"
 )
 
 func TestReaderSimple(t *testing.T) {
@@ -50,9 +56,23 @@ func TestReaderSingleStream(t *testing.T) {
 	if err != nil {
 		t.Fatalf("NewReader error %s", err)
 	}
-	if _, err = io.Copy(&buf, r); err != errUnexpectedData {
+	if _, err = io.Copy(&buf, r); !errors.Is(err, errUnexpectedData) {
 		t.Fatalf("io.Copy returned %v; want %v", err, errUnexpectedData)
 	}
+
+	buf.Reset()
+	data = append(data, "trailing garbage"...)
+	rc.IgnoreTrailingData = true
+	r, err = rc.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	if _, err = io.Copy(&buf, r); err != nil {
+		t.Fatalf("io.Copy with IgnoreTrailingData error %s", err)
+	}
+	if buf.String() != "The quick brown fox jumps over the lazy dog.\n" {
+		t.Fatalf("unexpected data %q", buf.String())
+	}
 }
 
 func TestReaaderMultipleStreams(t *testing.T) {
@@ -79,3 +99,312 @@ func TestReaaderMultipleStreams(t *testing.T) {
 		t.Fatalf("io.Copy error %s", err)
 	}
 }
+
+func TestReaderMultistream(t *testing.T) {
+	if Backend != "go" {
+		t.Skip("the backend reads ahead")
+	}
+	data, err := ioutil.ReadFile("fox.xz")
+	if err != nil {
+		t.Fatalf("ReadFile error %s", err)
+	}
+	const text = "The quick brown fox jumps over the lazy dog.\n"
+	m := make([]byte, 0, 2*len(data)+4)
+	m = append(m, data...)
+	m = append(m, 0, 0, 0, 0)
+	m = append(m, data...)
+	xz := bytes.NewReader(m)
+	r, err := NewReader(xz)
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	r.Multistream(false)
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll error %s", err)
+	}
+	if string(out) != text {
+		t.Fatalf("got %q; want %q", out, text)
+	}
+	if n := len(m) - xz.Len(); n != len(data) {
+		t.Fatalf("reader consumed %d bytes; want %d", n, len(data))
+	}
+	if _, err = r.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("Read after end of stream returned %v; want %v",
+			err, io.EOF)
+	}
+
+	// skip the stream padding and read the next stream
+	if _, err = xz.Seek(4, io.SeekCurrent); err != nil {
+		t.Fatalf("Seek error %s", err)
+	}
+	if err = r.Reset(xz); err != nil {
+		t.Fatalf("Reset error %s", err)
+	}
+	if out, err = ioutil.ReadAll(r); err != nil {
+		t.Fatalf("ReadAll after Reset error %s", err)
+	}
+	if string(out) != text {
+		t.Fatalf("got %q after Reset; want %q", out, text)
+	}
+	if xz.Len() != 0 {
+		t.Fatalf("%d bytes left after second stream", xz.Len())
+	}
+}
+
+// errSource is returned by failingReader.
+var errSource = errors.New("source failed")
+
+// failingReader returns errSource after the first n bytes.
+type failingReader struct {
+	data []byte
+	n    int
+}
+
+func (r *failingReader) Read(p []byte) (n int, err error) {
+	if r.n <= 0 {
+		return 0, errSource
+	}
+	if len(p) > r.n {
+		p = p[:r.n]
+	}
+	n = copy(p, r.data)
+	r.data = r.data[n:]
+	r.n -= n
+	return n, nil
+}
+
+func TestReaderErrorKinds(t *testing.T) {
+	data, err := ioutil.ReadFile("fox.xz")
+	if err != nil {
+		t.Fatalf("ReadFile error %s", err)
+	}
+	r, err := NewReader(&failingReader{data: data, n: len(data) - 8})
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	_, err = ioutil.ReadAll(r)
+	if !errors.Is(err, ErrIO) || !errors.Is(err, errSource) ||
+		errors.Is(err, ErrCorrupt) {
+		t.Fatalf("source error %q not classified as ErrIO", err)
+	}
+
+	if r, err = NewReader(bytes.NewReader(data[:len(data)-8])); err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	_, err = ioutil.ReadAll(r)
+	if !errors.Is(err, ErrCorrupt) || errors.Is(err, ErrIO) {
+		t.Fatalf("truncation error %q not classified as ErrCorrupt",
+			err)
+	}
+}
+
+func TestReaderDictCapLimit(t *testing.T) {
+	data, err := ioutil.ReadFile("fox.xz")
+	if err != nil {
+		t.Fatalf("ReadFile error %s", err)
+	}
+	cfg := ReaderConfig{DictCapLimit: 4096}
+	r, err := cfg.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	_, err = ioutil.ReadAll(r)
+	var e *lzma.DictCapLimitError
+	if !errors.As(err, &e) {
+		t.Fatalf("ReadAll returned error %v; want DictCapLimitError",
+			err)
+	}
+
+	cfg = ReaderConfig{DictCap: 1 << 20, DictCapLimit: 4096}
+	if err = cfg.Verify(); err == nil {
+		t.Fatal("Verify accepted DictCap larger than DictCapLimit")
+	}
+}
+
+// setCheckType changes the check type in the header and footer of the
+// single xz stream in data. The CRC-32 values are updated.
+func setCheckType(data []byte, flags byte) {
+	data[7] = flags
+	putUint32LE(data[8:], crc32.ChecksumIEEE(data[6:8]))
+	f := data[len(data)-footerLen:]
+	f[9] = flags
+	putUint32LE(f, crc32.ChecksumIEEE(f[4:10]))
+}
+
+// padBlockHeader extends the header of the first block of the single
+// xz stream in data by 4 bytes of padding.
+func padBlockHeader(t *testing.T, data []byte) []byte {
+	var f footer
+	if err := f.UnmarshalBinary(data[len(data)-footerLen:]); err != nil {
+		t.Fatalf("footer UnmarshalBinary error %s", err)
+	}
+	indexStart := int64(len(data)-footerLen) - f.indexSize
+	records, _, err := readIndexBody(
+		bytes.NewReader(data[indexStart+1:]), -1)
+	if err != nil {
+		t.Fatalf("readIndexBody error %s", err)
+	}
+	records[0].unpaddedSize += 4
+
+	hlen := (int(data[HeaderLen]) + 1) * 4
+	bh := make([]byte, hlen+4)
+	copy(bh, data[HeaderLen:HeaderLen+hlen-4])
+	bh[0]++
+	putUint32LE(bh[hlen:], crc32.ChecksumIEEE(bh[:hlen]))
+
+	var buf bytes.Buffer
+	buf.Write(data[:HeaderLen])
+	buf.Write(bh)
+	buf.Write(data[HeaderLen+hlen : indexStart])
+	n, err := writeIndex(&buf, records)
+	if err != nil {
+		t.Fatalf("writeIndex error %s", err)
+	}
+	p, err := (&footer{indexSize: n, flags: f.flags}).MarshalBinary()
+	if err != nil {
+		t.Fatalf("footer MarshalBinary error %s", err)
+	}
+	buf.Write(p)
+	return buf.Bytes()
+}
+
+func TestReaderTruncated(t *testing.T) {
+	data, err := ioutil.ReadFile("fox.xz")
+	if err != nil {
+		t.Fatalf("ReadFile error %s", err)
+	}
+	for n := 0; n < len(data); n++ {
+		r, err := NewReader(bytes.NewReader(data[:n]))
+		if err == nil {
+			_, err = ioutil.ReadAll(r)
+		}
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("file truncated to %d bytes: got error %v; "+
+				"want %v", n, err, io.ErrUnexpectedEOF)
+		}
+	}
+}
+
+func TestReaderLargeDictCap(t *testing.T) {
+	if Backend != "go" {
+		t.Skip("allocations of liblzma are not visible")
+	}
+	data, err := ioutil.ReadFile("fox.xz")
+	if err != nil {
+		t.Fatalf("ReadFile error %s", err)
+	}
+	// dictionary capacity 1 GiB in the LZMA2 filter
+	data[16] = 36
+	putUint32LE(data[20:], crc32.ChecksumIEEE(data[12:20]))
+
+	var m1, m2 runtime.MemStats
+	runtime.ReadMemStats(&m1)
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	if _, err = ioutil.ReadAll(r); err != nil {
+		t.Fatalf("ReadAll error %s", err)
+	}
+	runtime.ReadMemStats(&m2)
+	if n := m2.TotalAlloc - m1.TotalAlloc; n > 16<<20 {
+		t.Fatalf("decoding allocated %d bytes", n)
+	}
+}
+
+func TestReaderDefaultDictCapLimit(t *testing.T) {
+	data, err := ioutil.ReadFile("fox.xz")
+	if err != nil {
+		t.Fatalf("ReadFile error %s", err)
+	}
+	// dictionary capacity 3 GiB in the LZMA2 filter
+	data[16] = 39
+	putUint32LE(data[20:], crc32.ChecksumIEEE(data[12:20]))
+
+	r, err := NewReader(bytes.NewReader(data))
+	if err == nil {
+		_, err = ioutil.ReadAll(r)
+	}
+	if !errors.Is(err, ErrDictTooLarge) {
+		t.Fatalf("ReadAll returned error %v; want ErrDictTooLarge", err)
+	}
+	var e *lzma.DictCapLimitError
+	if errors.As(err, &e) && Backend == "go" && e.DictCap != 3<<30 {
+		t.Fatalf("DictCap is %d; want %d", e.DictCap, int64(3<<30))
+	}
+	_, err = VerifyStructure(bytes.NewReader(data), int64(len(data)))
+	if !errors.Is(err, ErrDictTooLarge) {
+		t.Fatalf("VerifyStructure returned error %v; "+
+			"want ErrDictTooLarge", err)
+	}
+}
+
+func TestReaderDictCapPlatformLimit(t *testing.T) {
+	if Backend != "go" {
+		t.Skip("the liblzma backend has its own limits")
+	}
+	data, err := ioutil.ReadFile("fox.xz")
+	if err != nil {
+		t.Fatalf("ReadFile error %s", err)
+	}
+	// dictionary capacity 3 GiB in the LZMA2 filter
+	data[16] = 39
+	putUint32LE(data[20:], crc32.ChecksumIEEE(data[12:20]))
+
+	r, err := ReaderConfig{DictCapLimit: -1}.NewReader(
+		bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	out, err := ioutil.ReadAll(r)
+	if strconv.IntSize == 32 {
+		if !errors.Is(err, ErrUnsupported) {
+			t.Fatalf("ReadAll returned error %v; "+
+				"want ErrUnsupported", err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("ReadAll error %s", err)
+	}
+	const want = "The quick brown fox jumps over the lazy dog.\n"
+	if string(out) != want {
+		t.Fatalf("got %q; want %q", out, want)
+	}
+}
+
+// readChunks reads r with reads of the given size until an error
+// occurs.
+func readChunks(r io.Reader, size int) (data []byte, err error) {
+	p := make([]byte, size)
+	for {
+		n, err := r.Read(p)
+		data = append(data, p[:n]...)
+		if err != nil {
+			return data, err
+		}
+	}
+}
+
+func TestReaderConfigVerifyErrors(t *testing.T) {
+	tests := []struct {
+		c    ReaderConfig
+		want string
+	}{
+		{ReaderConfig{DictCap: 16 << 20, DictCapLimit: 8 << 20},
+			"xz: DictCap 16 MiB exceeds DictCapLimit 8 MiB"},
+		{ReaderConfig{DictCap: 1000},
+			"xz: DictCap 1000 bytes not in [4 KiB, 4294967295 bytes]"},
+	}
+	for _, tc := range tests {
+		err := tc.c.Verify()
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("Verify error %v; want %s", err, tc.want)
+		}
+		if _, err = tc.c.NewReader(bytes.NewReader(nil)); err == nil ||
+			err.Error() != tc.want {
+			t.Errorf("NewReader error %v; want %s", err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import "io"
+
+// readSeekerAt provides the io.ReaderAt interface for an io.ReadSeeker.
+// The offsets are relative to base.
+type readSeekerAt struct {
+	rs   io.ReadSeeker
+	base int64
+}
+
+// ReadAt seeks to the offset and reads len(p) bytes.
+func (r *readSeekerAt) ReadAt(p []byte, off int64) (n int, err error) {
+	if _, err = r.rs.Seek(r.base+off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err = io.ReadFull(r.rs, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// readIndex reads the stream information of the xz data starting at
+// the current position of rs. The position is restored afterwards. The
+// offsets of the streams and blocks are relative to the position, which
+// is the base of the returned readSeekerAt.
+func readIndex(rs io.ReadSeeker) (sa *readSeekerAt, streams []StreamInfo,
+	err error) {
+	base, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, nil, err
+	}
+	end, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, nil, err
+	}
+	sa = &readSeekerAt{rs: rs, base: base}
+	streams, err = ReadStreamInfo(sa, end-base)
+	if _, serr := rs.Seek(base, io.SeekStart); err == nil {
+		err = serr
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return sa, streams, nil
+}
+
+// Streams returns the stream information read by NewReader if ReadIndex
+// has been set and the underlying reader supports io.Seeker. It is nil
+// otherwise. The offsets are relative to the position of the underlying
+// reader when NewReader was called.
+func (r *Reader) Streams() []StreamInfo {
+	return r.streams
+}
+
+// Size returns the size of the uncompressed data as recorded in the
+// index or -1 if the index hasn't been read. Only the first stream is
+// included if SingleStream is set.
+func (r *Reader) Size() int64 {
+	if len(r.streams) == 0 {
+		return -1
+	}
+	if r.SingleStream {
+		return r.streams[0].UncompressedSize
+	}
+	var n int64
+	for _, s := range r.streams {
+		n += s.UncompressedSize
+	}
+	return n
+}
+
+// Progress returns the fraction of the uncompressed data returned by
+// Read so far. It is -1 if the size is unknown and 1 for empty data.
+func (r *Reader) Progress() float64 {
+	size := r.Size()
+	if size < 0 {
+		return -1
+	}
+	if size == 0 {
+		return 1
+	}
+	return float64(r.n) / float64(size)
+}
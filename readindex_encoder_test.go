@@ -0,0 +1,81 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package xz
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestReaderReadIndex(t *testing.T) {
+	text := strings.Repeat("The quick brown fox jumps over the lazy dog.\n",
+		100)
+	var buf bytes.Buffer
+	buf.WriteString("junk")
+	w, err := NewWriter(&buf, WithBlockSize(1000))
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	if _, err = io.WriteString(w, text); err != nil {
+		t.Fatalf("WriteString error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("w.Close error %s", err)
+	}
+	data := buf.Bytes()
+
+	xz := bytes.NewReader(data)
+	if _, err = xz.Seek(4, io.SeekStart); err != nil {
+		t.Fatalf("Seek error %s", err)
+	}
+	r, err := NewReader(xz, WithReadIndex())
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	if n := r.Size(); n != int64(len(text)) {
+		t.Fatalf("Size is %d; want %d", n, len(text))
+	}
+	streams := r.Streams()
+	if len(streams) != 1 || len(streams[0].Blocks) != 5 ||
+		streams[0].Offset != 0 {
+		t.Fatalf("unexpected streams %+v", streams)
+	}
+	if _, err = io.CopyN(ioutil.Discard, r, int64(len(text)/2)); err != nil {
+		t.Fatalf("CopyN error %s", err)
+	}
+	if p := r.Progress(); p != 0.5 {
+		t.Fatalf("Progress is %g; want 0.5", p)
+	}
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll error %s", err)
+	}
+	if string(out) != text[len(text)/2:] {
+		t.Fatalf("uncompressed data differs")
+	}
+
+	// the index isn't read without io.Seeker
+	r, err = NewReader(bytes.NewBuffer(data[4:]), WithReadIndex())
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	if r.Size() != -1 || r.Progress() != -1 || r.Streams() != nil {
+		t.Fatalf("index read without io.Seeker")
+	}
+
+	// a corrupt index is reported by NewReader
+	corrupt := append([]byte(nil), data[4:]...)
+	corrupt[len(corrupt)-footerLen-2] ^= 0xff
+	_, err = NewReader(bytes.NewReader(corrupt), WithReadIndex())
+	if err == nil {
+		t.Fatalf("NewReader accepted corrupt index")
+	}
+}
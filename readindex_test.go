@@ -0,0 +1,42 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+func TestReaderConfigReadIndex(t *testing.T) {
+	c := ReaderConfig{ReadIndex: true, SkipLeadingGarbage: true}
+	if err := c.Verify(); err == nil {
+		t.Fatalf("Verify accepted ReadIndex with SkipLeadingGarbage")
+	}
+	c = ReaderConfig{ReadIndex: true, Recover: true}
+	if err := c.Verify(); err == nil {
+		t.Fatalf("Verify accepted ReadIndex with Recover")
+	}
+}
+
+func TestReadIndexOverflow(t *testing.T) {
+	data, err := ioutil.ReadFile(
+		"testdata/bad-3-index-uncomp-overflow.xz")
+	if err != nil {
+		t.Fatalf("ReadFile error %s", err)
+	}
+	c := ReaderConfig{ReadIndex: true}
+	if _, err = c.NewReader(bytes.NewReader(data)); !errors.Is(err,
+		ErrIndex) {
+		t.Fatalf("NewReader returned error %v; want ErrIndex", err)
+	}
+	_, err = ReaderConfig{}.VerifyStructure(bytes.NewReader(data),
+		int64(len(data)))
+	if !errors.Is(err, ErrIndex) {
+		t.Fatalf("VerifyStructure returned error %v; want ErrIndex",
+			err)
+	}
+}
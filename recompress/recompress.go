@@ -0,0 +1,142 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+// Package recompress converts compressed data into the xz format. The
+// input format is detected automatically. Supported are gzip and bzip2
+// using the decompressors of the standard library as well as xz,
+// LZMA_Alone and lzip. The package is intended for jobs migrating
+// archives to xz.
+package recompress
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"io"
+
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzip"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// ErrUnknownFormat indicates that the format of the input is not
+// supported.
+var ErrUnknownFormat = errors.New("recompress: unknown input format")
+
+// Config defines the parameters for the xz output. Level is the
+// compression level as used by xz.NewWriterLevel; since the zero value
+// is a valid level, xz.DefaultCompression must be given for the default
+// level. Workers gives the number of go routines compressing blocks in
+// parallel. ReaderConfig is used for xz input.
+type Config struct {
+	Level        int
+	Workers      int
+	ReaderConfig xz.ReaderConfig
+}
+
+// Result describes a conversion.
+type Result struct {
+	// Format of the input: gzip, bzip2, xz, lzma or lzip.
+	Format string
+	// UncompressedSize is the size of the uncompressed data.
+	UncompressedSize int64
+	// Size of the xz output.
+	Size int64
+}
+
+// gzipMagic and bzip2Magic start the gzip and bzip2 formats.
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+)
+
+// newReader detects the format of the input and returns the
+// decompressing reader.
+func (c *Config) newReader(br *bufio.Reader) (format string, r io.Reader,
+	err error) {
+
+	head, err := br.Peek(4)
+	if err != nil && err != io.EOF {
+		return "", nil, err
+	}
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		zr, err := gzip.NewReader(br)
+		return "gzip", zr, err
+	case bytes.HasPrefix(head, bzip2Magic) && len(head) == 4 &&
+		'1' <= head[3] && head[3] <= '9':
+		return "bzip2", bzip2.NewReader(br), nil
+	}
+	f, _, err := xz.DetectFormat(br)
+	if err != nil {
+		return "", nil, err
+	}
+	switch f {
+	case xz.XZ:
+		r, err = c.ReaderConfig.NewReader(br)
+	case xz.LZMAAlone:
+		r, err = lzma.NewReader(br)
+	case xz.LZIP:
+		r, err = lzip.NewReader(br)
+	default:
+		return "", nil, ErrUnknownFormat
+	}
+	return f.String(), r, err
+}
+
+// countingWriter counts the bytes written.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+// Write writes the data to the underlying writer.
+func (w *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// Recompress converts the input to xz using the default compression
+// level and a single go routine.
+func Recompress(dst io.Writer, src io.Reader) (*Result, error) {
+	return Config{Level: xz.DefaultCompression}.Recompress(dst, src)
+}
+
+// Recompress detects the format of the compressed data read from src,
+// decompresses it and writes it as xz stream to dst.
+func (c Config) Recompress(dst io.Writer, src io.Reader) (*Result,
+	error) {
+
+	wc, err := xz.LevelConfig(c.Level)
+	if err != nil {
+		return nil, err
+	}
+	wc.Workers = c.Workers
+	if err = wc.Verify(); err != nil {
+		return nil, err
+	}
+	format, r, err := c.newReader(bufio.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	cw := &countingWriter{w: dst}
+	w, err := wc.NewWriter(cw)
+	if err != nil {
+		return nil, err
+	}
+	n, err := io.Copy(w, r)
+	if err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return &Result{Format: format, UncompressedSize: n, Size: cw.n}, nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package recompress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzip"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+const fox = "The quick brown fox jumps over the lazy dog.\n"
+
+// compressWith compresses fox using the writer returned by newWriter.
+func compressWith(t *testing.T,
+	newWriter func(w io.Writer) (io.WriteCloser, error)) []byte {
+
+	var buf bytes.Buffer
+	w, err := newWriter(&buf)
+	if err != nil {
+		t.Fatalf("newWriter error %s", err)
+	}
+	if _, err = io.WriteString(w, fox); err != nil {
+		t.Fatalf("WriteString error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("Close error %s", err)
+	}
+	return buf.Bytes()
+}
+
+func TestRecompress(t *testing.T) {
+	bz2, err := ioutil.ReadFile("testdata/fox.bz2")
+	if err != nil {
+		t.Fatalf("ReadFile error %s", err)
+	}
+	inputs := map[string][]byte{
+		"bzip2": bz2,
+		"gzip": compressWith(t, func(w io.Writer) (io.WriteCloser,
+			error) {
+			return gzip.NewWriter(w), nil
+		}),
+		"xz": compressWith(t, func(w io.Writer) (io.WriteCloser,
+			error) {
+			return xz.NewWriter(w)
+		}),
+		"lzma": compressWith(t, func(w io.Writer) (io.WriteCloser,
+			error) {
+			return lzma.NewWriter(w)
+		}),
+		"lzip": compressWith(t, func(w io.Writer) (io.WriteCloser,
+			error) {
+			return lzip.NewWriter(w)
+		}),
+	}
+	for format, data := range inputs {
+		var buf bytes.Buffer
+		cfg := Config{Level: 1, Workers: 2}
+		res, err := cfg.Recompress(&buf, bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: Recompress error %s", format, err)
+		}
+		if res.Format != format {
+			t.Errorf("detected format %s; want %s", res.Format,
+				format)
+		}
+		if res.UncompressedSize != int64(len(fox)) {
+			t.Errorf("%s: uncompressed size %d; want %d", format,
+				res.UncompressedSize, len(fox))
+		}
+		if res.Size != int64(buf.Len()) {
+			t.Errorf("%s: size %d; want %d", format, res.Size,
+				buf.Len())
+		}
+		r, err := xz.NewReader(&buf)
+		if err != nil {
+			t.Fatalf("xz.NewReader error %s", err)
+		}
+		out, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("ReadAll error %s", err)
+		}
+		if string(out) != fox {
+			t.Errorf("%s: got %q; want %q", format, out, fox)
+		}
+	}
+}
+
+func TestRecompressUnknown(t *testing.T) {
+	_, err := Recompress(ioutil.Discard, bytes.NewReader([]byte(fox)))
+	if err != ErrUnknownFormat {
+		t.Fatalf("Recompress returned %v; want %v", err,
+			ErrUnknownFormat)
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"io"
+)
+
+// SkippedRange describes a damaged part of the compressed data that
+// the reader skipped in recovery mode.
+type SkippedRange struct {
+	// Offset is the position of the damaged block or stream header
+	// in the file.
+	Offset int64
+	// Size is the number of compressed bytes skipped.
+	Size int64
+	// UncompressedOffset is the position in the uncompressed data at
+	// which the data of the skipped range is missing.
+	UncompressedOffset int64
+	// Err is the error that caused the skip. It is usually a
+	// *DecodeError.
+	Err error
+}
+
+// pushbackReader allows to return data to the reader, so that it is
+// read again. It records the first error of the underlying reader
+// other than io.EOF, which must not be handled by recovery.
+type pushbackReader struct {
+	r   io.Reader
+	buf []byte
+	err error
+}
+
+// Read reads the data pushed back first.
+func (pr *pushbackReader) Read(p []byte) (n int, err error) {
+	if len(pr.buf) > 0 {
+		n = copy(p, pr.buf)
+		pr.buf = pr.buf[n:]
+		return n, nil
+	}
+	n, err = pr.r.Read(p)
+	if err != nil && err != io.EOF && pr.err == nil {
+		pr.err = err
+	}
+	return n, err
+}
+
+// unread puts p in front of the data to read.
+func (pr *pushbackReader) unread(p []byte) {
+	pr.buf = append(append([]byte(nil), p...), pr.buf...)
+}
+
+// Candidates found by the scan for resynchronization.
+const (
+	noCandidate = iota
+	blockCandidate
+	streamCandidate
+)
+
+// resyncCandidate checks whether p starts with a valid stream header
+// or, if blocks is set, with a valid block header. More data is
+// required for a block header if the function returns noCandidate and
+// need is larger than len(p).
+func resyncCandidate(p []byte, blocks bool) (kind int, need int) {
+	if len(p) < HeaderLen {
+		return noCandidate, HeaderLen
+	}
+	var h header
+	if h.UnmarshalBinary(p[:HeaderLen]) == nil {
+		return streamCandidate, HeaderLen
+	}
+	if !blocks || p[0] == 0 || p[1]&reservedBlockFlags != 0 {
+		return noCandidate, 0
+	}
+	n := (int(p[0]) + 1) * 4
+	if len(p) < n {
+		return noCandidate, n
+	}
+	var bh blockHeader
+	if bh.UnmarshalBinary(p[:n]) != nil {
+		return noCandidate, 0
+	}
+	return blockCandidate, n
+}
+
+// resyncBufLen is the size of the reads while scanning the input for
+// the next block or stream.
+const resyncBufLen = 1 << 16
+
+// recover handles the error err detected after n bytes have been
+// returned by the current call of read. It skips the input until the
+// next valid block header of the current stream or the next stream
+// header. The skipped range is recorded. The function returns nil if
+// reading can continue and io.EOF if the end of the input has been
+// reached. Errors of the underlying reader are returned unchanged.
+func (r *Reader) recover(err error, n int) error {
+	if r.pr.err != nil {
+		return err
+	}
+	e := r.decodeError(err)
+	if de, ok := e.(*DecodeError); ok {
+		de.UncompressedOffset += int64(n)
+	}
+	pos := r.offset + r.xz.n
+	s := SkippedRange{
+		Offset:             pos,
+		UncompressedOffset: r.n + int64(n),
+		Err:                e,
+	}
+	blocks := r.sr != nil
+	if blocks {
+		s.Offset = r.sr.offset
+	} else {
+		s.Offset = r.streamOffset
+	}
+
+	// Blocks and streams start at offsets that are multiples of four
+	// relative to the first stream.
+	var buf []byte
+	i := int((r.offset - pos) & 3)
+	eof := false
+	p := make([]byte, resyncBufLen)
+	for {
+		kind, need := noCandidate, 1
+		if i < len(buf) {
+			kind, need = resyncCandidate(buf[i:], blocks)
+		}
+		if kind == noCandidate && need > len(buf)-i && !eof {
+			k, err := r.xz.Read(p)
+			buf = append(buf, p[:k]...)
+			if err == io.EOF {
+				eof = true
+			} else if err != nil {
+				return err
+			}
+			continue
+		}
+		if kind == noCandidate && i < len(buf) {
+			i += 4
+			// discard the bytes scanned
+			if i >= resyncBufLen {
+				buf = append(buf[:0], buf[i:]...)
+				i = 0
+			}
+			continue
+		}
+		if i > len(buf) {
+			i = len(buf)
+		}
+		r.pr.unread(buf[i:])
+		r.xz.n -= int64(len(buf) - i)
+		s.Size = r.offset + r.xz.n - s.Offset
+		r.skipped = append(r.skipped, s)
+		switch kind {
+		case blockCandidate:
+			sr := r.sr
+			sr.br = nil
+			sr.inBlock = false
+			sr.damaged = true
+			sr.offset = r.offset + r.xz.n
+			sr.uncompressedOffset = r.n + int64(n)
+		case streamCandidate:
+			if r.sr != nil {
+				r.sr = nil
+				r.stream++
+			}
+		default:
+			r.sr = nil
+			return io.EOF
+		}
+		return nil
+	}
+}
+
+// Skipped returns the ranges of the compressed data that have been
+// skipped in recovery mode.
+func (r *Reader) Skipped() []SkippedRange {
+	return r.skipped
+}
@@ -0,0 +1,165 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package xz
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// multiBlockStream creates an xz stream with a block for every part.
+func multiBlockStream(t *testing.T, parts ...string) []byte {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	for _, p := range parts {
+		if _, err = io.WriteString(w, p); err != nil {
+			t.Fatalf("WriteString error %s", err)
+		}
+		if err = w.EndBlock(); err != nil {
+			t.Fatalf("EndBlock error %s", err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("w.Close error %s", err)
+	}
+	return buf.Bytes()
+}
+
+func TestReaderRecover(t *testing.T) {
+	a := strings.Repeat("A", 100)
+	b := strings.Repeat("B", 100)
+	c := strings.Repeat("C", 100)
+	data := multiBlockStream(t, a, b, c)
+	streams, err := ReadStreamInfo(bytes.NewReader(data),
+		int64(len(data)))
+	if err != nil {
+		t.Fatalf("ReadStreamInfo error %s", err)
+	}
+	blocks := streams[0].Blocks
+	n := int64(len(data))
+	tests := []struct {
+		name    string
+		data    []byte
+		pos     int64
+		want    string
+		skipped []SkippedRange
+	}{
+		{
+			name: "undamaged",
+			data: data,
+			pos:  -1,
+			want: a + b + c,
+		},
+		{
+			name: "block data",
+			data: data,
+			pos:  blocks[1].Offset + 18,
+			want: a + c,
+			skipped: []SkippedRange{{
+				Offset:             blocks[1].Offset,
+				Size:               blocks[1].TotalSize(),
+				UncompressedOffset: 100,
+			}},
+		},
+		{
+			name: "block header",
+			data: data,
+			pos:  blocks[1].Offset + 3,
+			want: a + c,
+			skipped: []SkippedRange{{
+				Offset:             blocks[1].Offset,
+				Size:               blocks[1].TotalSize(),
+				UncompressedOffset: 100,
+			}},
+		},
+		{
+			name: "stream header",
+			data: append(append([]byte(nil), data...), data...),
+			pos:  5,
+			want: a + b + c,
+			skipped: []SkippedRange{{
+				Offset: 0,
+				Size:   n,
+			}},
+		},
+		{
+			name: "last block and second stream",
+			data: append(append([]byte(nil), data...), data...),
+			pos:  blocks[2].Offset + 8,
+			want: a + b + a + b + c,
+			skipped: []SkippedRange{{
+				Offset:             blocks[2].Offset,
+				Size:               n - blocks[2].Offset,
+				UncompressedOffset: 200,
+			}},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			d := append([]byte(nil), tc.data...)
+			if tc.pos >= 0 {
+				d[tc.pos] ^= 0x55
+			}
+			r, err := ReaderConfig{Recover: true}.NewReader(
+				bytes.NewReader(d))
+			if err != nil {
+				t.Fatalf("NewReader error %s", err)
+			}
+			out, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatalf("ReadAll error %s", err)
+			}
+			if string(out) != tc.want {
+				t.Fatalf("got %q; want %q", out, tc.want)
+			}
+			skipped := r.Skipped()
+			if len(skipped) != len(tc.skipped) {
+				t.Fatalf("got %d skipped ranges; want %d",
+					len(skipped), len(tc.skipped))
+			}
+			for i, s := range skipped {
+				w := tc.skipped[i]
+				if s.Err == nil {
+					t.Fatalf("skipped range %d has no error", i)
+				}
+				s.Err = nil
+				if s != w {
+					t.Fatalf("skipped range %d is %+v; want %+v",
+						i, s, w)
+				}
+			}
+		})
+	}
+}
+
+func TestReaderRecoverTruncated(t *testing.T) {
+	data := multiBlockStream(t, strings.Repeat("A", 100),
+		strings.Repeat("B", 100))
+	for n := 0; n < len(data); n++ {
+		r, err := ReaderConfig{Recover: true}.NewReader(
+			bytes.NewReader(data[:n]))
+		if err != nil {
+			t.Fatalf("file truncated to %d bytes: NewReader error %s",
+				n, err)
+		}
+		if _, err = ioutil.ReadAll(r); err != nil {
+			t.Fatalf("file truncated to %d bytes: ReadAll error %s",
+				n, err)
+		}
+		if len(r.Skipped()) == 0 {
+			t.Fatalf("file truncated to %d bytes: no skipped range",
+				n)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import "sync"
+
+// SafeReader wraps a Reader for use by multiple goroutines. The methods
+// are serialized by a mutex, so every call of Read returns a contiguous
+// part of the uncompressed data. Which goroutine receives which part
+// depends on the scheduling.
+type SafeReader struct {
+	mu sync.Mutex
+	r  *Reader
+}
+
+// NewSafeReader returns a SafeReader for r. The Reader must not be used
+// directly while the SafeReader is in use.
+func NewSafeReader(r *Reader) *SafeReader {
+	return &SafeReader{r: r}
+}
+
+// Read reads uncompressed data while holding the lock.
+func (s *SafeReader) Read(p []byte) (n int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.r.Read(p)
+}
+
+// Close calls the Close method of the Reader while holding the lock.
+func (s *SafeReader) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.r.Close()
+}
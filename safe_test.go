@@ -0,0 +1,118 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package xz
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSafeWriterReader(t *testing.T) {
+	const goroutines, lines = 8, 200
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, WithBlockSize(4096))
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	sw := NewSafeWriter(w)
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < lines; i++ {
+				line := fmt.Sprintf("goroutine %d line %d\n", g, i)
+				if _, err := io.WriteString(sw, line); err != nil {
+					t.Errorf("WriteString error %s", err)
+					return
+				}
+				if i%50 == 0 {
+					if err := sw.Flush(); err != nil {
+						t.Errorf("Flush error %s", err)
+						return
+					}
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	if err = sw.Close(); err != nil {
+		t.Fatalf("sw.Close error %s", err)
+	}
+	if _, err = sw.Write([]byte("x")); err == nil {
+		t.Fatalf("Write after Close succeeded")
+	}
+
+	// every line must be intact
+	r, err := NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	var got []string
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		got = append(got, s.Text())
+	}
+	if err = s.Err(); err != nil {
+		t.Fatalf("Scan error %s", err)
+	}
+	var want []string
+	for g := 0; g < goroutines; g++ {
+		for i := 0; i < lines; i++ {
+			want = append(want, fmt.Sprintf("goroutine %d line %d",
+				g, i))
+		}
+	}
+	sort.Strings(got)
+	sort.Strings(want)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("lines differ")
+	}
+
+	// the reads of concurrent goroutines add up to the whole data
+	r, err = NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	sr := NewSafeReader(r)
+	var mu sync.Mutex
+	var total int
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p := make([]byte, 100)
+			for {
+				n, err := sr.Read(p)
+				mu.Lock()
+				total += n
+				mu.Unlock()
+				if err == io.EOF {
+					return
+				}
+				if err != nil {
+					t.Errorf("Read error %s", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if err = sr.Close(); err != nil {
+		t.Fatalf("sr.Close error %s", err)
+	}
+	if n := w.UncompressedCount(); int64(total) != n {
+		t.Fatalf("read %d bytes; want %d", total, n)
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package xz
+
+import "sync"
+
+// SafeWriter wraps a Writer for use by multiple goroutines, for
+// instance for a compressed log file shared by the whole application.
+// The methods are serialized by a mutex, so the data of a single Write
+// call is never interleaved with the data of other calls.
+type SafeWriter struct {
+	mu sync.Mutex
+	w  *Writer
+}
+
+// NewSafeWriter returns a SafeWriter for w. The Writer must not be used
+// directly while the SafeWriter is in use.
+func NewSafeWriter(w *Writer) *SafeWriter {
+	return &SafeWriter{w: w}
+}
+
+// Write compresses p while holding the lock.
+func (s *SafeWriter) Write(p []byte) (n int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
+
+// Flush calls the Flush method of the Writer while holding the lock.
+func (s *SafeWriter) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Flush()
+}
+
+// EndBlock calls the EndBlock method of the Writer while holding the
+// lock.
+func (s *SafeWriter) EndBlock() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.EndBlock()
+}
+
+// Close closes the Writer while holding the lock. Writes following
+// Close return an error.
+func (s *SafeWriter) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Close()
+}
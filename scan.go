@@ -0,0 +1,67 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// scanBufLen is the size of the buffer used for scanning.
+const scanBufLen = 32 * 1024
+
+// errNoStream indicates that no xz stream header has been found.
+var errNoStream = errors.New("xz: no xz stream header found")
+
+// scanHeader reads from r until a valid xz stream header has been
+// found. Magic bytes not followed by a valid header are skipped. The
+// returned reader provides the stream starting with the header; offset
+// is the number of bytes skipped. The function reads data in chunks,
+// but the data following the header is not lost, because it is
+// provided by the returned reader.
+func scanHeader(r io.Reader) (sr io.Reader, offset int64, err error) {
+	buf := make([]byte, scanBufLen)
+	var n int
+	for {
+		k, err := io.ReadFull(r, buf[n:])
+		n += k
+		eof := false
+		if err != nil {
+			if err != io.EOF && err != io.ErrUnexpectedEOF {
+				return nil, offset, err
+			}
+			eof = true
+		}
+		i := 0
+		for {
+			j := bytes.Index(buf[i:n], headerMagic)
+			if j < 0 {
+				i = n - (len(headerMagic) - 1)
+				if i < 0 {
+					i = 0
+				}
+				break
+			}
+			i += j
+			if n-i < HeaderLen {
+				break
+			}
+			if ValidHeader(buf[i : i+HeaderLen]) {
+				rest := make([]byte, n-i)
+				copy(rest, buf[i:n])
+				sr = io.MultiReader(bytes.NewReader(rest), r)
+				return sr, offset + int64(i), nil
+			}
+			i++
+		}
+		if eof {
+			return nil, offset, errNoStream
+		}
+		// keep the bytes that might start a header
+		n = copy(buf, buf[i:n])
+		offset += int64(i)
+	}
+}
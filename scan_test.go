@@ -0,0 +1,50 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+)
+
+func TestReaderSkipLeadingGarbage(t *testing.T) {
+	xz, err := ioutil.ReadFile("fox.xz")
+	if err != nil {
+		t.Fatalf("ReadFile error %s", err)
+	}
+	const want = "The quick brown fox jumps over the lazy dog.\n"
+	garbage := make([]byte, 3*scanBufLen+17)
+	rand.New(rand.NewSource(45)).Read(garbage)
+	// magic bytes without valid header at the buffer border
+	copy(garbage[scanBufLen-3:], headerMagic)
+	copy(garbage[2*scanBufLen:], xz[:HeaderLen-1])
+
+	for _, n := range []int{0, 1, scanBufLen - 2, len(garbage)} {
+		data := append(append([]byte{}, garbage[:n]...), xz...)
+		r, err := ReaderConfig{SkipLeadingGarbage: true}.NewReader(
+			bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("garbage %d: NewReader error %s", n, err)
+		}
+		if r.Offset() != int64(n) {
+			t.Fatalf("garbage %d: Offset returned %d", n, r.Offset())
+		}
+		out, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("garbage %d: ReadAll error %s", n, err)
+		}
+		if string(out) != want {
+			t.Fatalf("garbage %d: got %q; want %q", n, out, want)
+		}
+	}
+
+	_, err = ReaderConfig{SkipLeadingGarbage: true}.NewReader(
+		bytes.NewReader(garbage))
+	if err != errNoStream {
+		t.Fatalf("NewReader returned %v; want %v", err, errNoStream)
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+// errBackwardSeek indicates a seek to a position already read.
+var errBackwardSeek = errors.New("xz: backward seek not supported")
+
+// Seek sets the position in the uncompressed data for the next Read.
+// Only forward seeks are supported; seeking to a position before the
+// current one returns an error. The data up to the new position is
+// normally decompressed and discarded. If the index has been read
+// because ReadIndex is set and the underlying reader is an
+// io.ReadSeeker, blocks ending before the new position are skipped
+// without decompressing them. Their checks aren't verified and the
+// Hooks aren't called for them. io.SeekEnd requires the index. Seeking
+// beyond the end of the data returns the size and io.EOF.
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	if r.err != nil {
+		return r.n, r.err
+	}
+	var target int64
+	switch whence {
+	case io.SeekStart:
+		target = offset
+	case io.SeekCurrent:
+		target = r.n + offset
+	case io.SeekEnd:
+		size := r.Size()
+		if size < 0 {
+			return r.n, errors.New(
+				"xz: io.SeekEnd requires the index")
+		}
+		target = size + offset
+	default:
+		return r.n, errors.New("xz: invalid whence")
+	}
+	if target < r.n {
+		return r.n, errBackwardSeek
+	}
+	if err := r.skipBlocks(target); err != nil {
+		addStat(r.Stats, StatErrors, 1)
+		return r.n, r.decodeError(err)
+	}
+	if target > r.n {
+		if _, err := io.CopyN(ioutil.Discard, r, target-r.n); err != nil {
+			return r.n, err
+		}
+	}
+	return r.n, nil
+}
+
+// skipBlocks moves the reader to the start of the block containing the
+// uncompressed position target if the index is available and the block
+// starts after the current position.
+func (r *Reader) skipBlocks(target int64) error {
+	if r.seeker == nil || r.br != nil {
+		return nil
+	}
+	streams := r.streams
+	if r.SingleStream {
+		streams = streams[:1]
+	}
+	if r.single {
+		// don't skip beyond the current stream
+		n := r.stream
+		if r.sr != nil {
+			n++
+		}
+		if n < len(streams) {
+			streams = streams[:n]
+		}
+	}
+	for j := range streams {
+		s := &streams[j]
+		for i, b := range s.Blocks {
+			if b.UncompressedOffset+b.UncompressedSize <= target {
+				continue
+			}
+			if b.UncompressedOffset <= r.n {
+				// the block has already been started
+				return nil
+			}
+			return r.skipTo(j, i)
+		}
+	}
+	return nil
+}
+
+// skipTo moves the reader to the start of block i of stream j. The
+// records of the blocks skipped are taken from the index, so that the
+// index of the stream can still be verified.
+func (r *Reader) skipTo(j, i int) error {
+	s := &r.streams[j]
+	if r.sr == nil || r.sr.stream != j {
+		if err := r.seek(s.Offset); err != nil {
+			return err
+		}
+		r.streamOffset = s.Offset
+		sr, err := r.ReaderConfig.newStreamReader(r.xz)
+		if err != nil {
+			return err
+		}
+		sr.offset = r.xz.n
+		sr.uncompressedOffset = s.UncompressedOffset
+		sr.stream = j
+		sr.blocks = r.blocks
+		sr.dec = &r.dec
+		r.sr = sr
+		r.stream = j
+		r.header.Stream = j
+		r.header.CheckType = sr.h.flags
+	}
+	sr := r.sr
+	for _, b := range s.Blocks[len(sr.index):i] {
+		sr.index = append(sr.index, record{
+			unpaddedSize:     b.UnpaddedSize,
+			uncompressedSize: b.UncompressedSize,
+		})
+	}
+	b := s.Blocks[i]
+	if err := r.seek(b.Offset); err != nil {
+		return err
+	}
+	sr.br = nil
+	sr.inBlock = false
+	sr.offset = b.Offset
+	sr.uncompressedOffset = b.UncompressedOffset
+	r.n = b.UncompressedOffset
+	return nil
+}
+
+// seek moves the underlying reader to the offset relative to the
+// position at which NewReader has been called.
+func (r *Reader) seek(offset int64) error {
+	if _, err := r.seeker.rs.Seek(r.seeker.base+offset,
+		io.SeekStart); err != nil {
+		return err
+	}
+	r.xz.n = offset
+	return nil
+}
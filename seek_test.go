@@ -0,0 +1,174 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package xz
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// seekTestData returns two streams separated by stream padding and
+// the uncompressed text.
+func seekTestData(t *testing.T) (data []byte, text string) {
+	t.Helper()
+	var buf bytes.Buffer
+	for i := 0; i < 2; i++ {
+		var sb strings.Builder
+		for j := 0; j < 200; j++ {
+			fmt.Fprintf(&sb, "stream %d line %d\n", i, j)
+		}
+		s := sb.String()
+		w, err := NewWriter(&buf, WithBlockSize(500))
+		if err != nil {
+			t.Fatalf("NewWriter error %s", err)
+		}
+		if _, err = io.WriteString(w, s); err != nil {
+			t.Fatalf("WriteString error %s", err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("w.Close error %s", err)
+		}
+		if i == 0 {
+			buf.Write(make([]byte, 4))
+		}
+		text += s
+	}
+	return buf.Bytes(), text
+}
+
+// readSeekCounter counts the bytes read from the wrapped reader.
+type readSeekCounter struct {
+	rs io.ReadSeeker
+	n  int64
+}
+
+func (c *readSeekCounter) Read(p []byte) (n int, err error) {
+	n, err = c.rs.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *readSeekCounter) Seek(offset int64, whence int) (int64, error) {
+	return c.rs.Seek(offset, whence)
+}
+
+func TestReaderSeek(t *testing.T) {
+	data, text := seekTestData(t)
+	tests := []struct {
+		offset int64
+		whence int
+		pos    int64
+	}{
+		{100, io.SeekStart, 100},
+		{2000, io.SeekCurrent, 2110},
+		{2120, io.SeekStart, 2120},
+		{3000, io.SeekStart, 3000},
+		{int64(len(text)) - 3000, io.SeekStart, int64(len(text)) - 3000},
+		{-100, io.SeekEnd, int64(len(text)) - 100},
+	}
+	for _, index := range []bool{false, true} {
+		var opts []Option
+		if index {
+			opts = append(opts, WithReadIndex())
+		}
+		src := &readSeekCounter{rs: bytes.NewReader(data)}
+		r, err := NewReader(src, opts...)
+		if err != nil {
+			t.Fatalf("NewReader error %s", err)
+		}
+		p := make([]byte, 10)
+		for _, tc := range tests {
+			if tc.whence == io.SeekEnd && !index {
+				continue
+			}
+			pos, err := r.Seek(tc.offset, tc.whence)
+			if err != nil {
+				t.Fatalf("Seek(%d, %d) error %s", tc.offset,
+					tc.whence, err)
+			}
+			if pos != tc.pos {
+				t.Fatalf("Seek(%d, %d) returned %d; want %d",
+					tc.offset, tc.whence, pos, tc.pos)
+			}
+			if _, err = io.ReadFull(r, p); err != nil {
+				t.Fatalf("ReadFull error %s", err)
+			}
+			if s := text[pos : pos+10]; string(p) != s {
+				t.Fatalf("index %t: read %q at %d; want %q",
+					index, p, pos, s)
+			}
+		}
+		if _, err = r.Seek(0, io.SeekStart); err == nil {
+			t.Fatalf("backward Seek succeeded")
+		}
+		// the index records of the blocks skipped must match
+		if _, err = ioutil.ReadAll(r); err != nil {
+			t.Fatalf("ReadAll error %s", err)
+		}
+		if index && Backend == "go" && src.n >= int64(len(data)) {
+			t.Fatalf("read %d bytes of %d; no block skipped",
+				src.n, len(data))
+		}
+		pos, err := r.Seek(1, io.SeekCurrent)
+		if err != io.EOF || pos != int64(len(text)) {
+			t.Fatalf("Seek beyond end returned %d, %v", pos, err)
+		}
+	}
+}
+
+func TestReaderSeekSkipsBlocks(t *testing.T) {
+	if Backend != "go" {
+		t.Skip("the backend doesn't skip blocks")
+	}
+	data, text := seekTestData(t)
+	streams, err := ReadStreamInfo(bytes.NewReader(data),
+		int64(len(data)))
+	if err != nil {
+		t.Fatalf("ReadStreamInfo error %s", err)
+	}
+	// damage the second block of the second stream, which must not
+	// be read
+	b := streams[1].Blocks[1]
+	corrupt := append([]byte(nil), data...)
+	corrupt[b.Offset+b.UnpaddedSize-1] ^= 0xff
+	target := streams[1].Blocks[2].UncompressedOffset + 5
+	r, err := NewReader(bytes.NewReader(corrupt), WithReadIndex())
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	if _, err = r.Seek(target, io.SeekStart); err != nil {
+		t.Fatalf("Seek error %s", err)
+	}
+	if r.Stream() != 1 {
+		t.Fatalf("Stream is %d; want 1", r.Stream())
+	}
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll error %s", err)
+	}
+	if string(out) != text[target:] {
+		t.Fatalf("uncompressed data differs")
+	}
+
+	// SingleStream stops at the end of the first stream
+	c := ReaderConfig{ReadIndex: true, SingleStream: true,
+		IgnoreTrailingData: true}
+	r, err = c.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	size := streams[0].UncompressedSize
+	pos, err := r.Seek(size+10, io.SeekStart)
+	if err != io.EOF || pos != size {
+		t.Fatalf("Seek returned %d, %v; want %d, EOF", pos, err, size)
+	}
+}
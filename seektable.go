@@ -0,0 +1,305 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+)
+
+// A seek table is a compact description of the blocks of an xz file
+// that can be stored as a sidecar file next to it. It allows random
+// access to the uncompressed data without reading the indexes at the
+// end of the file, which requires a sequence of small reads that are
+// expensive for files on object storage accessed by HTTP range
+// requests.
+//
+// The binary format starts with the magic bytes "xzST" and the format
+// version 1. The size of the xz file and the number of blocks follow
+// as multibyte integers in the format of the xz index. For each block
+// the distance of the block header from the end of the previous block,
+// the unpadded size, the uncompressed size and the check type are
+// stored. The uncompressed offsets are the sums of the uncompressed
+// sizes of the preceding blocks. The table is terminated by the CRC32
+// of all preceding bytes in little-endian order.
+
+// seekTableMagic starts a binary seek table.
+var seekTableMagic = []byte("xzST")
+
+// seekTableVersion is the supported version of the seek table format.
+const seekTableVersion = 1
+
+// SeekEntry describes a single block of the xz file.
+type SeekEntry struct {
+	BlockInfo
+	// CheckSum identifies the check method of the stream containing
+	// the block.
+	CheckSum byte
+}
+
+// SeekTable lists the blocks of an xz file.
+type SeekTable struct {
+	// Size of the xz file.
+	Size int64
+	// Entries are the blocks ordered by their offsets.
+	Entries []SeekEntry
+}
+
+// NewSeekTable creates the seek table from the stream information
+// returned by ReadStreamInfo. The argument size must provide the size
+// of the file.
+func NewSeekTable(streams []StreamInfo, size int64) *SeekTable {
+	t := &SeekTable{Size: size}
+	for _, s := range streams {
+		for _, b := range s.Blocks {
+			t.Entries = append(t.Entries,
+				SeekEntry{BlockInfo: b, CheckSum: s.CheckSum})
+		}
+	}
+	return t
+}
+
+// ReadSeekTable reads the indexes of the xz file and returns the seek
+// table for it. The argument size must provide the size of the file.
+func ReadSeekTable(xz io.ReaderAt, size int64) (*SeekTable, error) {
+	streams, err := ReadStreamInfo(xz, size)
+	if err != nil {
+		return nil, err
+	}
+	return NewSeekTable(streams, size), nil
+}
+
+// UncompressedSize returns the size of the uncompressed data.
+func (t *SeekTable) UncompressedSize() int64 {
+	n := len(t.Entries)
+	if n == 0 {
+		return 0
+	}
+	e := &t.Entries[n-1]
+	return e.UncompressedOffset + e.UncompressedSize
+}
+
+// MarshalBinary encodes the seek table.
+func (t *SeekTable) MarshalBinary() (data []byte, err error) {
+	var buf bytes.Buffer
+	buf.Write(seekTableMagic)
+	buf.WriteByte(seekTableVersion)
+	p := make([]byte, 10)
+	putVarint := func(x int64) {
+		k := putUvarint(p, uint64(x))
+		buf.Write(p[:k])
+	}
+	putVarint(t.Size)
+	putVarint(int64(len(t.Entries)))
+	var end int64
+	for i := range t.Entries {
+		e := &t.Entries[i]
+		if e.Offset < end {
+			return nil, errors.New("xz: seek table entries " +
+				"overlap")
+		}
+		putVarint(e.Offset - end)
+		putVarint(e.UnpaddedSize)
+		putVarint(e.UncompressedSize)
+		buf.WriteByte(e.CheckSum)
+		end = e.Offset + e.TotalSize()
+	}
+	p = p[:4]
+	putUint32LE(p, crc32.ChecksumIEEE(buf.Bytes()))
+	buf.Write(p)
+	return buf.Bytes(), nil
+}
+
+// errSeekTable indicates a malformed seek table.
+var errSeekTable = errors.New("xz: malformed seek table")
+
+// UnmarshalBinary decodes the seek table.
+func (t *SeekTable) UnmarshalBinary(data []byte) error {
+	n := len(data) - 4
+	if n < len(seekTableMagic)+1 {
+		return errSeekTable
+	}
+	if crc32.ChecksumIEEE(data[:n]) != uint32LE(data[n:]) {
+		return errors.New("xz: seek table checksum error")
+	}
+	if !bytes.Equal(data[:len(seekTableMagic)], seekTableMagic) {
+		return errors.New("xz: invalid seek table magic")
+	}
+	if v := data[len(seekTableMagic)]; v != seekTableVersion {
+		return fmt.Errorf("xz: seek table version %d unsupported", v)
+	}
+	r := bytes.NewReader(data[len(seekTableMagic)+1 : n])
+	getVarint := func() (int64, error) {
+		x, _, err := readUvarint(r)
+		if err != nil || x > maxInt64 {
+			return 0, errSeekTable
+		}
+		return int64(x), nil
+	}
+	size, err := getVarint()
+	if err != nil {
+		return err
+	}
+	count, err := getVarint()
+	if err != nil {
+		return err
+	}
+	// each entry requires at least four bytes
+	if count > int64(r.Len())/4 {
+		return errSeekTable
+	}
+	entries := make([]SeekEntry, count)
+	var end, u int64
+	for i := range entries {
+		e := &entries[i]
+		var d int64
+		if d, err = getVarint(); err != nil {
+			return err
+		}
+		if e.UnpaddedSize, err = getVarint(); err != nil {
+			return err
+		}
+		if e.UncompressedSize, err = getVarint(); err != nil {
+			return err
+		}
+		if e.CheckSum, err = r.ReadByte(); err != nil {
+			return errSeekTable
+		}
+		e.Offset = end + d
+		e.UncompressedOffset = u
+		end = e.Offset + e.TotalSize()
+		u += e.UncompressedSize
+		if end > size || end < e.Offset || u < 0 {
+			return errSeekTable
+		}
+	}
+	if r.Len() != 0 {
+		return errSeekTable
+	}
+	t.Size = size
+	t.Entries = entries
+	return nil
+}
+
+// find returns the index of the entry containing the uncompressed
+// offset off. If there is no such entry the number of entries is
+// returned.
+func (t *SeekTable) find(off int64) int {
+	return sort.Search(len(t.Entries), func(i int) bool {
+		e := &t.Entries[i]
+		return off < e.UncompressedOffset+e.UncompressedSize
+	})
+}
+
+// SeekTableReader supports random access to the uncompressed data of an
+// xz file described by a seek table. Only the blocks containing the
+// requested data are read from the xz file. The reader continues the
+// decompression of a block if a read starts where the previous read
+// ended, so that sequential reads are efficient.
+type SeekTableReader struct {
+	ReaderConfig
+
+	xz    io.ReaderAt
+	table *SeekTable
+
+	mu sync.Mutex
+	// reader for the current block
+	br io.Reader
+	// uncompressed position of br
+	pos int64
+	// index of the entry for br
+	i int
+}
+
+// NewSeekTableReader creates a reader for random access using the
+// default configuration.
+func NewSeekTableReader(xz io.ReaderAt, t *SeekTable) (*SeekTableReader,
+	error) {
+	return ReaderConfig{}.NewSeekTableReader(xz, t)
+}
+
+// NewSeekTableReader creates a reader for random access to the
+// uncompressed data of the xz file using the seek table t.
+func (c ReaderConfig) NewSeekTableReader(xz io.ReaderAt, t *SeekTable,
+) (*SeekTableReader, error) {
+	if err := c.Verify(); err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, errors.New("xz: seek table is nil")
+	}
+	return &SeekTableReader{ReaderConfig: c, xz: xz, table: t}, nil
+}
+
+// Size returns the size of the uncompressed data.
+func (r *SeekTableReader) Size() int64 {
+	return r.table.UncompressedSize()
+}
+
+// seek positions the block reader at the uncompressed offset off.
+func (r *SeekTableReader) seek(off int64) error {
+	if r.br != nil && r.pos == off {
+		return nil
+	}
+	i := r.table.find(off)
+	if i >= len(r.table.Entries) {
+		return io.EOF
+	}
+	e := &r.table.Entries[i]
+	if !(r.br != nil && r.i == i && r.pos <= off) {
+		s := StreamInfo{CheckSum: e.CheckSum}
+		br, err := r.ReaderConfig.NewBlockReader(r.xz, &s,
+			&e.BlockInfo)
+		if err != nil {
+			r.br = nil
+			return err
+		}
+		r.br, r.i, r.pos = br, i, e.UncompressedOffset
+	}
+	n, err := io.CopyN(ioutil.Discard, r.br, off-r.pos)
+	r.pos += n
+	if err != nil {
+		r.br = nil
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	return nil
+}
+
+// ReadAt reads the uncompressed data at offset off. It implements the
+// io.ReaderAt interface; parallel calls are serialized.
+func (r *SeekTableReader) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("xz: negative offset")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for n < len(p) {
+		if err = r.seek(off + int64(n)); err != nil {
+			return n, err
+		}
+		k, err := r.br.Read(p[n:])
+		n += k
+		r.pos += int64(k)
+		if err == io.EOF {
+			// the next block will be used
+			r.br = nil
+			continue
+		}
+		if err != nil {
+			r.br = nil
+			return n, err
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,126 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package xz
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/ulikunitz/xz/internal/randtxt"
+)
+
+// newSeekTableFile creates an xz file consisting of two streams with
+// multiple blocks.
+func newSeekTableFile(t *testing.T) (xz []byte, txt []byte) {
+	var tbuf bytes.Buffer
+	io.CopyN(&tbuf, randtxt.NewReader(rand.NewSource(7)), 100000)
+	txt = tbuf.Bytes()
+	var buf bytes.Buffer
+	for _, part := range [][]byte{txt[:30000], txt[30000:]} {
+		w, err := WriterConfig{BlockSize: 8000}.NewWriter(&buf)
+		if err != nil {
+			t.Fatalf("NewWriter error %s", err)
+		}
+		if _, err = w.Write(part); err != nil {
+			t.Fatalf("Write error %s", err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("Close error %s", err)
+		}
+	}
+	return buf.Bytes(), txt
+}
+
+func TestSeekTableMarshal(t *testing.T) {
+	xz, _ := newSeekTableFile(t)
+	st, err := ReadSeekTable(bytes.NewReader(xz), int64(len(xz)))
+	if err != nil {
+		t.Fatalf("ReadSeekTable error %s", err)
+	}
+	if len(st.Entries) < 10 {
+		t.Fatalf("seek table has only %d entries", len(st.Entries))
+	}
+	data, err := st.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary error %s", err)
+	}
+	var st2 SeekTable
+	if err = st2.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary error %s", err)
+	}
+	if st2.Size != st.Size {
+		t.Fatalf("got size %d; want %d", st2.Size, st.Size)
+	}
+	if len(st2.Entries) != len(st.Entries) {
+		t.Fatalf("got %d entries; want %d", len(st2.Entries),
+			len(st.Entries))
+	}
+	for i, e := range st.Entries {
+		if st2.Entries[i] != e {
+			t.Fatalf("entry %d is %+v; want %+v", i,
+				st2.Entries[i], e)
+		}
+	}
+	data[len(data)/2] ^= 1
+	if err = st2.UnmarshalBinary(data); err == nil {
+		t.Fatal("UnmarshalBinary accepted corrupted seek table")
+	}
+}
+
+func TestSeekTableReader(t *testing.T) {
+	xz, txt := newSeekTableFile(t)
+	st, err := ReadSeekTable(bytes.NewReader(xz), int64(len(xz)))
+	if err != nil {
+		t.Fatalf("ReadSeekTable error %s", err)
+	}
+	r, err := NewSeekTableReader(bytes.NewReader(xz), st)
+	if err != nil {
+		t.Fatalf("NewSeekTableReader error %s", err)
+	}
+	if r.Size() != int64(len(txt)) {
+		t.Fatalf("Size returned %d; want %d", r.Size(), len(txt))
+	}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 50; i++ {
+		off := rng.Int63n(int64(len(txt)))
+		p := make([]byte, rng.Intn(20000))
+		n, err := r.ReadAt(p, off)
+		want := txt[off:]
+		if len(want) >= len(p) {
+			want = want[:len(p)]
+		} else if err != io.EOF {
+			t.Fatalf("ReadAt(%d) at end returned error %v",
+				off, err)
+		}
+		if n < len(p) && err == nil {
+			t.Fatalf("ReadAt(%d) returned %d bytes without error",
+				off, n)
+		}
+		if !bytes.Equal(p[:n], want) {
+			t.Fatalf("ReadAt(%d) returned wrong data", off)
+		}
+	}
+	// sequential reads
+	p := make([]byte, 1000)
+	var out []byte
+	for off := int64(0); ; off += int64(len(p)) {
+		n, err := r.ReadAt(p, off)
+		out = append(out, p[:n]...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("ReadAt error %s", err)
+		}
+	}
+	if !bytes.Equal(out, txt) {
+		t.Fatal("sequential reads returned wrong data")
+	}
+}
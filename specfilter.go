@@ -0,0 +1,99 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// deltaFilterID is the ID of the delta filter. The IDs 0x04 to 0x0b
+// identify the BCJ filters.
+const deltaFilterID = 0x03
+
+// specFilterNames maps the IDs of the delta and BCJ filters to their
+// names.
+var specFilterNames = map[uint64]string{
+	deltaFilterID: "delta",
+	0x04:          "x86",
+	0x05:          "PowerPC",
+	0x06:          "IA-64",
+	0x07:          "ARM",
+	0x08:          "ARM-Thumb",
+	0x09:          "SPARC",
+	0x0a:          "ARM64",
+	0x0b:          "RISC-V",
+}
+
+// specFilter represents the delta and BCJ filters, which are defined
+// by the xz specification but not supported by the package. They are
+// read from the block header, so that the filter chain can be
+// validated.
+type specFilter struct {
+	filterID uint64
+	props    []byte
+}
+
+// String returns the name of the filter.
+func (f specFilter) String() string {
+	return specFilterNames[f.filterID]
+}
+
+// id returns the filter ID.
+func (f specFilter) id() uint64 { return f.filterID }
+
+// MarshalBinary returns the encoded representation of the filter.
+func (f specFilter) MarshalBinary() (data []byte, err error) {
+	data = make([]byte, 20+len(f.props))
+	n := putUvarint(data, f.filterID)
+	n += putUvarint(data[n:], uint64(len(f.props)))
+	n += copy(data[n:], f.props)
+	return data[:n], nil
+}
+
+// UnmarshalBinary decodes the filter. The data must contain the filter
+// ID, the size of the properties and the properties.
+func (f *specFilter) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	id, _, err := readUvarint(r)
+	if err != nil {
+		return err
+	}
+	name, ok := specFilterNames[id]
+	if !ok {
+		return fmt.Errorf("xz: filter id %#x is not a delta or BCJ "+
+			"filter", id)
+	}
+	size, _, err := readUvarint(r)
+	if err != nil {
+		return err
+	}
+	props := data[len(data)-r.Len():]
+	if uint64(len(props)) != size ||
+		(id == deltaFilterID && size != 1) ||
+		(id != deltaFilterID && size != 0 && size != 4) {
+		return fmt.Errorf("xz: wrong properties size for %s filter",
+			name)
+	}
+	f.filterID = id
+	f.props = append([]byte(nil), props...)
+	return nil
+}
+
+// errUnsupported returns the error for the unsupported filter.
+func (f specFilter) errUnsupported() error {
+	return errorf(ErrUnsupported, "xz: %s filter unsupported", f)
+}
+
+// reader returns an error because the filter is not supported.
+func (f specFilter) reader(r io.Reader, c *ReaderConfig) (fr io.Reader,
+	err error) {
+	return nil, f.errUnsupported()
+}
+
+// last returns false; the delta and BCJ filters must not be the last
+// filter.
+func (f specFilter) last() bool { return false }
@@ -0,0 +1,150 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// SquashFS stores every data, fragment and metadata block compressed in
+// a separate xz stream. mksquashfs creates the streams with a single
+// block, the CRC32 check and the LZMA2 filter optionally preceded by a
+// BCJ filter. The Linux kernel decompresses them with xz_dec using a
+// dictionary of the size given in the compression options.
+
+// Block sizes supported by SquashFS.
+const (
+	SquashFSMinBlockSize = 1 << 12
+	SquashFSMaxBlockSize = 1 << 20
+)
+
+// squashFSMinDictCap is the minimum dictionary capacity accepted by
+// mksquashfs.
+const squashFSMinDictCap = 1 << 13
+
+// squashFSOptionsLen is the length of the xz compression options in the
+// SquashFS superblock area.
+const squashFSOptionsLen = 8
+
+// SquashFSConfig describes the xz compression parameters of a SquashFS
+// file system. The BlockSize defaults to 128 KiB and must be a power of
+// two between SquashFSMinBlockSize and SquashFSMaxBlockSize. The
+// DictCap defaults to the block size; like mksquashfs the profile
+// requires that it is at least 8 KiB, doesn't exceed the block size
+// and has the form 2^n or 2^n + 2^(n-1). The BCJ filters are not
+// supported by the package.
+type SquashFSConfig struct {
+	BlockSize int
+	DictCap   int
+}
+
+// fill replaces zero values with default values.
+func (c *SquashFSConfig) fill() {
+	if c.BlockSize == 0 {
+		c.BlockSize = 128 << 10
+	}
+	if c.DictCap == 0 {
+		c.DictCap = c.BlockSize
+	}
+}
+
+// Verify checks the configuration for errors. Zero values will be
+// replaced by default values.
+func (c *SquashFSConfig) Verify() error {
+	if c == nil {
+		return errors.New("xz: SquashFS configuration is nil")
+	}
+	c.fill()
+	b := c.BlockSize
+	if !(SquashFSMinBlockSize <= b && b <= SquashFSMaxBlockSize) ||
+		b&(b-1) != 0 {
+		return fmt.Errorf("xz: SquashFS block size %d invalid", b)
+	}
+	d := c.DictCap
+	if !(squashFSMinDictCap <= d && d <= b) {
+		return fmt.Errorf("xz: SquashFS dictionary capacity %d "+
+			"out of range", d)
+	}
+	// d must be 2^n or 2^n + 2^(n-1)
+	n := d &^ (d - 1)
+	if d != n && d != 3*n {
+		return fmt.Errorf("xz: SquashFS dictionary capacity %d "+
+			"is not of the form 2^n or 2^n + 2^(n-1)", d)
+	}
+	return nil
+}
+
+// WriterConfig returns the configuration for the writer creating the xz
+// stream of a single SquashFS block. It is equivalent to the
+// configuration used by mksquashfs and restricted to the output
+// supported by the kernel.
+func (c SquashFSConfig) WriterConfig() (WriterConfig, error) {
+	if err := c.Verify(); err != nil {
+		return WriterConfig{}, err
+	}
+	wc := WriterConfig{
+		Properties: &lzma.Properties{LC: 3, LP: 0, PB: 2},
+		DictCap:    c.DictCap,
+		CheckSum:   CRC32,
+		Embedded:   true,
+	}
+	if err := wc.Verify(); err != nil {
+		return WriterConfig{}, err
+	}
+	return wc, nil
+}
+
+// ReaderConfig returns the configuration for the reader of the xz
+// stream of a single SquashFS block. Like the kernel the reader
+// rejects streams requiring a dictionary larger than DictCap.
+func (c SquashFSConfig) ReaderConfig() (ReaderConfig, error) {
+	if err := c.Verify(); err != nil {
+		return ReaderConfig{}, err
+	}
+	rc := ReaderConfig{
+		DictCapLimit: c.DictCap,
+		SingleStream: true,
+	}
+	if err := rc.Verify(); err != nil {
+		return ReaderConfig{}, err
+	}
+	return rc, nil
+}
+
+// MarshalBinary encodes the xz compression options stored by mksquashfs
+// in the file system. They consist of the dictionary size and the BCJ
+// filter flags as little-endian 32-bit values.
+func (c *SquashFSConfig) MarshalBinary() (data []byte, err error) {
+	if err = c.Verify(); err != nil {
+		return nil, err
+	}
+	data = make([]byte, squashFSOptionsLen)
+	putUint32LE(data, uint32(c.DictCap))
+	return data, nil
+}
+
+// UnmarshalBinary decodes the xz compression options of a SquashFS file
+// system. The block size must be set before calling the method. An
+// error is returned if BCJ filters are requested.
+func (c *SquashFSConfig) UnmarshalBinary(data []byte) error {
+	if len(data) != squashFSOptionsLen {
+		return errors.New("xz: SquashFS compression options have " +
+			"wrong length")
+	}
+	d := uint32LE(data)
+	if d > SquashFSMaxBlockSize {
+		return fmt.Errorf("xz: SquashFS dictionary capacity %d "+
+			"out of range", d)
+	}
+	if flags := uint32LE(data[4:]); flags != 0 {
+		return fmt.Errorf("xz: SquashFS BCJ filters %#x unsupported",
+			flags)
+	}
+	c.DictCap = int(d)
+	return c.Verify()
+}
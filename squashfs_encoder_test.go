@@ -0,0 +1,61 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package xz
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestSquashFSWriter(t *testing.T) {
+	block := bytes.Repeat([]byte("SquashFS block data\n"), 2000)
+	c := SquashFSConfig{BlockSize: 64 << 10}
+	wc, err := c.WriterConfig()
+	if err != nil {
+		t.Fatalf("WriterConfig error %s", err)
+	}
+	var buf bytes.Buffer
+	w, err := wc.NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	if _, err = w.Write(block); err != nil {
+		t.Fatalf("Write error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("Close error %s", err)
+	}
+	data := buf.Bytes()
+	streams, err := ReadStreamInfo(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ReadStreamInfo error %s", err)
+	}
+	if len(streams) != 1 || len(streams[0].Blocks) != 1 {
+		t.Fatalf("got %d streams; want a single stream with one block",
+			len(streams))
+	}
+	if streams[0].CheckSum != CRC32 {
+		t.Fatalf("check %#x; want CRC32", streams[0].CheckSum)
+	}
+	rc, err := c.ReaderConfig()
+	if err != nil {
+		t.Fatalf("ReaderConfig error %s", err)
+	}
+	r, err := rc.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll error %s", err)
+	}
+	if !bytes.Equal(out, block) {
+		t.Fatalf("decompressed block differs")
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// decodeSquashFSBlock decompresses the test file using the SquashFS
+// profile.
+func decodeSquashFSBlock(t *testing.T, c SquashFSConfig, name string,
+) ([]byte, error) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "squashfs",
+		name))
+	if err != nil {
+		t.Fatalf("ReadFile error %s", err)
+	}
+	rc, err := c.ReaderConfig()
+	if err != nil {
+		t.Fatalf("ReaderConfig error %s", err)
+	}
+	r, err := rc.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
+
+func TestSquashFSBlocks(t *testing.T) {
+	const (
+		sumBlock = "2a4c75cf4e7a0cf92e0b0c1dbd19c92d3dcd0a3bc9656774a402d3991eb343b3"
+		sumFrag  = "4808f718c33c9564f06f679b45c0ee10812c0d8aea7481518bd4e8647a6be93e"
+	)
+	tests := []struct {
+		name    string
+		dictCap int
+		sum     string
+	}{
+		{"block-128k.xz", 0, sumBlock},
+		{"fragment-128k.xz", 0, sumFrag},
+		{"block-dict-64k.xz", 64 << 10, sumBlock},
+	}
+	for _, tc := range tests {
+		c := SquashFSConfig{DictCap: tc.dictCap}
+		out, err := decodeSquashFSBlock(t, c, tc.name)
+		if err != nil {
+			t.Fatalf("%s: decode error %s", tc.name, err)
+		}
+		h := sha256.Sum256(out)
+		if sum := hex.EncodeToString(h[:]); sum != tc.sum {
+			t.Fatalf("%s: checksum mismatch", tc.name)
+		}
+	}
+
+	// The kernel rejects a dictionary larger than the configured one.
+	// The liblzma backend supports only an approximate limit.
+	if Backend != "go" {
+		return
+	}
+	c := SquashFSConfig{DictCap: 64 << 10}
+	_, err := decodeSquashFSBlock(t, c, "block-128k.xz")
+	var e *lzma.DictCapLimitError
+	if !errors.As(err, &e) {
+		t.Fatalf("decode returned error %v; want DictCapLimitError",
+			err)
+	}
+}
+
+func TestSquashFSConfigVerify(t *testing.T) {
+	tests := []struct {
+		c  SquashFSConfig
+		ok bool
+	}{
+		{SquashFSConfig{}, true},
+		{SquashFSConfig{BlockSize: 1 << 20, DictCap: 3 << 18}, true},
+		{SquashFSConfig{BlockSize: 4 << 10}, false},
+		{SquashFSConfig{BlockSize: 8 << 10}, true},
+		{SquashFSConfig{BlockSize: 2 << 20}, false},
+		{SquashFSConfig{BlockSize: 100000}, false},
+		{SquashFSConfig{DictCap: 256 << 10}, false},
+		{SquashFSConfig{DictCap: 5 << 14}, false},
+	}
+	for _, tc := range tests {
+		err := tc.c.Verify()
+		if ok := err == nil; ok != tc.ok {
+			t.Errorf("%+v: Verify returned %v", tc.c, err)
+		}
+	}
+}
+
+func TestSquashFSOptions(t *testing.T) {
+	c := SquashFSConfig{BlockSize: 1 << 20, DictCap: 3 << 18}
+	data, err := c.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary error %s", err)
+	}
+	d := SquashFSConfig{BlockSize: 1 << 20}
+	if err = d.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary error %s", err)
+	}
+	if d != c {
+		t.Fatalf("UnmarshalBinary returned %+v; want %+v", d, c)
+	}
+	// x86 BCJ filter
+	data[4] = 1
+	if err = d.UnmarshalBinary(data); err == nil {
+		t.Fatalf("UnmarshalBinary accepted BCJ filter")
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import "io"
+
+// Stats receives the counters of readers, writers, encoders and
+// decoders configured with it. The method signature matches Add of
+// expvar.Map, so a *expvar.Map can be used directly; an adapter for a
+// Prometheus CounterVec only needs to call
+// WithLabelValues(name).Add(float64(delta)). The implementation must
+// be safe for concurrent use if it is shared.
+type Stats interface {
+	Add(name string, delta int64)
+}
+
+// The names of the counters reported to Stats. For readers the input
+// consists of the compressed bytes and the output of the uncompressed
+// bytes, for writers it is the other way round. Streams and blocks are
+// counted after they have been completely read or written; readers and
+// writers using the liblzma backend don't report them. Errors count
+// the errors returned by the Read, Write and Close methods. The pool
+// counters report whether EncodeAll and DecodeAll could reuse a pooled
+// reader or writer.
+const (
+	StatStreams    = "streams"
+	StatBlocks     = "blocks"
+	StatBytesIn    = "bytes_in"
+	StatBytesOut   = "bytes_out"
+	StatErrors     = "errors"
+	StatPoolHits   = "pool_hits"
+	StatPoolMisses = "pool_misses"
+)
+
+// addStat adds delta to the named counter if s is not nil.
+func addStat(s Stats, name string, delta int64) {
+	if s != nil && delta != 0 {
+		s.Add(name, delta)
+	}
+}
+
+// statsReader counts the bytes read as input.
+type statsReader struct {
+	r io.Reader
+	s Stats
+}
+
+// Read reads from the underlying reader and counts the bytes.
+func (sr *statsReader) Read(p []byte) (n int, err error) {
+	n, err = sr.r.Read(p)
+	addStat(sr.s, StatBytesIn, int64(n))
+	return n, err
+}
+
+// statsWriter counts the bytes written as output.
+type statsWriter struct {
+	w io.Writer
+	s Stats
+}
+
+// Write writes to the underlying writer and counts the bytes.
+func (sw *statsWriter) Write(p []byte) (n int, err error) {
+	n, err = sw.w.Write(p)
+	addStat(sw.s, StatBytesOut, int64(n))
+	return n, err
+}
@@ -0,0 +1,120 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package xz
+
+import (
+	"bytes"
+	"expvar"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// statValue returns the value of the named counter.
+func statValue(m *expvar.Map, name string) int64 {
+	v, ok := m.Get(name).(*expvar.Int)
+	if !ok {
+		return 0
+	}
+	return v.Value()
+}
+
+func TestStats(t *testing.T) {
+	text := strings.Repeat("The quick brown fox jumps over the lazy dog.\n",
+		100)
+	ws := new(expvar.Map)
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, WithBlockSize(1000), WithStats(ws))
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	if _, err = w.Write([]byte(text)); err != nil {
+		t.Fatalf("Write error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("w.Close error %s", err)
+	}
+	blocks := int64((len(text) + 999) / 1000)
+	if Backend == "go" {
+		if n := statValue(ws, StatStreams); n != 1 {
+			t.Fatalf("writer streams %d; want 1", n)
+		}
+		if n := statValue(ws, StatBlocks); n != blocks {
+			t.Fatalf("writer blocks %d; want %d", n, blocks)
+		}
+	}
+	if n := statValue(ws, StatBytesIn); n != int64(len(text)) {
+		t.Fatalf("writer bytes in %d; want %d", n, len(text))
+	}
+	if n := statValue(ws, StatBytesOut); n != int64(buf.Len()) {
+		t.Fatalf("writer bytes out %d; want %d", n, buf.Len())
+	}
+	data := append(buf.Bytes(), buf.Bytes()...)
+
+	rs := new(expvar.Map)
+	r, err := NewReader(bytes.NewReader(data), WithStats(rs))
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	if _, err = ioutil.ReadAll(r); err != nil {
+		t.Fatalf("ReadAll error %s", err)
+	}
+	if n := statValue(rs, StatBytesIn); n != int64(len(data)) {
+		t.Fatalf("reader bytes in %d; want %d", n, len(data))
+	}
+	if n := statValue(rs, StatBytesOut); n != 2*int64(len(text)) {
+		t.Fatalf("reader bytes out %d; want %d", n, 2*len(text))
+	}
+	if Backend == "go" {
+		if n := statValue(rs, StatStreams); n != 2 {
+			t.Fatalf("reader streams %d; want 2", n)
+		}
+		if n := statValue(rs, StatBlocks); n != 2*blocks {
+			t.Fatalf("reader blocks %d; want %d", n, 2*blocks)
+		}
+	}
+	if n := statValue(rs, StatErrors); n != 0 {
+		t.Fatalf("reader errors %d; want 0", n)
+	}
+
+	data[len(data)/2] ^= 0xff
+	if r, err = NewReader(bytes.NewReader(data), WithStats(rs)); err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	if _, err = ioutil.ReadAll(r); err == nil {
+		t.Fatalf("ReadAll accepted corrupt data")
+	}
+	if n := statValue(rs, StatErrors); n != 1 {
+		t.Fatalf("reader errors %d; want 1", n)
+	}
+}
+
+func TestStatsPool(t *testing.T) {
+	s := new(expvar.Map)
+	e, err := NewEncoder(WithStats(s))
+	if err != nil {
+		t.Fatalf("NewEncoder error %s", err)
+	}
+	d, err := NewDecoder(WithStats(s))
+	if err != nil {
+		t.Fatalf("NewDecoder error %s", err)
+	}
+	const calls = 3
+	for i := 0; i < calls; i++ {
+		data := e.EncodeAll([]byte("hello, world\n"), nil)
+		if _, err = d.DecodeAll(data, nil); err != nil {
+			t.Fatalf("DecodeAll error %s", err)
+		}
+	}
+	hits := statValue(s, StatPoolHits)
+	misses := statValue(s, StatPoolMisses)
+	if hits+misses != 2*calls || misses < 2 {
+		t.Fatalf("pool hits %d and misses %d for %d calls", hits,
+			misses, 2*calls)
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tarxz
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/ulikunitz/xz"
+)
+
+// The pixz tool appends a file index to compressed tar archives. The
+// index is stored in the last block of the xz stream and starts with
+// a magic number. Each entry consists of the null-terminated file name
+// and the uncompressed offset of the tar header as little-endian 64-bit
+// value. The last entry has an empty name and gives the offset of the
+// end of the archive. Since the tar reader stops at the end of the
+// archive, the index doesn't disturb tools not knowing it.
+
+// indexMagic starts the pixz file index.
+const indexMagic uint64 = 0xDBAE14D62E324CA6
+
+// IndexEntry is an entry of the pixz file index.
+type IndexEntry struct {
+	// Name of the file as given in the tar header
+	Name string
+	// Offset of the tar header in the uncompressed archive
+	Offset int64
+}
+
+// putUint64LE puts the little-endian representation of x into the
+// first eight bytes of p.
+func putUint64LE(p []byte, x uint64) {
+	for i := 0; i < 8; i++ {
+		p[i] = byte(x >> (8 * uint(i)))
+	}
+}
+
+// uint64LE converts a little-endian representation to an uint64 value.
+func uint64LE(p []byte) uint64 {
+	var x uint64
+	for i := 7; i >= 0; i-- {
+		x = x<<8 | uint64(p[i])
+	}
+	return x
+}
+
+// marshalIndex encodes the file index.
+func marshalIndex(index []IndexEntry) []byte {
+	var buf bytes.Buffer
+	p := make([]byte, 8)
+	putUint64LE(p, indexMagic)
+	buf.Write(p)
+	for _, e := range index {
+		buf.WriteString(e.Name)
+		buf.WriteByte(0)
+		putUint64LE(p, uint64(e.Offset))
+		buf.Write(p)
+	}
+	return buf.Bytes()
+}
+
+// ErrNoFileIndex indicates that the archive has no pixz file index.
+var ErrNoFileIndex = errors.New("tarxz: archive has no file index")
+
+// unmarshalIndex decodes the file index. The terminating entry is not
+// included in the result.
+func unmarshalIndex(data []byte) ([]IndexEntry, error) {
+	if len(data) < 8 || uint64LE(data) != indexMagic {
+		return nil, ErrNoFileIndex
+	}
+	data = data[8:]
+	var index []IndexEntry
+	for {
+		i := bytes.IndexByte(data, 0)
+		if i < 0 || len(data) < i+9 {
+			return nil, errors.New("tarxz: file index truncated")
+		}
+		e := IndexEntry{
+			Name:   string(data[:i]),
+			Offset: int64(uint64LE(data[i+1:])),
+		}
+		data = data[i+9:]
+		if e.Offset < 0 {
+			return nil, errors.New("tarxz: invalid offset in index")
+		}
+		if e.Name == "" {
+			break
+		}
+		index = append(index, e)
+	}
+	return index, nil
+}
+
+// Archive provides random access to the files of a compressed tar
+// archive with a pixz file index.
+type Archive struct {
+	// Index lists the files of the archive.
+	Index []IndexEntry
+
+	c       ReaderConfig
+	xz      io.ReaderAt
+	streams []xz.StreamInfo
+}
+
+// OpenArchive reads the file index of the archive using the default
+// configuration. The argument size must provide the size of the
+// compressed file. If the archive has no file index ErrNoFileIndex is
+// returned.
+func OpenArchive(xz io.ReaderAt, size int64) (*Archive, error) {
+	return ReaderConfig{}.OpenArchive(xz, size)
+}
+
+// OpenArchive reads the file index of the archive using the
+// configuration c.
+func (c ReaderConfig) OpenArchive(r io.ReaderAt, size int64) (*Archive,
+	error) {
+
+	streams, err := xz.ReadStreamInfo(r, size)
+	if err != nil {
+		return nil, err
+	}
+	s := &streams[len(streams)-1]
+	if len(s.Blocks) == 0 {
+		return nil, ErrNoFileIndex
+	}
+	br, err := c.ReaderConfig.NewBlockReader(r, s,
+		&s.Blocks[len(s.Blocks)-1])
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(br)
+	if err != nil {
+		return nil, err
+	}
+	index, err := unmarshalIndex(data)
+	if err != nil {
+		return nil, err
+	}
+	return &Archive{Index: index, c: c, xz: r, streams: streams}, nil
+}
+
+// blocksReader reads the uncompressed data of the blocks starting with
+// a given block.
+type blocksReader struct {
+	a    *Archive
+	s, b int
+	r    io.Reader
+}
+
+// Read reads the uncompressed data of the blocks.
+func (r *blocksReader) Read(p []byte) (n int, err error) {
+	for {
+		if r.r == nil {
+			if r.s >= len(r.a.streams) {
+				return 0, io.EOF
+			}
+			s := &r.a.streams[r.s]
+			if r.b >= len(s.Blocks) {
+				r.s++
+				r.b = 0
+				continue
+			}
+			r.r, err = r.a.c.ReaderConfig.NewBlockReader(r.a.xz, s,
+				&s.Blocks[r.b])
+			if err != nil {
+				return 0, err
+			}
+			r.b++
+		}
+		n, err = r.r.Read(p)
+		if err == io.EOF {
+			r.r = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+// Open returns the header and a reader for the content of the named
+// file. Only the blocks containing the file are decompressed.
+func (a *Archive) Open(name string) (*tar.Header, io.Reader, error) {
+	var e *IndexEntry
+	for i := range a.Index {
+		if a.Index[i].Name == name {
+			e = &a.Index[i]
+			break
+		}
+	}
+	if e == nil {
+		return nil, nil, fmt.Errorf("tarxz: file %q not in index",
+			name)
+	}
+	for i := range a.streams {
+		s := &a.streams[i]
+		for j := range s.Blocks {
+			b := &s.Blocks[j]
+			if e.Offset >= b.UncompressedOffset+b.UncompressedSize {
+				continue
+			}
+			r := &blocksReader{a: a, s: i, b: j}
+			skip := e.Offset - b.UncompressedOffset
+			if _, err := io.CopyN(ioutil.Discard, r, skip); err != nil {
+				return nil, nil, err
+			}
+			tr := tar.NewReader(r)
+			hdr, err := tr.Next()
+			if err != nil {
+				return nil, nil, err
+			}
+			return hdr, tr, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("tarxz: offset of file %q out of range",
+		name)
+}
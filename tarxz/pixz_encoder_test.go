@@ -0,0 +1,83 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package tarxz
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestFileIndex(t *testing.T) {
+	for _, align := range []bool{false, true} {
+		for _, workers := range []int{1, 4} {
+			c := WriterConfig{AlignBlocks: align, FileIndex: true}
+			c.Workers = workers
+			data := writeArchive(t, c)
+
+			// sequential readers must ignore the index
+			r, err := NewReader(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("NewReader error %s", err)
+			}
+			for range files {
+				if _, err = r.Next(); err != nil {
+					t.Fatalf("Next error %s", err)
+				}
+			}
+			if _, err = r.Next(); err != io.EOF {
+				t.Fatalf("Next returned %v; want io.EOF", err)
+			}
+
+			a, err := OpenArchive(bytes.NewReader(data),
+				int64(len(data)))
+			if err != nil {
+				t.Fatalf("OpenArchive error %s", err)
+			}
+			if len(a.Index) != len(files) {
+				t.Fatalf("index has %d entries; want %d",
+					len(a.Index), len(files))
+			}
+			for i := len(files) - 1; i >= 0; i-- {
+				f := files[i]
+				if a.Index[i].Name != f.name {
+					t.Fatalf("index entry %d is %q; want %q",
+						i, a.Index[i].Name, f.name)
+				}
+				hdr, fr, err := a.Open(f.name)
+				if err != nil {
+					t.Fatalf("Open(%q) error %s", f.name, err)
+				}
+				if hdr.Name != f.name {
+					t.Fatalf("got file %q; want %q", hdr.Name,
+						f.name)
+				}
+				body, err := ioutil.ReadAll(fr)
+				if err != nil {
+					t.Fatalf("ReadAll error %s", err)
+				}
+				if string(body) != f.body {
+					t.Fatalf("%s: got %q; want %q", f.name,
+						body, f.body)
+				}
+			}
+			if _, _, err = a.Open("missing"); err == nil {
+				t.Fatalf("Open of missing file succeeded")
+			}
+		}
+	}
+}
+
+func TestNoFileIndex(t *testing.T) {
+	data := writeArchive(t, WriterConfig{AlignBlocks: true})
+	_, err := OpenArchive(bytes.NewReader(data), int64(len(data)))
+	if err != ErrNoFileIndex {
+		t.Fatalf("OpenArchive returned %v; want ErrNoFileIndex", err)
+	}
+}
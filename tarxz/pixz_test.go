@@ -0,0 +1,23 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tarxz
+
+import "testing"
+
+func TestIndexMarshal(t *testing.T) {
+	index := []IndexEntry{{"a", 0}, {"dir/b", 1024}, {"", 3072}}
+	got, err := unmarshalIndex(marshalIndex(index))
+	if err != nil {
+		t.Fatalf("unmarshalIndex error %s", err)
+	}
+	if len(got) != 2 || got[0] != index[0] || got[1] != index[1] {
+		t.Fatalf("unmarshalIndex returned %v; want %v", got,
+			index[:2])
+	}
+	p := marshalIndex(index)
+	if _, err = unmarshalIndex(p[:len(p)-1]); err == nil {
+		t.Fatalf("unmarshalIndex accepted truncated index")
+	}
+}
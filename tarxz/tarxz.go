@@ -0,0 +1,44 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package tarxz reads and writes tar archives compressed with xz. The
+// Writer compresses the archive using multiple go routines and can
+// start a new xz block for every file, so that tools supporting random
+// access can extract single files without decompressing the whole
+// archive.
+package tarxz
+
+import (
+	"archive/tar"
+	"io"
+
+	"github.com/ulikunitz/xz"
+)
+
+// ReaderConfig defines the parameters for the tar archive reader.
+type ReaderConfig struct {
+	xz.ReaderConfig
+}
+
+// Reader reads a tar archive compressed with xz. The methods of
+// tar.Reader are available.
+type Reader struct {
+	*tar.Reader
+}
+
+// NewReader creates a tar archive reader using the default
+// configuration. The function reads the header of the xz stream.
+func NewReader(r io.Reader) (*Reader, error) {
+	return ReaderConfig{}.NewReader(r)
+}
+
+// NewReader creates a tar archive reader using the configuration c. The
+// function reads the header of the xz stream.
+func (c ReaderConfig) NewReader(r io.Reader) (*Reader, error) {
+	xr, err := c.ReaderConfig.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{Reader: tar.NewReader(xr)}, nil
+}
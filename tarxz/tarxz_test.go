@@ -0,0 +1,103 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package tarxz
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/ulikunitz/xz"
+)
+
+var files = []struct {
+	name string
+	body string
+}{
+	{"a.txt", "The quick brown fox jumps over the lazy dog.\n"},
+	{"b.txt", "Hello\nWorld!\n"},
+	{"empty.txt", ""},
+	{"c.txt", "Lorem ipsum dolor sit amet.\n"},
+}
+
+func writeArchive(t *testing.T, c WriterConfig) []byte {
+	var buf bytes.Buffer
+	w, err := c.NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	for _, f := range files {
+		hdr := &tar.Header{Name: f.name, Mode: 0644,
+			Size: int64(len(f.body))}
+		if err = w.WriteHeader(hdr); err != nil {
+			t.Fatalf("WriteHeader error %s", err)
+		}
+		if _, err = io.WriteString(w, f.body); err != nil {
+			t.Fatalf("WriteString error %s", err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("Close error %s", err)
+	}
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		c := WriterConfig{AlignBlocks: true}
+		c.Workers = workers
+		data := writeArchive(t, c)
+		r, err := NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("NewReader error %s", err)
+		}
+		for _, f := range files {
+			hdr, err := r.Next()
+			if err != nil {
+				t.Fatalf("Next error %s", err)
+			}
+			if hdr.Name != f.name {
+				t.Fatalf("got file %q; want %q", hdr.Name, f.name)
+			}
+			body, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatalf("ReadAll error %s", err)
+			}
+			if string(body) != f.body {
+				t.Fatalf("%s: got %q; want %q", f.name, body,
+					f.body)
+			}
+		}
+		if _, err = r.Next(); err != io.EOF {
+			t.Fatalf("Next returned %v; want io.EOF", err)
+		}
+	}
+}
+
+func TestAlignBlocks(t *testing.T) {
+	data := writeArchive(t, WriterConfig{AlignBlocks: true})
+	streams, err := xz.ReadStreamInfo(bytes.NewReader(data),
+		int64(len(data)))
+	if err != nil {
+		t.Fatalf("ReadStreamInfo error %s", err)
+	}
+	blocks := streams[0].Blocks
+	// every file gets a block; the end of the archive is in the
+	// block of the last file
+	if len(blocks) != len(files) {
+		t.Fatalf("got %d blocks; want %d", len(blocks), len(files))
+	}
+	for i, b := range blocks {
+		if b.UncompressedOffset%512 != 0 {
+			t.Fatalf("block %d starts at %d; not a tar header",
+				i, b.UncompressedOffset)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package tarxz
+
+import (
+	"archive/tar"
+	"errors"
+	"io"
+	"runtime"
+
+	"github.com/ulikunitz/xz"
+)
+
+// WriterConfig defines the parameters for the tar archive writer. The
+// embedded xz writer configuration is used for the compression; if
+// Workers is zero, one go routine per CPU is used. If AlignBlocks is
+// set, every file header starts a new xz block. FileIndex requests the
+// file index of the pixz tool in the last block of the stream.
+type WriterConfig struct {
+	xz.WriterConfig
+	AlignBlocks bool
+	FileIndex   bool
+}
+
+// fill replaces zero values with default values.
+func (c *WriterConfig) fill() {
+	if c.Workers == 0 {
+		c.Workers = runtime.NumCPU()
+	}
+}
+
+// Verify checks the configuration for errors. Zero values will be
+// replaced by default values.
+func (c *WriterConfig) Verify() error {
+	if c == nil {
+		return errors.New("tarxz: writer configuration is nil")
+	}
+	c.fill()
+	return c.WriterConfig.Verify()
+}
+
+// Writer writes a tar archive compressed with xz. The methods of
+// tar.Writer are available; Close completes the archive and the xz
+// stream but doesn't close the underlying writer.
+type Writer struct {
+	*tar.Writer
+	xw    *xz.Writer
+	cw    *countingWriter
+	align bool
+	// index is nil unless the file index has been requested
+	index []IndexEntry
+}
+
+// countingWriter counts the bytes written to the xz writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+// Write writes the data to the underlying writer.
+func (w *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// NewWriter creates a tar archive writer using the default
+// configuration. Files are aligned to xz blocks.
+func NewWriter(w io.Writer) (*Writer, error) {
+	return WriterConfig{AlignBlocks: true}.NewWriter(w)
+}
+
+// NewWriter creates a tar archive writer using the configuration c.
+func (c WriterConfig) NewWriter(w io.Writer) (*Writer, error) {
+	if err := c.Verify(); err != nil {
+		return nil, err
+	}
+	xw, err := c.WriterConfig.NewWriter(w)
+	if err != nil {
+		return nil, err
+	}
+	tw := &Writer{
+		xw:    xw,
+		cw:    &countingWriter{w: xw},
+		align: c.AlignBlocks,
+	}
+	tw.Writer = tar.NewWriter(tw.cw)
+	if c.FileIndex {
+		tw.index = make([]IndexEntry, 0, 16)
+	}
+	return tw, nil
+}
+
+// WriteHeader writes the header of the next file. If the writer aligns
+// blocks, the padding of the previous file is written and a new xz
+// block is started before the header.
+func (w *Writer) WriteHeader(hdr *tar.Header) error {
+	if w.align || w.index != nil {
+		if err := w.Writer.Flush(); err != nil {
+			return err
+		}
+	}
+	if w.align {
+		if err := w.xw.EndBlock(); err != nil {
+			return err
+		}
+	}
+	if w.index != nil {
+		w.index = append(w.index,
+			IndexEntry{Name: hdr.Name, Offset: w.cw.n})
+	}
+	return w.Writer.WriteHeader(hdr)
+}
+
+// Close writes the end of the tar archive, the file index if requested
+// and closes the xz stream.
+func (w *Writer) Close() error {
+	if w.index != nil {
+		if err := w.Writer.Flush(); err != nil {
+			return err
+		}
+		w.index = append(w.index, IndexEntry{Offset: w.cw.n})
+	}
+	if err := w.Writer.Close(); err != nil {
+		return err
+	}
+	if w.index != nil {
+		if err := w.xw.EndBlock(); err != nil {
+			return err
+		}
+		if _, err := w.xw.Write(marshalIndex(w.index)); err != nil {
+			return err
+		}
+	}
+	return w.xw.Close()
+}
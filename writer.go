@@ -2,100 +2,21 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
 package xz
 
 import (
 	"errors"
+	"fmt"
 	"hash"
 	"io"
+	"time"
 
 	"github.com/ulikunitz/xz/lzma"
 )
 
-// WriterConfig describe the parameters for an xz writer.
-type WriterConfig struct {
-	Properties *lzma.Properties
-	DictCap    int
-	BufSize    int
-	BlockSize  int64
-	// checksum method: CRC32, CRC64 or SHA256
-	CheckSum byte
-	// match algorithm
-	Matcher lzma.MatchAlgorithm
-}
-
-// fill replaces zero values with default values.
-func (c *WriterConfig) fill() {
-	if c.Properties == nil {
-		c.Properties = &lzma.Properties{LC: 3, LP: 0, PB: 2}
-	}
-	if c.DictCap == 0 {
-		c.DictCap = 8 * 1024 * 1024
-	}
-	if c.BufSize == 0 {
-		c.BufSize = 4096
-	}
-	if c.BlockSize == 0 {
-		c.BlockSize = maxInt64
-	}
-	if c.CheckSum == 0 {
-		c.CheckSum = CRC64
-	}
-}
-
-// Verify checks the configuration for errors. Zero values will be
-// replaced by default values.
-func (c *WriterConfig) Verify() error {
-	if c == nil {
-		return errors.New("xz: writer configuration is nil")
-	}
-	c.fill()
-	lc := lzma.Writer2Config{
-		Properties: c.Properties,
-		DictCap:    c.DictCap,
-		BufSize:    c.BufSize,
-		Matcher:    c.Matcher,
-	}
-	if err := lc.Verify(); err != nil {
-		return err
-	}
-	if c.BlockSize <= 0 {
-		return errors.New("xz: block size out of range")
-	}
-	if err := verifyFlags(c.CheckSum); err != nil {
-		return err
-	}
-	return nil
-}
-
-// filters creates the filter list for the given parameters.
-func (c *WriterConfig) filters() []filter {
-	return []filter{&lzmaFilter{int64(c.DictCap)}}
-}
-
-// maxInt64 defines the maximum 64-bit signed integer.
-const maxInt64 = 1<<63 - 1
-
-// verifyFilters checks the filter list for the length and the right
-// sequence of filters.
-func verifyFilters(f []filter) error {
-	if len(f) == 0 {
-		return errors.New("xz: no filters")
-	}
-	if len(f) > 4 {
-		return errors.New("xz: more than four filters")
-	}
-	for _, g := range f[:len(f)-1] {
-		if g.last() {
-			return errors.New("xz: last filter is not last")
-		}
-	}
-	if !f[len(f)-1].last() {
-		return errors.New("xz: wrong last filter")
-	}
-	return nil
-}
-
 // newFilterWriteCloser converts a filter list into a WriteCloser that
 // can be used by a blockWriter.
 func (c *WriterConfig) newFilterWriteCloser(w io.Writer, f []filter) (fw io.WriteCloser, err error) {
@@ -129,25 +50,147 @@ func nopWriteCloser(w io.Writer) io.WriteCloser {
 	return nopWCloser{w}
 }
 
+// filterWriter provides the writeCloser method of the filter
+// interface, which isn't available in decoder-only builds.
+type filterWriter interface {
+	writeCloser(w io.WriteCloser, c *WriterConfig) (fw io.WriteCloser, err error)
+}
+
+// writeCloser creates a io.WriteCloser for the LZMA2 filter.
+func (f lzmaFilter) writeCloser(w io.WriteCloser, c *WriterConfig,
+) (fw io.WriteCloser, err error) {
+	config, err := f.writer2Config(c)
+	if err != nil {
+		return nil, err
+	}
+	fw, err = config.NewWriter2(w)
+	if err != nil {
+		return nil, err
+	}
+	return fw, nil
+}
+
+// writer2Config returns the configuration of the LZMA2 writer for the
+// filter.
+func (f lzmaFilter) writer2Config(c *WriterConfig) (config lzma.Writer2Config,
+	err error) {
+	if c != nil {
+		config = lzma.Writer2Config{
+			Properties:    c.Properties,
+			DictCap:       c.DictCap,
+			BufSize:       c.BufSize,
+			Matcher:       c.Matcher,
+			Depth:         c.Depth,
+			Logger:        c.Logger,
+			DecisionTrace: c.DecisionTrace,
+		}
+	}
+
+	if f.dictCap > maxInt {
+		return config, errors.New("xz: LZMA2 filter parameter " +
+			"dictionary capacity overflow")
+	}
+	dc := int(f.dictCap)
+	if dc > config.DictCap {
+		config.DictCap = dc
+	}
+	if err = config.Verify(); err != nil {
+		return config, err
+	}
+	return config, nil
+}
+
+// encoderCache keeps an LZMA2 writer, so that the dictionary and the
+// match finder can be reused for the next block instead of being
+// allocated again. The writer is only reused for the same encoder
+// parameters; it keeps its Logger and DecisionTrace.
+type encoderCache struct {
+	w *lzma.Writer2
+	// params are the parameters w has been created for
+	params lzma.Writer2Config
+}
+
+// writer returns an LZMA2 writer for the configuration writing to
+// lzma2. The cached writer is reset if it has been created for the same
+// parameters; otherwise a new writer replaces it. The configuration
+// must have been verified.
+func (e *encoderCache) writer(c lzma.Writer2Config, lzma2 io.Writer,
+) (w *lzma.Writer2, err error) {
+	p := e.params
+	if e.w != nil && *p.Properties == *c.Properties &&
+		p.DictCap == c.DictCap && p.BufSize == c.BufSize &&
+		p.Matcher == c.Matcher && p.Depth == c.Depth {
+		if err = e.w.Reset(lzma2); err != nil {
+			return nil, err
+		}
+		return e.w, nil
+	}
+	if w, err = c.NewWriter2(lzma2); err != nil {
+		return nil, err
+	}
+	props := *c.Properties
+	c.Properties = &props
+	e.w, e.params = w, c
+	return w, nil
+}
+
+// writeCloser returns an error because the filter is not supported.
+func (f specFilter) writeCloser(w io.WriteCloser, c *WriterConfig,
+) (fw io.WriteCloser, err error) {
+	return nil, f.errUnsupported()
+}
+
 // Writer compresses data written to it. It is an io.WriteCloser.
 type Writer struct {
 	WriterConfig
 
 	xz      io.Writer
 	bw      *blockWriter
+	pw      *parallelWriter
+	bk      backendWriter
 	newHash func() hash.Hash
 	h       header
 	index   []record
 	closed  bool
+	// err is the error of the last Reset
+	err error
+	// cxz counts the compressed bytes written to the underlying
+	// writer
+	cxz *countingWriter
+	// n counts the uncompressed bytes written
+	n int64
+	// stream counts the streams written; uoff is the uncompressed
+	// offset of the next block started
+	stream int
+	uoff   int64
+	// event and start describe the current block for the hooks
+	event BlockEvent
+	start time.Time
+	// enc keeps the LZMA2 writer of the sequential writer
+	enc encoderCache
 }
 
 // newBlockWriter creates a new block writer writes the header out.
 func (w *Writer) newBlockWriter() error {
 	var err error
-	w.bw, err = w.WriterConfig.newBlockWriter(w.xz, w.newHash())
+	w.bw, err = w.WriterConfig.newBlockWriter(w.xz, w.newHash(),
+		w.blockSize(len(w.index)), &w.enc)
 	if err != nil {
 		return err
 	}
+	if w.Hooks != nil {
+		w.event = BlockEvent{
+			Stream: w.stream,
+			Block:  len(w.index),
+			BlockInfo: BlockInfo{
+				Offset:             w.cxz.n,
+				UncompressedOffset: w.uoff,
+				UnpaddedSize:       -1,
+				UncompressedSize:   -1,
+			},
+		}
+		w.start = w.Hooks.blockStart(&w.event)
+	}
 	if err = w.bw.writeHeader(w.xz); err != nil {
 		return err
 	}
@@ -161,45 +204,125 @@ func (w *Writer) closeBlockWriter() error {
 	if err = w.bw.Close(); err != nil {
 		return err
 	}
-	w.index = append(w.index, w.bw.record())
+	rec := w.bw.record()
+	logf(w.Logger, "block record %+v", rec)
+	w.index = append(w.index, rec)
+	w.uoff += rec.uncompressedSize
+	addStat(w.Stats, StatBlocks, 1)
+	if w.Hooks != nil {
+		w.event.UnpaddedSize = rec.unpaddedSize
+		w.event.UncompressedSize = rec.uncompressedSize
+		w.Hooks.blockEnd(&w.event, w.start)
+	}
 	return nil
 }
 
-// NewWriter creates a new xz writer using default parameters.
-func NewWriter(xz io.Writer) (w *Writer, err error) {
-	return WriterConfig{}.NewWriter(xz)
+// NewWriter creates a new xz writer using the default parameters
+// changed by the options.
+func NewWriter(xz io.Writer, opts ...Option) (w *Writer, err error) {
+	c, err := writerConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	return c.NewWriter(xz)
 }
 
 // NewWriter creates a new Writer using the given configuration parameters.
 func (c WriterConfig) NewWriter(xz io.Writer) (w *Writer, err error) {
-	if err = c.Verify(); err != nil {
+	w = new(Writer)
+	if err = w.init(c, xz); err != nil {
 		return nil, err
 	}
-	w = &Writer{
+	return w, nil
+}
+
+// init initializes the writer for a new stream written to xz and writes
+// the stream header. The encoders of the writer are kept for reuse.
+func (w *Writer) init(c WriterConfig, xz io.Writer) (err error) {
+	if err = c.Verify(); err != nil {
+		return err
+	}
+	var free []*encoderCache
+	if w.pw != nil {
+		free = w.pw.free
+	}
+	*w = Writer{
 		WriterConfig: c,
-		xz:           xz,
 		h:            header{c.CheckSum},
 		index:        make([]record, 0, 4),
+		cxz:          &countingWriter{w: &ioWriter{w: xz}},
+		enc:          w.enc,
+	}
+	if c.Stats != nil {
+		w.cxz.w = &statsWriter{w: w.cxz.w, s: c.Stats}
+	}
+	w.xz = w.cxz
+	if w.bk, err = c.newBackendWriter(w.xz); err != nil {
+		return err
+	}
+	if w.bk != nil {
+		return nil
 	}
 	if w.newHash, err = newHashFunc(c.CheckSum); err != nil {
-		return nil, err
+		return err
 	}
 	data, err := w.h.MarshalBinary()
-	if _, err = xz.Write(data); err != nil {
-		return nil, err
+	if _, err = w.xz.Write(data); err != nil {
+		return err
 	}
-	if err = w.newBlockWriter(); err != nil {
-		return nil, err
+	logf(w.Logger, "xz header %s", w.h)
+	if c.Workers > 1 || c.PartSize > 0 {
+		w.pw = c.newParallelWriter()
+		w.pw.free = free
 	}
-	return w, nil
+	// blocks are started by Write
+	return nil
+}
 
+// NewWriterLevel creates a new xz writer using the given compression
+// level. Like the function of the compress/gzip package it is
+// equivalent to NewWriter for DefaultCompression.
+func NewWriterLevel(xz io.Writer, level int) (*Writer, error) {
+	c, err := LevelConfig(level)
+	if err != nil {
+		return nil, err
+	}
+	return c.NewWriter(xz)
 }
 
 // Write compresses the uncompressed data provided.
 func (w *Writer) Write(p []byte) (n int, err error) {
+	n, err = w.write(p)
+	w.n += int64(n)
+	addStat(w.Stats, StatBytesIn, int64(n))
+	if err != nil {
+		addStat(w.Stats, StatErrors, 1)
+	}
+	return n, err
+}
+
+// write compresses the data without counting it.
+func (w *Writer) write(p []byte) (n int, err error) {
 	if w.closed {
 		return 0, errClosed
 	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.bk != nil {
+		return w.bk.Write(p)
+	}
+	if w.pw != nil {
+		return w.writeParallel(p)
+	}
+	if w.bw == nil {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		if err = w.newBlockWriter(); err != nil {
+			return 0, err
+		}
+	}
 	for {
 		k, err := w.bw.Write(p[n:])
 		n += k
@@ -215,30 +338,202 @@ func (w *Writer) Write(p []byte) (n int, err error) {
 	}
 }
 
+// Flush writes all buffered data to the underlying writer, so that a
+// reader can decompress all data written so far. It uses the FlushMode
+// of the configuration; see FlushWithMode.
+func (w *Writer) Flush() error {
+	return w.FlushWithMode(w.FlushMode)
+}
+
+// FlushWithMode flushes the writer using the given mode. In sequential
+// mode FlushChunk flushes the LZMA2 data of the current block and
+// FlushBlock ends the block like EndBlock. In parallel mode blocks are
+// compressed independently, so both modes compress the buffered data
+// into a block and write all pending blocks.
+func (w *Writer) FlushWithMode(mode FlushMode) error {
+	if w.closed {
+		return errClosed
+	}
+	if w.err != nil {
+		return w.err
+	}
+	if mode > FlushBlock {
+		return fmt.Errorf("xz: %s not supported", mode)
+	}
+	if w.bk != nil {
+		if mode == FlushBlock {
+			return w.bk.EndBlock()
+		}
+		return w.bk.Flush()
+	}
+	if w.pw != nil {
+		return w.flushParallel()
+	}
+	if mode == FlushBlock {
+		return w.EndBlock()
+	}
+	if w.bw == nil {
+		return nil
+	}
+	return w.bw.Flush()
+}
+
+// EndBlock ends the current block, so that the data written next
+// starts a new block. Nothing happens if no data has been written to
+// the current block, so that no empty blocks are created. Readers
+// supporting random access can start decompression at the beginning of
+// every block.
+func (w *Writer) EndBlock() error {
+	if w.closed {
+		return errClosed
+	}
+	if w.err != nil {
+		return w.err
+	}
+	if w.bk != nil {
+		return w.bk.EndBlock()
+	}
+	if w.pw != nil {
+		pw := w.pw
+		if pw.err != nil {
+			return pw.err
+		}
+		if len(pw.buf) == 0 {
+			return nil
+		}
+		if err := w.startBlock(); err != nil {
+			pw.err = err
+			return err
+		}
+		return nil
+	}
+	if w.bw == nil || w.bw.uncompressedSize() == 0 {
+		return nil
+	}
+	err := w.closeBlockWriter()
+	// the next block is started by Write
+	w.bw = nil
+	return err
+}
+
 // Close closes the writer and adds the footer to the Writer. Close
-// doesn't close the underlying writer.
+// doesn't close the underlying writer. If no data has been written, the
+// stream contains no blocks unless EmptyBlock is set.
 func (w *Writer) Close() error {
+	err := w.close()
+	if err != nil {
+		addStat(w.Stats, StatErrors, 1)
+	}
+	return err
+}
+
+// close closes the writer without counting errors.
+func (w *Writer) close() error {
 	if w.closed {
 		return errClosed
 	}
 	w.closed = true
+	if w.err != nil {
+		return w.err
+	}
+	if w.bk != nil {
+		return w.bk.Close()
+	}
 	var err error
-	if err = w.closeBlockWriter(); err != nil {
+	if w.pw != nil {
+		err = w.closeParallel()
+	} else {
+		if w.bw == nil && len(w.index) == 0 && w.EmptyBlock {
+			err = w.newBlockWriter()
+		}
+		if err == nil && w.bw != nil {
+			err = w.closeBlockWriter()
+		}
+	}
+	if err != nil {
 		return err
 	}
+	_, err = w.writeFooter()
+	return err
+}
+
+// CompressedCount returns the number of bytes written to the
+// underlying writer. Buffered data is not included before it is written
+// by Flush, EndBlock or Close.
+func (w *Writer) CompressedCount() int64 {
+	if w.cxz == nil {
+		return 0
+	}
+	return w.cxz.n
+}
+
+// UncompressedCount returns the number of bytes accepted by Write.
+func (w *Writer) UncompressedCount() int64 {
+	return w.n
+}
+
+// Ratio returns the ratio of the compressed and uncompressed counts as
+// reported by xz --list. The ratio is only meaningful after Flush or
+// Close, because the writer buffers data.
+func (w *Writer) Ratio() float64 {
+	return ratio(w.CompressedCount(), w.n)
+}
 
+// Block returns the index of the block that receives the data written
+// next. The blocks are counted from the start of the output. It is -1
+// if the backend doesn't provide the index.
+func (w *Writer) Block() int {
+	switch {
+	case w.bk != nil:
+		return -1
+	case w.pw != nil:
+		return w.pw.blocks
+	case w.bw == nil || w.bw.uncompressedSize() < w.bw.blockSize:
+		return len(w.index)
+	}
+	return len(w.index) + 1
+}
+
+// writeFooter writes the index and the footer of the stream. It returns
+// the number of bytes written.
+func (w *Writer) writeFooter() (n int64, err error) {
 	f := footer{flags: w.h.flags}
 	if f.indexSize, err = writeIndex(w.xz, w.index); err != nil {
-		return err
+		return 0, err
 	}
 	data, err := f.MarshalBinary()
 	if err != nil {
-		return err
+		return 0, err
 	}
 	if _, err = w.xz.Write(data); err != nil {
-		return err
+		return 0, err
+	}
+	logf(w.Logger, "xz footer %s", f)
+	w.stream++
+	addStat(w.Stats, StatStreams, 1)
+	return f.indexSize + footerLen, nil
+}
+
+// Reset discards the state of the writer and starts a new stream written
+// to xz with the configuration of the writer, so that a Writer can be
+// reused rather than allocated again. The LZMA2 encoders are kept, which
+// saves the allocation of the dictionaries and match finders. Blocks
+// still compressed by the workers of a parallel writer are waited for
+// and discarded; the resources of a liblzma backend writer not closed
+// are released. Data not written by Close is discarded. Like the Reset
+// methods of the compress/flate and compress/gzip writers it doesn't
+// return an error; an error writing the stream header is returned by
+// the next call of Write, Flush, EndBlock or Close.
+func (w *Writer) Reset(xz io.Writer) {
+	if w.pw != nil {
+		w.pw.discard()
+	}
+	if w.bk != nil && !w.closed {
+		w.bk.release()
+	}
+	if err := w.init(w.WriterConfig, xz); err != nil {
+		*w = Writer{WriterConfig: w.WriterConfig, enc: w.enc, err: err}
 	}
-	return nil
 }
 
 // countingWriter is a writer that counts all data written to it.
@@ -272,18 +567,28 @@ type blockWriter struct {
 	hash    hash.Hash
 }
 
-// newBlockWriter creates a new block writer.
-func (c *WriterConfig) newBlockWriter(xz io.Writer, hash hash.Hash) (bw *blockWriter, err error) {
+// newBlockWriter creates a new block writer. The argument blockSize
+// limits the uncompressed size of the block. The LZMA2 writer is taken
+// from the encoder cache.
+func (c *WriterConfig) newBlockWriter(xz io.Writer, hash hash.Hash,
+	blockSize int64, enc *encoderCache) (bw *blockWriter, err error) {
 	bw = &blockWriter{
 		cxz:       countingWriter{w: xz},
-		blockSize: c.BlockSize,
+		blockSize: blockSize,
 		filters:   c.filters(),
 		hash:      hash,
 	}
-	bw.w, err = c.newFilterWriteCloser(&bw.cxz, bw.filters)
+	if err = verifyFilters(bw.filters); err != nil {
+		return nil, err
+	}
+	// the writer uses only the LZMA2 filter
+	config, err := bw.filters[0].(*lzmaFilter).writer2Config(c)
 	if err != nil {
 		return nil, err
 	}
+	if bw.w, err = enc.writer(config, &bw.cxz); err != nil {
+		return nil, err
+	}
 	bw.mw = io.MultiWriter(bw.w, bw.hash)
 	return bw, nil
 }
@@ -366,6 +671,24 @@ func (bw *blockWriter) Write(p []byte) (n int, err error) {
 	return n, err
 }
 
+// flusher is implemented by filter writers that can flush their data.
+type flusher interface {
+	Flush() error
+}
+
+// Flush flushes the data written to the block writer if the filter
+// writer supports it.
+func (bw *blockWriter) Flush() error {
+	if bw.closed {
+		return errClosed
+	}
+	f, ok := bw.w.(flusher)
+	if !ok {
+		return nil
+	}
+	return f.Flush()
+}
+
 // Close closes the writer.
 func (bw *blockWriter) Close() error {
 	if bw.closed {
@@ -2,17 +2,25 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
 package xz
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"io"
+	"io/ioutil"
 	"log"
 	"math/rand"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/ulikunitz/xz/internal/randtxt"
+	"github.com/ulikunitz/xz/lzma"
 )
 
 func TestWriter(t *testing.T) {
@@ -136,3 +144,910 @@ func TestWriter2(t *testing.T) {
 		t.Fatal("decompressed data differs from original")
 	}
 }
+
+// failingWriter fails all writes.
+type failingWriter struct{}
+
+var errSink = errors.New("sink failed")
+
+func (failingWriter) Write(p []byte) (n int, err error) {
+	return 0, errSink
+}
+
+func TestWriterIOError(t *testing.T) {
+	// the liblzma backend writes the stream header later
+	w, err := NewWriter(failingWriter{})
+	if err == nil {
+		if _, err = w.Write([]byte("foo")); err == nil {
+			err = w.Close()
+		}
+	}
+	if !errors.Is(err, ErrIO) || !errors.Is(err, errSink) ||
+		errors.Is(err, ErrCorrupt) {
+		t.Fatalf("error %q not classified as ErrIO", err)
+	}
+}
+
+func TestWriterBlockList(t *testing.T) {
+	const txtlen = 10000
+	var buf bytes.Buffer
+	io.CopyN(&buf, randtxt.NewReader(rand.NewSource(42)), txtlen)
+	txt := buf.Bytes()
+
+	tests := []struct {
+		blockSize int64
+		blockList []int64
+		want      []int64
+	}{
+		{4096, nil, []int64{4096, 4096, 1808}},
+		{4096, []int64{1000, 3000}, []int64{1000, 3000, 3000, 3000}},
+		{4096, []int64{1000, 0}, []int64{1000, 4096, 4096, 808}},
+		{2000, []int64{5000}, []int64{2000, 2000, 2000, 2000, 2000}},
+	}
+	for _, c := range tests {
+		var xzbuf bytes.Buffer
+		cfg := WriterConfig{BlockSize: c.blockSize, BlockList: c.blockList}
+		w, err := cfg.NewWriter(&xzbuf)
+		if err != nil {
+			t.Fatalf("NewWriter error %s", err)
+		}
+		if _, err = w.Write(txt); err != nil {
+			t.Fatalf("Write error %s", err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("Close error %s", err)
+		}
+		streams, err := ReadStreamInfo(bytes.NewReader(xzbuf.Bytes()),
+			int64(xzbuf.Len()))
+		if err != nil {
+			t.Fatalf("ReadStreamInfo error %s", err)
+		}
+		blocks := streams[0].Blocks
+		if len(blocks) != len(c.want) {
+			t.Fatalf("block list %v: got %d blocks; want %d",
+				c.blockList, len(blocks), len(c.want))
+		}
+		for i, b := range blocks {
+			if b.UncompressedSize != c.want[i] {
+				t.Errorf("block list %v: block %d has size %d; "+
+					"want %d", c.blockList, i,
+					b.UncompressedSize, c.want[i])
+			}
+		}
+	}
+}
+
+func TestWriterConfigEmbedded(t *testing.T) {
+	cfg := WriterConfig{Embedded: true}
+	if err := cfg.Verify(); err != nil {
+		t.Fatalf("Verify error %s", err)
+	}
+	if cfg.CheckSum != CRC32 {
+		t.Fatalf("CheckSum is %#x; want CRC32", cfg.CheckSum)
+	}
+	cfg = WriterConfig{Embedded: true, CheckSum: CRC64}
+	if err := cfg.Verify(); err == nil {
+		t.Fatal("Verify accepted CRC64 check")
+	}
+	cfg = WriterConfig{Embedded: true, DictCap: 2 * EmbeddedMaxDictCap}
+	if err := cfg.Verify(); err == nil {
+		t.Fatal("Verify accepted too large dictionary capacity")
+	}
+
+	var buf bytes.Buffer
+	w, err := WriterConfig{Embedded: true}.NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	if _, err = io.WriteString(w, "Hello, kernel!\n"); err != nil {
+		t.Fatalf("WriteString error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("Close error %s", err)
+	}
+	data := buf.Bytes()
+	streams, err := ReadStreamInfo(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ReadStreamInfo error %s", err)
+	}
+	if len(streams) != 1 || streams[0].CheckSum != CRC32 {
+		t.Fatalf("output is not a single stream with CRC32 check")
+	}
+}
+
+func TestWriterConfigBlockListVerify(t *testing.T) {
+	cfg := WriterConfig{BlockList: []int64{0, 1000}}
+	if err := cfg.Verify(); err == nil {
+		t.Fatal("Verify accepted zero size in front of block list")
+	}
+	cfg.BlockList = []int64{-1}
+	if err := cfg.Verify(); err == nil {
+		t.Fatal("Verify accepted negative block size")
+	}
+}
+
+func TestWriterParallel(t *testing.T) {
+	const txtlen = 100000
+	var buf bytes.Buffer
+	io.CopyN(&buf, randtxt.NewReader(rand.NewSource(43)), txtlen)
+	txt := buf.Bytes()
+
+	for _, workers := range []int{2, 4} {
+		var xzbuf bytes.Buffer
+		cfg := WriterConfig{Workers: workers, BlockSize: 8192}
+		w, err := cfg.NewWriter(&xzbuf)
+		if err != nil {
+			t.Fatalf("NewWriter error %s", err)
+		}
+		// write in odd pieces to cross the block boundaries
+		for p := txt; len(p) > 0; {
+			k := 3001
+			if k > len(p) {
+				k = len(p)
+			}
+			if _, err = w.Write(p[:k]); err != nil {
+				t.Fatalf("Write error %s", err)
+			}
+			p = p[k:]
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("Close error %s", err)
+		}
+		streams, err := ReadStreamInfo(bytes.NewReader(xzbuf.Bytes()),
+			int64(xzbuf.Len()))
+		if err != nil {
+			t.Fatalf("ReadStreamInfo error %s", err)
+		}
+		if n := len(streams[0].Blocks); n != (txtlen+8191)/8192 {
+			t.Fatalf("got %d blocks; want %d", n,
+				(txtlen+8191)/8192)
+		}
+		r, err := NewReader(&xzbuf)
+		if err != nil {
+			t.Fatalf("NewReader error %s", err)
+		}
+		var out bytes.Buffer
+		if _, err = io.Copy(&out, r); err != nil {
+			t.Fatalf("io.Copy error %s", err)
+		}
+		if !bytes.Equal(out.Bytes(), txt) {
+			t.Fatalf("workers %d: decompressed data differs",
+				workers)
+		}
+	}
+}
+
+func TestWriterSetConcurrency(t *testing.T) {
+	w, err := NewWriter(ioutil.Discard)
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	if err = w.SetConcurrency(2); err == nil {
+		t.Fatalf("SetConcurrency accepted sequential writer")
+	}
+	if Backend != "go" {
+		t.Skip("the backend doesn't support SetConcurrency")
+	}
+	const txtlen = 100000
+	var buf bytes.Buffer
+	io.CopyN(&buf, randtxt.NewReader(rand.NewSource(43)), txtlen)
+	txt := buf.Bytes()
+
+	var xzbuf bytes.Buffer
+	cfg := WriterConfig{Workers: 4, BlockSize: 8192}
+	if w, err = cfg.NewWriter(&xzbuf); err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	if err = w.SetConcurrency(0); err == nil {
+		t.Fatalf("SetConcurrency accepted zero")
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, n := range []int{1, 8, 2} {
+			if err := w.SetConcurrency(n); err != nil {
+				t.Errorf("SetConcurrency error %s", err)
+			}
+		}
+	}()
+	if _, err = w.Write(txt[:txtlen/2]); err != nil {
+		t.Fatalf("Write error %s", err)
+	}
+	<-done
+	if err = w.SetConcurrency(1); err != nil {
+		t.Fatalf("SetConcurrency error %s", err)
+	}
+	if _, err = w.Write(txt[txtlen/2:]); err != nil {
+		t.Fatalf("Write error %s", err)
+	}
+	if n := len(w.pw.pending); n > 1 {
+		t.Fatalf("%d blocks pending with concurrency 1", n)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("Close error %s", err)
+	}
+	r, err := NewReader(&xzbuf)
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll error %s", err)
+	}
+	if !bytes.Equal(out, txt) {
+		t.Fatalf("decompressed data differs")
+	}
+}
+
+func TestWriterParallelEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := WriterConfig{Workers: 2}.NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("Close error %s", err)
+	}
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	n, err := io.Copy(ioutil.Discard, r)
+	if err != nil {
+		t.Fatalf("io.Copy error %s", err)
+	}
+	if n != 0 {
+		t.Fatalf("read %d bytes; want %d", n, 0)
+	}
+}
+
+func TestWriterEmpty(t *testing.T) {
+	tests := []struct {
+		name   string
+		c      WriterConfig
+		blocks int
+		flush  bool
+	}{
+		{"sequential", WriterConfig{}, 0, false},
+		{"flush", WriterConfig{}, 0, true},
+		{"flushBlock", WriterConfig{FlushMode: FlushBlock}, 0, true},
+		{"parallel", WriterConfig{Workers: 2}, 0, true},
+		{"part", WriterConfig{PartSize: MinPartSize}, 0, false},
+		{"embedded", WriterConfig{Embedded: true}, 0, false},
+		{"emptyBlock", WriterConfig{EmptyBlock: true}, 1, true},
+		{"parallelEmptyBlock",
+			WriterConfig{Workers: 2, EmptyBlock: true}, 1, false},
+		{"partEmptyBlock",
+			WriterConfig{PartSize: MinPartSize, EmptyBlock: true},
+			1, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if Backend != "go" && tc.c.PartSize == 0 &&
+				tc.blocks > 0 {
+				t.Skip("the backend ignores EmptyBlock")
+			}
+			var buf bytes.Buffer
+			w, err := tc.c.NewWriter(&buf)
+			if err != nil {
+				t.Fatalf("NewWriter error %s", err)
+			}
+			if tc.flush {
+				if err = w.Flush(); err != nil {
+					t.Fatalf("Flush error %s", err)
+				}
+				if err = w.EndBlock(); err != nil {
+					t.Fatalf("EndBlock error %s", err)
+				}
+			}
+			if err = w.Close(); err != nil {
+				t.Fatalf("Close error %s", err)
+			}
+			data := buf.Bytes()
+			if tc.blocks == 0 && len(data) != 32 {
+				t.Fatalf("stream has %d bytes; want %d",
+					len(data), 32)
+			}
+			streams, err := ReadStreamInfo(bytes.NewReader(data),
+				int64(len(data)))
+			if err != nil {
+				t.Fatalf("ReadStreamInfo error %s", err)
+			}
+			if len(streams) != 1 {
+				t.Fatalf("got %d streams; want %d",
+					len(streams), 1)
+			}
+			s := streams[0]
+			if len(s.Blocks) != tc.blocks {
+				t.Fatalf("stream has %d blocks; want %d",
+					len(s.Blocks), tc.blocks)
+			}
+			for _, b := range s.Blocks {
+				if b.UncompressedSize != 0 {
+					t.Fatalf("block has %d bytes; want %d",
+						b.UncompressedSize, 0)
+				}
+			}
+			r, err := NewReader(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("NewReader error %s", err)
+			}
+			p := make([]byte, 16)
+			n, err := r.Read(p)
+			if n != 0 || err != io.EOF {
+				t.Fatalf("Read returned %d, %v; want %d, %v",
+					n, err, 0, io.EOF)
+			}
+			out, err := Decompress(nil, data, 0)
+			if err != nil {
+				t.Fatalf("Decompress error %s", err)
+			}
+			if len(out) != 0 {
+				t.Fatalf("Decompress returned %d bytes; want %d",
+					len(out), 0)
+			}
+		})
+	}
+}
+
+func TestWriterDecisionTrace(t *testing.T) {
+	const text = "The quick brown fox jumps over the lazy dog.\n"
+	var buf, trace bytes.Buffer
+	w, err := NewWriter(&buf, WithDecisionTrace(&trace),
+		WithBlockSize(int64(len(text))))
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	if _, err = io.WriteString(w, text+text); err != nil {
+		t.Fatalf("WriteString error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("w.Close error %s", err)
+	}
+	dec := json.NewDecoder(&trace)
+	starts := 0
+	var n int
+	for {
+		var d lzma.Decision
+		if err = dec.Decode(&d); err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Decode error %s", err)
+		}
+		if d.Pos == 0 {
+			starts++
+		}
+		n += d.Len
+	}
+	if n != 2*len(text) {
+		t.Fatalf("decisions cover %d bytes; want %d", n, 2*len(text))
+	}
+	// the positions restart in the second block
+	if starts != 2 {
+		t.Fatalf("got %d decisions at position 0; want %d", starts, 2)
+	}
+
+	_, err = NewWriter(ioutil.Discard, WithDecisionTrace(&trace),
+		WithWorkers(2))
+	if err == nil {
+		t.Fatalf("NewWriter with Workers 2 and DecisionTrace " +
+			"succeeded")
+	}
+}
+
+func TestWriterFlush(t *testing.T) {
+	const txt = "The quick brown fox jumps over the lazy dog."
+	for _, workers := range []int{1, 2} {
+		var buf bytes.Buffer
+		w, err := WriterConfig{Workers: workers}.NewWriter(&buf)
+		if err != nil {
+			t.Fatalf("NewWriter error %s", err)
+		}
+		if _, err = io.WriteString(w, txt); err != nil {
+			t.Fatalf("WriteString error %s", err)
+		}
+		if err = w.Flush(); err != nil {
+			t.Fatalf("Flush error %s", err)
+		}
+		// the flushed data must be decodable without the footer
+		r, err := NewReader(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("NewReader error %s", err)
+		}
+		p := make([]byte, len(txt))
+		if _, err = io.ReadFull(r, p); err != nil {
+			t.Fatalf("workers %d: ReadFull error %s", workers, err)
+		}
+		if string(p) != txt {
+			t.Fatalf("workers %d: got %q; want %q", workers, p,
+				txt)
+		}
+		if _, err = io.WriteString(w, txt); err != nil {
+			t.Fatalf("WriteString error %s", err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("Close error %s", err)
+		}
+		r, err = NewReader(&buf)
+		if err != nil {
+			t.Fatalf("NewReader error %s", err)
+		}
+		out, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("ReadAll error %s", err)
+		}
+		if string(out) != txt+txt {
+			t.Fatalf("workers %d: got %q; want %q", workers, out,
+				txt+txt)
+		}
+	}
+}
+
+func TestWriterEndBlock(t *testing.T) {
+	parts := []string{"The quick ", "brown fox ", "jumps over ",
+		"the lazy dog."}
+	for _, workers := range []int{1, 2} {
+		var buf bytes.Buffer
+		w, err := WriterConfig{Workers: workers}.NewWriter(&buf)
+		if err != nil {
+			t.Fatalf("NewWriter error %s", err)
+		}
+		for _, s := range parts {
+			if _, err = io.WriteString(w, s); err != nil {
+				t.Fatalf("WriteString error %s", err)
+			}
+			// the second call must not create an empty block
+			for i := 0; i < 2; i++ {
+				if err = w.EndBlock(); err != nil {
+					t.Fatalf("EndBlock error %s", err)
+				}
+			}
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("Close error %s", err)
+		}
+		streams, err := ReadStreamInfo(bytes.NewReader(buf.Bytes()),
+			int64(buf.Len()))
+		if err != nil {
+			t.Fatalf("ReadStreamInfo error %s", err)
+		}
+		blocks := streams[0].Blocks
+		if len(blocks) != len(parts) {
+			t.Fatalf("workers %d: got %d blocks; want %d", workers,
+				len(blocks), len(parts))
+		}
+		for i, s := range parts {
+			if blocks[i].UncompressedSize != int64(len(s)) {
+				t.Fatalf("workers %d: block %d has size %d; "+
+					"want %d", workers, i,
+					blocks[i].UncompressedSize, len(s))
+			}
+		}
+	}
+}
+
+func TestWriterFlushMode(t *testing.T) {
+	const txt = "The quick brown fox jumps over the lazy dog."
+	tests := []struct {
+		mode   FlushMode
+		blocks int
+	}{
+		{FlushChunk, 1},
+		{FlushBlock, 3},
+	}
+	for _, tc := range tests {
+		var buf bytes.Buffer
+		w, err := NewWriter(&buf, WithFlushMode(tc.mode))
+		if err != nil {
+			t.Fatalf("NewWriter error %s", err)
+		}
+		for i := 1; i <= 3; i++ {
+			if _, err = io.WriteString(w, txt); err != nil {
+				t.Fatalf("WriteString error %s", err)
+			}
+			if err = w.Flush(); err != nil {
+				t.Fatalf("Flush error %s", err)
+			}
+			// the flushed data must be decodable
+			r, err := NewReader(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatalf("NewReader error %s", err)
+			}
+			p := make([]byte, i*len(txt))
+			if _, err = io.ReadFull(r, p); err != nil {
+				t.Fatalf("%s: ReadFull error %s", tc.mode, err)
+			}
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("w.Close error %s", err)
+		}
+		streams, err := ReadStreamInfo(bytes.NewReader(buf.Bytes()),
+			int64(buf.Len()))
+		if err != nil {
+			t.Fatalf("ReadStreamInfo error %s", err)
+		}
+		if n := len(streams[0].Blocks); n != tc.blocks {
+			t.Fatalf("%s: got %d blocks; want %d", tc.mode, n,
+				tc.blocks)
+		}
+	}
+
+	// the mode can be selected per call
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	for _, mode := range []FlushMode{FlushChunk, FlushBlock, FlushChunk} {
+		if _, err = io.WriteString(w, txt); err != nil {
+			t.Fatalf("WriteString error %s", err)
+		}
+		if err = w.FlushWithMode(mode); err != nil {
+			t.Fatalf("FlushWithMode(%s) error %s", mode, err)
+		}
+	}
+	if err = w.FlushWithMode(FlushBlock + 1); err == nil {
+		t.Fatalf("FlushWithMode accepted an unsupported mode")
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("w.Close error %s", err)
+	}
+	streams, err := ReadStreamInfo(bytes.NewReader(buf.Bytes()),
+		int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("ReadStreamInfo error %s", err)
+	}
+	if n := len(streams[0].Blocks); n != 2 {
+		t.Fatalf("got %d blocks; want 2", n)
+	}
+
+	c := WriterConfig{FlushMode: FlushBlock + 1}
+	if err = c.Verify(); err == nil {
+		t.Fatalf("Verify accepted an unsupported FlushMode")
+	}
+}
+
+// errWriter fails all writes.
+type errWriter struct{}
+
+func (errWriter) Write(p []byte) (n int, err error) {
+	return 0, errors.New("write failed")
+}
+
+func TestWriterReset(t *testing.T) {
+	texts := []string{"The quick brown fox jumps over the lazy dog.",
+		"Hello\nWorld!\n"}
+	// the interfaces used for pooling writers and readers
+	type resetWriter interface {
+		io.WriteCloser
+		Flush() error
+		Reset(w io.Writer)
+	}
+	type resetReader interface {
+		io.Reader
+		Reset(r io.Reader) error
+	}
+	for _, workers := range []int{1, 2} {
+		var w resetWriter
+		var r resetReader
+		for i, txt := range texts {
+			var buf bytes.Buffer
+			if w == nil {
+				xw, err := WriterConfig{Workers: workers}.NewWriter(
+					&buf)
+				if err != nil {
+					t.Fatalf("NewWriter error %s", err)
+				}
+				w = xw
+			} else {
+				w.Reset(&buf)
+			}
+			if _, err := io.WriteString(w, txt); err != nil {
+				t.Fatalf("WriteString error %s", err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close error %s", err)
+			}
+			if r == nil {
+				xr, err := NewReader(&buf)
+				if err != nil {
+					t.Fatalf("NewReader error %s", err)
+				}
+				r = xr
+			} else if err := r.Reset(&buf); err != nil {
+				t.Fatalf("Reset error %s", err)
+			}
+			out, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatalf("ReadAll error %s", err)
+			}
+			if string(out) != txt {
+				t.Fatalf("workers %d, text %d: got %q; want %q",
+					workers, i, out, txt)
+			}
+		}
+	}
+
+	w, err := NewWriter(ioutil.Discard)
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	// the liblzma backend writes the stream header with the first
+	// block
+	w.Reset(errWriter{})
+	if _, err = w.Write([]byte("a")); err == nil && Backend == "go" {
+		t.Fatal("Write succeeded after failed Reset")
+	}
+	if err = w.Close(); err == nil {
+		t.Fatal("Close succeeded after failed Reset")
+	}
+
+	var buf bytes.Buffer
+	r, err := NewReader(bytes.NewReader(foxXZ(t)))
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	if err = r.Reset(&buf); err == nil && Backend == "go" {
+		t.Fatal("Reset succeeded for empty input")
+	}
+	if _, err = r.Read(make([]byte, 1)); err == nil {
+		t.Fatal("Read succeeded for empty input")
+	}
+}
+
+func TestWriterResetReuse(t *testing.T) {
+	if Backend != "go" {
+		t.Skip("the backend doesn't use the Go encoder")
+	}
+	txt := []byte(strings.Repeat("The quick brown fox jumps over the lazy dog.",
+		1000))
+	cfg := WriterConfig{DictCap: 1 << 16, BlockSize: 8192}
+	var buf bytes.Buffer
+	w, err := cfg.NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	if _, err = w.Write(txt); err != nil {
+		t.Fatalf("Write error %s", err)
+	}
+	lw := w.enc.w
+	if lw == nil {
+		t.Fatal("no LZMA2 writer cached")
+	}
+	// Reset without Close discards the data
+	buf.Reset()
+	w.Reset(&buf)
+	if _, err = w.Write(txt); err != nil {
+		t.Fatalf("Write error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("Close error %s", err)
+	}
+	if w.enc.w != lw {
+		t.Fatal("Reset didn't keep the LZMA2 writer")
+	}
+
+	r, err := NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	if _, err = io.Copy(ioutil.Discard, r); err != nil {
+		t.Fatalf("Copy error %s", err)
+	}
+	lr := r.dec.r
+	if lr == nil {
+		t.Fatal("no LZMA2 reader cached")
+	}
+	if err = r.Reset(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("Reset error %s", err)
+	}
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll error %s", err)
+	}
+	if !bytes.Equal(out, txt) {
+		t.Fatal("decompressed data differs from the original")
+	}
+	if r.dec.r != lr {
+		t.Fatal("Reset didn't keep the LZMA2 reader")
+	}
+
+	// the blocks started by a parallel writer are waited for
+	cfg.Workers = 4
+	if w, err = cfg.NewWriter(ioutil.Discard); err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	if _, err = w.Write(txt); err != nil {
+		t.Fatalf("Write error %s", err)
+	}
+	if len(w.pw.pending) == 0 {
+		t.Fatal("no blocks pending")
+	}
+	w.Reset(ioutil.Discard)
+	if len(w.pw.free) == 0 {
+		t.Fatal("encoders of the discarded blocks not kept")
+	}
+}
+
+func TestWriterPartSize(t *testing.T) {
+	const partSize = MinPartSize
+	var tbuf bytes.Buffer
+	// the random source generates incompressible data
+	io.CopyN(&tbuf, randtxt.NewReader(rand.NewSource(3)), 200000)
+	io.CopyN(&tbuf, rand.New(rand.NewSource(4)), 100000)
+	txt := tbuf.Bytes()
+	for _, workers := range []int{1, 3} {
+		var buf bytes.Buffer
+		cfg := WriterConfig{PartSize: partSize, Workers: workers}
+		w, err := cfg.NewWriter(&buf)
+		if err != nil {
+			t.Fatalf("NewWriter error %s", err)
+		}
+		if _, err = w.Write(txt); err != nil {
+			t.Fatalf("Write error %s", err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("Close error %s", err)
+		}
+		data := buf.Bytes()
+		if len(data) <= 2*partSize {
+			t.Fatalf("compressed size %d too small for test",
+				len(data))
+		}
+		var out []byte
+		for off := 0; off < len(data); off += partSize {
+			end := off + partSize
+			if end > len(data) {
+				end = len(data)
+			}
+			r, err := NewReader(bytes.NewReader(data[off:end]))
+			if err != nil {
+				t.Fatalf("part at %d: NewReader error %s", off,
+					err)
+			}
+			p, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatalf("part at %d: ReadAll error %s", off,
+					err)
+			}
+			out = append(out, p...)
+		}
+		if !bytes.Equal(out, txt) {
+			t.Fatalf("workers %d: decompressed parts differ from "+
+				"input", workers)
+		}
+	}
+
+	cfg := WriterConfig{PartSize: MinPartSize + 2}
+	if err := cfg.Verify(); err == nil {
+		t.Fatal("Verify accepted part size not a multiple of four")
+	}
+	cfg = WriterConfig{PartSize: MinPartSize, BlockSize: MinPartSize}
+	if err := cfg.Verify(); err == nil {
+		t.Fatal("Verify accepted block size larger than half the " +
+			"part size")
+	}
+	cfg = WriterConfig{PartSize: MinPartSize, Embedded: true}
+	if err := cfg.Verify(); err == nil {
+		t.Fatal("Verify accepted part size for XZ Embedded")
+	}
+}
+
+func TestNewWriterLevel(t *testing.T) {
+	const txt = "The quick brown fox jumps over the lazy dog."
+	for _, level := range []int{BestSpeed, 3, BestCompression,
+		DefaultCompression} {
+		var buf bytes.Buffer
+		w, err := NewWriterLevel(&buf, level)
+		if err != nil {
+			t.Fatalf("NewWriterLevel(%d) error %s", level, err)
+		}
+		if _, err = io.WriteString(w, txt); err != nil {
+			t.Fatalf("WriteString error %s", err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("Close error %s", err)
+		}
+		r, err := NewReader(&buf)
+		if err != nil {
+			t.Fatalf("NewReader error %s", err)
+		}
+		out, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("ReadAll error %s", err)
+		}
+		if err = r.Close(); err != nil {
+			t.Fatalf("Reader.Close error %s", err)
+		}
+		if string(out) != txt {
+			t.Fatalf("level %d: got %q; want %q", level, out, txt)
+		}
+	}
+	c, err := LevelConfig(DefaultCompression)
+	if err != nil {
+		t.Fatalf("LevelConfig error %s", err)
+	}
+	var d WriterConfig
+	if err = d.Verify(); err != nil {
+		t.Fatalf("Verify error %s", err)
+	}
+	if c.DictCap != d.DictCap {
+		t.Fatalf("default level uses dictionary capacity %d; want %d",
+			c.DictCap, d.DictCap)
+	}
+	for _, level := range []int{-2, 10} {
+		if _, err = NewWriterLevel(ioutil.Discard, level); err == nil {
+			t.Fatalf("NewWriterLevel accepted level %d", level)
+		}
+	}
+}
+
+func TestParsePreset(t *testing.T) {
+	tests := []struct {
+		preset    string
+		dictCap   int
+		lc        int
+		matcher   lzma.MatchAlgorithm
+		check     byte
+		blockSize int64
+		depth     int
+	}{
+		{"6", 1 << 23, 3, lzma.HashTable4, 0, 0, 0},
+		{"9e", 1 << 26, 3, lzma.HashTable4, 0, 0, ExtremeDepth},
+		{"preset=3,dict=32MiB", 32 << 20, 3, lzma.HashTable4, 0, 0, 0},
+		{"dict=32MiB,preset=3", 1 << 22, 3, lzma.HashTable4, 0, 0, 0},
+		{"preset=0e, lc=4,lp=0, mf=bt4", 1 << 18, 4,
+			lzma.BinaryTree, 0, 0, ExtremeDepth},
+		{"dict=64k,check=SHA256,block=1m", 1 << 16, 3,
+			lzma.HashTable4, SHA256, 1 << 20, 0},
+		{"preset=6e,depth=64", 1 << 23, 3, lzma.HashTable4, 0, 0, 64},
+	}
+	for _, tc := range tests {
+		c, err := ParsePreset(tc.preset)
+		if err != nil {
+			t.Fatalf("ParsePreset(%q) error %s", tc.preset, err)
+		}
+		if c.DictCap != tc.dictCap || c.Properties.LC != tc.lc ||
+			c.Matcher != tc.matcher || c.CheckSum != tc.check ||
+			c.BlockSize != tc.blockSize || c.Depth != tc.depth {
+			t.Fatalf("ParsePreset(%q) returned %+v", tc.preset, c)
+		}
+	}
+	for _, preset := range []string{"", "10", "-1", "+3", "6ee",
+		"preset=x", "dict=", "dict=3", "dict=4GiB", "lc=5,lp=1",
+		"mf=hc3", "check=none", "nice=273", "block=1t", "depth=-1",
+		"depth=5000"} {
+		if _, err := ParsePreset(preset); err == nil {
+			t.Fatalf("ParsePreset accepted %q", preset)
+		}
+	}
+}
+
+func TestWriterConfigVerifyErrors(t *testing.T) {
+	cfg := WriterConfig{DictCap: 3, Workers: -1, CheckSum: 5}
+	err := cfg.Verify()
+	if err == nil {
+		t.Fatal("Verify accepted invalid configuration")
+	}
+	want := []string{
+		"xz: DictCap 3 bytes not in [4 KiB, 4294967295 bytes]",
+		"xz: Workers -1 is negative",
+		"xz: CheckSum 0x05 not supported; use CRC32, CRC64 or SHA256",
+	}
+	if s := err.Error(); s != strings.Join(want, "\n") {
+		t.Fatalf("Verify error %q; want %q", s,
+			strings.Join(want, "\n"))
+	}
+
+	// a single error is returned unchanged
+	cfg = WriterConfig{Properties: &lzma.Properties{LC: 3, LP: 2, PB: 2}}
+	if err = cfg.Verify(); err != lzma.ErrLCLPTooLarge {
+		t.Fatalf("Verify error %v; want %v", err, lzma.ErrLCLPTooLarge)
+	}
+	cfg = WriterConfig{DictCap: 3, Properties: &lzma.Properties{
+		LC: 3, LP: 2, PB: 2}}
+	if err = cfg.Verify(); !errors.Is(err, lzma.ErrLCLPTooLarge) {
+		t.Fatalf("Verify error %v; want %v", err, lzma.ErrLCLPTooLarge)
+	}
+}
@@ -0,0 +1,326 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// WriterConfig describe the parameters for an xz writer.
+type WriterConfig struct {
+	Properties *lzma.Properties
+	DictCap    int
+	BufSize    int
+	BlockSize  int64
+	// BlockList provides the uncompressed sizes of the first
+	// blocks. If more data is written than the sum of the sizes, the
+	// last size will be repeated. A last size of zero requests that
+	// all remaining data is written into a single block. Each block
+	// is still limited by BlockSize.
+	BlockList []int64
+	// checksum method: CRC32, CRC64 or SHA256
+	CheckSum byte
+	// match algorithm
+	Matcher lzma.MatchAlgorithm
+	// Depth is the number of match candidates the match finder
+	// checks per position. Larger values improve the compression
+	// ratio and slow down the encoder. The value 0 selects the
+	// default of the encoder; see lzma.DefaultDepth.
+	Depth int
+	// Workers gives the number of go routines compressing blocks in
+	// parallel. Values smaller than two select sequential
+	// compression. Parallel compression requires a limited block
+	// size; if BlockSize is not set, three times the dictionary
+	// capacity but at least 1 MiB is used.
+	Workers int
+	// Embedded restricts the output to the streams supported by
+	// XZ Embedded, the decompressor of the Linux kernel used for
+	// kernel images and initramfs archives. The check defaults to
+	// CRC32 and must not be changed; the dictionary capacity must
+	// not exceed EmbeddedMaxDictCap.
+	Embedded bool
+	// PartSize requests output that can be split into parts of
+	// exactly PartSize bytes, for instance the parts of a multipart
+	// upload to object storage. Every part contains complete xz
+	// streams followed by stream padding, so that each part can be
+	// decompressed independently. Only the last part may be
+	// shorter. The part size must be a multiple of four and at least
+	// MinPartSize. BlockSize defaults to a quarter of the part size
+	// and must not exceed half of it. PartSize cannot be combined
+	// with Embedded.
+	PartSize int64
+	// Stats receives the counters of the writer if it is not nil.
+	Stats Stats
+	// Hooks provides the block lifecycle callbacks if it is not
+	// nil.
+	Hooks *Hooks
+	// Logger receives debug messages if it is not nil. It is also
+	// used by the LZMA2 encoder.
+	Logger Logger
+	// FlushMode selects the semantics of the Flush method of the
+	// writer. The default FlushChunk ends only the current LZMA2
+	// chunk.
+	FlushMode FlushMode
+	// EmptyBlock requests a single empty block if no data has been
+	// written to a stream. By default such a stream contains no
+	// blocks, which is the minimal stream of 32 bytes also written
+	// by the xz tool. Some decoders don't accept streams without
+	// blocks. The liblzma backend ignores the field.
+	EmptyBlock bool
+	// DecisionTrace receives the operations chosen by the LZMA
+	// encoder as JSON lines if it is not nil; see lzma.Decision.
+	// The positions of the decisions restart at zero for every
+	// block. The trace requires sequential compression and the
+	// liblzma backend is not used.
+	DecisionTrace io.Writer
+}
+
+// FlushMode selects how a Writer flushes its data.
+type FlushMode byte
+
+// Supported flush modes.
+const (
+	// FlushChunk ends the current LZMA2 chunk. The overhead is a
+	// few bytes, but a reader must decompress the block from its
+	// start.
+	FlushChunk FlushMode = iota
+	// FlushBlock ends the current block, which adds the check and
+	// an index record. Readers supporting random access can start
+	// decompression at the next block.
+	FlushBlock
+)
+
+// String returns the name of the flush mode.
+func (m FlushMode) String() string {
+	switch m {
+	case FlushChunk:
+		return "FlushChunk"
+	case FlushBlock:
+		return "FlushBlock"
+	}
+	return fmt.Sprintf("FlushMode(%d)", byte(m))
+}
+
+// MinPartSize is the minimum part size supported by the writer.
+const MinPartSize = 1 << 16
+
+// EmbeddedMaxDictCap is the maximum dictionary capacity supported for
+// XZ Embedded output.
+const EmbeddedMaxDictCap = 64 << 20
+
+// parallelBlockSize returns the default block size for parallel
+// compression. Like the xz tool it uses three times the dictionary
+// capacity but at least 1 MiB.
+func parallelBlockSize(dictCap int) int64 {
+	n := 3 * int64(dictCap)
+	if n < 1<<20 {
+		n = 1 << 20
+	}
+	return n
+}
+
+// fill replaces zero values with default values.
+func (c *WriterConfig) fill() {
+	if c.Properties == nil {
+		c.Properties = &lzma.Properties{LC: 3, LP: 0, PB: 2}
+	}
+	if c.DictCap == 0 {
+		c.DictCap = 8 * 1024 * 1024
+	}
+	if c.BufSize == 0 {
+		c.BufSize = 4096
+	}
+	if c.BlockSize == 0 {
+		c.BlockSize = maxInt64
+		if c.PartSize > 0 {
+			c.BlockSize = c.PartSize / 4
+		} else if c.Workers > 1 {
+			c.BlockSize = parallelBlockSize(c.DictCap)
+		}
+	}
+	if c.CheckSum == 0 {
+		c.CheckSum = CRC64
+		if c.Embedded {
+			c.CheckSum = CRC32
+		}
+	}
+}
+
+// Verify checks the configuration for errors. Zero values will be
+// replaced by default values. All invalid parameters are reported; if
+// there is more than one, the errors are combined with errors.Join.
+// The constructors of the package call Verify.
+func (c *WriterConfig) Verify() error {
+	if c == nil {
+		return errors.New("xz: writer configuration is nil")
+	}
+	c.fill()
+	var errs []error
+	dictCap := c.DictCap
+	if !(lzma.MinDictCap <= dictCap && int64(dictCap) <= lzma.MaxDictCap) {
+		errs = append(errs, fmt.Errorf("xz: DictCap %s not in [%s, %s]",
+			sizeString(int64(dictCap)),
+			sizeString(lzma.MinDictCap),
+			sizeString(lzma.MaxDictCap)))
+		// report the other errors of the LZMA2 parameters
+		dictCap = lzma.MinDictCap
+	}
+	lc := lzma.Writer2Config{
+		Properties: c.Properties,
+		DictCap:    dictCap,
+		BufSize:    c.BufSize,
+		Matcher:    c.Matcher,
+		Depth:      c.Depth,
+	}
+	if err := lc.Verify(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.BlockSize <= 0 {
+		errs = append(errs, fmt.Errorf(
+			"xz: BlockSize %d must be positive", c.BlockSize))
+	}
+	if c.Workers < 0 {
+		errs = append(errs, fmt.Errorf("xz: Workers %d is negative",
+			c.Workers))
+	}
+	if c.Workers > 1 && c.DecisionTrace != nil {
+		errs = append(errs, fmt.Errorf(
+			"xz: DecisionTrace requires Workers of at most one; "+
+				"have %d", c.Workers))
+	}
+	if c.Workers > 1 && c.BlockSize > maxInt {
+		errs = append(errs, fmt.Errorf(
+			"xz: BlockSize %s exceeds %s supported for parallel "+
+				"compression", sizeString(c.BlockSize),
+			sizeString(maxInt)))
+	}
+	for i, n := range c.BlockList {
+		if n < 0 {
+			errs = append(errs, fmt.Errorf(
+				"xz: BlockList[%d] %d is negative", i, n))
+		} else if n == 0 && i < len(c.BlockList)-1 {
+			errs = append(errs, fmt.Errorf(
+				"xz: BlockList[%d] is zero; only the last "+
+					"size may be zero", i))
+		}
+	}
+	if err := verifyFlags(c.CheckSum); err != nil {
+		errs = append(errs, fmt.Errorf(
+			"xz: CheckSum %#02x not supported; use CRC32, CRC64 "+
+				"or SHA256", c.CheckSum))
+	}
+	if c.FlushMode > FlushBlock {
+		errs = append(errs, fmt.Errorf("xz: %s not supported",
+			c.FlushMode))
+	}
+	if c.PartSize != 0 {
+		if c.PartSize < MinPartSize || c.PartSize%4 != 0 {
+			errs = append(errs, fmt.Errorf(
+				"xz: PartSize %d must be a multiple of four "+
+					"and at least %s", c.PartSize,
+				sizeString(MinPartSize)))
+		} else if c.BlockSize > c.PartSize/2 {
+			errs = append(errs, fmt.Errorf(
+				"xz: BlockSize %s exceeds half of PartSize %s",
+				sizeString(c.BlockSize),
+				sizeString(c.PartSize)))
+		}
+	}
+	if c.Embedded {
+		if c.CheckSum != CRC32 {
+			errs = append(errs, fmt.Errorf(
+				"xz: CheckSum %s not supported by XZ "+
+					"Embedded; use CRC32",
+				flagString(c.CheckSum)))
+		}
+		if c.DictCap > EmbeddedMaxDictCap {
+			errs = append(errs, fmt.Errorf(
+				"xz: DictCap %s exceeds %s supported by XZ "+
+					"Embedded", sizeString(int64(c.DictCap)),
+				sizeString(EmbeddedMaxDictCap)))
+		}
+		if c.PartSize != 0 {
+			errs = append(errs, errors.New(
+				"xz: PartSize not supported by XZ Embedded; "+
+					"it requires a single stream"))
+		}
+	}
+	return joinErrors(errs)
+}
+
+// blockSize returns the maximum uncompressed size for block i.
+func (c *WriterConfig) blockSize(i int) int64 {
+	n := len(c.BlockList)
+	if n == 0 {
+		return c.BlockSize
+	}
+	if i >= n {
+		i = n - 1
+	}
+	s := c.BlockList[i]
+	if s == 0 || s > c.BlockSize {
+		return c.BlockSize
+	}
+	return s
+}
+
+// filters creates the filter list for the given parameters.
+func (c *WriterConfig) filters() []filter {
+	return []filter{&lzmaFilter{int64(c.DictCap)}}
+}
+
+// maxInt64 defines the maximum 64-bit signed integer.
+const maxInt64 = 1<<63 - 1
+
+// maxInt defines the maximum value of the int type.
+const maxInt = int64(^uint(0) >> 1)
+
+// Errors for filter chains violating the rules of the xz
+// specification.
+var (
+	// ErrNoFilters indicates an empty filter chain.
+	ErrNoFilters = errors.New("xz: no filters")
+	// ErrTooManyFilters indicates a chain of more than four filters.
+	ErrTooManyFilters = errors.New("xz: more than four filters")
+	// ErrLZMA2NotLast indicates that the LZMA2 filter isn't the
+	// last filter of the chain.
+	ErrLZMA2NotLast = errors.New("xz: LZMA2 filter is not the last filter")
+	// ErrLastFilter indicates that the last filter of the chain,
+	// for instance a delta or BCJ filter, cannot be the last filter.
+	ErrLastFilter = errors.New("xz: filter cannot be the last filter")
+	// ErrDuplicateFilter indicates that a filter appears twice in
+	// the chain.
+	ErrDuplicateFilter = errors.New("xz: duplicate filter in chain")
+)
+
+// verifyFilters checks the filter list for the length and the right
+// sequence of filters. Only the last filter may be the LZMA2 filter,
+// which must be the last one, and no filter may appear twice.
+func verifyFilters(f []filter) error {
+	if len(f) < minFilters {
+		return ErrNoFilters
+	}
+	if len(f) > maxFilters {
+		return ErrTooManyFilters
+	}
+	for i, g := range f[:len(f)-1] {
+		if g.last() {
+			return ErrLZMA2NotLast
+		}
+		for _, h := range f[i+1:] {
+			if g.id() == h.id() {
+				return ErrDuplicateFilter
+			}
+		}
+	}
+	if !f[len(f)-1].last() {
+		return ErrLastFilter
+	}
+	return nil
+}
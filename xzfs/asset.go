@@ -0,0 +1,116 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xzfs
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+// Asset provides the content of a single xz-compressed byte slice,
+// typically embedded with go:embed:
+//
+//	//go:embed data.json.xz
+//	var dataXZ []byte
+//
+//	var data = xzfs.NewAsset("data.json", dataXZ)
+//
+// The data is decompressed on the first access and kept in memory. The
+// Asset may be used by multiple go routines concurrently.
+type Asset struct {
+	name string
+	xz   []byte
+	c    Config
+
+	once sync.Once
+	data []byte
+	err  error
+}
+
+// NewAsset creates an asset with the default configuration. The name
+// is reported by the file information.
+func NewAsset(name string, xz []byte) *Asset {
+	return Config{}.NewAsset(name, xz)
+}
+
+// NewAsset creates an asset using the reader configuration of c. The
+// Cache field is ignored; the content of an asset is always cached.
+func (c Config) NewAsset(name string, xz []byte) *Asset {
+	return &Asset{name: name, xz: xz, c: c}
+}
+
+// Bytes returns the decompressed content. The returned slice must not
+// be modified.
+func (a *Asset) Bytes() ([]byte, error) {
+	a.once.Do(func() {
+		r, err := a.c.ReaderConfig.NewReader(bytes.NewReader(a.xz))
+		if err != nil {
+			a.err = err
+			return
+		}
+		a.data, a.err = ioutil.ReadAll(r)
+	})
+	if a.err != nil {
+		return nil, &fs.PathError{Op: "read", Path: a.name, Err: a.err}
+	}
+	return a.data, nil
+}
+
+// ReadAt reads decompressed data at offset off. It implements the
+// io.ReaderAt interface.
+func (a *Asset) ReadAt(p []byte, off int64) (n int, err error) {
+	data, err := a.Bytes()
+	if err != nil {
+		return 0, err
+	}
+	return bytes.NewReader(data).ReadAt(p, off)
+}
+
+// Open returns a file providing the decompressed content. The file
+// supports io.Seeker and io.ReaderAt.
+func (a *Asset) Open() (fs.File, error) {
+	data, err := a.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	return &assetFile{Reader: bytes.NewReader(data), a: a}, nil
+}
+
+// assetFile provides the content of an asset.
+type assetFile struct {
+	*bytes.Reader
+	a *Asset
+}
+
+// Stat returns the file information.
+func (f *assetFile) Stat() (fs.FileInfo, error) {
+	return assetInfo{f.a}, nil
+}
+
+// Close does nothing.
+func (f *assetFile) Close() error { return nil }
+
+// assetInfo provides the file information of an asset. The asset is a
+// read-only file without modification time.
+type assetInfo struct {
+	a *Asset
+}
+
+func (fi assetInfo) Name() string       { return fi.a.name }
+func (fi assetInfo) Size() int64        { return int64(len(fi.a.data)) }
+func (fi assetInfo) Mode() fs.FileMode  { return 0444 }
+func (fi assetInfo) ModTime() time.Time { return time.Time{} }
+func (fi assetInfo) IsDir() bool        { return false }
+func (fi assetInfo) Sys() interface{}   { return nil }
+
+// verify that the interfaces are implemented
+var (
+	_ io.ReaderAt = (*Asset)(nil)
+	_ io.Seeker   = (*assetFile)(nil)
+)
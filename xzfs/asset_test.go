@@ -0,0 +1,72 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package xzfs
+
+import (
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+)
+
+func TestAsset(t *testing.T) {
+	const txt = "The quick brown fox jumps over the lazy dog.\n"
+	a := NewAsset("fox.txt", compress(t, txt))
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p := make([]byte, 5)
+			if _, err := a.ReadAt(p, 4); err != nil {
+				t.Errorf("ReadAt error %s", err)
+				return
+			}
+			if string(p) != "quick" {
+				t.Errorf("ReadAt returned %q; want %q", p,
+					"quick")
+			}
+		}()
+	}
+	wg.Wait()
+
+	f, err := a.Open()
+	if err != nil {
+		t.Fatalf("Open error %s", err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatalf("Stat error %s", err)
+	}
+	if fi.Name() != "fox.txt" || fi.Size() != int64(len(txt)) {
+		t.Fatalf("Stat returned name %q size %d", fi.Name(), fi.Size())
+	}
+	if _, err = f.(io.Seeker).Seek(10, io.SeekStart); err != nil {
+		t.Fatalf("Seek error %s", err)
+	}
+	out, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatalf("ReadAll error %s", err)
+	}
+	if string(out) != txt[10:] {
+		t.Fatalf("read %q; want %q", out, txt[10:])
+	}
+}
+
+func TestAssetCorrupt(t *testing.T) {
+	data := compress(t, "file a\n")
+	data[len(data)/2] ^= 0xff
+	a := NewAsset("a.txt", data)
+	if _, err := a.Open(); err == nil {
+		t.Fatal("Open succeeded for corrupted data")
+	}
+	if _, err := a.ReadAt(make([]byte, 1), 0); err == nil {
+		t.Fatal("ReadAt succeeded for corrupted data")
+	}
+}
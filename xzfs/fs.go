@@ -0,0 +1,455 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package xzfs provides a file system that decompresses xz files
+// transparently. A file foo.txt.xz of the underlying file system is
+// served as foo.txt. This is useful for compressed assets embedded
+// with go:embed. A single embedded byte slice can be wrapped with
+// NewAsset.
+package xzfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ulikunitz/xz"
+)
+
+// ext is the extension of the compressed files.
+const ext = ".xz"
+
+// Config defines the parameters of the file system. ReaderConfig is
+// used to decompress the files. If Cache is set, the decompressed
+// content of a file is kept in memory after it has been opened for the
+// first time. Otherwise the files are decompressed while they are read;
+// they implement io.Seeker, but seeking requires the decompression of
+// the data up to the new position.
+type Config struct {
+	ReaderConfig xz.ReaderConfig
+	Cache        bool
+}
+
+// FS wraps a file system and decompresses xz files on demand. A file
+// name.xz is served as name unless the underlying file system contains
+// a file name. The compressed files can still be opened using their
+// original names.
+type FS struct {
+	Config
+
+	fsys fs.FS
+
+	mu sync.Mutex
+	// cache contains the decompressed content of the files
+	cache map[string]*cacheEntry
+}
+
+// cacheEntry holds the decompressed content of a file. The once field
+// ensures that the file is decompressed only once, even if it is opened
+// concurrently. The field done is protected by the mutex of the file
+// system and reports that data is available.
+type cacheEntry struct {
+	once sync.Once
+	data []byte
+	err  error
+	done bool
+}
+
+// New creates a file system with the default configuration.
+func New(fsys fs.FS) *FS {
+	return Config{}.NewFS(fsys)
+}
+
+// NewFS creates a file system using the configuration c.
+func (c Config) NewFS(fsys fs.FS) *FS {
+	return &FS{Config: c, fsys: fsys}
+}
+
+// Open opens the named file. If the file doesn't exist the file with
+// the xz extension is opened and decompressed.
+func (f *FS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name,
+			Err: fs.ErrInvalid}
+	}
+	ff, err := f.fsys.Open(name)
+	if err == nil {
+		return f.wrapDir(name, ff)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	xzFile, info, xerr := f.openXZ(name)
+	if xerr != nil {
+		if errors.Is(xerr, fs.ErrNotExist) {
+			return nil, err
+		}
+		return nil, xerr
+	}
+	if f.Cache {
+		data, err := f.cached(name, xzFile)
+		xzFile.Close()
+		if err != nil {
+			return nil, err
+		}
+		info.size = int64(len(data))
+		return &memFile{Reader: bytes.NewReader(data), info: info},
+			nil
+	}
+	return &file{f: xzFile, fsys: f, path: name, info: info}, nil
+}
+
+// openXZ opens the compressed file for name.
+func (f *FS) openXZ(name string) (fs.File, *fileInfo, error) {
+	xzFile, err := f.fsys.Open(name + ext)
+	if err != nil {
+		return nil, nil, err
+	}
+	fi, err := xzFile.Stat()
+	if err != nil {
+		xzFile.Close()
+		return nil, nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		xzFile.Close()
+		return nil, nil, &fs.PathError{Op: "open", Path: name,
+			Err: fs.ErrNotExist}
+	}
+	return xzFile, &fileInfo{FileInfo: fi, name: path.Base(name),
+		size: -1}, nil
+}
+
+// cached returns the decompressed content of the file. The file is
+// decompressed without holding the lock of the file system, so that
+// other files can be opened in the meantime. Concurrent calls for the
+// same name wait for the first decompression. An entry that failed is
+// removed, so that the next call tries again.
+func (f *FS) cached(name string, xzFile fs.File) ([]byte, error) {
+	f.mu.Lock()
+	e, ok := f.cache[name]
+	if !ok {
+		if f.cache == nil {
+			f.cache = make(map[string]*cacheEntry)
+		}
+		e = new(cacheEntry)
+		f.cache[name] = e
+	}
+	f.mu.Unlock()
+	e.once.Do(func() {
+		e.data, e.err = f.decompress(name, xzFile)
+		f.mu.Lock()
+		if e.err == nil {
+			e.done = true
+		} else if f.cache[name] == e {
+			delete(f.cache, name)
+		}
+		f.mu.Unlock()
+	})
+	if e.err != nil {
+		return nil, e.err
+	}
+	return e.data, nil
+}
+
+// decompress reads the complete decompressed content of the file.
+func (f *FS) decompress(name string, xzFile fs.File) ([]byte, error) {
+	r, err := f.ReaderConfig.NewReader(xzFile)
+	if err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+	return data, nil
+}
+
+// uncompressedSize returns the size of the decompressed file. The size
+// is taken from the xz index if the file supports io.ReaderAt;
+// otherwise the file is decompressed.
+func (f *FS) uncompressedSize(name string) (int64, error) {
+	f.mu.Lock()
+	e := f.cache[name]
+	done := e != nil && e.done
+	f.mu.Unlock()
+	if done {
+		return int64(len(e.data)), nil
+	}
+	xzFile, info, err := f.openXZ(name)
+	if err != nil {
+		return 0, err
+	}
+	defer xzFile.Close()
+	if ra, ok := xzFile.(io.ReaderAt); ok {
+		streams, err := xz.ReadStreamInfo(ra, info.FileInfo.Size())
+		if err == nil {
+			var n int64
+			for _, s := range streams {
+				n += s.UncompressedSize
+			}
+			return n, nil
+		}
+	}
+	r, err := f.ReaderConfig.NewReader(xzFile)
+	if err != nil {
+		return 0, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	n, err := io.Copy(ioutil.Discard, r)
+	if err != nil {
+		return 0, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return n, nil
+}
+
+// Stat returns the file information for the named file.
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	ff, err := f.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer ff.Close()
+	return ff.Stat()
+}
+
+// ReadDir reads the named directory. Compressed files are listed
+// without the xz extension unless a file with that name exists.
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := fs.ReadDir(f.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		names[e.Name()] = true
+	}
+	list := make([]fs.DirEntry, 0, len(entries))
+	for _, e := range entries {
+		n := e.Name()
+		base := strings.TrimSuffix(n, ext)
+		if e.Type().IsRegular() && base != n && base != "" &&
+			!names[base] {
+			list = append(list, &dirEntry{
+				DirEntry: e,
+				fsys:     f,
+				name:     base,
+				path:     path.Join(name, base),
+			})
+			continue
+		}
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name() < list[j].Name()
+	})
+	return list, nil
+}
+
+// wrapDir wraps directories, so that ReadDir of the directory file
+// returns the same entries as the ReadDir method of the file system.
+func (f *FS) wrapDir(name string, file fs.File) (fs.File, error) {
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return file, nil
+	}
+	return &dir{File: file, fsys: f, name: name}, nil
+}
+
+// fileInfo describes a decompressed file. A negative size indicates
+// that the size hasn't been computed yet.
+type fileInfo struct {
+	fs.FileInfo
+	name string
+	size int64
+}
+
+// Name returns the name of the decompressed file.
+func (fi *fileInfo) Name() string { return fi.name }
+
+// Size returns the size of the decompressed file.
+func (fi *fileInfo) Size() int64 { return fi.size }
+
+// file decompresses an xz file while it is read. The field pos
+// provides the position in the decompressed data.
+type file struct {
+	f    fs.File
+	fsys *FS
+	path string
+	info *fileInfo
+	r    *xz.Reader
+	pos  int64
+}
+
+// Stat returns the file information. The size of the decompressed file
+// is computed on the first call.
+func (f *file) Stat() (fs.FileInfo, error) {
+	if f.info.size < 0 {
+		n, err := f.fsys.uncompressedSize(f.path)
+		if err != nil {
+			return nil, err
+		}
+		f.info.size = n
+	}
+	return f.info, nil
+}
+
+// reader creates the reader for the decompressed data. If the
+// compressed file supports io.Seeker, the index is read, so that Seek
+// can skip whole blocks.
+func (f *file) reader() (err error) {
+	c := f.fsys.ReaderConfig
+	_, seeker := f.f.(io.Seeker)
+	if seeker && !c.SkipLeadingGarbage && !c.Recover {
+		c.ReadIndex = true
+	}
+	f.r, err = c.NewReader(f.f)
+	return err
+}
+
+// Read reads decompressed data.
+func (f *file) Read(p []byte) (n int, err error) {
+	if f.r == nil {
+		if err = f.reader(); err != nil {
+			return 0, err
+		}
+	}
+	n, err = f.r.Read(p)
+	f.pos += int64(n)
+	return n, err
+}
+
+// Seek sets the position in the decompressed data for the next Read.
+// The data up to the new position must be decompressed; blocks before
+// it are skipped if the compressed file supports io.Seeker. Seeking
+// backwards reopens the compressed file and starts decompressing it
+// again. io.SeekEnd requires the size of the decompressed file; see
+// Stat.
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	var target int64
+	switch whence {
+	case io.SeekStart:
+		target = offset
+	case io.SeekCurrent:
+		target = f.pos + offset
+	case io.SeekEnd:
+		fi, err := f.Stat()
+		if err != nil {
+			return f.pos, err
+		}
+		target = fi.Size() + offset
+	default:
+		return f.pos, &fs.PathError{Op: "seek", Path: f.path,
+			Err: fs.ErrInvalid}
+	}
+	if target < 0 {
+		return f.pos, &fs.PathError{Op: "seek", Path: f.path,
+			Err: fs.ErrInvalid}
+	}
+	if f.r == nil || target < f.pos {
+		if err := f.rewind(); err != nil {
+			return f.pos, err
+		}
+	}
+	n, err := f.r.Seek(target, io.SeekStart)
+	if err == io.EOF {
+		// Reads after the end of the file return io.EOF.
+		n, err = target, nil
+	}
+	f.pos = n
+	return n, err
+}
+
+// rewind reopens the compressed file and creates a new reader starting
+// at the beginning of the decompressed data.
+func (f *file) rewind() error {
+	if f.r != nil {
+		xzFile, _, err := f.fsys.openXZ(f.path)
+		if err != nil {
+			return err
+		}
+		f.f.Close()
+		f.f = xzFile
+	}
+	f.pos = 0
+	if err := f.reader(); err != nil {
+		f.r = nil
+		return err
+	}
+	return nil
+}
+
+// Close closes the compressed file.
+func (f *file) Close() error { return f.f.Close() }
+
+// memFile provides the cached content of a file.
+type memFile struct {
+	*bytes.Reader
+	info *fileInfo
+}
+
+// Stat returns the file information.
+func (f *memFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+// Close does nothing.
+func (f *memFile) Close() error { return nil }
+
+// dirEntry describes a compressed file in a directory listing.
+type dirEntry struct {
+	fs.DirEntry
+	fsys *FS
+	name string
+	path string
+}
+
+// Name returns the name without the xz extension.
+func (e *dirEntry) Name() string { return e.name }
+
+// Info returns the file information of the decompressed file.
+func (e *dirEntry) Info() (fs.FileInfo, error) {
+	return e.fsys.Stat(e.path)
+}
+
+// dir provides the directory listing of the file system for a
+// directory file.
+type dir struct {
+	fs.File
+	fsys    *FS
+	name    string
+	entries []fs.DirEntry
+	read    bool
+}
+
+// ReadDir reads the directory entries like fs.ReadDirFile.
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		var err error
+		if d.entries, err = d.fsys.ReadDir(d.name); err != nil {
+			return nil, err
+		}
+		d.read = true
+	}
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
@@ -0,0 +1,185 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package xzfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/ulikunitz/xz"
+)
+
+func compress(t *testing.T, s string) []byte {
+	var buf bytes.Buffer
+	w, err := xz.NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("xz.NewWriter error %s", err)
+	}
+	if _, err = w.Write([]byte(s)); err != nil {
+		t.Fatalf("w.Write error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("w.Close error %s", err)
+	}
+	return buf.Bytes()
+}
+
+func newMapFS(t *testing.T) fstest.MapFS {
+	return fstest.MapFS{
+		"a.txt.xz":     {Data: compress(t, "file a\n")},
+		"dir/b.txt.xz": {Data: compress(t, "file b\n")},
+		"c.txt":        {Data: []byte("file c\n")},
+		"d.txt":        {Data: []byte("file d\n")},
+		"d.txt.xz":     {Data: compress(t, "compressed d\n")},
+		"empty.xz":     {Data: compress(t, "")},
+	}
+}
+
+func testFS(t *testing.T, fsys *FS) {
+	err := fstest.TestFS(fsys, "a.txt", "dir/b.txt", "c.txt", "d.txt",
+		"d.txt.xz", "empty")
+	if err != nil {
+		t.Fatalf("fstest.TestFS error %s", err)
+	}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"a.txt", "file a\n"},
+		{"dir/b.txt", "file b\n"},
+		{"c.txt", "file c\n"},
+		{"d.txt", "file d\n"},
+		{"empty", ""},
+	}
+	for _, tc := range tests {
+		data, err := fs.ReadFile(fsys, tc.name)
+		if err != nil {
+			t.Fatalf("ReadFile(%q) error %s", tc.name, err)
+		}
+		if s := string(data); s != tc.want {
+			t.Errorf("ReadFile(%q) returned %q; want %q", tc.name, s,
+				tc.want)
+		}
+	}
+	if _, err = fsys.Open("missing.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Open(%q) returned error %v; want fs.ErrNotExist",
+			"missing.txt", err)
+	}
+}
+
+func TestFS(t *testing.T) {
+	testFS(t, New(newMapFS(t)))
+}
+
+func TestFSCache(t *testing.T) {
+	fsys := Config{Cache: true}.NewFS(newMapFS(t))
+	testFS(t, fsys)
+	if _, ok := fsys.cache["a.txt"]; !ok {
+		t.Fatalf("a.txt is not cached")
+	}
+}
+
+func TestFSCacheConcurrent(t *testing.T) {
+	fsys := Config{Cache: true}.NewFS(newMapFS(t))
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, name := range []string{"a.txt", "dir/b.txt"} {
+				if _, err := fs.ReadFile(fsys, name); err != nil {
+					t.Errorf("ReadFile(%q) error %s", name, err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if !fsys.cache["a.txt"].done || !fsys.cache["dir/b.txt"].done {
+		t.Fatalf("files are not cached")
+	}
+
+	// a corrupt file isn't cached
+	mfs := newMapFS(t)
+	mfs["bad.txt.xz"] = &fstest.MapFile{Data: []byte("no xz file")}
+	fsys = Config{Cache: true}.NewFS(mfs)
+	if _, err := fsys.Open("bad.txt"); err == nil {
+		t.Fatalf("Open of a corrupt file succeeded")
+	}
+	if _, ok := fsys.cache["bad.txt"]; ok {
+		t.Fatalf("the corrupt file is cached")
+	}
+}
+
+func TestFSSeek(t *testing.T) {
+	txt := strings.Repeat("0123456789abcdef", 4096)
+	var buf bytes.Buffer
+	w, err := xz.WriterConfig{BlockSize: 4096}.NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	if _, err = io.WriteString(w, txt); err != nil {
+		t.Fatalf("WriteString error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("Close error %s", err)
+	}
+	fsys := New(fstest.MapFS{"f.xz": {Data: buf.Bytes()}})
+	f, err := fsys.Open("f")
+	if err != nil {
+		t.Fatalf("Open error %s", err)
+	}
+	defer f.Close()
+	s, ok := f.(io.ReadSeeker)
+	if !ok {
+		t.Fatalf("file doesn't support io.Seeker")
+	}
+	tests := []struct {
+		offset int64
+		whence int
+		pos    int64
+	}{
+		{10000, io.SeekStart, 10000},
+		{-5000, io.SeekCurrent, 5016},
+		{-16, io.SeekEnd, int64(len(txt)) - 16},
+		{3, io.SeekStart, 3},
+	}
+	for _, tc := range tests {
+		pos, err := s.Seek(tc.offset, tc.whence)
+		if err != nil {
+			t.Fatalf("Seek(%d, %d) error %s", tc.offset, tc.whence,
+				err)
+		}
+		if pos != tc.pos {
+			t.Fatalf("Seek(%d, %d) returned %d; want %d",
+				tc.offset, tc.whence, pos, tc.pos)
+		}
+		p := make([]byte, 16)
+		if _, err = io.ReadFull(s, p); err != nil {
+			t.Fatalf("ReadFull error %s", err)
+		}
+		if want := txt[pos : pos+16]; string(p) != want {
+			t.Fatalf("read %q at %d; want %q", p, pos, want)
+		}
+	}
+	pos, err := s.Seek(1, io.SeekEnd)
+	if err != nil || pos != int64(len(txt))+1 {
+		t.Fatalf("Seek beyond the end returned %d, %v", pos, err)
+	}
+	if n, err := s.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Fatalf("Read beyond the end returned %d, %v", n, err)
+	}
+	if _, err = s.Seek(-1, io.SeekStart); err == nil {
+		t.Fatalf("Seek to a negative position succeeded")
+	}
+}
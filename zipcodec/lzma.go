@@ -0,0 +1,158 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package zipcodec provides compressors and decompressors for the
+// package archive/zip. It supports the zip methods LZMA (14) and XZ
+// (95) as used for instance by 7-Zip and WinZip.
+//
+// The compressors and decompressors can be registered for a single zip
+// reader or writer:
+//
+//	r.RegisterDecompressor(zipcodec.LZMA,
+//		zipcodec.LZMADecompressor(lzma.ReaderConfig{}))
+//
+// or globally using zip.RegisterDecompressor. The functions RegisterLZMA
+// and RegisterXZ register the default configurations. The compressors
+// and the Register functions require the encoder, so they are not
+// available with the xz_noencoder build tag.
+package zipcodec
+
+import (
+	"archive/zip"
+	"errors"
+	"io"
+
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// LZMA is the zip method for LZMA compressed files.
+const LZMA uint16 = 14
+
+// Length of the prefix of the LZMA data in a zip file. It consists of
+// two version bytes, the length of the properties as little-endian
+// 16-bit value and the properties.
+const (
+	propsLen  = 5
+	prefixLen = 4 + propsLen
+)
+
+// EOSFlag is the bit of the general purpose flags of the zip file
+// header that signals an end-of-stream marker in the LZMA data.
+const EOSFlag = 0x2
+
+// SetLZMA selects the LZMA method for the file header. The compressor
+// always writes an end-of-stream marker, which is signaled by the
+// EOSFlag. The header must be passed to zip.Writer.CreateHeader.
+func SetLZMA(fh *zip.FileHeader) {
+	fh.Method = LZMA
+	fh.Flags |= EOSFlag
+}
+
+// prefixReader returns the prefix before the data of the underlying
+// reader. It supports ReadByte, so that the lzma reader reads not more
+// data than required.
+type prefixReader struct {
+	prefix []byte
+	r      io.Reader
+	br     io.ByteReader
+}
+
+// Read reads the prefix and then the data of the underlying reader.
+func (r *prefixReader) Read(p []byte) (n int, err error) {
+	if len(r.prefix) > 0 {
+		n = copy(p, r.prefix)
+		r.prefix = r.prefix[n:]
+		return n, nil
+	}
+	return r.r.Read(p)
+}
+
+// ReadByte reads a single byte.
+func (r *prefixReader) ReadByte() (c byte, err error) {
+	if len(r.prefix) > 0 {
+		c = r.prefix[0]
+		r.prefix = r.prefix[1:]
+		return c, nil
+	}
+	return r.br.ReadByte()
+}
+
+// errReader returns always the same error.
+type errReader struct {
+	err error
+}
+
+// Read returns the error.
+func (r errReader) Read(p []byte) (n int, err error) { return 0, r.err }
+
+// Close returns nil.
+func (r errReader) Close() error { return nil }
+
+// lzmaReader decompresses the LZMA data of a zip file.
+type lzmaReader struct {
+	r *lzma.Reader
+}
+
+// Read reads decompressed data. The zip file header tells whether the
+// data is terminated by an end-of-stream marker, but the header is not
+// available to a decompressor. If the marker is missing the lzma
+// reader reports an unexpected end of the compressed data. The error is
+// ignored, because the lzma reader returns the remaining data and
+// io.EOF on the next calls. Truncated data will be detected by the zip
+// reader that checks size and checksum of the uncompressed data.
+func (r lzmaReader) Read(p []byte) (n int, err error) {
+	n, err = r.r.Read(p)
+	if err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return n, err
+}
+
+// Close does nothing.
+func (r lzmaReader) Close() error { return nil }
+
+var errPrefix = errors.New("zipcodec: invalid LZMA properties prefix")
+
+// newLZMAReader reads the prefix of the zip LZMA data and creates a
+// reader for the LZMA stream.
+func newLZMAReader(c lzma.ReaderConfig, r io.Reader) (io.ReadCloser,
+	error) {
+
+	p := make([]byte, prefixLen)
+	if _, err := io.ReadFull(r, p); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if p[2] != propsLen || p[3] != 0 {
+		return nil, errPrefix
+	}
+	// The classic LZMA header consists of the properties and the
+	// uncompressed size, which is unknown.
+	h := make([]byte, lzma.HeaderLen)
+	copy(h, p[4:])
+	for i := propsLen; i < len(h); i++ {
+		h[i] = 0xff
+	}
+	pr := &prefixReader{prefix: h, r: r, br: lzma.ByteReader(r)}
+	lr, err := c.NewReader(pr)
+	if err != nil {
+		return nil, err
+	}
+	return lzmaReader{lr}, nil
+}
+
+// LZMADecompressor returns a decompressor for the LZMA method using the
+// reader configuration c. Data with and without end-of-stream marker
+// is supported.
+func LZMADecompressor(c lzma.ReaderConfig) zip.Decompressor {
+	return func(r io.Reader) io.ReadCloser {
+		rc, err := newLZMAReader(c, r)
+		if err != nil {
+			return errReader{err}
+		}
+		return rc
+	}
+}
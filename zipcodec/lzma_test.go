@@ -0,0 +1,64 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zipcodec
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/ulikunitz/xz/lzma"
+)
+
+const foxSentence = "The quick brown fox jumps over the lazy dog.\n"
+
+// readZipFile reads the only file of the zip archive.
+func readZipFile(t *testing.T, data []byte, method uint16,
+	d zip.Decompressor) []byte {
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("zip.NewReader error %s", err)
+	}
+	zr.RegisterDecompressor(method, d)
+	if len(zr.File) != 1 {
+		t.Fatalf("zip archive has %d files; want 1", len(zr.File))
+	}
+	if m := zr.File[0].Method; m != method {
+		t.Fatalf("zip method is %d; want %d", m, method)
+	}
+	rc, err := zr.File[0].Open()
+	if err != nil {
+		t.Fatalf("Open error %s", err)
+	}
+	defer rc.Close()
+	out, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("ReadAll error %s", err)
+	}
+	return out
+}
+
+func TestLZMADecompressor(t *testing.T) {
+	// created by the Python zipfile module
+	data, err := ioutil.ReadFile("testdata/fox-lzma.zip")
+	if err != nil {
+		t.Fatalf("ReadFile error %s", err)
+	}
+	out := readZipFile(t, data, LZMA,
+		LZMADecompressor(lzma.ReaderConfig{}))
+	if s := string(out); s != foxSentence {
+		t.Fatalf("got %q; want %q", s, foxSentence)
+	}
+}
+
+func TestLZMADecompressorPrefix(t *testing.T) {
+	r := LZMADecompressor(lzma.ReaderConfig{})(
+		bytes.NewReader([]byte{9, 20, 4, 0, 0, 0, 0, 0, 0}))
+	if _, err := ioutil.ReadAll(r); err != errPrefix {
+		t.Fatalf("ReadAll returned error %v; want %v", err, errPrefix)
+	}
+}
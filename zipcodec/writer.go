@@ -0,0 +1,159 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package zipcodec
+
+import (
+	"archive/zip"
+	"io"
+
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// lzmaVersion is the version of the LZMA SDK written into the prefix
+// of the compressed data. It has only informational value.
+var lzmaVersion = [2]byte{9, 20}
+
+// headerWriter replaces the header of the classic LZMA format written
+// by the lzma writer with the prefix of the zip LZMA data. The prefix is
+// written together with the first compressed data, because the zip
+// writer writes the file header after the compressor has been created.
+type headerWriter struct {
+	w      io.Writer
+	prefix []byte
+	skip   int
+}
+
+// Write writes the data following the skipped header.
+func (w *headerWriter) Write(p []byte) (n int, err error) {
+	k := w.skip
+	if k > len(p) {
+		k = len(p)
+	}
+	w.skip -= k
+	if k == len(p) {
+		return k, nil
+	}
+	if w.prefix != nil {
+		if _, err = w.w.Write(w.prefix); err != nil {
+			return k, err
+		}
+		w.prefix = nil
+	}
+	n, err = w.w.Write(p[k:])
+	return n + k, err
+}
+
+// LZMACompressor returns a compressor for the LZMA method using the
+// writer configuration c. The uncompressed size is unknown to the
+// compressor, so the data is always terminated by an end-of-stream
+// marker; the fields Size, SizeInHeader and EOSMarker of c are
+// ignored. Use SetLZMA to set the method and flag in the file header.
+func LZMACompressor(c lzma.WriterConfig) zip.Compressor {
+	c.Size = 0
+	c.SizeInHeader = false
+	c.EOSMarker = true
+	return func(w io.Writer) (io.WriteCloser, error) {
+		cfg := c
+		if err := cfg.Verify(); err != nil {
+			return nil, err
+		}
+		p := make([]byte, prefixLen)
+		copy(p, lzmaVersion[:])
+		p[2] = propsLen
+		p[4] = cfg.Properties.Code()
+		putUint32LE(p[5:], uint32(cfg.DictCap))
+		return cfg.NewWriter(&headerWriter{
+			w:      w,
+			prefix: p,
+			skip:   lzma.HeaderLen,
+		})
+	}
+}
+
+// putUint32LE puts the little-endian representation of x into the
+// first four bytes of p.
+func putUint32LE(p []byte, x uint32) {
+	for i := 0; i < 4; i++ {
+		p[i] = byte(x >> (8 * uint(i)))
+	}
+}
+
+// RegisterLZMA registers the compressor and decompressor for the LZMA
+// method with the default configurations for the zip writer w and the
+// zip reader r. Either argument may be nil. Files written with the
+// LZMA method need the header flag set by SetLZMA.
+func RegisterLZMA(w *zip.Writer, r *zip.Reader) {
+	if w != nil {
+		w.RegisterCompressor(LZMA, LZMACompressor(lzma.WriterConfig{}))
+	}
+	if r != nil {
+		r.RegisterDecompressor(LZMA,
+			LZMADecompressor(lzma.ReaderConfig{}))
+	}
+}
+
+// xzWriter creates the xz writer on the first call of Write or Close,
+// because the xz writer writes the stream header immediately, but the
+// zip writer writes the file header after the compressor has been
+// created.
+type xzWriter struct {
+	c  xz.WriterConfig
+	w  io.Writer
+	xw *xz.Writer
+}
+
+// init creates the xz writer if required.
+func (w *xzWriter) init() error {
+	if w.xw != nil {
+		return nil
+	}
+	var err error
+	w.xw, err = w.c.NewWriter(w.w)
+	return err
+}
+
+// Write compresses the data.
+func (w *xzWriter) Write(p []byte) (n int, err error) {
+	if err = w.init(); err != nil {
+		return 0, err
+	}
+	return w.xw.Write(p)
+}
+
+// Close completes the xz stream.
+func (w *xzWriter) Close() error {
+	if err := w.init(); err != nil {
+		return err
+	}
+	return w.xw.Close()
+}
+
+// XZCompressor returns a compressor for the XZ method using the writer
+// configuration c. The compressed data is a complete xz stream.
+func XZCompressor(c xz.WriterConfig) zip.Compressor {
+	return func(w io.Writer) (io.WriteCloser, error) {
+		cfg := c
+		if err := cfg.Verify(); err != nil {
+			return nil, err
+		}
+		return &xzWriter{c: cfg, w: w}, nil
+	}
+}
+
+// RegisterXZ registers the compressor and decompressor for the XZ
+// method with the default configurations for the zip writer w and the
+// zip reader r. Either argument may be nil.
+func RegisterXZ(w *zip.Writer, r *zip.Reader) {
+	if w != nil {
+		w.RegisterCompressor(XZ, XZCompressor(xz.WriterConfig{}))
+	}
+	if r != nil {
+		r.RegisterDecompressor(XZ, XZDecompressor(xz.ReaderConfig{}))
+	}
+}
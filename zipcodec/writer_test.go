@@ -0,0 +1,102 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !xz_noencoder
+// +build !xz_noencoder
+
+package zipcodec
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/internal/randtxt"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+func TestLZMADecompressorNoEOS(t *testing.T) {
+	var buf bytes.Buffer
+	orig := []byte(foxSentence)
+	cfg := lzma.WriterConfig{Size: int64(len(orig))}
+	w, err := cfg.NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	if _, err = w.Write(orig); err != nil {
+		t.Fatalf("w.Write error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("w.Close error %s", err)
+	}
+	data := append([]byte{9, 20, propsLen, 0},
+		buf.Bytes()[:propsLen]...)
+	data = append(data, buf.Bytes()[lzma.HeaderLen:]...)
+
+	r := LZMADecompressor(lzma.ReaderConfig{})(bytes.NewReader(data))
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll error %s", err)
+	}
+	if !bytes.Equal(out, orig) {
+		t.Fatalf("got %q; want %q", out, orig)
+	}
+}
+
+func TestLZMACompressor(t *testing.T) {
+	const txtlen = 50000
+	var orig bytes.Buffer
+	io.CopyN(&orig, randtxt.NewReader(rand.NewSource(41)), txtlen)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	zw.RegisterCompressor(LZMA, LZMACompressor(lzma.WriterConfig{}))
+	fh := &zip.FileHeader{Name: "a.txt"}
+	SetLZMA(fh)
+	w, err := zw.CreateHeader(fh)
+	if err != nil {
+		t.Fatalf("CreateHeader error %s", err)
+	}
+	if _, err = w.Write(orig.Bytes()); err != nil {
+		t.Fatalf("w.Write error %s", err)
+	}
+	if err = zw.Close(); err != nil {
+		t.Fatalf("zw.Close error %s", err)
+	}
+
+	out := readZipFile(t, buf.Bytes(), LZMA,
+		LZMADecompressor(lzma.ReaderConfig{}))
+	if !bytes.Equal(out, orig.Bytes()) {
+		t.Fatalf("decompressed data differs from original")
+	}
+}
+
+func TestXZCompressor(t *testing.T) {
+	const txtlen = 50000
+	var orig bytes.Buffer
+	io.CopyN(&orig, randtxt.NewReader(rand.NewSource(41)), txtlen)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	RegisterXZ(zw, nil)
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "a.txt", Method: XZ})
+	if err != nil {
+		t.Fatalf("CreateHeader error %s", err)
+	}
+	if _, err = w.Write(orig.Bytes()); err != nil {
+		t.Fatalf("w.Write error %s", err)
+	}
+	if err = zw.Close(); err != nil {
+		t.Fatalf("zw.Close error %s", err)
+	}
+
+	out := readZipFile(t, buf.Bytes(), XZ, XZDecompressor(xz.ReaderConfig{}))
+	if !bytes.Equal(out, orig.Bytes()) {
+		t.Fatalf("decompressed data differs from original")
+	}
+}
@@ -0,0 +1,35 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zipcodec
+
+import (
+	"archive/zip"
+	"io"
+
+	"github.com/ulikunitz/xz"
+)
+
+// XZ is the zip method for files compressed in the xz format.
+const XZ uint16 = 95
+
+// xzReader provides the Close method for the xz reader.
+type xzReader struct {
+	*xz.Reader
+}
+
+// Close does nothing.
+func (r xzReader) Close() error { return nil }
+
+// XZDecompressor returns a decompressor for the XZ method using the
+// reader configuration c.
+func XZDecompressor(c xz.ReaderConfig) zip.Decompressor {
+	return func(r io.Reader) io.ReadCloser {
+		xr, err := c.NewReader(r)
+		if err != nil {
+			return errReader{err}
+		}
+		return xzReader{xr}
+	}
+}
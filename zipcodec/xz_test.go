@@ -0,0 +1,24 @@
+// Copyright 2014-2017 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zipcodec
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/ulikunitz/xz"
+)
+
+func TestXZDecompressor(t *testing.T) {
+	// xz data created by the Python lzma module
+	data, err := ioutil.ReadFile("testdata/fox-xz.zip")
+	if err != nil {
+		t.Fatalf("ReadFile error %s", err)
+	}
+	out := readZipFile(t, data, XZ, XZDecompressor(xz.ReaderConfig{}))
+	if s := string(out); s != foxSentence {
+		t.Fatalf("got %q; want %q", s, foxSentence)
+	}
+}